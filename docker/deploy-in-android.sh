@@ -65,21 +65,13 @@ else
 fi
 echo ""
 
-# Step 3: 更新 kspeeder 配置（通过环境变量）
-echo "[3/4] 配置 kspeeder..."
+# Step 3: 服务配置
+echo "[3/4] 检查服务配置..."
+# supervisord 的 etc/*.conf 由 installer 根据服务注册表生成，这里不再修改
 if [ -f "$DOCKER_ROOT/etc/kspeeder.conf" ]; then
-    # 更新环境变量配置
-    if grep -q "environment=" "$DOCKER_ROOT/etc/kspeeder.conf"; then
-        # 备份原文件
-        cp "$DOCKER_ROOT/etc/kspeeder.conf" "$DOCKER_ROOT/etc/kspeeder.conf.bak"
-        sed -i "s|environment=DISK_CACHE=.*|environment=DISK_CACHE=\"$DISK_ROOT/Cache\"|g" "$DOCKER_ROOT/etc/kspeeder.conf"
-        echo "✓ 已更新 kspeeder 环境变量配置"
-    else
-        echo "✓ kspeeder 将使用 docker.env 中的环境变量"
-    fi
     echo "✓ kspeeder 缓存路径: \$DISK_CACHE/Kspeeder"
 else
-    echo "⚠ kspeeder.conf 文件不存在，跳过配置"
+    echo "✓ kspeeder 服务已禁用"
 fi
 echo ""
 
@@ -129,11 +121,28 @@ echo "=========================================="
 DPANEL_CONFIG_DIR="$DISK_ROOT/Configs/DPanel"
 echo "✓ DPanel 配置目录: $DPANEL_CONFIG_DIR"
 
-echo "⏳ 拉取 DPanel 镜像..."
-if docker pull dpanel/dpanel:latest; then
-    echo "✓ DPanel 镜像拉取成功"
+# 离线安装时导入离线安装包中的镜像
+if [ -n "$DFA_IMAGES_DIR" ] && [ -d "$DFA_IMAGES_DIR" ]; then
+    for image in "$DFA_IMAGES_DIR"/*.tar; do
+        [ -f "$image" ] || continue
+        echo "⏳ 导入镜像 $(basename "$image")..."
+        if docker load -i "$image" > /dev/null; then
+            echo "✓ 镜像已导入"
+        else
+            echo "⚠ 镜像导入失败: $image"
+        fi
+    done
+fi
+
+if [ "$DFA_OFFLINE" = "1" ] && docker image inspect dpanel/dpanel:latest > /dev/null 2>&1; then
+    echo "✓ 使用离线安装包中的 DPanel 镜像"
 else
-    echo "⚠ DPanel 镜像拉取失败，请检查网络连接"
+    echo "⏳ 拉取 DPanel 镜像..."
+    if docker pull dpanel/dpanel:latest; then
+        echo "✓ DPanel 镜像拉取成功"
+    else
+        echo "⚠ DPanel 镜像拉取失败，请检查网络连接"
+    fi
 fi
 
 docker rm -f dpanel > /dev/null 2>&1 || true
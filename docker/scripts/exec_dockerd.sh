@@ -1,27 +1,73 @@
 #!/bin/sh
 
-busybox mount --make-slave /
-busybox mount --make-slave /sys
-busybox mount --make-slave /dev
-busybox mount --make-slave /proc
-busybox mount --make-slave /data
-busybox mount --make-slave /system 2>/dev/null
-
-if [ -z "$DOCKER_DATA_ROOT" ]; then
+# 没有 busybox 时使用系统自带的 mount
+MOUNT="busybox mount"
+command -v busybox >/dev/null 2>&1 || MOUNT=mount
+
+$MOUNT --make-slave /
+$MOUNT --make-slave /sys
+$MOUNT --make-slave /dev
+$MOUNT --make-slave /proc
+$MOUNT --make-slave /data
+$MOUNT --make-slave /system 2>/dev/null
+
+# 与 launch-dockerd 一致：DISK_ROOT 为空时 DOCKER_DATA_ROOT 只是默认值，视为未配置
+[ -n "$DISK_ROOT" ] || DOCKER_DATA_ROOT=
+
+# 安装时记录的数据盘挂载点
+DISK_MOUNT=
+if [ -f "$DOCKER_ROOT/etc/data-disk.json" ]; then
+	DISK_MOUNT=$(grep -oE '"mount_point": *"[^"]*"' "$DOCKER_ROOT/etc/data-disk.json" | sed -E 's/.*"([^"]*)"$/\1/')
+fi
+
+# find_data_root 数据盘已挂载时返回 0，未配置 DISK_ROOT 时查找 NVMe ext4 分区
+find_data_root() {
+	if [ -n "$DOCKER_DATA_ROOT" ]; then
+		if [ -n "$DISK_MOUNT" ] && ! mountpoint -q "$DISK_MOUNT"; then
+			return 1
+		fi
+		[ -d "$DOCKER_DATA_ROOT" ]
+		return
+	fi
 	NVME=$(mount | grep -F '/dev/block/vold/public:259,1 on /mnt/media_rw/' | grep -F ' type ext4 ' | grep -oE '/mnt/media_rw/[^ ]+')
-	if [ -n "$NVME" ]; then
-		DOCKER_DATA_ROOT="$NVME/opt/dockerd/docker"
-		mkdir -p "$DOCKER_DATA_ROOT"
-		touch "$NVME/opt/.nomedia"
+	[ -n "$NVME" ] || return 1
+	DOCKER_DATA_ROOT="$NVME/opt/dockerd/docker"
+	mkdir -p "$DOCKER_DATA_ROOT"
+	touch "$NVME/opt/.nomedia"
+}
+
+# 开机时硬盘可能还没有挂载，最多等待 DATA_ROOT_WAIT 秒
+DATA_ROOT_WAIT=${DATA_ROOT_WAIT:-90}
+WAITED=0
+DATA_ROOT_MISSING=
+until find_data_root; do
+	if [ "$WAITED" -ge "$DATA_ROOT_WAIT" ]; then
+		DATA_ROOT_MISSING=1
+		break
 	fi
-fi
+	[ "$WAITED" -eq 0 ] && echo "[INFO]: waiting up to ${DATA_ROOT_WAIT}s for the data disk" >&2
+	sleep 2
+	WAITED=$((WAITED + 2))
+done
 
 mkdir "$DOCKER_ROOT/data" 2>/dev/null
-if [ -z "$DOCKER_DATA_ROOT" ]; then
-	echo "[WARN]: NVMe ext4 mountpoint not found! Use tmpfs for testing." >&2
+if [ -n "$DATA_ROOT_MISSING" ]; then
+	# 不再静默使用 tmpfs，否则用户会以为镜像和容器丢失
+	if [ -n "$DOCKER_DATA_ROOT" ]; then
+		REASON="data disk for $DOCKER_DATA_ROOT not mounted after ${DATA_ROOT_WAIT}s"
+	else
+		REASON="DISK_ROOT not set and no NVMe ext4 partition found after ${DATA_ROOT_WAIT}s"
+	fi
+	if [ "$DATA_ROOT_POLICY" != "degraded" ]; then
+		echo "[ERROR]: $REASON, refusing to start dockerd (mount the disk, or set DATA_ROOT_POLICY=degraded to start with a temporary data dir)" >&2
+		exit 1
+	fi
+	echo "[WARN]: $REASON, using 100M tmpfs (DATA_ROOT_POLICY=degraded); images and containers will be lost on reboot" >&2
+	echo "$REASON" > "$DOCKER_ROOT/var/run/data-degraded"
 	mount -t tmpfs -o size=100M,uid=0,gid=0,mode=0755 tmpfs "$DOCKER_ROOT/data"
 else
-	echo "[INFO]: NVMe docker data dir: $DOCKER_DATA_ROOT" >&2
+	rm -f "$DOCKER_ROOT/var/run/data-degraded"
+	echo "[INFO]: docker data dir: $DOCKER_DATA_ROOT" >&2
 	mount --bind "$DOCKER_DATA_ROOT" "$DOCKER_ROOT/data"
 fi
 
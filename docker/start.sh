@@ -2,6 +2,11 @@
 
 . /data/local/docker/docker.env
 
+# 优先使用安装器完成网络、挂载命名空间和 cgroup 的准备
+if [ -x "$DOCKER_ROOT/bin/install-docker" ]; then
+	exec "$DOCKER_ROOT/bin/install-docker" launch-dockerd
+fi
+
 [ -d "$HOME" ] || mkdir "$HOME"
 [ -d "$DOCKER_ROOT/var" ] || mkdir "$DOCKER_ROOT/var"
 
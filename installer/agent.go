@@ -0,0 +1,718 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// agentSocketPath dfa-agent 默认监听的 unix socket
+	agentSocketPath = dockerRoot + "/var/run/dfa-agent.sock"
+	// dockerSocketPath dockerd 的 API socket
+	dockerSocketPath = dockerRoot + "/var/run/docker.sock"
+	// supervisordBin supervisord 可执行文件，ctl 子命令用于查询和控制服务
+	supervisordBin = binDir + "/supervisord"
+	// upgradeLogPath 通过 agent 触发升级时的输出
+	upgradeLogPath = dockerRoot + "/upgrade.log"
+	// agentTokenPath 修改状态的接口需要的令牌，首次启动时生成，只有 root 可读
+	agentTokenPath = dockerRoot + "/etc/dfa-agent.token"
+
+	// dockerdPingTimeout 检查 dockerd 健康状态的超时
+	dockerdPingTimeout = 3 * time.Second
+)
+
+// ProgramStatus supervisord 中一个程序的状态
+type ProgramStatus struct {
+	Name        string `json:"name"`
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
+}
+
+// parseSupervisorStatus 解析 `supervisord ctl status` 的输出
+// 每行形如 "dockerd    Running   pid 1234, uptime 0:10:00"
+func parseSupervisorStatus(output string) []ProgramStatus {
+	var programs []ProgramStatus
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		p := ProgramStatus{Name: fields[0], State: strings.ToUpper(fields[1])}
+		if len(fields) > 2 {
+			p.Description = strings.Join(fields[2:], " ")
+		}
+		programs = append(programs, p)
+	}
+	return programs
+}
+
+// DiskUsage 磁盘空间（KB）
+type DiskUsage struct {
+	Path    string `json:"path"`
+	TotalKB uint64 `json:"total_kb"`
+	FreeKB  uint64 `json:"free_kb"`
+	Error   string `json:"error,omitempty"`
+}
+
+// diskUsage 通过 getDiskSize/getFreeSpace 获取空间
+func diskUsage(path string) DiskUsage {
+	usage := DiskUsage{Path: path}
+	total, err := getDiskSize(path)
+	if err != nil {
+		usage.Error = err.Error()
+		return usage
+	}
+	free, err := getFreeSpace(path)
+	if err != nil {
+		usage.Error = err.Error()
+		return usage
+	}
+	usage.TotalKB, usage.FreeKB = total, free
+	return usage
+}
+
+// DockerdHealth dockerd 健康状态
+type DockerdHealth struct {
+	Healthy    bool   `json:"healthy"`
+	Version    string `json:"version,omitempty"`
+	APIVersion string `json:"api_version,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// newUnixHTTPClient 创建通过 unix socket 访问 HTTP API 的客户端
+func newUnixHTTPClient(socket string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// checkDockerd 通过 /_ping 和 /version 检查 dockerd
+func checkDockerd(client *http.Client) DockerdHealth {
+	var health DockerdHealth
+	resp, err := client.Get("http://docker/_ping")
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		health.Error = fmt.Sprintf("/_ping 返回 %s", resp.Status)
+		return health
+	}
+	health.Healthy = true
+
+	resp, err = client.Get("http://docker/version")
+	if err != nil {
+		return health
+	}
+	defer resp.Body.Close()
+	var v struct {
+		Version    string
+		APIVersion string
+	}
+	if json.NewDecoder(resp.Body).Decode(&v) == nil {
+		health.Version, health.APIVersion = v.Version, v.APIVersion
+	}
+	return health
+}
+
+// NetworkStatus 容器网络状态
+type NetworkStatus struct {
+	Uplink  string       `json:"uplink,omitempty"`
+	Gateway string       `json:"gateway,omitempty"`
+	Rules   []RuleStatus `json:"rules,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// AgentStatus /v1/status 的返回内容
+type AgentStatus struct {
+	Version      string          `json:"version"`
+	Channel      string          `json:"channel"`
+	Architecture string          `json:"architecture,omitempty"`
+	InstalledAt  *time.Time      `json:"installed_at,omitempty"`
+	Degraded     string          `json:"degraded,omitempty"`
+	Disks        []DiskUsage     `json:"disks"`
+	Programs     []ProgramStatus `json:"programs"`
+	ProgramError string          `json:"program_error,omitempty"`
+	Dockerd      DockerdHealth   `json:"dockerd"`
+	Network      NetworkStatus   `json:"network"`
+	Update       *UpdateStatus   `json:"update,omitempty"`
+}
+
+// AgentJob 通过 agent 触发的后台任务
+type AgentJob struct {
+	Name       string     `json:"name"`
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Log        string     `json:"log,omitempty"`
+}
+
+// Agent 本地管理服务
+type Agent struct {
+	runner    CommandRunner
+	docker    *http.Client
+	statePath string
+	envPath   string
+	// markerPath launch-dockerd 降级启动时写入的标记
+	markerPath string
+	routePath  string
+	logger     *log.Logger
+
+	// upgrade 执行分阶段升级，trigger 为 auto 或 manual，输出写入 w
+	upgrade    func(w io.Writer, trigger string) error
+	upgradeLog string
+	// updates 定期检查新版本，为 nil 时不检查
+	updates *UpdateChecker
+	// updateStatusPath 最近一次检查更新的结果
+	updateStatusPath  string
+	updateHistoryPath string
+	// downloadPausedPath 存在时安装和升级的下载暂停
+	downloadPausedPath string
+	mirrorConfigPath   string
+	// token POST 接口需要的 Bearer 令牌，为空时拒绝所有 POST 请求
+	token string
+
+	mu   sync.Mutex
+	jobs map[string]*AgentJob
+}
+
+// newAgent 创建使用真实系统命令的 agent
+func newAgent(logger *log.Logger) *Agent {
+	return &Agent{
+		runner:     execRunner{},
+		docker:     newUnixHTTPClient(dockerSocketPath, dockerdPingTimeout),
+		statePath:  installStatePath,
+		envPath:    dockerEnvPath,
+		markerPath: degradedMarkerPath,
+		routePath:  procNetRoute,
+		logger:     logger,
+		upgrade:    runDetachedUpgrade,
+		upgradeLog: upgradeLogPath,
+		jobs:       map[string]*AgentJob{},
+
+		updateStatusPath:  updateStatusPath,
+		updateHistoryPath: updateHistoryPath,
+
+		downloadPausedPath: downloadPausedPath,
+		mirrorConfigPath:   mirrorConfigPath,
+	}
+}
+
+// runDetachedUpgrade 在新会话中运行 update apply，升级会停止 supervisord 及其管理的 agent，
+// 备份、健康检查和回滚都在这个独立进程中完成
+func runDetachedUpgrade(w io.Writer, trigger string) error {
+	cmd := exec.Command(installerBinPath, "update", "apply", "-trigger", trigger)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return cmd.Run()
+}
+
+// programs 查询 supervisord 中的程序状态
+func (a *Agent) programs() ([]ProgramStatus, error) {
+	output, err := a.runner.Run(supervisordBin, "ctl", "status")
+	programs := parseSupervisorStatus(output)
+	if err != nil && len(programs) == 0 {
+		return nil, fmt.Errorf("查询 supervisord 状态失败: %v", err)
+	}
+	return programs, nil
+}
+
+// network 查询当前上行接口和规则
+func (a *Agent) network() NetworkStatus {
+	manager := newNetworkManager(a.runner)
+	manager.routePath = a.routePath
+	uplinks, err := manager.discover()
+	if err != nil {
+		return NetworkStatus{Error: err.Error()}
+	}
+	return NetworkStatus{
+		Uplink:  uplinks[0].Interface,
+		Gateway: uplinks[0].Gateway,
+		Rules:   manager.rules.Status(uplinks[0].Interface),
+	}
+}
+
+// disks 返回数据盘和安装目录的空间
+func (a *Agent) disks() []DiskUsage {
+	paths := []string{dockerRoot}
+	if env, err := loadDockerEnv(a.envPath); err == nil && env["DISK_ROOT"] != "" {
+		paths = append([]string{env["DISK_ROOT"]}, paths...)
+	}
+	var disks []DiskUsage
+	for _, p := range paths {
+		disks = append(disks, diskUsage(p))
+	}
+	return disks
+}
+
+// Status 汇总所有状态
+func (a *Agent) Status() *AgentStatus {
+	status := &AgentStatus{Version: "unknown", Channel: defaultChannel}
+	if state, err := loadInstallState(a.statePath); err == nil && state != nil {
+		status.Version = state.Version
+		status.Channel = state.Channel
+		status.Architecture = state.Architecture
+		status.InstalledAt = &state.InstalledAt
+	}
+	if data, err := os.ReadFile(a.markerPath); err == nil {
+		status.Degraded = strings.TrimSpace(string(data))
+	}
+	status.Disks = a.disks()
+	programs, err := a.programs()
+	if err != nil {
+		status.ProgramError = err.Error()
+	}
+	status.Programs = programs
+	status.Dockerd = checkDockerd(a.docker)
+	status.Network = a.network()
+	if update, err := loadUpdateStatus(a.updateStatusPath); err == nil {
+		status.Update = update
+	}
+	return status
+}
+
+// startUpgrade 在后台开始升级
+func (a *Agent) startUpgrade(trigger string) (*AgentJob, error) {
+	return a.startJob("upgrade", a.upgradeLog, func(w io.Writer) error {
+		return a.upgrade(w, trigger)
+	})
+}
+
+// restart 通过 supervisord 重启程序，name 为 all 时重启全部
+func (a *Agent) restart(name string) error {
+	if name != "all" && findService(name) == nil {
+		return fmt.Errorf("未知服务: %s", name)
+	}
+	if output, err := a.runner.Run(supervisordBin, "ctl", "restart", name); err != nil {
+		return fmt.Errorf("重启 %s 失败: %v %s", name, err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// errJobRunning 同名任务正在运行
+var errJobRunning = errors.New("任务正在运行")
+
+// startJob 在后台运行任务，输出写入 logPath
+func (a *Agent) startJob(name, logPath string, run func(w io.Writer) error) (*AgentJob, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if job := a.jobs[name]; job != nil && job.Running {
+		return nil, errJobRunning
+	}
+
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	job := &AgentJob{Name: name, Running: true, StartedAt: time.Now(), Log: logPath}
+	a.jobs[name] = job
+
+	go func() {
+		err := run(f)
+		f.Close()
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		now := time.Now()
+		job.Running = false
+		job.FinishedAt = &now
+		if err != nil {
+			job.Error = err.Error()
+		}
+		a.logger.Printf("任务 %s 结束: %v", name, err)
+	}()
+	return job, nil
+}
+
+// job 返回任务状态的副本
+func (a *Agent) job(name string) *AgentJob {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if job := a.jobs[name]; job != nil {
+		copied := *job
+		return &copied
+	}
+	return nil
+}
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// writeError 输出错误响应
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// allowMethod 检查请求方法，不匹配时返回 405
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("只支持 %s", method))
+		return false
+	}
+	return true
+}
+
+// loadAgentToken 读取 path 中的令牌，文件不存在时生成随机令牌，文件权限总是设为 0600
+func loadAgentToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("%s 为空", path)
+		}
+		return token, os.Chmod(path, 0600)
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// authorize 检查修改状态的请求：必须带有 Bearer 令牌，不能带 Origin，Content-Type 只能为空或 JSON，
+// 其他应用和浏览器中的网页都无法构造这样的请求
+func (a *Agent) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Origin") != "" {
+		writeError(w, http.StatusForbidden, errors.New("不接受浏览器发起的请求"))
+		return false
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if media, _, err := mime.ParseMediaType(ct); err != nil || media != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, errors.New("Content-Type 只能为 application/json"))
+			return false
+		}
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if a.token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(a.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("缺少或错误的令牌"))
+		return false
+	}
+	return true
+}
+
+// Handler 返回 HTTP API，GET 以外的请求都要通过 authorize 检查
+//
+//	GET  /v1/status           全部状态
+//	GET  /v1/programs         supervisord 程序状态
+//	GET  /v1/dockerd          dockerd 健康状态
+//	GET  /v1/network          容器网络状态
+//	POST /v1/restart?program= 重启服务，默认 dockerd
+//	GET  /v1/upgrade          升级任务状态
+//	POST /v1/upgrade          开始升级
+//	GET  /v1/update           更新设置、最近一次检查结果和升级记录
+//	POST /v1/update/check     立即检查更新
+//	GET  /v1/downloads        下载是否暂停和低优先级下载的限速
+//	POST /v1/downloads/pause  暂停正在进行和之后的下载
+//	POST /v1/downloads/resume 恢复下载
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/update", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		status, err := loadUpdateStatus(a.updateStatusPath)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		history, err := loadUpdateHistory(a.updateHistoryPath)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp := map[string]interface{}{"status": status, "history": history}
+		if a.updates != nil {
+			config, err := loadUpdateConfig(a.updates.configPath)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			resp["config"] = config
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+	mux.HandleFunc("/v1/update/check", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		if a.updates == nil {
+			writeError(w, http.StatusServiceUnavailable, errors.New("未启用更新检查"))
+			return
+		}
+		status, err := a.updates.Check(time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})
+	mux.HandleFunc("/v1/downloads", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		config, err := loadMirrorConfig(a.mirrorConfigPath)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"paused":        fileExists(a.downloadPausedPath),
+			"rate_limit":    config.RateLimit,
+			"rate_schedule": config.RateSchedule,
+		})
+	})
+	for action, paused := range map[string]bool{"pause": true, "resume": false} {
+		paused := paused
+		mux.HandleFunc("/v1/downloads/"+action, func(w http.ResponseWriter, r *http.Request) {
+			if !allowMethod(w, r, http.MethodPost) {
+				return
+			}
+			if err := setDownloadPaused(a.downloadPausedPath, paused); err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			a.logger.Printf("下载暂停: %v", paused)
+			writeJSON(w, http.StatusOK, map[string]bool{"paused": paused})
+		})
+	}
+	mux.HandleFunc("/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, a.Status())
+		}
+	})
+	mux.HandleFunc("/v1/programs", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		programs, err := a.programs()
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, programs)
+	})
+	mux.HandleFunc("/v1/dockerd", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, checkDockerd(a.docker))
+		}
+	})
+	mux.HandleFunc("/v1/network", func(w http.ResponseWriter, r *http.Request) {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, a.network())
+		}
+	})
+	mux.HandleFunc("/v1/restart", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		program := r.URL.Query().Get("program")
+		if program == "" {
+			program = "dockerd"
+		}
+		if err := a.restart(program); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		a.logger.Printf("已重启 %s", program)
+		writeJSON(w, http.StatusOK, map[string]string{"restarted": program})
+	})
+	mux.HandleFunc("/v1/upgrade", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			job := a.job("upgrade")
+			if job == nil {
+				writeError(w, http.StatusNotFound, errors.New("没有升级任务"))
+				return
+			}
+			writeJSON(w, http.StatusOK, job)
+		case http.MethodPost:
+			job, err := a.startUpgrade("manual")
+			if err == errJobRunning {
+				writeError(w, http.StatusConflict, err)
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			a.logger.Printf("开始升级，日志: %s", a.upgradeLog)
+			writeJSON(w, http.StatusAccepted, job)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, errors.New("只支持 GET 和 POST"))
+		}
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !a.authorize(w, r) {
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// listenUnix 监听 unix socket，删除上次残留的 socket 文件
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("监听 %s 失败: %v", path, err)
+	}
+	// 只允许 root 和同组进程访问
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// listenLoopback 监听 TCP，只允许回环地址，避免接口暴露到局域网
+func listenLoopback(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("地址格式错误: %v", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("只允许监听回环地址: %s", addr)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("监听 %s 失败: %v", addr, err)
+	}
+	return l, nil
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:    "dfa-agent",
+		usage:   msgUsageAgent,
+		network: networkOptional,
+		run:     runAgent,
+	})
+}
+
+// runAgent 实现 dfa-agent 子命令
+func runAgent(args []string) error {
+	fs := flag.NewFlagSet("dfa-agent", flag.ExitOnError)
+	socket := fs.String("socket", agentSocketPath, "unix socket 路径")
+	listen := fs.String("listen", "", "同时监听的回环 TCP 地址，例如 127.0.0.1:9100")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	token, err := loadAgentToken(agentTokenPath)
+	if err != nil {
+		return fmt.Errorf("读取令牌失败: %v", err)
+	}
+	var listeners []net.Listener
+	l, err := listenUnix(*socket)
+	if err != nil {
+		return err
+	}
+	listeners = append(listeners, l)
+	if *listen != "" {
+		l, err := listenLoopback(*listen)
+		if err != nil {
+			listeners[0].Close()
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	agent := newAgent(logger)
+	agent.token = token
+	agent.updates = newUpdateChecker(CreateHTTPClient(), func(version, channel string) error {
+		_, err := agent.startUpgrade("auto")
+		return err
+	}, logger)
+	go agent.updates.Run(ctx, updateTickInterval)
+
+	// 在局域网中提供本机缓存的安装包，配置读取失败或没有安装记录时不共享
+	if config, err := loadMirrorConfig(mirrorConfigPath); err != nil {
+		logger.Printf("读取下载源配置失败，不共享安装包: %v", err)
+	} else if config.Peers.Share {
+		peers, err := newPeerServer(installStatePath, config.Peers.Port, logger)
+		if err != nil {
+			logger.Printf("局域网共享安装包失败: %v", err)
+		} else {
+			go func() {
+				if err := peers.Run(ctx, fmt.Sprintf(":%d", config.Peers.Port)); err != nil {
+					logger.Printf("局域网共享安装包失败: %v", err)
+				}
+			}()
+		}
+	}
+
+	server := &http.Server{Handler: agent.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		logger.Printf("dfa-agent 监听 %s", l.Addr())
+		go func(l net.Listener) { errs <- server.Serve(l) }(l)
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errs:
+		if err != http.ErrServerClosed {
+			server.Close()
+			return err
+		}
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	os.Remove(*socket)
+	return nil
+}
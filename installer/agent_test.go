@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAgentRunner 在 fakeNetRunner 的基础上模拟 supervisord ctl
+type fakeAgentRunner struct {
+	*fakeNetRunner
+	status string
+}
+
+func (f *fakeAgentRunner) Run(name string, args ...string) (string, error) {
+	if name == supervisordBin {
+		f.calls = append(f.calls, "supervisord "+strings.Join(args, " "))
+		if args[1] == "status" {
+			return f.status, nil
+		}
+		return "", nil
+	}
+	return f.fakeNetRunner.Run(name, args...)
+}
+
+// startFakeDockerd 在 unix socket 上模拟 dockerd 的 /_ping 和 /version
+func startFakeDockerd(t *testing.T) string {
+	t.Helper()
+	// unix socket 路径长度有限，不使用 t.TempDir
+	dir, err := os.MkdirTemp("", "dfa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "OK") })
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"Version":"24.0.7","ApiVersion":"1.43"}`)
+	})
+	server := &httptest.Server{Listener: l, Config: &http.Server{Handler: mux}}
+	server.Start()
+	t.Cleanup(server.Close)
+	return socket
+}
+
+// newTestAgent 创建使用假命令和临时文件的 agent
+func newTestAgent(t *testing.T) (*Agent, *fakeAgentRunner) {
+	dir := t.TempDir()
+	runner := &fakeAgentRunner{
+		fakeNetRunner: newFakeNetRunner("default via 192.168.1.1 dev wlan0 table wlan0 proto static\n"),
+		status:        "dockerd                          Running   pid 1234, uptime 0:10:00\nkspeeder                         Stopped   Not started\n",
+	}
+	saveInstallState(filepath.Join(dir, "install.json"), &InstallState{Version: "1.2.3", Channel: "beta", InstalledAt: time.Now()})
+	os.WriteFile(filepath.Join(dir, "docker.env"), []byte("export DISK_ROOT="+dir+"\n"), 0644)
+
+	a := &Agent{
+		runner:     runner,
+		docker:     newUnixHTTPClient(startFakeDockerd(t), time.Second),
+		statePath:  filepath.Join(dir, "install.json"),
+		envPath:    filepath.Join(dir, "docker.env"),
+		markerPath: filepath.Join(dir, "data-degraded"),
+		routePath:  filepath.Join(dir, "route"),
+		logger:     log.New(io.Discard, "", 0),
+		upgradeLog: filepath.Join(dir, "upgrade.log"),
+		jobs:       map[string]*AgentJob{},
+
+		updateStatusPath:  filepath.Join(dir, "update-status.json"),
+		updateHistoryPath: filepath.Join(dir, "update-history.json"),
+
+		downloadPausedPath: filepath.Join(dir, "download-paused"),
+		mirrorConfigPath:   filepath.Join(dir, "mirrors.json"),
+		token:              testAgentToken,
+	}
+	return a, runner
+}
+
+// testAgentToken newTestAgent 使用的令牌
+const testAgentToken = "test-token"
+
+// agentPost 创建带有令牌的 POST 请求
+func agentPost(target string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, nil)
+	req.Header.Set("Authorization", "Bearer "+testAgentToken)
+	return req
+}
+
+// TestParseSupervisorStatus 测试解析 supervisord ctl status
+func TestParseSupervisorStatus(t *testing.T) {
+	programs := parseSupervisorStatus("dockerd   Running   pid 1234, uptime 0:10:00\n\nnetwatch  Fatal  Exited too quickly\n")
+	if len(programs) != 2 {
+		t.Fatalf("程序数量错误: %v", programs)
+	}
+	if programs[0].Name != "dockerd" || programs[0].State != "RUNNING" || programs[0].Description != "pid 1234, uptime 0:10:00" {
+		t.Errorf("dockerd 解析错误: %+v", programs[0])
+	}
+	if programs[1].State != "FATAL" {
+		t.Errorf("netwatch 解析错误: %+v", programs[1])
+	}
+}
+
+// TestAgentStatus 测试 /v1/status 汇总信息
+func TestAgentStatus(t *testing.T) {
+	a, _ := newTestAgent(t)
+	os.WriteFile(a.markerPath, []byte("/mnt/media_rw/USB 未挂载\n"), 0644)
+
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码错误: %d %s", rec.Code, rec.Body)
+	}
+
+	var status AgentStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if status.Version != "1.2.3" || status.Channel != "beta" {
+		t.Errorf("版本信息错误: %+v", status)
+	}
+	if status.Degraded != "/mnt/media_rw/USB 未挂载" {
+		t.Errorf("应报告降级模式: %q", status.Degraded)
+	}
+	if !status.Dockerd.Healthy || status.Dockerd.Version != "24.0.7" {
+		t.Errorf("dockerd 状态错误: %+v", status.Dockerd)
+	}
+	if len(status.Programs) != 2 || status.Programs[1].State != "STOPPED" {
+		t.Errorf("程序状态错误: %+v", status.Programs)
+	}
+	if status.Network.Uplink != "wlan0" || len(status.Network.Rules) == 0 {
+		t.Errorf("网络状态错误: %+v", status.Network)
+	}
+	if len(status.Disks) != 2 || status.Disks[0].TotalKB == 0 {
+		t.Errorf("磁盘信息错误: %+v", status.Disks)
+	}
+}
+
+// TestAgentDockerdDown 测试 dockerd 不可用时报告错误
+func TestAgentDockerdDown(t *testing.T) {
+	health := checkDockerd(newUnixHTTPClient(filepath.Join(t.TempDir(), "missing.sock"), time.Second))
+	if health.Healthy || health.Error == "" {
+		t.Errorf("应报告 dockerd 不可用: %+v", health)
+	}
+}
+
+// TestAgentDownloads 测试通过 agent 暂停和恢复下载
+func TestAgentDownloads(t *testing.T) {
+	a, _ := newTestAgent(t)
+	os.WriteFile(a.mirrorConfigPath, []byte(`{"rate_limit": "512K"}`), 0644)
+	h := a.Handler()
+
+	status := func() map[string]interface{} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/downloads", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("状态码错误: %d %s", rec.Code, rec.Body)
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+	if resp := status(); resp["paused"] != false || resp["rate_limit"] != "512K" {
+		t.Errorf("下载状态错误: %v", resp)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, agentPost("/v1/downloads/pause"))
+	if rec.Code != http.StatusOK || !fileExists(a.downloadPausedPath) {
+		t.Fatalf("暂停失败: %d %s", rec.Code, rec.Body)
+	}
+	if resp := status(); resp["paused"] != true {
+		t.Errorf("应显示已暂停: %v", resp)
+	}
+
+	for i := 0; i < 2; i++ {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, agentPost("/v1/downloads/resume"))
+		if rec.Code != http.StatusOK || fileExists(a.downloadPausedPath) {
+			t.Fatalf("恢复失败: %d %s", rec.Code, rec.Body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/downloads/pause", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET 应返回 405: %d", rec.Code)
+	}
+}
+
+// TestAgentRestart 测试重启接口
+func TestAgentRestart(t *testing.T) {
+	a, runner := newTestAgent(t)
+	h := a.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, agentPost("/v1/restart?program=kspeeder"))
+	if rec.Code != http.StatusOK || runner.countCalls("supervisord ctl restart kspeeder") != 1 {
+		t.Errorf("重启失败: %d %s %v", rec.Code, rec.Body, runner.calls)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, agentPost("/v1/restart?program=sshd"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("未知服务应返回 400: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/restart", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET 应返回 405: %d", rec.Code)
+	}
+}
+
+// TestAgentUpgrade 测试升级任务只能同时运行一个
+func TestAgentUpgrade(t *testing.T) {
+	a, _ := newTestAgent(t)
+	release := make(chan struct{})
+	a.upgrade = func(w io.Writer, trigger string) error {
+		io.WriteString(w, "升级中 "+trigger+"\n")
+		<-release
+		return errors.New("下载失败")
+	}
+	h := a.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/upgrade", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("没有任务时应返回 404: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, agentPost("/v1/upgrade"))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("开始升级失败: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, agentPost("/v1/upgrade"))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("重复升级应返回 409: %d", rec.Code)
+	}
+
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job := a.job("upgrade")
+		if !job.Running {
+			if job.Error != "下载失败" || job.FinishedAt == nil {
+				t.Errorf("任务结果错误: %+v", job)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("升级任务未结束")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if data, _ := os.ReadFile(a.upgradeLog); string(data) != "升级中 manual\n" {
+		t.Errorf("升级日志错误: %q", data)
+	}
+}
+
+// TestListenLoopback 测试拒绝非回环地址
+func TestListenLoopback(t *testing.T) {
+	if _, err := listenLoopback("0.0.0.0:9100"); err == nil {
+		t.Error("应拒绝 0.0.0.0")
+	}
+	l, err := listenLoopback("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听回环地址失败: %v", err)
+	}
+	l.Close()
+}
+
+// TestAgentAuthorize 测试没有令牌、带有 Origin 或非 JSON 的 POST 请求被拒绝
+func TestAgentAuthorize(t *testing.T) {
+	a, runner := newTestAgent(t)
+	a.upgrade = func(w io.Writer, trigger string) error { return nil }
+	h := a.Handler()
+
+	tests := []struct {
+		name    string
+		header  map[string]string
+		code    int
+		allowed bool
+	}{
+		{"没有令牌", nil, http.StatusUnauthorized, false},
+		{"错误的令牌", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized, false},
+		{"跨站请求", map[string]string{"Authorization": "Bearer " + testAgentToken, "Origin": "http://evil.example"}, http.StatusForbidden, false},
+		{"表单", map[string]string{"Authorization": "Bearer " + testAgentToken, "Content-Type": "application/x-www-form-urlencoded"}, http.StatusUnsupportedMediaType, false},
+		{"JSON", map[string]string{"Authorization": "Bearer " + testAgentToken, "Content-Type": "application/json; charset=utf-8"}, http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		for _, target := range []string{"/v1/restart", "/v1/upgrade", "/v1/update/check", "/v1/downloads/pause", "/v1/downloads/resume"} {
+			req := httptest.NewRequest(http.MethodPost, target, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if !tt.allowed && rec.Code != tt.code {
+				t.Errorf("%s %s: 状态码 %d，期望 %d", tt.name, target, rec.Code, tt.code)
+			}
+			if tt.allowed && (rec.Code == http.StatusUnauthorized || rec.Code == http.StatusForbidden || rec.Code == http.StatusUnsupportedMediaType) {
+				t.Errorf("%s %s: 不应拒绝: %d %s", tt.name, target, rec.Code, rec.Body)
+			}
+		}
+	}
+	if runner.countCalls("supervisord ctl restart dockerd") != 1 || a.job("upgrade") == nil {
+		t.Errorf("只有带令牌的请求应执行: %v", runner.calls)
+	}
+
+	// 没有令牌时 GET 仍然可用
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/downloads", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET 不需要令牌: %d", rec.Code)
+	}
+
+	// 没有设置令牌时拒绝所有 POST
+	a.token = ""
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, agentPost("/v1/downloads/pause"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("未设置令牌时应拒绝: %d", rec.Code)
+	}
+}
+
+// TestLoadAgentToken 测试首次生成令牌并以 0600 保存
+func TestLoadAgentToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "etc", "dfa-agent.token")
+	token, err := loadAgentToken(path)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("token = %q, err = %v", token, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("令牌文件权限错误: %v %v", info.Mode(), err)
+	}
+	os.Chmod(path, 0644)
+	if again, err := loadAgentToken(path); err != nil || again != token {
+		t.Errorf("应读取已有的令牌: %q %v", again, err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("应修正令牌文件权限: %v", info.Mode())
+	}
+}
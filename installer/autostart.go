@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const (
+	// autostartScriptName 开机脚本文件名，99 保证在其他模块之后运行
+	autostartScriptName = "99-docker-for-android.sh"
+	// autostartMarker 用于识别由本程序生成的脚本，disable 时不会删除同名的其他文件
+	autostartMarker = "# docker-for-android autostart"
+)
+
+// BootMechanism 开机执行脚本的方式
+type BootMechanism struct {
+	Name string
+	// Detect 任意一个路径存在即认为可用
+	Detect []string
+	// Dir 放置开机脚本的目录
+	Dir string
+}
+
+// bootMechanisms 按优先级排列，Magisk 和 KernelSU 都会执行 /data/adb/service.d 中的脚本
+var bootMechanisms = []BootMechanism{
+	{Name: "magisk", Detect: []string{"/data/adb/magisk"}, Dir: "/data/adb/service.d"},
+	{Name: "kernelsu", Detect: []string{"/data/adb/ksu"}, Dir: "/data/adb/service.d"},
+	{Name: "service.d", Detect: []string{"/data/adb/service.d"}, Dir: "/data/adb/service.d"},
+	{Name: "init.d", Detect: []string{"/system/etc/init.d"}, Dir: "/system/etc/init.d"},
+}
+
+// findBootMechanism 按名称查找
+func findBootMechanism(name string) *BootMechanism {
+	for i := range bootMechanisms {
+		if bootMechanisms[i].Name == name {
+			return &bootMechanisms[i]
+		}
+	}
+	return nil
+}
+
+// detectBootMechanisms 返回 root 下可用的开机方式
+func detectBootMechanisms(root string) []BootMechanism {
+	var found []BootMechanism
+	for _, m := range bootMechanisms {
+		for _, p := range m.Detect {
+			if fileExists(filepath.Join(root, p)) {
+				found = append(found, m)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// autostartParams 开机脚本模板参数
+type autostartParams struct {
+	Mechanism   string
+	Marker      string
+	StartScript string
+	Log         string
+}
+
+// autostartTemplate 开机脚本，在后台等待系统启动完成后执行 start.sh
+// 数据盘的等待和校验由 launch-dockerd 完成，没有 installer 时由 exec_dockerd.sh 按 DATA_ROOT_WAIT/DATA_ROOT_POLICY 完成
+var autostartTemplate = template.Must(template.New("autostart").Parse(`#!/system/bin/sh
+{{.Marker}} ({{.Mechanism}})
+# 由 install-docker enable-autostart 生成，删除请运行 install-docker disable-autostart
+
+LOG={{.Log}}
+
+(
+	until [ "$(getprop sys.boot_completed)" = "1" ]; do
+		sleep 5
+	done
+
+	if [ ! -f {{.StartScript}} ]; then
+		echo "[$(date)] {{.StartScript}} 不存在，跳过启动" >> "$LOG"
+		exit 0
+	fi
+
+	echo "[$(date)] 开机启动 Docker" >> "$LOG"
+	sh {{.StartScript}} >> "$LOG" 2>&1
+) &
+`))
+
+// renderAutostartScript 生成开机脚本内容
+func renderAutostartScript(mechanism string) (string, error) {
+	var buf bytes.Buffer
+	err := autostartTemplate.Execute(&buf, autostartParams{
+		Mechanism:   mechanism,
+		Marker:      autostartMarker,
+		StartScript: filepath.Join(dockerRoot, "start.sh"),
+		Log:         filepath.Join(dockerRoot, "autostart.log"),
+	})
+	return buf.String(), err
+}
+
+// enableAutostart 在 root 下安装开机脚本，返回脚本路径
+func enableAutostart(root string, m *BootMechanism) (string, error) {
+	content, err := renderAutostartScript(m.Name)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, m.Dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建 %s 失败: %v", m.Dir, err)
+	}
+	path := filepath.Join(dir, autostartScriptName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0755); err != nil {
+		return "", fmt.Errorf("写入开机脚本失败: %v", err)
+	}
+	// WriteFile 受 umask 影响，service.d 要求脚本可执行
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+// installedAutostartScripts 返回 root 下由本程序生成的开机脚本
+func installedAutostartScripts(root string) []string {
+	var scripts []string
+	seen := map[string]bool{}
+	for _, m := range bootMechanisms {
+		path := filepath.Join(root, m.Dir, autostartScriptName)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		data, err := os.ReadFile(path)
+		if err == nil && strings.Contains(string(data), autostartMarker) {
+			scripts = append(scripts, path)
+		}
+	}
+	return scripts
+}
+
+// disableAutostart 删除所有由本程序生成的开机脚本
+func disableAutostart(root string) ([]string, error) {
+	scripts := installedAutostartScripts(root)
+	for _, path := range scripts {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("删除 %s 失败: %v", path, err)
+		}
+	}
+	return scripts, nil
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "enable-autostart",
+		usage: msgUsageEnableAutostart,
+		run:   runEnableAutostart,
+	})
+	registerSubcommand(&subcommand{
+		name:  "disable-autostart",
+		usage: msgUsageDisableAutostart,
+		run:   runDisableAutostart,
+	})
+}
+
+// runEnableAutostart 实现 enable-autostart 子命令
+func runEnableAutostart(args []string) error {
+	fs := flag.NewFlagSet("enable-autostart", flag.ExitOnError)
+	method := fs.String("method", "", "开机方式 magisk/kernelsu/service.d/init.d，默认自动检测")
+	root := fs.String("root", "/", "文件系统根目录（用于测试）")
+	dryRun := fs.Bool("dry-run", false, "只显示生成的脚本")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var m *BootMechanism
+	if *method != "" {
+		if m = findBootMechanism(*method); m == nil {
+			return fmt.Errorf("未知的开机方式: %s", *method)
+		}
+	} else {
+		found := detectBootMechanisms(*root)
+		if len(found) == 0 {
+			return fmt.Errorf("未检测到 Magisk、KernelSU、/data/adb/service.d 或 init.d，无法设置开机启动")
+		}
+		m = &found[0]
+	}
+
+	if *dryRun {
+		content, err := renderAutostartScript(m.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("# %s\n%s", filepath.Join(*root, m.Dir, autostartScriptName), content)
+		return nil
+	}
+
+	path, err := enableAutostart(*root, m)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ 已通过 %s 设置开机启动: %s\n", m.Name, path)
+	return nil
+}
+
+// runDisableAutostart 实现 disable-autostart 子命令
+func runDisableAutostart(args []string) error {
+	fs := flag.NewFlagSet("disable-autostart", flag.ExitOnError)
+	root := fs.String("root", "/", "文件系统根目录（用于测试）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	removed, err := disableAutostart(*root)
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		fmt.Println("未设置开机启动")
+		return nil
+	}
+	for _, path := range removed {
+		fmt.Printf("✓ 已删除 %s\n", path)
+	}
+	return nil
+}
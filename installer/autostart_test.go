@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDetectBootMechanisms 测试按优先级检测开机方式
+func TestDetectBootMechanisms(t *testing.T) {
+	root := t.TempDir()
+	if found := detectBootMechanisms(root); len(found) != 0 {
+		t.Fatalf("空目录不应检测到开机方式: %v", found)
+	}
+
+	os.MkdirAll(filepath.Join(root, "system", "etc", "init.d"), 0755)
+	os.MkdirAll(filepath.Join(root, "data", "adb", "ksu"), 0755)
+	found := detectBootMechanisms(root)
+	if len(found) != 2 || found[0].Name != "kernelsu" || found[1].Name != "init.d" {
+		t.Errorf("检测结果错误: %v", found)
+	}
+}
+
+// TestEnableDisableAutostart 测试安装和删除开机脚本
+func TestEnableDisableAutostart(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "data", "adb", "magisk"), 0755)
+
+	m := detectBootMechanisms(root)[0]
+	path, err := enableAutostart(root, &m)
+	if err != nil {
+		t.Fatalf("安装开机脚本失败: %v", err)
+	}
+	if path != filepath.Join(root, "data", "adb", "service.d", autostartScriptName) {
+		t.Errorf("脚本路径错误: %s", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Fatalf("脚本应可执行: %v, %v", info, err)
+	}
+	data, _ := os.ReadFile(path)
+	content := string(data)
+	for _, want := range []string{
+		"#!/system/bin/sh\n",
+		autostartMarker + " (magisk)",
+		"getprop sys.boot_completed",
+		"sh /data/local/docker/start.sh >> \"$LOG\" 2>&1",
+		") &",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("脚本缺少 %q:\n%s", want, content)
+		}
+	}
+
+	// 重复安装覆盖同一文件
+	if _, err := enableAutostart(root, &m); err != nil {
+		t.Fatalf("重复安装失败: %v", err)
+	}
+	if scripts := installedAutostartScripts(root); len(scripts) != 1 {
+		t.Errorf("应只有一个开机脚本: %v", scripts)
+	}
+
+	removed, err := disableAutostart(root)
+	if err != nil || len(removed) != 1 || fileExists(path) {
+		t.Errorf("删除开机脚本失败: %v, %v", removed, err)
+	}
+}
+
+// TestDisableAutostart_KeepsForeignFiles 测试不删除其他程序的同名脚本
+func TestDisableAutostart_KeepsForeignFiles(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "system", "etc", "init.d")
+	os.MkdirAll(dir, 0755)
+	foreign := filepath.Join(dir, autostartScriptName)
+	os.WriteFile(foreign, []byte("#!/system/bin/sh\necho hello\n"), 0755)
+
+	removed, err := disableAutostart(root)
+	if err != nil || len(removed) != 0 {
+		t.Errorf("不应删除其他脚本: %v, %v", removed, err)
+	}
+	if !fileExists(foreign) {
+		t.Error("其他脚本被删除")
+	}
+}
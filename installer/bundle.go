@@ -0,0 +1,656 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// bundleFormat 离线安装包的格式版本，不兼容的修改时递增
+	bundleFormat = 1
+	// bundleIndexName 离线安装包中描述所有文件的索引，总是第一个文件
+	bundleIndexName = "bundle.json"
+	// bundleSigName bundle.json 的 ed25519 签名（base64），紧跟在 bundle.json 之后
+	bundleSigName = "bundle.json.sig"
+	// bundleIndexLimit bundle.json 的大小上限
+	bundleIndexLimit = 1 << 20
+)
+
+// 离线安装包中文件的类型
+const (
+	bundleKindManifest  = "manifest"
+	bundleKindDocker    = "docker"
+	bundleKindBin       = "bin"
+	bundleKindInstaller = "installer"
+	bundleKindSignature = "signature"
+	bundleKindImage     = "image"
+)
+
+// BundleFile 离线安装包中的一个文件
+type BundleFile struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	Arch   string `json:"arch,omitempty"`
+	Image  string `json:"image,omitempty"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// BundleIndex bundle.json，描述离线安装包的版本、架构和所有文件
+type BundleIndex struct {
+	Format        int          `json:"format"`
+	Version       string       `json:"version"`
+	Channel       string       `json:"channel"`
+	CreatedAt     time.Time    `json:"created_at"`
+	Architectures []string     `json:"architectures"`
+	Files         []BundleFile `json:"files"`
+}
+
+// file 返回路径对应的文件
+func (b *BundleIndex) file(p string) (BundleFile, bool) {
+	for _, f := range b.Files {
+		if f.Path == p {
+			return f, true
+		}
+	}
+	return BundleFile{}, false
+}
+
+// hasArch 离线安装包是否包含 arch 的二进制包
+func (b *BundleIndex) hasArch(arch string) bool {
+	for _, a := range b.Architectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleOptions bundle create 的参数
+type bundleOptions struct {
+	Channel string
+	Archs   []string
+	Images  []string
+	// SignKey ed25519 私钥文件（base64，64 字节私钥或 32 字节种子），为空时不签名
+	SignKey string
+	Output  string
+}
+
+// dockerPlatform 返回 docker pull 使用的平台
+func dockerPlatform(arch string) string {
+	if arch == "x86_64" {
+		return "linux/amd64"
+	}
+	return "linux/" + arch
+}
+
+// imageFileName 把镜像名转换为文件名，如 dpanel/dpanel:latest → dpanel_dpanel_latest.tar
+func imageFileName(ref string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(ref) + ".tar"
+}
+
+// loadSignKey 读取 ed25519 私钥
+func loadSignKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errorf(msgBundleSignKeyInvalid, path, err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, errorf(msgBundleSignKeyLength, path, len(key))
+	}
+}
+
+// fileSHA256 计算文件的 SHA256 和大小
+func fileSHA256(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// bundleCreator 在 Linux 主机上生成离线安装包
+type bundleCreator struct {
+	// fetch 下载发布目录中的文件到 dest，sha 为空时不校验
+	fetch func(name, dest, sha string) error
+	// runner 执行 docker pull/save
+	runner CommandRunner
+	now    func() time.Time
+}
+
+// Create 下载版本文件、安装包和镜像到临时目录，再打包成 opts.Output，返回写入的索引
+func (c *bundleCreator) Create(opts bundleOptions) (*BundleIndex, error) {
+	if len(opts.Archs) == 0 {
+		return nil, errorf(msgBundleNoArch)
+	}
+	var signKey ed25519.PrivateKey
+	if opts.SignKey != "" {
+		key, err := loadSignKey(opts.SignKey)
+		if err != nil {
+			return nil, err
+		}
+		signKey = key
+	}
+	stage, err := os.MkdirTemp("", "dfa-bundle-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	index := &BundleIndex{Format: bundleFormat, Channel: opts.Channel, CreatedAt: c.now().UTC(), Architectures: opts.Archs}
+	add := func(p, kind, arch, image string) error {
+		sum, size, err := fileSHA256(filepath.Join(stage, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		index.Files = append(index.Files, BundleFile{Path: p, Kind: kind, Arch: arch, Image: image, SHA256: sum, Size: size})
+		return nil
+	}
+	fetch := func(name, sha string) (string, error) {
+		p := "release/" + name
+		dest := filepath.Join(stage, "release", name)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return "", err
+		}
+		fmt.Println(T(msgBundleFetching, name))
+		if err := c.fetch(name, dest, sha); err != nil {
+			return "", errorf(msgBundleFetchFailed, name, err)
+		}
+		return p, nil
+	}
+
+	// 版本文件总是在安装包之前，安装时先解析它再校验安装包
+	manifest := manifestName(opts.Channel)
+	manifestPath, err := fetch(manifest, "")
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(filepath.Join(stage, "release", manifest))
+	if err != nil {
+		return nil, err
+	}
+	infos := map[string]*VersionInfo{}
+	for _, arch := range opts.Archs {
+		info, err := parseVersionInfo(content, arch)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", arch, err)
+		}
+		infos[arch] = info
+	}
+	first := infos[opts.Archs[0]]
+	index.Version = first.Version
+	if err := add(manifestPath, bundleKindManifest, "", ""); err != nil {
+		return nil, err
+	}
+
+	dockerTar, err := fetch(fmt.Sprintf("docker-%s.tar.gz", first.Version), first.DockerSHA256)
+	if err != nil {
+		return nil, err
+	}
+	if err := add(dockerTar, bundleKindDocker, "", ""); err != nil {
+		return nil, err
+	}
+	for _, arch := range opts.Archs {
+		info := infos[arch]
+		binTar, err := fetch(fmt.Sprintf("docker-for-android-bin-%s-%s.tar.gz", info.Version, arch), info.BinSHA256)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(binTar, bundleKindBin, arch, ""); err != nil {
+			return nil, err
+		}
+		if info.InstallerSHA256 == "" {
+			continue
+		}
+		// 附带设备上运行的 installer 和它的发布签名，离线时直接 adb push 使用
+		name := installerFileName(arch)
+		installer, err := fetch(name, info.InstallerSHA256)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(installer, bundleKindInstaller, arch, ""); err != nil {
+			return nil, err
+		}
+		if sig, err := fetch(name+".sig", ""); err != nil {
+			fmt.Println(T(msgBundleNoInstallerSig, name, err))
+		} else if err := add(sig, bundleKindSignature, arch, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, arch := range opts.Archs {
+		if err := os.MkdirAll(filepath.Join(stage, "images", arch), 0755); err != nil {
+			return nil, err
+		}
+		for _, ref := range opts.Images {
+			p := path.Join("images", arch, imageFileName(ref))
+			fmt.Println(T(msgBundlePullImage, ref, dockerPlatform(arch)))
+			if _, err := c.runner.Run("docker", "pull", "--platform", dockerPlatform(arch), ref); err != nil {
+				return nil, err
+			}
+			if _, err := c.runner.Run("docker", "save", "-o", filepath.Join(stage, filepath.FromSlash(p)), ref); err != nil {
+				return nil, err
+			}
+			if err := add(p, bundleKindImage, arch, ref); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	var sig []byte
+	if signKey != nil {
+		sig = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(signKey, data)) + "\n")
+	}
+	if err := writeBundle(opts.Output, stage, data, sig, index.Files); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// writeBundle 按 bundle.json、签名、索引中的顺序写入 tar，先写临时文件再改名
+func writeBundle(out, stage string, indexData, sig []byte, files []BundleFile) error {
+	tmp := out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		tw := tar.NewWriter(f)
+		writeData := func(name string, data []byte) error {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+				return err
+			}
+			_, err := tw.Write(data)
+			return err
+		}
+		if err := writeData(bundleIndexName, indexData); err != nil {
+			return err
+		}
+		if sig != nil {
+			if err := writeData(bundleSigName, sig); err != nil {
+				return err
+			}
+		}
+		for _, file := range files {
+			src, err := os.Open(filepath.Join(stage, filepath.FromSlash(file.Path)))
+			if err != nil {
+				return err
+			}
+			err = tw.WriteHeader(&tar.Header{Name: file.Path, Mode: 0644, Size: file.Size, ModTime: time.Now()})
+			if err == nil {
+				_, err = io.Copy(tw, src)
+			}
+			src.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+	}()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+// bundleReader 顺序读取离线安装包
+type bundleReader struct {
+	f     *os.File
+	tr    *tar.Reader
+	index *BundleIndex
+	// signed bundle.json 的签名已校验
+	signed bool
+	// next 读取 bundle.json 后预读的下一个文件头
+	next *tar.Header
+}
+
+// openBundle 打开离线安装包，读取并校验 bundle.json
+// bundle.json 必须带有 publicKey 的签名；allowUnsigned 为 true 时没有公钥或没有签名也接受，只校验 SHA256
+func openBundle(p, publicKey string, allowUnsigned bool) (*bundleReader, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	r := &bundleReader{f: f, tr: tar.NewReader(f)}
+	if err := r.readIndex(publicKey, allowUnsigned); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	return r, nil
+}
+
+func (r *bundleReader) readIndex(publicKey string, allowUnsigned bool) error {
+	hdr, err := r.tr.Next()
+	if err != nil || hdr.Name != bundleIndexName {
+		return errorf(msgBundleNotBundle, bundleIndexName)
+	}
+	data, err := io.ReadAll(io.LimitReader(r.tr, bundleIndexLimit))
+	if err != nil {
+		return err
+	}
+	var index BundleIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return errorf(msgBundleIndexInvalid, bundleIndexName, err)
+	}
+	if index.Format != bundleFormat {
+		return errorf(msgBundleFormat, index.Format)
+	}
+	r.index = &index
+
+	hdr, err = r.tr.Next()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	var sig []byte
+	if hdr != nil && hdr.Name == bundleSigName {
+		if sig, err = io.ReadAll(io.LimitReader(r.tr, bundleIndexLimit)); err != nil {
+			return err
+		}
+	} else {
+		r.next = hdr
+	}
+	switch {
+	case publicKey != "" && sig != nil:
+		// 有签名就校验，即使允许未签名的离线安装包
+		if err := verifySignature(data, sig, publicKey); err != nil {
+			return err
+		}
+		r.signed = true
+	case allowUnsigned:
+	case publicKey == "":
+		return errorf(msgBundleNoKey)
+	default:
+		return errorf(msgBundleNoSignature)
+	}
+	return nil
+}
+
+// each 依次处理 bundle.json 中记录的文件，fn 负责读取并校验内容；出现未记录的文件时返回错误
+func (r *bundleReader) each(fn func(f BundleFile, body io.Reader) error) error {
+	for {
+		hdr := r.next
+		r.next = nil
+		if hdr == nil {
+			var err error
+			if hdr, err = r.tr.Next(); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		if hdr.Name == bundleSigName {
+			continue
+		}
+		f, ok := r.index.file(hdr.Name)
+		if !ok {
+			return errorf(msgBundleUnlisted, hdr.Name)
+		}
+		if hdr.Size != f.Size {
+			return errorf(msgBundleSizeMismatch, f.Path, hdr.Size, f.Size)
+		}
+		if err := fn(f, r.tr); err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+	}
+}
+
+func (r *bundleReader) Close() error {
+	return r.f.Close()
+}
+
+// bundleKey 返回校验离线安装包签名的公钥，未指定时使用 installer 内置的发布公钥
+func bundleKey(flagKey string) string {
+	if flagKey != "" {
+		return flagKey
+	}
+	return installerPublicKey
+}
+
+// importBundle 从离线安装包读取 arch 对应的版本信息，把安装包导入缓存，镜像写入 imagesDir
+// 返回版本信息和镜像文件，之后的安装流程从缓存中取安装包，不访问网络
+func importBundle(p, publicKey string, allowUnsigned bool, arch string, cache *artifactCache, imagesDir string) (*VersionInfo, []string, error) {
+	r, err := openBundle(p, publicKey, allowUnsigned)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	index := r.index
+	if !index.hasArch(arch) {
+		return nil, nil, errorf(msgBundleArchMissing, arch, strings.Join(index.Architectures, ", "))
+	}
+	if r.signed {
+		fmt.Println(T(msgBundleSigned))
+	} else {
+		fmt.Println(T(msgBundleUnsigned))
+	}
+
+	var version *VersionInfo
+	var images []string
+	imported := map[string]string{}
+	now := time.Now()
+	err = r.each(func(f BundleFile, body io.Reader) error {
+		if f.Arch != "" && f.Arch != arch {
+			return nil
+		}
+		switch f.Kind {
+		case bundleKindManifest:
+			data, err := io.ReadAll(io.LimitReader(body, bundleIndexLimit))
+			if err != nil {
+				return err
+			}
+			if actual := fmt.Sprintf("%x", sha256.Sum256(data)); actual != f.SHA256 {
+				return &checksumMismatchError{Expected: f.SHA256, Actual: actual}
+			}
+			if version, err = parseVersionInfo(data, arch); err != nil {
+				return err
+			}
+			if version.Version != index.Version {
+				return errorf(msgBundleVersionMismatch, version.Version, index.Version)
+			}
+		case bundleKindDocker, bundleKindBin:
+			// 安装包的 SHA256 以版本文件为准，版本文件必须在安装包之前
+			if version == nil {
+				return errorf(msgBundleManifestOrder)
+			}
+			expected := version.DockerSHA256
+			if f.Kind == bundleKindBin {
+				expected = version.BinSHA256
+			}
+			if !strings.EqualFold(f.SHA256, expected) {
+				return &checksumMismatchError{Expected: expected, Actual: f.SHA256}
+			}
+			name := path.Base(f.Path)
+			if _, ok := cache.lookup(expected, version.Version, now); !ok {
+				if _, err := cache.storeFrom(body, CacheEntry{SHA256: expected, Name: name, Version: version.Version, AddedAt: now, UsedAt: now}); err != nil {
+					return err
+				}
+			}
+			imported[f.Kind] = name
+			fmt.Println(T(msgBundleImported, name))
+		case bundleKindImage:
+			if err := os.MkdirAll(imagesDir, 0755); err != nil {
+				return err
+			}
+			dst := filepath.Join(imagesDir, path.Base(f.Path))
+			if _, err := writeVerified(body, dst, f.SHA256); err != nil {
+				return err
+			}
+			images = append(images, dst)
+			fmt.Println(T(msgBundleImage, f.Image))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if version == nil {
+		return nil, nil, errorf(msgBundleNoManifest)
+	}
+	for _, kind := range []string{bundleKindDocker, bundleKindBin} {
+		if imported[kind] == "" {
+			return nil, nil, errorf(msgBundleMissingKind, kind)
+		}
+	}
+	return version, images, nil
+}
+
+// verifyBundle 校验离线安装包中所有文件的 SHA256
+func verifyBundle(p, publicKey string, allowUnsigned bool) (*BundleIndex, bool, error) {
+	r, err := openBundle(p, publicKey, allowUnsigned)
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+	seen := map[string]bool{}
+	err = r.each(func(f BundleFile, body io.Reader) error {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, body); err != nil {
+			return err
+		}
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != f.SHA256 {
+			return &checksumMismatchError{Expected: f.SHA256, Actual: actual}
+		}
+		seen[f.Path] = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	for _, f := range r.index.Files {
+		if !seen[f.Path] {
+			return nil, false, errorf(msgBundleMissingFile, f.Path)
+		}
+	}
+	return r.index, r.signed, nil
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:    "bundle",
+		usage:   msgUsageBundle,
+		network: networkOptional,
+		run:     runBundle,
+	})
+}
+
+// runBundle 实现 bundle 子命令
+func runBundle(args []string) error {
+	if len(args) == 0 {
+		return errorf(msgBundleUsage)
+	}
+	action, args := args[0], args[1:]
+	switch action {
+	case "create":
+		return runBundleCreate(args)
+	case "verify":
+		fs := flag.NewFlagSet("bundle verify", flag.ExitOnError)
+		key := fs.String("key", "", "校验签名的 ed25519 公钥（base64），默认使用发布公钥")
+		allowUnsigned := fs.Bool("allow-unsigned", false, "接受没有签名的离线安装包，只校验 SHA256")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errorf(msgBundleVerifyUsage)
+		}
+		index, signed, err := verifyBundle(fs.Arg(0), bundleKey(*key), *allowUnsigned)
+		if err != nil {
+			return err
+		}
+		fmt.Println(T(msgBundleVerified, index.Version, index.Channel, strings.Join(index.Architectures, ", "), len(index.Files)))
+		if !signed {
+			fmt.Println(T(msgBundleVerifyUnsigned))
+		}
+		return nil
+	default:
+		return errorf(msgUnknownAction, action)
+	}
+}
+
+// runBundleCreate 实现 bundle create，在能访问网络的 Linux 主机上运行
+func runBundleCreate(args []string) error {
+	fs := flag.NewFlagSet("bundle create", flag.ExitOnError)
+	channel := fs.String("channel", defaultChannel, "发布通道")
+	archs := fs.String("arch", "arm64", "架构，多个用逗号分隔，如 arm64,x86_64")
+	images := fs.String("images", "", "预先拉取的镜像，多个用逗号分隔，如 dpanel/dpanel:latest")
+	signKey := fs.String("sign-key", "", "签名 bundle.json 的 ed25519 私钥文件（base64）")
+	output := fs.String("o", "", "输出文件，默认 docker-for-android-<版本>-bundle.tar")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts := bundleOptions{Channel: *channel, Archs: splitList(*archs), Images: splitList(*images), SignKey: *signKey, Output: *output}
+	for _, arch := range opts.Archs {
+		if arch != "arm64" && arch != "x86_64" {
+			return errorf(msgArchUnsupported, arch)
+		}
+	}
+	if opts.Output == "" {
+		// 版本在下载版本文件后才知道，先写到临时名称
+		opts.Output = "docker-for-android-bundle.tar"
+	}
+
+	client := CreateHTTPClient()
+	c := &bundleCreator{
+		fetch:  func(name, dest, sha string) error { return downloadFile(client, dest, name, sha) },
+		runner: execRunner{},
+		now:    time.Now,
+	}
+	index, err := c.Create(opts)
+	if err != nil {
+		return err
+	}
+	out := opts.Output
+	if *output == "" {
+		out = fmt.Sprintf("docker-for-android-%s-bundle.tar", index.Version)
+		if err := os.Rename(opts.Output, out); err != nil {
+			return err
+		}
+	}
+	fmt.Println(T(msgBundleCreated, out, index.Version, strings.Join(index.Architectures, ", "), len(index.Files)))
+	return nil
+}
+
+// splitList 拆分逗号分隔的列表，忽略空项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeImageRunner 记录 docker 命令，docker save 写入镜像文件
+type fakeImageRunner struct {
+	calls []string
+}
+
+func (f *fakeImageRunner) Run(name string, args ...string) (string, error) {
+	f.calls = append(f.calls, name+" "+strings.Join(args, " "))
+	if len(args) == 4 && args[0] == "save" {
+		return "", os.WriteFile(args[2], []byte("image "+args[3]), 0644)
+	}
+	return "", nil
+}
+
+// testRelease 返回发布目录中的文件
+func testRelease() map[string][]byte {
+	files := map[string][]byte{
+		"docker-1.2.0.tar.gz":                        []byte("docker common package"),
+		"docker-for-android-bin-1.2.0-arm64.tar.gz":  []byte("bin arm64 package"),
+		"docker-for-android-bin-1.2.0-x86_64.tar.gz": []byte("bin x86_64 package"),
+		"install-docker-arm64":                       []byte("installer arm64"),
+		"install-docker-arm64.sig":                   []byte("c2lnbmF0dXJl\n"),
+	}
+	files["version.txt"] = []byte(fmt.Sprintf("VERSION=1.2.0\nDOCKER_SHA256=%s\nBIN_ARM64_SHA256=%s\nBIN_X86_64_SHA256=%s\nINSTALLER_VERSION=1.2.0\nINSTALLER_ARM64_SHA256=%s\n",
+		sha256Hex(files["docker-1.2.0.tar.gz"]), sha256Hex(files["docker-for-android-bin-1.2.0-arm64.tar.gz"]),
+		sha256Hex(files["docker-for-android-bin-1.2.0-x86_64.tar.gz"]), sha256Hex(files["install-docker-arm64"])))
+	return files
+}
+
+// createTestBundle 生成包含两个架构和 DPanel 镜像的离线安装包，返回路径和签名公钥
+func createTestBundle(t *testing.T, sign bool) (string, string, *fakeImageRunner) {
+	t.Helper()
+	dir := t.TempDir()
+	release := testRelease()
+	runner := &fakeImageRunner{}
+	c := &bundleCreator{
+		fetch: func(name, dest, sha string) error {
+			data, ok := release[name]
+			if !ok {
+				return errors.New("404")
+			}
+			os.WriteFile(dest, data, 0644)
+			if sha != "" {
+				return verifySHA256(dest, sha)
+			}
+			return nil
+		},
+		runner: runner,
+		now:    func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}
+	opts := bundleOptions{Channel: "stable", Archs: []string{"arm64", "x86_64"}, Images: []string{"dpanel/dpanel:latest"}, Output: filepath.Join(dir, "bundle.tar")}
+	var publicKey string
+	if sign {
+		pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+		opts.SignKey = filepath.Join(dir, "sign.key")
+		os.WriteFile(opts.SignKey, []byte(base64.StdEncoding.EncodeToString(priv.Seed())+"\n"), 0600)
+		publicKey = base64.StdEncoding.EncodeToString(pub)
+	}
+	index, err := c.Create(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Version != "1.2.0" || len(index.Files) != 8 {
+		t.Fatalf("index = %+v", index)
+	}
+	return opts.Output, publicKey, runner
+}
+
+// TestBundleCreate 测试生成离线安装包并校验
+func TestBundleCreate(t *testing.T) {
+	bundle, key, runner := createTestBundle(t, true)
+	want := "docker pull --platform linux/arm64 dpanel/dpanel:latest"
+	if len(runner.calls) != 4 || runner.calls[0] != want || !strings.HasPrefix(runner.calls[2], "docker pull --platform linux/amd64 ") {
+		t.Errorf("docker 命令: %v", runner.calls)
+	}
+
+	index, signed, err := verifyBundle(bundle, key, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signed || index.Channel != "stable" || strings.Join(index.Architectures, ",") != "arm64,x86_64" {
+		t.Errorf("signed = %v, index = %+v", signed, index)
+	}
+	if f, ok := index.file("images/x86_64/dpanel_dpanel_latest.tar"); !ok || f.Image != "dpanel/dpanel:latest" {
+		t.Errorf("镜像记录错误: %+v", f)
+	}
+
+	// 错误的公钥
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, _, err := verifyBundle(bundle, base64.StdEncoding.EncodeToString(other), true); err == nil {
+		t.Error("expected signature error")
+	}
+}
+
+// TestBundleTampered 测试内容被修改或缺少签名的离线安装包
+func TestBundleTampered(t *testing.T) {
+	bundle, key, _ := createTestBundle(t, true)
+	data, _ := os.ReadFile(bundle)
+	os.WriteFile(bundle, bytes.Replace(data, []byte("bin arm64 package"), []byte("BIN arm64 package"), 1), 0644)
+	_, _, err := verifyBundle(bundle, key, false)
+	var mismatch *checksumMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+
+	unsigned, _, _ := createTestBundle(t, false)
+	if _, _, err := verifyBundle(unsigned, key, false); err == nil {
+		t.Error("指定公钥时应要求签名")
+	}
+	if _, _, err := verifyBundle(unsigned, "", false); err == nil {
+		t.Error("没有公钥时应拒绝未签名的离线安装包")
+	}
+	if _, _, err := verifyBundle(bundle, "", false); err == nil {
+		t.Error("没有公钥时不能校验签名，应拒绝")
+	}
+	for _, k := range []string{"", key} {
+		if _, signed, err := verifyBundle(unsigned, k, true); err != nil || signed {
+			t.Errorf("-allow-unsigned 时只校验 SHA256: signed = %v, err = %v", signed, err)
+		}
+	}
+
+	notBundle := filepath.Join(t.TempDir(), "docker.tar.gz")
+	os.WriteFile(notBundle, []byte("not a tar"), 0644)
+	if _, _, err := verifyBundle(notBundle, "", true); err == nil {
+		t.Error("expected error for non-bundle file")
+	}
+}
+
+// TestImportBundle 测试从离线安装包导入对应架构的安装包和镜像
+func TestImportBundle(t *testing.T) {
+	bundle, key, _ := createTestBundle(t, true)
+	dir := t.TempDir()
+	cache, err := openArtifactCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imagesDir := filepath.Join(dir, "cache", "images")
+	version, images, err := importBundle(bundle, key, false, "arm64", cache, imagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := testRelease()
+	if version.Version != "1.2.0" || version.BinSHA256 != sha256Hex(release["docker-for-android-bin-1.2.0-arm64.tar.gz"]) {
+		t.Errorf("version = %+v", version)
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("应只导入 arm64 的安装包: %v", cache.list())
+	}
+	for _, sha := range []string{version.DockerSHA256, version.BinSHA256} {
+		if _, ok := cache.lookup(sha, version.Version, time.Now()); !ok {
+			t.Errorf("缓存中没有 %s", sha)
+		}
+	}
+	if len(images) != 1 || images[0] != filepath.Join(imagesDir, "dpanel_dpanel_latest.tar") {
+		t.Fatalf("images = %v", images)
+	}
+	if data, _ := os.ReadFile(images[0]); string(data) != "image dpanel/dpanel:latest" {
+		t.Errorf("镜像内容错误: %q", data)
+	}
+
+	// 安装流程之后从缓存取安装包，不访问网络
+	path, err := fetchArtifact(nil, cache, t.TempDir(), "docker-1.2.0.tar.gz", version.DockerSHA256, version.Version)
+	if err != nil || path != cache.path(version.DockerSHA256) {
+		t.Errorf("path = %s, err = %v", path, err)
+	}
+
+	if _, _, err := importBundle(bundle, key, false, "mips", cache, imagesDir); err == nil || !strings.Contains(err.Error(), "arm64, x86_64") {
+		t.Errorf("expected arch error, got %v", err)
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// cacheConfigPath 安装包缓存的保留策略
+	cacheConfigPath = dockerRoot + "/etc/cache.json"
+
+	// cacheBlobsDir 缓存目录下按 SHA256 保存安装包的子目录
+	cacheBlobsDir = "blobs"
+	// cacheIndexFile 缓存目录下记录安装包名称、版本和使用时间的文件
+	cacheIndexFile = "index.json"
+)
+
+// CacheConfig 安装包缓存的保留策略，保存在 etc/cache.json
+type CacheConfig struct {
+	// KeepPrevious 除当前版本外保留最近使用的几个版本，用于重装和回滚
+	KeepPrevious int `json:"keep_previous"`
+	// MaxSize 缓存大小上限，如 2G，超出时从最久未使用的开始删除，当前版本不删除；为空表示不限制
+	MaxSize string `json:"max_size"`
+}
+
+// defaultCacheConfig 默认保留当前和上一个版本，最多 2G
+func defaultCacheConfig() *CacheConfig {
+	return &CacheConfig{KeepPrevious: 1, MaxSize: "2G"}
+}
+
+// loadCacheConfig 读取保留策略，文件不存在时返回默认值
+func loadCacheConfig(path string) (*CacheConfig, error) {
+	config := defaultCacheConfig()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, errorf(msgCacheConfigInvalid, path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// validate 检查保留策略
+func (c *CacheConfig) validate() error {
+	if c.KeepPrevious < 0 {
+		return errorf(msgCacheKeepInvalid, c.KeepPrevious)
+	}
+	_, err := parseSize(c.MaxSize)
+	return err
+}
+
+// CacheEntry 缓存中的一个安装包
+type CacheEntry struct {
+	SHA256 string `json:"sha256"`
+	Name   string `json:"name"`
+	// Version 最近一次使用这个安装包的版本
+	Version string    `json:"version"`
+	Size    int64     `json:"size"`
+	AddedAt time.Time `json:"added_at"`
+	UsedAt  time.Time `json:"used_at"`
+}
+
+// artifactCache 以 SHA256 为键的安装包缓存，位于 DISK_ROOT/Cache/installer
+// 安装包保存在 blobs/<sha256>，名称和版本记录在 index.json
+type artifactCache struct {
+	dir     string
+	entries map[string]*CacheEntry
+}
+
+// openArtifactCache 打开缓存目录，丢弃文件已不存在的记录
+func openArtifactCache(dir string) (*artifactCache, error) {
+	if err := os.MkdirAll(filepath.Join(dir, cacheBlobsDir), 0755); err != nil {
+		return nil, err
+	}
+	c := &artifactCache{dir: dir, entries: map[string]*CacheEntry{}}
+	data, err := os.ReadFile(filepath.Join(dir, cacheIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var entries []*CacheEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			// 索引损坏时重新开始，之前的安装包在清理时删除
+			fmt.Println(T(msgCacheIndexCorrupt, err))
+		}
+		for _, e := range entries {
+			if fileExists(c.path(e.SHA256)) {
+				c.entries[e.SHA256] = e
+			}
+		}
+	}
+	return c, nil
+}
+
+// path 返回安装包在缓存中的路径
+func (c *artifactCache) path(sha256 string) string {
+	return filepath.Join(c.dir, cacheBlobsDir, strings.ToLower(sha256))
+}
+
+// list 按最近使用时间排序返回所有安装包
+func (c *artifactCache) list() []*CacheEntry {
+	entries := make([]*CacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].UsedAt.Equal(entries[j].UsedAt) {
+			return entries[i].UsedAt.After(entries[j].UsedAt)
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// has 返回缓存中是否记录了该安装包，不校验内容
+func (c *artifactCache) has(sha256 string) bool {
+	_, ok := c.entries[strings.ToLower(sha256)]
+	return ok && sha256 != ""
+}
+
+// save 写入索引
+func (c *artifactCache) save() error {
+	return writeJSONFile(filepath.Join(c.dir, cacheIndexFile), c.list())
+}
+
+// lookup 查找安装包并校验 SHA256，命中时记录使用的版本和时间
+// 校验失败的安装包从缓存中删除
+func (c *artifactCache) lookup(sha256, version string, now time.Time) (string, bool) {
+	e, ok := c.entries[strings.ToLower(sha256)]
+	if !ok || sha256 == "" {
+		return "", false
+	}
+	path := c.path(e.SHA256)
+	if err := verifySHA256(path, e.SHA256); err != nil {
+		fmt.Println(T(msgCacheEntryCorrupt, e.Name, err))
+		os.Remove(path)
+		delete(c.entries, e.SHA256)
+		c.saveIndex()
+		return "", false
+	}
+	e.Version, e.UsedAt = version, now
+	c.saveIndex()
+	return path, true
+}
+
+// saveIndex 写入索引，失败时只警告，缓存中的安装包仍然可用
+func (c *artifactCache) saveIndex() {
+	if err := c.save(); err != nil {
+		fmt.Println(T(msgCacheIndexWarn, err))
+	}
+}
+
+// store 把 src 放入缓存并返回缓存中的路径
+// move 为 true 时 src 是已校验过的下载文件，直接移动；否则先尝试硬链接，不在同一文件系统时流式复制，并校验 SHA256
+func (c *artifactCache) store(src string, entry CacheEntry, move bool) (string, error) {
+	entry.SHA256 = strings.ToLower(entry.SHA256)
+	dst := c.path(entry.SHA256)
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+	if move {
+		if err := os.Rename(src, tmp); err != nil {
+			return "", err
+		}
+	} else if err := os.Link(src, tmp); err == nil {
+		if err := verifySHA256(tmp, entry.SHA256); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+	} else {
+		f, err := os.Open(src)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		return c.storeFrom(f, entry)
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	entry.Size = info.Size()
+	c.entries[entry.SHA256] = &entry
+	c.saveIndex()
+	return dst, nil
+}
+
+// storeFrom 把 r 的内容校验 SHA256 后放入缓存，用于复制本地文件和导入离线安装包
+func (c *artifactCache) storeFrom(r io.Reader, entry CacheEntry) (string, error) {
+	entry.SHA256 = strings.ToLower(entry.SHA256)
+	dst := c.path(entry.SHA256)
+	size, err := writeVerified(r, dst, entry.SHA256)
+	if err != nil {
+		return "", err
+	}
+	entry.Size = size
+	c.entries[entry.SHA256] = &entry
+	c.saveIndex()
+	return dst, nil
+}
+
+// writeVerified 流式写入 dst 并计算 SHA256，一致时才改名为 dst，返回写入的字节数
+func writeVerified(r io.Reader, dst, expected string) (int64, error) {
+	tmp := dst + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != strings.ToLower(expected) {
+			err = &checksumMismatchError{Expected: expected, Actual: actual}
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return n, nil
+}
+
+// prune 按保留策略删除安装包，返回删除的记录
+// 保留 current 版本和除它之外最近使用的 KeepPrevious 个版本，再按 MaxSize 从最久未使用的开始删除，current 版本始终保留
+func (c *artifactCache) prune(config *CacheConfig, current string) ([]*CacheEntry, error) {
+	maxSize, err := parseSize(config.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	keep := map[string]bool{}
+	if current != "" {
+		keep[current] = true
+	}
+	kept := 0
+	for _, e := range c.list() {
+		if kept >= config.KeepPrevious {
+			break
+		}
+		if e.Version != "" && !keep[e.Version] {
+			keep[e.Version] = true
+			kept++
+		}
+	}
+
+	var removed []*CacheEntry
+	var total int64
+	entries := c.list()
+	for _, e := range entries {
+		if keep[e.Version] {
+			total += e.Size
+		}
+	}
+	// 从最久未使用的开始删除
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if keep[e.Version] && (maxSize == 0 || total <= maxSize || e.Version == current) {
+			continue
+		}
+		if err := os.Remove(c.path(e.SHA256)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		if keep[e.Version] {
+			total -= e.Size
+		}
+		delete(c.entries, e.SHA256)
+		removed = append(removed, e)
+	}
+	c.removeOrphans()
+	return removed, c.save()
+}
+
+// removeOrphans 删除索引中没有记录的文件，例如中断的复制
+func (c *artifactCache) removeOrphans() {
+	names, err := os.ReadDir(filepath.Join(c.dir, cacheBlobsDir))
+	if err != nil {
+		return
+	}
+	for _, n := range names {
+		if _, ok := c.entries[n.Name()]; !ok {
+			os.RemoveAll(filepath.Join(c.dir, cacheBlobsDir, n.Name()))
+		}
+	}
+}
+
+// cleanTmpDir 删除缓存目录中除安装包缓存以外的临时文件（version.txt、下载到一半的文件等）
+func cleanTmpDir(dir string) error {
+	names, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if n.Name() == cacheBlobsDir || n.Name() == cacheIndexFile {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, n.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchArtifact 返回安装包在缓存中的路径：先查缓存，再使用 localDir 中的文件，最后从下载源下载
+func fetchArtifact(client *http.Client, cache *artifactCache, localDir, name, sha256, version string) (string, error) {
+	now := time.Now()
+	if path, ok := cache.lookup(sha256, version, now); ok {
+		fmt.Println(T(msgCacheHit, name))
+		return path, nil
+	}
+
+	entry := CacheEntry{SHA256: sha256, Name: name, Version: version, AddedAt: now, UsedAt: now}
+	localPath := filepath.Join(localDir, name)
+	if fileExists(localPath) {
+		fmt.Println(T(msgUseLocalFile, localPath))
+		path, err := cache.store(localPath, entry, false)
+		if err != nil {
+			return "", installFailure(errCodeCopyLocal, err, msgCopyLocalFailed)
+		}
+		fmt.Println(T(msgCopied, name))
+		return path, nil
+	}
+
+	fmt.Println(T(msgDownloading, name))
+	tmpPath := filepath.Join(cache.dir, name)
+	if err := downloadFile(client, tmpPath, name, sha256); err != nil {
+		return "", installFailure(errCodeDownload, err, msgDownloadFailed, name)
+	}
+	path, err := cache.store(tmpPath, entry, true)
+	if err != nil {
+		return "", installFailure(errCodeDownload, err, msgDownloadFailed, name)
+	}
+	fmt.Println(T(msgDownloaded, name))
+	return path, nil
+}
+
+// installCacheDir 返回已安装的数据盘上的缓存目录，没有安装记录时检测硬盘
+func installCacheDir() (dir, current string, err error) {
+	state, err := loadInstallState(installStatePath)
+	if err != nil {
+		return "", "", err
+	}
+	diskRoot := ""
+	if state != nil {
+		diskRoot, current = state.DiskRoot, state.Version
+	}
+	if diskRoot == "" {
+		if diskRoot, err = detectDiskMount(); err != nil {
+			return "", "", err
+		}
+	}
+	return diskCacheDir(diskRoot), current, nil
+}
+
+// diskCacheDir 返回数据盘上的安装包缓存目录
+func diskCacheDir(diskRoot string) string {
+	return filepath.Join(diskRoot, "Cache", "installer")
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "cache",
+		usage: msgUsageCache,
+		run:   runCache,
+	})
+}
+
+// runCache 实现 cache 子命令
+func runCache(args []string) error {
+	action := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	dir, current, err := installCacheDir()
+	if err != nil {
+		return err
+	}
+	cache, err := openArtifactCache(dir)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		return printCache(os.Stdout, cache, current)
+	case "prune":
+		config, err := loadCacheConfig(cacheConfigPath)
+		if err != nil {
+			return err
+		}
+		fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+		fs.IntVar(&config.KeepPrevious, "keep", config.KeepPrevious, "除当前版本外保留的版本数")
+		fs.StringVar(&config.MaxSize, "max-size", config.MaxSize, "缓存大小上限，如 2G，0 表示不限制")
+		all := fs.Bool("all", false, "删除全部缓存，包括当前版本")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if err := config.validate(); err != nil {
+			return err
+		}
+		if *all {
+			config.KeepPrevious, config.MaxSize, current = 0, "", ""
+		}
+		removed, err := cache.prune(config, current)
+		var freed int64
+		for _, e := range removed {
+			fmt.Println(T(msgCacheRemoved, e.Name, e.Version))
+			freed += e.Size
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(T(msgCachePruneDone, len(removed), float64(freed)/(1<<20)))
+		return nil
+	default:
+		return errorf(msgUnknownAction, action)
+	}
+}
+
+// printCache 列出缓存中的安装包，* 表示当前安装的版本
+func printCache(w io.Writer, cache *artifactCache, current string) error {
+	entries := cache.list()
+	if len(entries) == 0 {
+		fmt.Fprintln(w, T(msgCacheEmpty, cache.dir))
+		return nil
+	}
+	var total int64
+	for _, e := range entries {
+		mark := " "
+		if e.Version == current {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s %-12s %8.1f MB  %s  %s\n", mark, e.Version, float64(e.Size)/(1<<20), e.UsedAt.Format("2006-01-02 15:04"), e.Name)
+		total += e.Size
+	}
+	fmt.Fprintln(w, T(msgCacheTotal, len(entries), float64(total)/(1<<20), cache.dir))
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// addCacheEntry 在缓存中放入 content，返回 SHA256
+func addCacheEntry(t *testing.T, c *artifactCache, name, version string, content []byte, used time.Time) string {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), name)
+	os.WriteFile(src, content, 0644)
+	sum := sha256Hex(content)
+	if _, err := c.store(src, CacheEntry{SHA256: sum, Name: name, Version: version, AddedAt: used, UsedAt: used}, false); err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+// TestArtifactCacheLookup 测试存入、查找和损坏的安装包
+func TestArtifactCacheLookup(t *testing.T) {
+	dir := t.TempDir()
+	c, err := openArtifactCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	sum := addCacheEntry(t, c, "docker-1.0.tar.gz", "1.0", []byte("docker 1.0"), now)
+
+	// 重新打开后仍然可以找到
+	c, err = openArtifactCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, ok := c.lookup(strings.ToUpper(sum), "1.1", now.Add(time.Hour))
+	if !ok || path != filepath.Join(dir, "blobs", sum) {
+		t.Fatalf("lookup = %s, %v", path, ok)
+	}
+	if e := c.entries[sum]; e.Version != "1.1" || !e.UsedAt.Equal(now.Add(time.Hour)) || e.Size != 10 {
+		t.Errorf("entry = %+v", e)
+	}
+	if _, ok := c.lookup("", "1.1", now); ok {
+		t.Error("空 SHA256 不应命中")
+	}
+
+	// 损坏的安装包被删除
+	os.WriteFile(path, []byte("corrupted"), 0644)
+	if _, ok := c.lookup(sum, "1.1", now); ok {
+		t.Error("损坏的安装包不应命中")
+	}
+	if fileExists(path) || len(c.entries) != 0 {
+		t.Error("损坏的安装包应被删除")
+	}
+
+	// 存入时校验 SHA256
+	src := filepath.Join(t.TempDir(), "bin.tar.gz")
+	os.WriteFile(src, []byte("bin"), 0644)
+	_, err = c.store(src, CacheEntry{SHA256: sha256Hex([]byte("other")), Name: "bin.tar.gz"}, false)
+	var mismatch *checksumMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+	if names, _ := os.ReadDir(filepath.Join(dir, "blobs")); len(names) != 0 {
+		t.Errorf("校验失败后不应留下文件: %v", names)
+	}
+}
+
+// TestFetchArtifact 测试依次使用缓存、本地文件和下载源
+func TestFetchArtifact(t *testing.T) {
+	useMirrorMode(t, false, false)
+	content := []byte("docker package")
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(content)
+	}))
+	defer srv.Close()
+	useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: srv.URL})
+
+	dir, localDir := t.TempDir(), t.TempDir()
+	c, err := openArtifactCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256Hex(content)
+	for i := 0; i < 2; i++ {
+		path, err := fetchArtifact(srv.Client(), c, localDir, "docker-1.0.tar.gz", sum, "1.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != string(content) {
+			t.Errorf("内容错误: %q", data)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("第二次应使用缓存，请求了 %d 次", requests)
+	}
+	if fileExists(filepath.Join(dir, "docker-1.0.tar.gz")) {
+		t.Error("下载的文件应移动到 blobs")
+	}
+
+	// 本地文件优先于下载源
+	local := []byte("local bin package")
+	os.WriteFile(filepath.Join(localDir, "bin-1.0.tar.gz"), local, 0644)
+	path, err := fetchArtifact(srv.Client(), c, localDir, "bin-1.0.tar.gz", sha256Hex(local), "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != c.path(sha256Hex(local)) || requests != 1 {
+		t.Errorf("path = %s, requests = %d", path, requests)
+	}
+
+	// 本地文件与 version.txt 不一致
+	os.WriteFile(filepath.Join(localDir, "bin-1.1.tar.gz"), []byte("stale"), 0644)
+	_, err = fetchArtifact(srv.Client(), c, localDir, "bin-1.1.tar.gz", sha256Hex(local)+"0", "1.1")
+	var ie *InstallError
+	if !errors.As(err, &ie) || ie.ErrorCode != errCodeCopyLocal {
+		t.Errorf("expected copy_local error, got %v", err)
+	}
+}
+
+// TestArtifactCachePrune 测试保留当前和之前的版本以及大小上限
+func TestArtifactCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	c, err := openArtifactCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	v10 := addCacheEntry(t, c, "docker-1.0.tar.gz", "1.0", make([]byte, 3000), base)
+	v11 := addCacheEntry(t, c, "docker-1.1.tar.gz", "1.1", make([]byte, 2000), base.Add(time.Hour))
+	v12 := addCacheEntry(t, c, "docker-1.2.tar.gz", "1.2", make([]byte, 1000), base.Add(2*time.Hour))
+	os.WriteFile(filepath.Join(dir, "blobs", "orphan.tmp"), []byte("partial"), 0644)
+
+	removed, err := c.prune(&CacheConfig{KeepPrevious: 1}, "1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].SHA256 != v10 || fileExists(c.path(v10)) {
+		t.Errorf("应只删除 1.0: %v", removed)
+	}
+	if fileExists(filepath.Join(dir, "blobs", "orphan.tmp")) {
+		t.Error("未记录的文件应被删除")
+	}
+
+	// 超过大小上限时删除之前的版本，当前版本始终保留
+	removed, err = c.prune(&CacheConfig{KeepPrevious: 1, MaxSize: "1"}, "1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].SHA256 != v11 || !fileExists(c.path(v12)) {
+		t.Errorf("应删除 1.1 并保留 1.2: %v", removed)
+	}
+
+	c, _ = openArtifactCache(dir)
+	if len(c.entries) != 1 || c.entries[v12] == nil {
+		t.Errorf("索引未更新: %v", c.entries)
+	}
+}
+
+// TestCleanTmpDir 测试清理临时文件时保留缓存
+func TestCleanTmpDir(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := openArtifactCache(dir)
+	sum := addCacheEntry(t, c, "docker-1.0.tar.gz", "1.0", []byte("docker"), time.Now())
+	os.WriteFile(filepath.Join(dir, "version.txt"), []byte("VERSION=1.0"), 0644)
+	os.WriteFile(filepath.Join(dir, "docker-1.1.tar.gz.part"), []byte("part"), 0644)
+
+	if err := cleanTmpDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := os.ReadDir(dir)
+	if len(names) != 2 || !fileExists(c.path(sum)) {
+		t.Errorf("剩余文件: %v", names)
+	}
+}
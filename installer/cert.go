@@ -2,10 +2,16 @@ package main
 
 import (
 	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/jannson/gocertifi"
 )
 
+// androidSystemCADir Android 系统信任的 CA 证书，每个文件一个 PEM 证书
+const androidSystemCADir = "/system/etc/security/cacerts"
+
 var rootCAs *x509.CertPool
 
 func RootCAsGlobal() *x509.CertPool {
@@ -15,3 +21,49 @@ func RootCAsGlobal() *x509.CertPool {
 func init() {
 	rootCAs, _ = gocertifi.CACerts()
 }
+
+// buildRootCAs 在内置证书的基础上追加用户提供的 PEM 文件和 Android 系统证书
+// 企业网络的 HTTPS 代理会用自己的 CA 重新签发证书，只信任内置证书时下载会失败
+func buildRootCAs(bundle string, systemDir string) (*x509.CertPool, error) {
+	pool, err := gocertifi.CACerts()
+	if err != nil {
+		return nil, fmt.Errorf("加载内置 CA 证书失败: %v", err)
+	}
+	if bundle != "" {
+		pem, err := os.ReadFile(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s 中没有有效的 PEM 证书", bundle)
+		}
+	}
+	if systemDir != "" {
+		if n, err := appendCertDir(pool, systemDir); err != nil {
+			return nil, err
+		} else if n == 0 {
+			return nil, fmt.Errorf("%s 中没有有效的证书", systemDir)
+		}
+	}
+	return pool, nil
+}
+
+// appendCertDir 追加目录中的证书，返回成功追加的文件数
+// Android 的证书文件名为 <hash>.0，PEM 之后还附有证书的文字说明，AppendCertsFromPEM 会跳过
+func appendCertDir(pool *x509.CertPool, dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("读取系统证书失败: %v", err)
+	}
+	n := 0
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		pem, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err == nil && pool.AppendCertsFromPEM(pem) {
+			n++
+		}
+	}
+	return n, nil
+}
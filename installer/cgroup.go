@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// cgroupMountRoot dockerd 查找 cgroup 的位置
+	cgroupMountRoot = "/sys/fs/cgroup"
+	// cgroupTmpfsOptions 挂载在 /sys/fs/cgroup 的 tmpfs 参数
+	cgroupTmpfsOptions = "size=4M,uid=0,gid=0,mode=0755"
+)
+
+// CgroupController /proc/cgroups 中的一行
+type CgroupController struct {
+	Name       string
+	Hierarchy  int
+	NumCgroups int
+	Enabled    bool
+}
+
+// parseProcCgroups 解析 /proc/cgroups
+func parseProcCgroups(r io.Reader) ([]CgroupController, error) {
+	var controllers []CgroupController
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("无法解析 /proc/cgroups 行: %q", line)
+		}
+		hierarchy, err1 := strconv.Atoi(fields[1])
+		num, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("无法解析 /proc/cgroups 行: %q", line)
+		}
+		controllers = append(controllers, CgroupController{
+			Name:       fields[0],
+			Hierarchy:  hierarchy,
+			NumCgroups: num,
+			Enabled:    fields[3] == "1",
+		})
+	}
+	return controllers, scanner.Err()
+}
+
+// MountInfo /proc/self/mountinfo 中的一行
+type MountInfo struct {
+	MountID      int
+	ParentID     int
+	Root         string
+	MountPoint   string
+	Options      string
+	FSType       string
+	Source       string
+	SuperOptions string
+}
+
+// parseMountInfo 解析 /proc/self/mountinfo
+// 格式: 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfo(r io.Reader) ([]MountInfo, error) {
+	var mounts []MountInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		sep := -1
+		for i, f := range fields {
+			if f == "-" && i >= 6 {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || len(fields) < sep+3 {
+			return nil, fmt.Errorf("无法解析 mountinfo 行: %q", line)
+		}
+		mountID, err1 := strconv.Atoi(fields[0])
+		parentID, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("无法解析 mountinfo 行: %q", line)
+		}
+		m := MountInfo{
+			MountID:    mountID,
+			ParentID:   parentID,
+			Root:       unescapeMountPath(fields[3]),
+			MountPoint: unescapeMountPath(fields[4]),
+			Options:    fields[5],
+			FSType:     fields[sep+1],
+			Source:     unescapeMountPath(fields[sep+2]),
+		}
+		if len(fields) > sep+3 {
+			m.SuperOptions = fields[sep+3]
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath 还原 mountinfo 中的八进制转义（如 \040 表示空格）
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// findMount 返回挂载点为 target 的最后一个挂载（最上层）
+func findMount(mounts []MountInfo, target string) *MountInfo {
+	var found *MountInfo
+	for i := range mounts {
+		if mounts[i].MountPoint == target {
+			found = &mounts[i]
+		}
+	}
+	return found
+}
+
+// CgroupMode 当前系统的 cgroup 版本
+type CgroupMode string
+
+const (
+	cgroupModeNone    CgroupMode = "none"
+	cgroupModeLegacy  CgroupMode = "legacy"  // 只有 cgroup v1
+	cgroupModeHybrid  CgroupMode = "hybrid"  // v1 和 v2 同时挂载（Android 10 及以上常见）
+	cgroupModeUnified CgroupMode = "unified" // 只有 cgroup v2
+)
+
+// CgroupProbe 探测 cgroup 所需的系统信息，可以从 fixture 目录加载
+type CgroupProbe struct {
+	Controllers []CgroupController
+	Mounts      []MountInfo
+	// HasCgroup2 内核是否支持 cgroup2 文件系统
+	HasCgroup2 bool
+	// V2Controllers /sys/fs/cgroup/cgroup.controllers 中可用的控制器
+	V2Controllers []string
+}
+
+// loadCgroupProbe 从 root 下的 proc 和 sys 文件读取探测信息，root 为 "/" 时读取本机
+func loadCgroupProbe(root string) (*CgroupProbe, error) {
+	probe := &CgroupProbe{}
+
+	f, err := os.Open(filepath.Join(root, "proc", "cgroups"))
+	if err != nil {
+		return nil, fmt.Errorf("读取 /proc/cgroups 失败: %v", err)
+	}
+	probe.Controllers, err = parseProcCgroups(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err = os.Open(filepath.Join(root, "proc", "self", "mountinfo"))
+	if err != nil {
+		return nil, fmt.Errorf("读取 /proc/self/mountinfo 失败: %v", err)
+	}
+	probe.Mounts, err = parseMountInfo(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if content, err := os.ReadFile(filepath.Join(root, "proc", "filesystems")); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) > 0 && fields[len(fields)-1] == "cgroup2" {
+				probe.HasCgroup2 = true
+			}
+		}
+	}
+
+	if m := findMount(probe.Mounts, cgroupMountRoot); m != nil && m.FSType == "cgroup2" {
+		content, err := os.ReadFile(filepath.Join(root, strings.TrimPrefix(cgroupMountRoot, "/"), "cgroup.controllers"))
+		if err == nil {
+			probe.V2Controllers = strings.Fields(string(content))
+		}
+	}
+	return probe, nil
+}
+
+// Mode 根据挂载情况判断 cgroup 版本
+func (p *CgroupProbe) Mode() CgroupMode {
+	hasV1, hasV2 := false, false
+	for _, m := range p.Mounts {
+		switch m.FSType {
+		case "cgroup":
+			hasV1 = true
+		case "cgroup2":
+			hasV2 = true
+		}
+	}
+	switch {
+	case hasV1 && hasV2:
+		return cgroupModeHybrid
+	case hasV2:
+		return cgroupModeUnified
+	case hasV1:
+		return cgroupModeLegacy
+	default:
+		return cgroupModeNone
+	}
+}
+
+// enabledV1Controllers 返回内核启用的控制器名称
+func (p *CgroupProbe) enabledV1Controllers() []string {
+	var names []string
+	for _, c := range p.Controllers {
+		if c.Enabled {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// useUnifiedLayout 当 /sys/fs/cgroup 已是 cgroup2 且提供 memory 和 cpu 控制器时直接使用 v2
+func (p *CgroupProbe) useUnifiedLayout() bool {
+	return p.Mode() == cgroupModeUnified &&
+		containsString(p.V2Controllers, "memory") && containsString(p.V2Controllers, "cpu")
+}
+
+// cgroupFeatures Docker 功能依赖的控制器，v1 和 v2 中的名称可能不同
+var cgroupFeatures = []struct {
+	v1, v2  string
+	feature string
+}{
+	{"memory", "memory", "--memory 内存限制"},
+	{"cpu", "cpu", "--cpus/--cpu-shares CPU 限制"},
+	{"cpuset", "cpuset", "--cpuset-cpus CPU 绑定"},
+	{"pids", "pids", "--pids-limit 进程数限制"},
+	{"blkio", "io", "--blkio-weight/--device-read-bps 磁盘 IO 限制"},
+	{"devices", "", "设备访问控制（缺失时 dockerd 可能无法启动容器）"},
+	{"freezer", "", "docker pause"},
+}
+
+// MissingController 缺失的控制器及受影响的功能
+type MissingController struct {
+	Name    string `json:"name"`
+	Feature string `json:"feature"`
+}
+
+// MountStep 挂载计划中的一步
+type MountStep struct {
+	Action  string // umount、mount、mkdir、bind、make-slave、copy、touch
+	Source  string
+	Target  string
+	FSType  string
+	Options string
+	// Optional 为 true 时失败只跳过该控制器，不中断后续步骤
+	Optional bool
+	// Verify 挂载后必须存在的文件，不存在时撤销挂载
+	Verify string
+}
+
+// String 以 shell 命令形式显示
+func (s MountStep) String() string {
+	switch s.Action {
+	case "umount":
+		return "umount " + s.Target
+	case "mkdir":
+		return "mkdir -p " + s.Target
+	case "touch":
+		return "touch " + s.Target
+	case "copy":
+		return fmt.Sprintf("cp -a %s %s", s.Source, s.Target)
+	case "make-slave":
+		return "mount --make-slave " + s.Target
+	case "bind":
+		return fmt.Sprintf("mount --bind %s %s", s.Source, s.Target)
+	default:
+		cmd := fmt.Sprintf("mount -t %s", s.FSType)
+		if s.Options != "" {
+			cmd += " -o " + s.Options
+		}
+		cmd += fmt.Sprintf(" %s %s", s.Source, s.Target)
+		if s.Verify != "" {
+			cmd += fmt.Sprintf("  # 需要 %s", filepath.Base(s.Verify))
+		}
+		return cmd
+	}
+}
+
+// CgroupPlan cgroup 挂载计划
+type CgroupPlan struct {
+	Mode        CgroupMode
+	Layout      string // v1 或 v2
+	Steps       []MountStep
+	Controllers []string
+	Missing     []MissingController
+}
+
+// planCgroupMounts 根据探测结果生成挂载计划，target 通常为 /sys/fs/cgroup
+func planCgroupMounts(p *CgroupProbe, target string) *CgroupPlan {
+	plan := &CgroupPlan{Mode: p.Mode()}
+
+	if p.useUnifiedLayout() {
+		plan.Layout = "v2"
+		plan.Controllers = append(plan.Controllers, p.V2Controllers...)
+		for _, f := range cgroupFeatures {
+			if f.v2 != "" && !containsString(p.V2Controllers, f.v2) {
+				plan.Missing = append(plan.Missing, MissingController{Name: f.v2, Feature: f.feature})
+			}
+		}
+		return plan
+	}
+
+	plan.Layout = "v1"
+
+	// 卸载 Android 挂载在 /dev 下的 v1 控制器（/dev/cpuctl、/dev/memcg 等），
+	// 同一控制器只能属于一个层级，否则无法重新挂载到 target 下
+	var androidMounts []string
+	for _, m := range p.Mounts {
+		if m.FSType == "cgroup" && strings.HasPrefix(m.MountPoint, "/dev/") {
+			androidMounts = append(androidMounts, m.MountPoint)
+		}
+	}
+	sort.Strings(androidMounts)
+	for _, mp := range androidMounts {
+		plan.Steps = append(plan.Steps, MountStep{Action: "umount", Target: mp, Optional: true})
+	}
+
+	if findMount(p.Mounts, target) != nil {
+		plan.Steps = append(plan.Steps, MountStep{Action: "umount", Target: target, Optional: true})
+	}
+	plan.Steps = append(plan.Steps, MountStep{
+		Action: "mount", Source: "cgroup", Target: target, FSType: "tmpfs", Options: cgroupTmpfsOptions,
+	})
+
+	enabled := p.enabledV1Controllers()
+	for _, name := range enabled {
+		dir := filepath.Join(target, name)
+		step := MountStep{
+			Action: "mount", Source: "cgroup", Target: dir, FSType: "cgroup", Options: name, Optional: true,
+		}
+		// Android 的 cpuset 以 noprefix 挂载时没有 cpuset.cpus，会导致 docker run 失败
+		if name == "cpuset" {
+			step.Verify = filepath.Join(dir, "cpuset.cpus")
+		}
+		plan.Steps = append(plan.Steps,
+			MountStep{Action: "mkdir", Target: dir, Optional: true},
+			step,
+		)
+	}
+	plan.Controllers = enabled
+
+	for _, f := range cgroupFeatures {
+		if !containsString(enabled, f.v1) {
+			plan.Missing = append(plan.Missing, MissingController{Name: f.v1, Feature: f.feature})
+		}
+	}
+	return plan
+}
+
+// Mounter 执行挂载操作，测试时可替换
+type Mounter interface {
+	Mount(source, target, fstype, options string) error
+	Unmount(target string) error
+	MkdirAll(path string) error
+	Remove(path string) error
+	Exists(path string) bool
+}
+
+// syscallMounter 通过系统调用执行挂载
+type syscallMounter struct{}
+
+func (syscallMounter) Mount(source, target, fstype, options string) error {
+	flags, data := parseMountOptions(options)
+	return syscall.Mount(source, target, fstype, flags, data)
+}
+
+// mountFlagOptions mount 命令中对应 MS_* 标志的选项
+var mountFlagOptions = map[string]uintptr{
+	"ro":         syscall.MS_RDONLY,
+	"nosuid":     syscall.MS_NOSUID,
+	"nodev":      syscall.MS_NODEV,
+	"noexec":     syscall.MS_NOEXEC,
+	"noatime":    syscall.MS_NOATIME,
+	"nodiratime": syscall.MS_NODIRATIME,
+	"relatime":   syscall.MS_RELATIME,
+	"bind":       syscall.MS_BIND,
+	"rbind":      syscall.MS_BIND | syscall.MS_REC,
+	"slave":      syscall.MS_SLAVE,
+	"rslave":     syscall.MS_SLAVE | syscall.MS_REC,
+	"private":    syscall.MS_PRIVATE,
+	"rprivate":   syscall.MS_PRIVATE | syscall.MS_REC,
+}
+
+// parseMountOptions 将 mount -o 风格的选项拆分为系统调用的标志和文件系统参数
+func parseMountOptions(options string) (uintptr, string) {
+	var flags uintptr
+	var data []string
+	for _, opt := range strings.Split(options, ",") {
+		if opt == "" || opt == "rw" || opt == "defaults" {
+			continue
+		}
+		if f, ok := mountFlagOptions[opt]; ok {
+			flags |= f
+			continue
+		}
+		data = append(data, opt)
+	}
+	return flags, strings.Join(data, ",")
+}
+
+func (syscallMounter) Unmount(target string) error {
+	return syscall.Unmount(target, 0)
+}
+
+func (syscallMounter) MkdirAll(path string) error {
+	return os.MkdirAll(path, 0755)
+}
+
+func (syscallMounter) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (syscallMounter) Exists(path string) bool {
+	return fileExists(path)
+}
+
+// CgroupResult 执行挂载计划的结果
+type CgroupResult struct {
+	Mounted []string
+	Skipped map[string]string
+}
+
+// applyCgroupPlan 执行挂载计划，可选步骤失败时记录并跳过
+func applyCgroupPlan(plan *CgroupPlan, m Mounter) (*CgroupResult, error) {
+	result := &CgroupResult{Skipped: map[string]string{}}
+
+	for _, step := range plan.Steps {
+		var err error
+		switch step.Action {
+		case "umount":
+			err = m.Unmount(step.Target)
+		case "mkdir":
+			err = m.MkdirAll(step.Target)
+		case "mount":
+			err = m.Mount(step.Source, step.Target, step.FSType, step.Options)
+			if err == nil && step.Verify != "" && !m.Exists(step.Verify) {
+				m.Unmount(step.Target)
+				err = fmt.Errorf("缺少 %s", filepath.Base(step.Verify))
+			}
+		default:
+			err = fmt.Errorf("未知操作: %s", step.Action)
+		}
+
+		if err == nil {
+			if step.Action == "mount" && step.FSType == "cgroup" {
+				result.Mounted = append(result.Mounted, step.Options)
+			}
+			continue
+		}
+		if !step.Optional {
+			return result, fmt.Errorf("%s: %v", step, err)
+		}
+		if step.Action == "mount" && step.FSType == "cgroup" {
+			result.Skipped[step.Options] = err.Error()
+			m.Remove(step.Target)
+		}
+	}
+	return result, nil
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "cgroup",
+		usage: msgUsageCgroup,
+		run:   runCgroupCommand,
+	})
+}
+
+// runCgroupCommand 实现 cgroup 子命令
+func runCgroupCommand(args []string) error {
+	action := "status"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("cgroup", flag.ExitOnError)
+	root := fs.String("root", "/", "读取 proc/sys 文件的根目录（用于离线分析）")
+	target := fs.String("target", cgroupMountRoot, "cgroup 挂载位置")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	probe, err := loadCgroupProbe(*root)
+	if err != nil {
+		return err
+	}
+	plan := planCgroupMounts(probe, *target)
+
+	switch action {
+	case "status":
+		printCgroupSummary(plan)
+		return nil
+	case "plan":
+		printCgroupSummary(plan)
+		fmt.Println("挂载计划:")
+		if len(plan.Steps) == 0 {
+			fmt.Println("  （无需挂载，直接使用 cgroup v2）")
+		}
+		for _, step := range plan.Steps {
+			fmt.Printf("  %s\n", step)
+		}
+		return nil
+	case "mount":
+		result, err := applyCgroupPlan(plan, syscallMounter{})
+		if err != nil {
+			return err
+		}
+		if plan.Layout == "v2" {
+			fmt.Println("✓ 使用 cgroup v2，无需挂载")
+			return nil
+		}
+		fmt.Printf("✓ 已挂载控制器: %s\n", strings.Join(result.Mounted, " "))
+		for name, reason := range result.Skipped {
+			fmt.Printf("⚠ 跳过控制器 %s: %s\n", name, reason)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知操作: %s", action)
+	}
+}
+
+// printCgroupSummary 输出 cgroup 版本、布局和缺失的控制器
+func printCgroupSummary(plan *CgroupPlan) {
+	fmt.Printf("cgroup 模式: %s\n", plan.Mode)
+	fmt.Printf("使用布局: %s\n", plan.Layout)
+	fmt.Printf("可用控制器: %s\n", strings.Join(plan.Controllers, " "))
+	for _, m := range plan.Missing {
+		fmt.Printf("⚠ 缺少 %s 控制器: %s 不可用\n", m.Name, m.Feature)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// loadCgroupFixture 从 testdata/cgroup 加载探测信息
+func loadCgroupFixture(t *testing.T, name string) *CgroupProbe {
+	t.Helper()
+	probe, err := loadCgroupProbe(filepath.Join("testdata", "cgroup", name))
+	if err != nil {
+		t.Fatalf("加载 fixture %s 失败: %v", name, err)
+	}
+	return probe
+}
+
+// TestParseProcCgroups 测试解析 /proc/cgroups
+func TestParseProcCgroups(t *testing.T) {
+	probe := loadCgroupFixture(t, "no-memory")
+	if len(probe.Controllers) != 5 {
+		t.Fatalf("控制器数量错误: %v", probe.Controllers)
+	}
+	for _, c := range probe.Controllers {
+		if c.Name == "memory" && c.Enabled {
+			t.Error("memory 应为禁用")
+		}
+		if c.Name == "cpuset" && (c.Hierarchy != 2 || c.NumCgroups != 4 || !c.Enabled) {
+			t.Errorf("cpuset 解析错误: %+v", c)
+		}
+	}
+
+	if _, err := parseProcCgroups(strings.NewReader("cpu 1 2\n")); err == nil {
+		t.Error("字段数不对时应返回错误")
+	}
+}
+
+// TestParseMountInfo 测试解析 mountinfo
+func TestParseMountInfo(t *testing.T) {
+	probe := loadCgroupFixture(t, "android-legacy")
+
+	cpuset := findMount(probe.Mounts, "/dev/cpuset")
+	if cpuset == nil {
+		t.Fatal("未找到 /dev/cpuset")
+	}
+	if cpuset.FSType != "cgroup" || !strings.Contains(cpuset.SuperOptions, "noprefix") {
+		t.Errorf("/dev/cpuset 解析错误: %+v", cpuset)
+	}
+
+	if findMount(probe.Mounts, "/mnt/media_rw/My Disk") == nil {
+		t.Error("挂载点中的 \\040 应还原为空格")
+	}
+
+	// 带多个可选字段的行
+	mounts, err := parseMountInfo(strings.NewReader("36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 shared:2 - ext3 /dev/root rw,errors=continue\n"))
+	if err != nil || len(mounts) != 1 || mounts[0].FSType != "ext3" || mounts[0].Source != "/dev/root" {
+		t.Errorf("可选字段解析错误: %+v, %v", mounts, err)
+	}
+	if _, err := parseMountInfo(strings.NewReader("36 35 98:0 /mnt1 /mnt2 rw\n")); err == nil {
+		t.Error("缺少分隔符时应返回错误")
+	}
+}
+
+// TestCgroupMode 测试 cgroup 版本识别
+func TestCgroupMode(t *testing.T) {
+	tests := map[string]CgroupMode{
+		"android-legacy": cgroupModeLegacy,
+		"android-hybrid": cgroupModeHybrid,
+		"unified":        cgroupModeUnified,
+		"no-memory":      cgroupModeLegacy,
+	}
+	for name, want := range tests {
+		if got := loadCgroupFixture(t, name).Mode(); got != want {
+			t.Errorf("%s: 期望 %s, 实际 %s", name, want, got)
+		}
+	}
+}
+
+// TestPlanCgroupMounts_AndroidLegacy 测试 Android v1 布局的挂载计划
+func TestPlanCgroupMounts_AndroidLegacy(t *testing.T) {
+	plan := planCgroupMounts(loadCgroupFixture(t, "android-legacy"), "/sys/fs/cgroup")
+
+	if plan.Layout != "v1" {
+		t.Fatalf("应使用 v1 布局, 实际: %s", plan.Layout)
+	}
+
+	var lines []string
+	for _, step := range plan.Steps {
+		lines = append(lines, step.String())
+	}
+	text := strings.Join(lines, "\n")
+
+	for _, want := range []string{
+		"umount /dev/blkio",
+		"umount /dev/cpuctl",
+		"umount /dev/cpuset",
+		"umount /dev/memcg",
+		"mount -t tmpfs -o size=4M,uid=0,gid=0,mode=0755 cgroup /sys/fs/cgroup",
+		"mount -t cgroup -o memory cgroup /sys/fs/cgroup/memory",
+		"mount -t cgroup -o cpuset cgroup /sys/fs/cgroup/cpuset  # 需要 cpuset.cpus",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("挂载计划缺少 %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "umount /acct") {
+		t.Error("不应卸载 /dev 以外的挂载")
+	}
+	if strings.Contains(text, "umount /sys/fs/cgroup") {
+		t.Error("/sys/fs/cgroup 未挂载时不需要卸载")
+	}
+
+	var missing []string
+	for _, m := range plan.Missing {
+		missing = append(missing, m.Name)
+	}
+	if strings.Join(missing, ",") != "pids" {
+		t.Errorf("缺失控制器错误: %v", missing)
+	}
+}
+
+// TestPlanCgroupMounts_Hybrid 测试 v2 没有可用控制器时回退到 v1 布局
+func TestPlanCgroupMounts_Hybrid(t *testing.T) {
+	plan := planCgroupMounts(loadCgroupFixture(t, "android-hybrid"), "/sys/fs/cgroup")
+	if plan.Layout != "v1" {
+		t.Fatalf("hybrid 应使用 v1 布局, 实际: %s", plan.Layout)
+	}
+	if plan.Steps[len(plan.Steps)-1].Target != "/sys/fs/cgroup/pids" {
+		t.Errorf("pids 控制器应被挂载: %v", plan.Steps)
+	}
+	found := false
+	for _, step := range plan.Steps {
+		if step.Action == "umount" && step.Target == "/sys/fs/cgroup" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("应先卸载 /sys/fs/cgroup 上的 cgroup2")
+	}
+}
+
+// TestPlanCgroupMounts_Unified 测试纯 cgroup v2 系统不需要挂载
+func TestPlanCgroupMounts_Unified(t *testing.T) {
+	plan := planCgroupMounts(loadCgroupFixture(t, "unified"), "/sys/fs/cgroup")
+	if plan.Layout != "v2" || len(plan.Steps) != 0 {
+		t.Fatalf("应直接使用 v2: %+v", plan)
+	}
+	if len(plan.Missing) != 0 {
+		t.Errorf("不应有缺失控制器: %v", plan.Missing)
+	}
+}
+
+// TestPlanCgroupMounts_NoMemory 测试报告缺失的 memory 控制器
+func TestPlanCgroupMounts_NoMemory(t *testing.T) {
+	plan := planCgroupMounts(loadCgroupFixture(t, "no-memory"), "/sys/fs/cgroup")
+	var feature string
+	for _, m := range plan.Missing {
+		if m.Name == "memory" {
+			feature = m.Feature
+		}
+	}
+	if !strings.Contains(feature, "--memory") {
+		t.Errorf("应报告 --memory 不可用: %v", plan.Missing)
+	}
+	for _, step := range plan.Steps {
+		if step.Options == "memory" {
+			t.Error("禁用的 memory 控制器不应挂载")
+		}
+	}
+}
+
+// fakeMounter 记录挂载操作
+type fakeMounter struct {
+	ops     []string
+	fail    map[string]bool
+	present map[string]bool
+}
+
+func (m *fakeMounter) Mount(source, target, fstype, options string) error {
+	m.ops = append(m.ops, "mount "+target)
+	if m.fail[target] {
+		return errors.New("device or resource busy")
+	}
+	return nil
+}
+
+func (m *fakeMounter) Unmount(target string) error {
+	m.ops = append(m.ops, "umount "+target)
+	if m.fail["umount "+target] {
+		return errors.New("invalid argument")
+	}
+	return nil
+}
+
+func (m *fakeMounter) MkdirAll(path string) error {
+	m.ops = append(m.ops, "mkdir "+path)
+	return nil
+}
+
+func (m *fakeMounter) Remove(path string) error {
+	m.ops = append(m.ops, "rmdir "+path)
+	return nil
+}
+
+func (m *fakeMounter) Exists(path string) bool {
+	return m.present[path]
+}
+
+// TestApplyCgroupPlan 测试执行挂载计划
+func TestApplyCgroupPlan(t *testing.T) {
+	plan := planCgroupMounts(loadCgroupFixture(t, "android-legacy"), "/sys/fs/cgroup")
+	m := &fakeMounter{
+		fail: map[string]bool{
+			"/sys/fs/cgroup/blkio": true,
+			"umount /dev/memcg":    true,
+		},
+		present: map[string]bool{},
+	}
+
+	result, err := applyCgroupPlan(plan, m)
+	if err != nil {
+		t.Fatalf("执行挂载计划失败: %v", err)
+	}
+
+	if _, ok := result.Skipped["blkio"]; !ok {
+		t.Error("挂载失败的 blkio 应被跳过")
+	}
+	// cpuset 挂载后没有 cpuset.cpus，应撤销
+	if _, ok := result.Skipped["cpuset"]; !ok {
+		t.Error("缺少 cpuset.cpus 时应撤销 cpuset 挂载")
+	}
+	if !containsString(result.Mounted, "memory") || !containsString(result.Mounted, "cpu") {
+		t.Errorf("已挂载控制器错误: %v", result.Mounted)
+	}
+	ops := strings.Join(m.ops, "\n")
+	if !strings.Contains(ops, "umount /sys/fs/cgroup/cpuset\nrmdir /sys/fs/cgroup/cpuset") {
+		t.Errorf("cpuset 应被卸载并删除目录:\n%s", ops)
+	}
+}
+
+// TestApplyCgroupPlan_RequiredFailure 测试必需步骤失败时中断
+func TestApplyCgroupPlan_RequiredFailure(t *testing.T) {
+	plan := planCgroupMounts(loadCgroupFixture(t, "android-legacy"), "/sys/fs/cgroup")
+	m := &fakeMounter{fail: map[string]bool{"/sys/fs/cgroup": true}}
+	if _, err := applyCgroupPlan(plan, m); err == nil {
+		t.Fatal("tmpfs 挂载失败时应返回错误")
+	}
+	for _, op := range m.ops {
+		if strings.HasPrefix(op, "mkdir") {
+			t.Fatal("tmpfs 挂载失败后不应继续")
+		}
+	}
+}
+
+// TestParseMountOptions 测试拆分挂载标志和文件系统参数
+func TestParseMountOptions(t *testing.T) {
+	flags, data := parseMountOptions("ro,noatime,lowerdir=/system/etc,upperdir=/u,workdir=/w")
+	if flags != syscall.MS_RDONLY|syscall.MS_NOATIME || data != "lowerdir=/system/etc,upperdir=/u,workdir=/w" {
+		t.Errorf("解析错误: %#x %q", flags, data)
+	}
+	if flags, data := parseMountOptions("rslave"); flags != syscall.MS_SLAVE|syscall.MS_REC || data != "" {
+		t.Errorf("rslave 解析错误: %#x %q", flags, data)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -42,15 +43,15 @@ func detectDiskMount() (string, error) {
 	// 定义候选的存储路径（按优先级排序）
 	candidatePaths := []string{
 		// 外接硬盘路径
-		"/mnt/media_rw",           // 外接硬盘挂载点
-		"/storage",                // 存储设备
-		"/mnt/sdcard",             // SD卡
+		"/mnt/media_rw", // 外接硬盘挂载点
+		"/storage",      // 存储设备
+		"/mnt/sdcard",   // SD卡
 		// 本地空间路径
-		"/data/local/tmp",         // 系统临时目录
-		"/data/data",              // 应用数据目录
-		"/data",                   // 系统数据分区
-		"/sdcard",                 // 内部存储
-		"/storage/emulated/0",     // 模拟存储
+		"/data/local/tmp",     // 系统临时目录
+		"/data/data",          // 应用数据目录
+		"/data",               // 系统数据分区
+		"/sdcard",             // 内部存储
+		"/storage/emulated/0", // 模拟存储
 	}
 
 	var maxFreeSpace uint64
@@ -75,8 +76,7 @@ func detectDiskMount() (string, error) {
 			continue
 		}
 
-		fmt.Printf("  检测路径: %s, 可用空间: %.2f GB\n", 
-			basePath, float64(freeSpace)/1024/1024)
+		fmt.Println(T(msgDiskCandidate, basePath, float64(freeSpace)/1024/1024))
 
 		if freeSpace > maxFreeSpace {
 			maxFreeSpace = freeSpace
@@ -89,16 +89,14 @@ func detectDiskMount() (string, error) {
 		currentDir, err := os.Getwd()
 		if err == nil {
 			if freeSpace, err := getFreeSpace(currentDir); err == nil && freeSpace > 1048576 {
-				fmt.Printf("  使用当前目录: %s, 可用空间: %.2f GB\n", 
-					currentDir, float64(freeSpace)/1024/1024)
+				fmt.Println(T(msgDiskUseCwd, currentDir, float64(freeSpace)/1024/1024))
 				return currentDir, nil
 			}
 		}
-		return "", fmt.Errorf("未找到足够的可用空间（需要至少 1GB 空间）")
+		return "", errorf(msgDiskNoSpace)
 	}
 
-	fmt.Printf("✓ 选择存储路径: %s, 可用空间: %.2f GB\n", 
-		bestPath, float64(maxFreeSpace)/1024/1024)
+	fmt.Println(T(msgDiskSelected, bestPath, float64(maxFreeSpace)/1024/1024))
 	return bestPath, nil
 }
 
@@ -107,7 +105,7 @@ func detectArchitecture() (string, error) {
 	cmd := exec.Command("uname", "-m")
 	output, err := cmd.Output()
 	if err != nil {
-		return "", fmt.Errorf("无法检测系统架构: %v", err)
+		return "", errorf(msgArchDetectFailed, err)
 	}
 
 	arch := strings.TrimSpace(string(output))
@@ -117,7 +115,7 @@ func detectArchitecture() (string, error) {
 	case "x86_64", "amd64":
 		return "x86_64", nil
 	default:
-		return "", fmt.Errorf("不支持的架构: %s", arch)
+		return "", errorf(msgArchUnsupported, arch)
 	}
 }
 
@@ -128,17 +126,17 @@ func executeScript(scriptPath string, diskRoot string) error {
 	// 创建管道来捕获标准输出和标准错误
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return fmt.Errorf("创建 stdout 管道失败: %v", err)
+		return errorf(msgScriptPipeFailed, "stdout", err)
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return fmt.Errorf("创建 stderr 管道失败: %v", err)
+		return errorf(msgScriptPipeFailed, "stderr", err)
 	}
 
 	// 启动命令
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("启动脚本失败: %v", err)
+		return errorf(msgScriptStartFailed, err)
 	}
 
 	// 实时打印输出
@@ -147,7 +145,7 @@ func executeScript(scriptPath string, diskRoot string) error {
 
 	// 等待命令完成
 	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("脚本执行失败: %v", err)
+		return errorf(msgScriptFailed, err)
 	}
 
 	return nil
@@ -169,21 +167,21 @@ func stopSupervisord() error {
 	// 检查 supervisord 文件是否存在
 	if _, err := os.Stat(supervisordPath); os.IsNotExist(err) {
 		// 文件不存在，说明是首次安装，无需停止服务
-		fmt.Println("✓ 未检测到已安装的 supervisord，跳过停止服务")
+		fmt.Println(T(msgSupervisordNotInstalled))
 		return nil
 	}
 
-	fmt.Println("⏳ 检测到已安装的 supervisord，正在停止服务...")
+	fmt.Println(T(msgSupervisordStopping))
 
 	// 执行 supervisorctl stop all
 	cmd := exec.Command(supervisordPath, "ctl", "stop", "all")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		// 如果命令执行失败，可能是 supervisord 未运行，继续执行
-		fmt.Printf("⚠ supervisorctl stop all 执行警告: %v\n", err)
-		fmt.Printf("  输出: %s\n", strings.TrimSpace(string(output)))
+		fmt.Println(T(msgSupervisordStopWarn, err))
+		fmt.Println(T(msgSupervisordOutput, strings.TrimSpace(string(output))))
 	} else {
-		fmt.Println("✓ supervisord 服务已停止")
+		fmt.Println(T(msgSupervisordStopped))
 		fmt.Printf("  %s\n", strings.TrimSpace(string(output)))
 	}
 
@@ -191,12 +189,12 @@ func stopSupervisord() error {
 	time.Sleep(2 * time.Second)
 
 	// 检查 supervisord 进程是否仍在运行，并强制终止
-	fmt.Println("⏳ 检查并终止 supervisord 进程...")
+	fmt.Println(T(msgSupervisordKilling))
 	if err := killSupervisordProcesses(); err != nil {
-		fmt.Printf("终止 supervisord 进程失败: %v，但继续运行\n", err)
+		fmt.Println(T(msgSupervisordKillFailed, err))
 	}
 
-	fmt.Println("✓ 所有 supervisord 进程已终止")
+	fmt.Println(T(msgSupervisordKilled))
 	return nil
 }
 
@@ -212,17 +210,46 @@ func killSupervisordProcesses() error {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			if exitErr.ExitCode() == 1 {
 				// 没有找到进程，这也是成功的情况
-				fmt.Println("  未检测到 supervisord 进程")
+				fmt.Println(T(msgSupervisordNoProcess))
 				return nil
 			}
 		}
 		// 其他错误
-		return fmt.Errorf("执行 pkill 失败: %v", err)
+		return errorf(msgPkillFailed, err)
 	}
 
 	// 等待进程完全终止
 	time.Sleep(1 * time.Second)
 
-	fmt.Println("  已终止所有 supervisord 进程")
+	fmt.Println(T(msgSupervisordAllKilled))
 	return nil
 }
+
+// findSupervisordProcesses 查找所有正在运行的 supervisord 进程
+func findSupervisordProcesses() ([]int, error) {
+	cmd := exec.Command("ps", "-ef")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errorf(msgPsFailed, err)
+	}
+
+	var pids []int
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.Contains(line, "supervisord") && !strings.Contains(line, "grep") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				pid, err := strconv.Atoi(fields[1])
+				if err == nil {
+					pids = append(pids, pid)
+				}
+			}
+		}
+	}
+	return pids, nil
+}
+
+// killProcess 使用 kill -9 强制终止指定 PID 的进程
+func killProcess(pid int) error {
+	cmd := exec.Command("kill", "-9", strconv.Itoa(pid))
+	return cmd.Run()
+}
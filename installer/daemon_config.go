@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DaemonConfig daemon.json 的内容，保留未知字段原样输出
+type DaemonConfig map[string]interface{}
+
+// DaemonConfigPaths daemon.json 相关文件路径
+type DaemonConfigPaths struct {
+	// Output dockerd 通过 --config-file 读取的最终文件
+	Output string
+	// Defaults 安装包自带的默认配置快照
+	Defaults string
+	// Detected 安装时根据设备探测的配置（如 storage-driver），覆盖默认配置
+	Detected string
+	// Override 用户覆盖配置，重新安装时不会被覆盖
+	Override string
+}
+
+// defaultDaemonConfigPaths 返回设备上的 daemon.json 路径
+func defaultDaemonConfigPaths() DaemonConfigPaths {
+	return daemonConfigPathsIn(filepath.Join(dockerRoot, "etc", "docker"))
+}
+
+// daemonConfigPathsIn 返回指定目录下的 daemon.json 路径
+func daemonConfigPathsIn(dir string) DaemonConfigPaths {
+	return DaemonConfigPaths{
+		Output:   filepath.Join(dir, "daemon.json"),
+		Defaults: filepath.Join(dir, "daemon.default.json"),
+		Detected: filepath.Join(dir, "daemon.detected.json"),
+		Override: filepath.Join(dir, "daemon.override.json"),
+	}
+}
+
+// daemonValueKind 已知字段的值类型
+type daemonValueKind int
+
+const (
+	daemonString daemonValueKind = iota
+	daemonBool
+	daemonStringList
+	daemonStringMap
+)
+
+// daemonKeySpec 已知字段的校验规则
+type daemonKeySpec struct {
+	kind    daemonValueKind
+	allowed []string
+	check   func(value string) error
+}
+
+// daemonKeySpecs 需要校验的 daemon.json 字段，其余字段原样透传
+var daemonKeySpecs = map[string]daemonKeySpec{
+	"log-level":           {kind: daemonString, allowed: []string{"debug", "info", "warn", "error", "fatal"}},
+	"log-driver":          {kind: daemonString, allowed: []string{"json-file", "local", "none", "syslog", "journald", "fluentd", "gelf"}},
+	"storage-driver":      {kind: daemonString, allowed: []string{"overlay2", "fuse-overlayfs", "btrfs", "zfs", "vfs"}},
+	"log-opts":            {kind: daemonStringMap},
+	"registry-mirrors":    {kind: daemonStringList, check: validateRegistryMirror},
+	"insecure-registries": {kind: daemonStringList, check: validateInsecureRegistry},
+	"iptables":            {kind: daemonBool},
+	"ip6tables":           {kind: daemonBool},
+	"ipv6":                {kind: daemonBool},
+	"live-restore":        {kind: daemonBool},
+	"experimental":        {kind: daemonBool},
+	"debug":               {kind: daemonBool},
+}
+
+// daemonForbiddenKeys 由启动命令行指定、不能出现在 daemon.json 中的字段
+// dockerd 在命令行和配置文件同时指定时会拒绝启动
+var daemonForbiddenKeys = []string{"data-root", "host", "hosts", "pidfile", "exec-root"}
+
+// loadDaemonConfigFile 读取 daemon.json 文件，文件不存在时返回空配置
+func loadDaemonConfigFile(path string) (DaemonConfig, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DaemonConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %v", path, err)
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return DaemonConfig{}, nil
+	}
+
+	cfg := DaemonConfig{}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// writeDaemonConfigFile 以缩进格式写入 daemon.json，先写临时文件再替换
+func writeDaemonConfigFile(path string, cfg DaemonConfig) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cfg); err != nil {
+		return fmt.Errorf("序列化配置失败: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("替换 %s 失败: %v", path, err)
+	}
+	return nil
+}
+
+// mergeDaemonConfig 将 overlay 合并到 base 上，返回新配置
+// 对象字段递归合并，其他类型整体替换，值为 null 表示删除该字段
+func mergeDaemonConfig(base, overlay DaemonConfig) DaemonConfig {
+	return DaemonConfig(mergeJSONObject(base, overlay))
+}
+
+func mergeJSONObject(base, overlay map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base)+len(overlay))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range overlay {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		overlayObj, ok := v.(map[string]interface{})
+		baseObj, baseOK := result[k].(map[string]interface{})
+		if ok && baseOK {
+			result[k] = mergeJSONObject(baseObj, overlayObj)
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// validateDaemonConfig 校验已知字段的类型和取值，返回所有问题
+func validateDaemonConfig(cfg DaemonConfig) error {
+	var problems []string
+
+	for _, key := range daemonForbiddenKeys {
+		if _, ok := cfg[key]; ok {
+			problems = append(problems, fmt.Sprintf("%s 由 dockerd 启动参数指定，不能写入 daemon.json", key))
+		}
+	}
+
+	keys := make([]string, 0, len(cfg))
+	for key := range cfg {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		spec, ok := daemonKeySpecs[key]
+		if !ok {
+			continue
+		}
+		if err := validateDaemonValue(spec, cfg[key]); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("daemon.json 校验失败:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func validateDaemonValue(spec daemonKeySpec, value interface{}) error {
+	switch spec.kind {
+	case daemonBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("应为 true/false")
+		}
+	case daemonString:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("应为字符串")
+		}
+		if len(spec.allowed) > 0 && !containsString(spec.allowed, s) {
+			return fmt.Errorf("不支持的值 %q（可选: %s）", s, strings.Join(spec.allowed, ", "))
+		}
+	case daemonStringList:
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("应为字符串数组")
+		}
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("数组元素应为字符串: %v", item)
+			}
+			if spec.check != nil {
+				if err := spec.check(s); err != nil {
+					return err
+				}
+			}
+		}
+	case daemonStringMap:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("应为对象")
+		}
+		for k, v := range obj {
+			if _, ok := v.(string); !ok {
+				return fmt.Errorf("%s 的值应为字符串", k)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRegistryMirror 校验镜像加速地址，必须是 http(s) URL
+func validateRegistryMirror(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("无效的镜像地址 %q: %v", value, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("镜像地址 %q 必须以 http:// 或 https:// 开头", value)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("镜像地址 %q 缺少主机名", value)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("镜像地址 %q 不能包含查询参数、片段或认证信息", value)
+	}
+	return nil
+}
+
+// validateInsecureRegistry 校验非安全仓库地址，支持 host[:port] 或 CIDR
+func validateInsecureRegistry(value string) error {
+	if strings.Contains(value, "://") {
+		return fmt.Errorf("非安全仓库 %q 不能包含协议前缀", value)
+	}
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return nil
+	}
+	host := value
+	if h, port, err := net.SplitHostPort(value); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("非安全仓库 %q 端口无效", value)
+		}
+		host = h
+	}
+	if host == "" || strings.ContainsAny(host, "/ ") {
+		return fmt.Errorf("无效的非安全仓库地址 %q", value)
+	}
+	return nil
+}
+
+// loadEffectiveDaemonConfig 读取默认配置、探测配置和用户覆盖配置并合并，优先级依次升高
+// 返回的 defaults 已包含探测配置；旧版本安装没有默认配置快照时，使用当前 daemon.json 作为默认值
+func loadEffectiveDaemonConfig(paths DaemonConfigPaths) (defaults, override, merged DaemonConfig, err error) {
+	defaultsPath := paths.Defaults
+	if !fileExists(defaultsPath) {
+		defaultsPath = paths.Output
+	}
+	defaults, err = loadDaemonConfigFile(defaultsPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if paths.Detected != "" {
+		detected, err := loadDaemonConfigFile(paths.Detected)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		defaults = mergeDaemonConfig(defaults, detected)
+	}
+	override, err = loadDaemonConfigFile(paths.Override)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return defaults, override, mergeDaemonConfig(defaults, override), nil
+}
+
+// snapshotDaemonDefaults 保存安装包自带的 daemon.json 作为默认配置
+// 在解压安装包之后调用，此时 daemon.json 是刚解压的默认内容
+func snapshotDaemonDefaults(paths DaemonConfigPaths) error {
+	cfg, err := loadDaemonConfigFile(paths.Output)
+	if err != nil {
+		return err
+	}
+	return writeDaemonConfigFile(paths.Defaults, cfg)
+}
+
+// saveDetectedDaemonConfig 保存探测配置，每次安装整体替换旧的结果
+func saveDetectedDaemonConfig(paths DaemonConfigPaths, detected DaemonConfig) error {
+	return writeDaemonConfigFile(paths.Detected, detected)
+}
+
+// applyDaemonConfig 合并默认配置和用户配置，校验后写入 daemon.json
+func applyDaemonConfig(paths DaemonConfigPaths) (DaemonConfig, error) {
+	_, _, merged, err := loadEffectiveDaemonConfig(paths)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDaemonConfig(merged); err != nil {
+		return nil, err
+	}
+	if err := writeDaemonConfigFile(paths.Output, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// parseDaemonValue 将命令行参数转换为字段值
+func parseDaemonValue(key string, args []string) (interface{}, error) {
+	spec, known := daemonKeySpecs[key]
+	if known && spec.kind == daemonStringList {
+		list := make([]interface{}, 0, len(args))
+		for _, arg := range args {
+			list = append(list, arg)
+		}
+		return list, nil
+	}
+
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s 只接受一个值", key)
+	}
+	raw := args[0]
+
+	if known {
+		switch spec.kind {
+		case daemonString:
+			return raw, nil
+		case daemonBool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s 应为 true/false", key)
+			}
+			return b, nil
+		}
+	}
+
+	// 其他字段优先按 JSON 解析，失败时作为字符串
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		return v, nil
+	}
+	return raw, nil
+}
+
+// daemonStringListValue 读取字符串数组字段
+func daemonStringListValue(cfg DaemonConfig, key string) []string {
+	list, _ := cfg[key].([]interface{})
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "config",
+		usage: msgUsageConfig,
+		run:   runConfigCommand,
+	})
+}
+
+// runConfigCommand 实现 config 子命令
+func runConfigCommand(args []string) error {
+	return runConfigCommandWithPaths(defaultDaemonConfigPaths(), args)
+}
+
+func runConfigCommandWithPaths(paths DaemonConfigPaths, args []string) error {
+	if len(args) == 0 {
+		args = []string{"show"}
+	}
+	action, args := args[0], args[1:]
+
+	defaults, override, merged, err := loadEffectiveDaemonConfig(paths)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "show":
+		return printJSON(merged)
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("用法: config get <key>")
+		}
+		value, ok := merged[args[0]]
+		if !ok {
+			return fmt.Errorf("未设置: %s", args[0])
+		}
+		return printJSON(value)
+	case "set":
+		if len(args) < 2 {
+			return fmt.Errorf("用法: config set <key> <value>...")
+		}
+		value, err := parseDaemonValue(args[0], args[1:])
+		if err != nil {
+			return err
+		}
+		override[args[0]] = value
+	case "add", "remove":
+		if len(args) < 2 {
+			return fmt.Errorf("用法: config %s <key> <value>...", action)
+		}
+		key := args[0]
+		if spec, ok := daemonKeySpecs[key]; !ok || spec.kind != daemonStringList {
+			return fmt.Errorf("%s 不是数组字段", key)
+		}
+		current := daemonStringListValue(merged, key)
+		var updated []interface{}
+		if action == "add" {
+			for _, s := range current {
+				updated = append(updated, s)
+			}
+			for _, s := range args[1:] {
+				if !containsString(current, s) {
+					updated = append(updated, s)
+				}
+			}
+		} else {
+			for _, s := range current {
+				if !containsString(args[1:], s) {
+					updated = append(updated, s)
+				}
+			}
+		}
+		if updated == nil {
+			updated = []interface{}{}
+		}
+		override[key] = updated
+	case "unset":
+		if len(args) != 1 {
+			return fmt.Errorf("用法: config unset <key>")
+		}
+		delete(override, args[0])
+	case "delete":
+		// 默认配置中的字段不能通过 unset 去掉，在用户配置中写入 null 表示删除
+		if len(args) != 1 {
+			return fmt.Errorf("用法: config delete <key>")
+		}
+		if _, ok := merged[args[0]]; !ok {
+			return fmt.Errorf("未设置: %s", args[0])
+		}
+		override[args[0]] = nil
+	default:
+		return fmt.Errorf("未知操作: %s", action)
+	}
+
+	// 先校验合并结果，避免写入无效的用户配置
+	if err := validateDaemonConfig(mergeDaemonConfig(defaults, override)); err != nil {
+		return err
+	}
+
+	// 首次修改时保存默认配置快照，防止 daemon.json 被合并结果覆盖后丢失默认值
+	if !fileExists(paths.Defaults) {
+		if err := writeDaemonConfigFile(paths.Defaults, defaults); err != nil {
+			return err
+		}
+	}
+	if err := writeDaemonConfigFile(paths.Override, override); err != nil {
+		return err
+	}
+	if _, err := applyDaemonConfig(paths); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ 已更新 %s\n", paths.Output)
+	fmt.Println("  重启 dockerd 后生效: supervisord ctl restart dockerd")
+	return nil
+}
+
+// printJSON 以缩进格式输出 JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
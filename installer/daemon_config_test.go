@@ -0,0 +1,251 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testShippedDaemonJSON = `{ "iptables": false, "ip6tables": false, "registry-mirrors": [ "https:\/\/registry.linkease.net:5443" ], "log-level": "warn", "log-driver": "json-file", "log-opts": { "max-size": "50m", "max-file": "2" } }`
+
+// setupDaemonConfigDir 创建模拟安装后的 etc/docker 目录
+func setupDaemonConfigDir(t *testing.T) DaemonConfigPaths {
+	t.Helper()
+	paths := daemonConfigPathsIn(t.TempDir())
+	if err := os.WriteFile(paths.Output, []byte(testShippedDaemonJSON), 0644); err != nil {
+		t.Fatalf("创建 daemon.json 失败: %v", err)
+	}
+	return paths
+}
+
+// TestMergeDaemonConfig 测试配置合并
+func TestMergeDaemonConfig(t *testing.T) {
+	base := DaemonConfig{
+		"log-level": "warn",
+		"log-opts":  map[string]interface{}{"max-size": "50m", "max-file": "2"},
+		"iptables":  false,
+	}
+	overlay := DaemonConfig{
+		"log-level": "info",
+		"log-opts":  map[string]interface{}{"max-file": "5"},
+		"iptables":  nil,
+	}
+
+	merged := mergeDaemonConfig(base, overlay)
+
+	if merged["log-level"] != "info" {
+		t.Errorf("log-level 应被覆盖为 info, 实际: %v", merged["log-level"])
+	}
+	opts := merged["log-opts"].(map[string]interface{})
+	if opts["max-size"] != "50m" || opts["max-file"] != "5" {
+		t.Errorf("log-opts 合并错误: %v", opts)
+	}
+	if _, ok := merged["iptables"]; ok {
+		t.Error("值为 null 的字段应被删除")
+	}
+	if base["log-level"] != "warn" {
+		t.Error("合并不应修改原配置")
+	}
+}
+
+// TestValidateDaemonConfig 测试字段校验
+func TestValidateDaemonConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     DaemonConfig
+		wantErr string
+	}{
+		{
+			name: "合法配置",
+			cfg: DaemonConfig{
+				"log-driver":          "json-file",
+				"storage-driver":      "overlay2",
+				"registry-mirrors":    []interface{}{"https://mirror.example.com"},
+				"insecure-registries": []interface{}{"192.168.1.10:5000", "10.0.0.0/8", "registry.lan"},
+				"iptables":            false,
+				"unknown-key":         42,
+			},
+		},
+		{name: "data-root 不允许", cfg: DaemonConfig{"data-root": "/data"}, wantErr: "data-root"},
+		{name: "未知日志驱动", cfg: DaemonConfig{"log-driver": "awslogs2"}, wantErr: "log-driver"},
+		{name: "存储驱动类型错误", cfg: DaemonConfig{"storage-driver": 1}, wantErr: "storage-driver"},
+		{name: "镜像地址缺少协议", cfg: DaemonConfig{"registry-mirrors": []interface{}{"mirror.example.com"}}, wantErr: "registry-mirrors"},
+		{name: "镜像地址不是数组", cfg: DaemonConfig{"registry-mirrors": "https://mirror.example.com"}, wantErr: "registry-mirrors"},
+		{name: "非安全仓库带协议", cfg: DaemonConfig{"insecure-registries": []interface{}{"http://registry.lan"}}, wantErr: "insecure-registries"},
+		{name: "布尔字段类型错误", cfg: DaemonConfig{"iptables": "false"}, wantErr: "iptables"},
+		{name: "log-opts 值必须是字符串", cfg: DaemonConfig{"log-opts": map[string]interface{}{"max-file": 2}}, wantErr: "log-opts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDaemonConfig(tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("不应返回错误: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("错误应包含 %q, 实际: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestApplyDaemonConfig_PreservesOverride 测试重新安装后用户配置不丢失
+func TestApplyDaemonConfig_PreservesOverride(t *testing.T) {
+	paths := setupDaemonConfigDir(t)
+	if err := os.WriteFile(paths.Override, []byte(`{"log-level": "debug"}`), 0644); err != nil {
+		t.Fatalf("写入用户配置失败: %v", err)
+	}
+
+	// 模拟重新安装：安装包覆盖 daemon.json 后重新合并
+	if err := snapshotDaemonDefaults(paths); err != nil {
+		t.Fatalf("保存默认配置失败: %v", err)
+	}
+	merged, err := applyDaemonConfig(paths)
+	if err != nil {
+		t.Fatalf("生成 daemon.json 失败: %v", err)
+	}
+	if merged["log-level"] != "debug" {
+		t.Errorf("用户配置未生效: %v", merged["log-level"])
+	}
+
+	content, err := os.ReadFile(paths.Output)
+	if err != nil {
+		t.Fatalf("读取 daemon.json 失败: %v", err)
+	}
+	if !strings.Contains(string(content), "\n  \"log-level\": \"debug\"") {
+		t.Errorf("daemon.json 应为缩进格式:\n%s", content)
+	}
+	if strings.Contains(string(content), `\/`) {
+		t.Errorf("daemon.json 不应包含转义的斜杠:\n%s", content)
+	}
+}
+
+// TestApplyDaemonConfig_Invalid 测试无效配置不会写入 daemon.json
+func TestApplyDaemonConfig_Invalid(t *testing.T) {
+	paths := setupDaemonConfigDir(t)
+	if err := os.WriteFile(paths.Override, []byte(`{"data-root": "/mnt/disk"}`), 0644); err != nil {
+		t.Fatalf("写入用户配置失败: %v", err)
+	}
+
+	if _, err := applyDaemonConfig(paths); err == nil {
+		t.Fatal("期望校验失败")
+	}
+	content, _ := os.ReadFile(paths.Output)
+	if string(content) != testShippedDaemonJSON {
+		t.Error("校验失败时不应修改 daemon.json")
+	}
+}
+
+// TestConfigCommand 测试 config 子命令修改镜像地址
+func TestConfigCommand(t *testing.T) {
+	paths := setupDaemonConfigDir(t)
+
+	steps := [][]string{
+		{"add", "registry-mirrors", "https://mirror.example.com"},
+		{"set", "insecure-registries", "192.168.1.10:5000"},
+		{"set", "log-level", "info"},
+		{"remove", "registry-mirrors", "https://registry.linkease.net:5443"},
+	}
+	for _, args := range steps {
+		if err := runConfigCommandWithPaths(paths, args); err != nil {
+			t.Fatalf("config %v 失败: %v", args, err)
+		}
+	}
+
+	cfg, err := loadDaemonConfigFile(paths.Output)
+	if err != nil {
+		t.Fatalf("读取 daemon.json 失败: %v", err)
+	}
+	mirrors := daemonStringListValue(cfg, "registry-mirrors")
+	if len(mirrors) != 1 || mirrors[0] != "https://mirror.example.com" {
+		t.Errorf("registry-mirrors 错误: %v", mirrors)
+	}
+	if insecure := daemonStringListValue(cfg, "insecure-registries"); len(insecure) != 1 {
+		t.Errorf("insecure-registries 错误: %v", insecure)
+	}
+	if cfg["log-level"] != "info" {
+		t.Errorf("log-level 错误: %v", cfg["log-level"])
+	}
+
+	// 默认配置快照应保留安装包的原始值
+	defaults, err := loadDaemonConfigFile(paths.Defaults)
+	if err != nil {
+		t.Fatalf("读取默认配置失败: %v", err)
+	}
+	if defaults["log-level"] != "warn" {
+		t.Errorf("默认配置被修改: %v", defaults["log-level"])
+	}
+
+	// unset 后恢复默认值
+	if err := runConfigCommandWithPaths(paths, []string{"unset", "log-level"}); err != nil {
+		t.Fatalf("config unset 失败: %v", err)
+	}
+	cfg, _ = loadDaemonConfigFile(paths.Output)
+	if cfg["log-level"] != "warn" {
+		t.Errorf("unset 后应恢复默认值, 实际: %v", cfg["log-level"])
+	}
+
+	// delete 删除默认配置中的字段，unset 后恢复
+	if err := runConfigCommandWithPaths(paths, []string{"delete", "log-level"}); err != nil {
+		t.Fatalf("config delete 失败: %v", err)
+	}
+	cfg, _ = loadDaemonConfigFile(paths.Output)
+	if _, ok := cfg["log-level"]; ok {
+		t.Errorf("delete 后不应有 log-level: %v", cfg["log-level"])
+	}
+	if err := runConfigCommandWithPaths(paths, []string{"delete", "log-level"}); err == nil {
+		t.Error("删除未设置的字段应返回错误")
+	}
+	if err := runConfigCommandWithPaths(paths, []string{"unset", "log-level"}); err != nil {
+		t.Fatalf("config unset 失败: %v", err)
+	}
+	cfg, _ = loadDaemonConfigFile(paths.Output)
+	if cfg["log-level"] != "warn" {
+		t.Errorf("unset 后应恢复默认值, 实际: %v", cfg["log-level"])
+	}
+}
+
+// TestConfigCommand_RejectsInvalid 测试无效值不会写入用户配置
+func TestConfigCommand_RejectsInvalid(t *testing.T) {
+	paths := setupDaemonConfigDir(t)
+
+	if err := runConfigCommandWithPaths(paths, []string{"set", "registry-mirrors", "not a url"}); err == nil {
+		t.Fatal("期望无效镜像地址被拒绝")
+	}
+	if err := runConfigCommandWithPaths(paths, []string{"set", "data-root", "/mnt/disk"}); err == nil {
+		t.Fatal("期望 data-root 被拒绝")
+	}
+	if _, err := os.Stat(paths.Override); !os.IsNotExist(err) {
+		t.Error("校验失败时不应写入用户配置")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(paths.Output), "daemon.json.tmp")); !os.IsNotExist(err) {
+		t.Error("不应残留临时文件")
+	}
+}
+
+// TestParseDaemonValue 测试命令行值解析
+func TestParseDaemonValue(t *testing.T) {
+	v, err := parseDaemonValue("iptables", []string{"true"})
+	if err != nil || v != true {
+		t.Errorf("布尔值解析错误: %v, %v", v, err)
+	}
+	if _, err := parseDaemonValue("iptables", []string{"yes-please"}); err == nil {
+		t.Error("无效布尔值应返回错误")
+	}
+	v, _ = parseDaemonValue("registry-mirrors", []string{"https://a", "https://b"})
+	if list, ok := v.([]interface{}); !ok || len(list) != 2 {
+		t.Errorf("数组解析错误: %v", v)
+	}
+	v, _ = parseDaemonValue("default-ulimits", []string{`{"nofile":{"Name":"nofile","Hard":65536,"Soft":65536}}`})
+	if _, ok := v.(map[string]interface{}); !ok {
+		t.Errorf("未知字段应按 JSON 解析: %v", v)
+	}
+	v, _ = parseDaemonValue("bip", []string{"172.18.0.1/16"})
+	if v != "172.18.0.1/16" {
+		t.Errorf("非 JSON 值应作为字符串: %v", v)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// dataDiskPath 安装时记录的数据盘信息
+	dataDiskPath = dockerRoot + "/etc/data-disk.json"
+	// degradedMarkerPath 以降级模式启动时写入原因，重启后随 var 的 tmpfs 清除
+	degradedMarkerPath = dockerRoot + "/var/run/data-degraded"
+
+	// defaultDataDiskWait 开机时等待数据盘挂载的默认时间
+	defaultDataDiskWait  = 90 * time.Second
+	dataDiskPollInterval = 2 * time.Second
+
+	// 找不到数据盘时的处理方式
+	dataPolicyRefuse   = "refuse"
+	dataPolicyDegraded = "degraded"
+
+	// ext4 超级块位于设备偏移 1024 处
+	ext4SuperblockOffset = 1024
+	ext4MagicOffset      = 0x38
+	ext4UUIDOffset       = 0x68
+	ext4Magic            = 0xEF53
+)
+
+// DiskIdentity 数据盘的挂载信息，用于开机时确认挂载的是同一块盘
+type DiskIdentity struct {
+	Root       string `json:"root"`
+	MountPoint string `json:"mount_point"`
+	Source     string `json:"source"`
+	FSType     string `json:"fstype"`
+	UUID       string `json:"uuid,omitempty"`
+}
+
+// mountFor 返回包含 path 的最深挂载点
+func mountFor(mounts []MountInfo, path string) *MountInfo {
+	path = filepath.Clean(path)
+	var best *MountInfo
+	for i := range mounts {
+		mp := mounts[i].MountPoint
+		if path != mp && !strings.HasPrefix(path, strings.TrimSuffix(mp, "/")+"/") {
+			continue
+		}
+		// 同一挂载点被多次挂载时以最后一次为准
+		if best == nil || len(mp) >= len(best.MountPoint) {
+			best = &mounts[i]
+		}
+	}
+	return best
+}
+
+// readExt4UUID 从块设备的超级块读取 ext4 文件系统 UUID
+func readExt4UUID(device string) (string, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sb := make([]byte, ext4UUIDOffset+16)
+	if _, err := f.ReadAt(sb, ext4SuperblockOffset); err != nil {
+		return "", fmt.Errorf("读取 %s 超级块失败: %v", device, err)
+	}
+	if binary.LittleEndian.Uint16(sb[ext4MagicOffset:]) != ext4Magic {
+		return "", fmt.Errorf("%s 不是 ext4 文件系统", device)
+	}
+	u := sb[ext4UUIDOffset : ext4UUIDOffset+16]
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
+
+// identifyDisk 根据挂载信息生成 root 所在磁盘的标识，只有 ext4 会读取 UUID
+func identifyDisk(root string, mounts []MountInfo, readUUID func(string) (string, error)) (*DiskIdentity, error) {
+	m := mountFor(mounts, root)
+	if m == nil {
+		return nil, fmt.Errorf("找不到 %s 的挂载点", root)
+	}
+	id := &DiskIdentity{Root: filepath.Clean(root), MountPoint: m.MountPoint, Source: m.Source, FSType: m.FSType}
+	if m.FSType == "ext4" {
+		uuid, err := readUUID(m.Source)
+		if err != nil {
+			return nil, err
+		}
+		id.UUID = uuid
+	}
+	return id, nil
+}
+
+// loadDiskIdentity 读取数据盘记录，文件不存在时返回 nil
+func loadDiskIdentity(path string) (*DiskIdentity, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var id DiskIdentity
+	if err := json.Unmarshal(data, &id); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", path, err)
+	}
+	return &id, nil
+}
+
+// saveDiskIdentity 保存数据盘记录
+func saveDiskIdentity(path string, id *DiskIdentity) error {
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// recordDataDisk 安装时记录 diskRoot 所在的磁盘
+func recordDataDisk(diskRoot string) (*DiskIdentity, error) {
+	mounts, err := readMountInfo()
+	if err != nil {
+		return nil, err
+	}
+	id, err := identifyDisk(diskRoot, mounts, readExt4UUID)
+	if err != nil {
+		return nil, err
+	}
+	return id, saveDiskIdentity(dataDiskPath, id)
+}
+
+// readMountInfo 读取当前命名空间的挂载信息
+func readMountInfo() ([]MountInfo, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMountInfo(f)
+}
+
+// diskMismatchError 挂载点上是另一块盘
+type diskMismatchError struct {
+	mountPoint, want, got string
+}
+
+func (e *diskMismatchError) Error() string {
+	return fmt.Sprintf("%s 上挂载的磁盘 UUID %s 与安装时记录的 %s 不一致", e.mountPoint, e.got, e.want)
+}
+
+// verifyDataDisk 检查 diskRoot 是否已挂载且是安装时记录的磁盘
+// id 为 nil（旧版本安装）时只检查数据目录是否存在
+func verifyDataDisk(diskRoot, dataRoot string, id *DiskIdentity, mounts []MountInfo, exists func(string) bool, readUUID func(string) (string, error)) error {
+	if id == nil || id.Root != filepath.Clean(diskRoot) {
+		if !exists(dataRoot) {
+			return fmt.Errorf("数据目录 %s 不存在", dataRoot)
+		}
+		return nil
+	}
+
+	m := mountFor(mounts, diskRoot)
+	if m == nil || m.MountPoint != id.MountPoint {
+		return fmt.Errorf("%s 未挂载", id.MountPoint)
+	}
+	if id.UUID != "" {
+		uuid, err := readUUID(m.Source)
+		if err != nil {
+			return err
+		}
+		if uuid != id.UUID {
+			return &diskMismatchError{mountPoint: id.MountPoint, want: id.UUID, got: uuid}
+		}
+	}
+	if !exists(dataRoot) {
+		return fmt.Errorf("数据目录 %s 不存在", dataRoot)
+	}
+	return nil
+}
+
+// dataDiskWaiter 开机时等待数据盘挂载
+type dataDiskWaiter struct {
+	diskRoot string
+	dataRoot string
+	identity *DiskIdentity
+	timeout  time.Duration
+	interval time.Duration
+
+	loadMounts func() ([]MountInfo, error)
+	exists     func(string) bool
+	readUUID   func(string) (string, error)
+}
+
+// Wait 轮询直到数据盘通过校验或超时，返回最后读取的挂载信息
+// UUID 不一致说明插错了盘，不需要继续等待
+func (w *dataDiskWaiter) Wait() ([]MountInfo, error) {
+	deadline := time.Now().Add(w.timeout)
+	for {
+		mounts, err := w.loadMounts()
+		if err != nil {
+			return nil, err
+		}
+		err = verifyDataDisk(w.diskRoot, w.dataRoot, w.identity, mounts, w.exists, w.readUUID)
+		if _, wrongDisk := err.(*diskMismatchError); err == nil || wrongDisk {
+			return mounts, err
+		}
+		if !time.Now().Before(deadline) {
+			return mounts, fmt.Errorf("等待 %s 超时: %v", w.timeout, err)
+		}
+		time.Sleep(w.interval)
+	}
+}
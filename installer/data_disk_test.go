@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeExt4Image 生成只包含超级块的 ext4 镜像
+func writeExt4Image(t *testing.T, uuid []byte) string {
+	t.Helper()
+	img := make([]byte, 4096)
+	binary.LittleEndian.PutUint16(img[ext4SuperblockOffset+ext4MagicOffset:], ext4Magic)
+	copy(img[ext4SuperblockOffset+ext4UUIDOffset:], uuid)
+	path := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(path, img, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestReadExt4UUID 测试从超级块读取 UUID
+func TestReadExt4UUID(t *testing.T) {
+	uuid := []byte{0x3e, 0x6b, 0xe9, 0xde, 0x81, 0x39, 0x4a, 0x14, 0x9a, 0x8b, 0x2b, 0x60, 0x1c, 0x1a, 0x2a, 0xf5}
+	got, err := readExt4UUID(writeExt4Image(t, uuid))
+	if err != nil {
+		t.Fatalf("读取 UUID 失败: %v", err)
+	}
+	if got != "3e6be9de-8139-4a14-9a8b-2b601c1a2af5" {
+		t.Errorf("UUID 错误: %s", got)
+	}
+
+	vfat := filepath.Join(t.TempDir(), "vfat.img")
+	os.WriteFile(vfat, make([]byte, 4096), 0644)
+	if _, err := readExt4UUID(vfat); err == nil {
+		t.Error("非 ext4 应返回错误")
+	}
+}
+
+// TestIdentifyDisk 测试记录数据盘所在的挂载
+func TestIdentifyDisk(t *testing.T) {
+	mounts := loadCgroupFixture(t, "android-legacy").Mounts
+	readUUID := func(dev string) (string, error) { return "uuid-" + dev, nil }
+
+	id, err := identifyDisk("/mnt/media_rw/0A1B-2C3D/", mounts, readUUID)
+	if err != nil {
+		t.Fatalf("识别失败: %v", err)
+	}
+	if id.MountPoint != "/mnt/media_rw/0A1B-2C3D" || id.UUID != "uuid-/dev/block/vold/public:259,1" {
+		t.Errorf("识别结果错误: %+v", id)
+	}
+
+	id, err = identifyDisk("/mnt/media_rw/My Disk/docker", mounts, readUUID)
+	if err != nil || id.FSType != "vfat" || id.UUID != "" {
+		t.Errorf("非 ext4 不应读取 UUID: %+v, %v", id, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "etc", "data-disk.json")
+	if err := saveDiskIdentity(path, id); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadDiskIdentity(path)
+	if err != nil || *loaded != *id {
+		t.Errorf("保存后读取不一致: %+v, %v", loaded, err)
+	}
+	if loaded, err := loadDiskIdentity(filepath.Join(t.TempDir(), "missing.json")); loaded != nil || err != nil {
+		t.Errorf("文件不存在时应返回 nil: %+v, %v", loaded, err)
+	}
+}
+
+// TestVerifyDataDisk 测试开机时的数据盘校验
+func TestVerifyDataDisk(t *testing.T) {
+	mounts := loadCgroupFixture(t, "android-legacy").Mounts
+	id := &DiskIdentity{Root: "/mnt/media_rw/0A1B-2C3D", MountPoint: "/mnt/media_rw/0A1B-2C3D", UUID: "good"}
+	dataRoot := "/mnt/media_rw/0A1B-2C3D/opt/dockerd/docker"
+	exists := func(string) bool { return true }
+	uuidIs := func(uuid string) func(string) (string, error) {
+		return func(string) (string, error) { return uuid, nil }
+	}
+
+	if err := verifyDataDisk(id.Root, dataRoot, id, mounts, exists, uuidIs("good")); err != nil {
+		t.Errorf("同一块盘应通过校验: %v", err)
+	}
+
+	err := verifyDataDisk(id.Root, dataRoot, id, mounts, exists, uuidIs("other"))
+	if _, ok := err.(*diskMismatchError); !ok {
+		t.Errorf("UUID 不一致应返回 diskMismatchError: %v", err)
+	}
+
+	// 硬盘未挂载时路径落在 /mnt/media_rw 的 tmpfs 上
+	unmounted := []MountInfo{{MountPoint: "/"}, {MountPoint: "/mnt/media_rw", FSType: "tmpfs"}}
+	if err := verifyDataDisk(id.Root, dataRoot, id, unmounted, exists, uuidIs("good")); err == nil || !strings.Contains(err.Error(), "未挂载") {
+		t.Errorf("未挂载时应返回错误: %v", err)
+	}
+
+	// 旧版本安装没有记录，只检查数据目录
+	if err := verifyDataDisk(id.Root, dataRoot, nil, unmounted, func(string) bool { return false }, nil); err == nil {
+		t.Error("数据目录不存在时应返回错误")
+	}
+}
+
+// TestDataDiskWaiter 测试等待硬盘挂载和超时
+func TestDataDiskWaiter(t *testing.T) {
+	mounted := loadCgroupFixture(t, "android-legacy").Mounts
+	unmounted := []MountInfo{{MountPoint: "/"}, {MountPoint: "/mnt/media_rw", FSType: "tmpfs"}}
+
+	polls := 0
+	w := &dataDiskWaiter{
+		diskRoot: "/mnt/media_rw/0A1B-2C3D",
+		dataRoot: "/mnt/media_rw/0A1B-2C3D/opt/dockerd/docker",
+		identity: &DiskIdentity{Root: "/mnt/media_rw/0A1B-2C3D", MountPoint: "/mnt/media_rw/0A1B-2C3D", UUID: "good"},
+		timeout:  time.Second,
+		interval: time.Millisecond,
+		loadMounts: func() ([]MountInfo, error) {
+			polls++
+			if polls < 3 {
+				return unmounted, nil
+			}
+			return mounted, nil
+		},
+		exists:   func(string) bool { return true },
+		readUUID: func(string) (string, error) { return "good", nil },
+	}
+	if _, err := w.Wait(); err != nil || polls != 3 {
+		t.Errorf("硬盘挂载后应通过: polls=%d err=%v", polls, err)
+	}
+
+	// UUID 不一致时立即返回
+	polls = 0
+	w.readUUID = func(string) (string, error) { return "other", nil }
+	if _, err := w.Wait(); err == nil || polls != 3 {
+		t.Errorf("插错盘时应立即失败: polls=%d err=%v", polls, err)
+	}
+
+	w.timeout = 5 * time.Millisecond
+	w.loadMounts = func() ([]MountInfo, error) { return unmounted, nil }
+	if _, err := w.Wait(); err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Errorf("应返回超时错误: %v", err)
+	}
+
+	w.loadMounts = func() ([]MountInfo, error) { return nil, errors.New("permission denied") }
+	if _, err := w.Wait(); err == nil {
+		t.Error("读取挂载信息失败时应返回错误")
+	}
+}
+
+// TestDataDiskTimeout 测试等待时间的优先级
+func TestDataDiskTimeout(t *testing.T) {
+	if got := dataDiskTimeout(5*time.Second, "30"); got != 5*time.Second {
+		t.Errorf("参数应优先: %s", got)
+	}
+	if got := dataDiskTimeout(0, "30"); got != 30*time.Second {
+		t.Errorf("应使用 DATA_ROOT_WAIT: %s", got)
+	}
+	if got := dataDiskTimeout(0, ""); got != defaultDataDiskWait {
+		t.Errorf("应使用默认值: %s", got)
+	}
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// doctorMinFreeKB 数据盘可用空间低于此值时检查失败（1GB）
+	doctorMinFreeKB = 1024 * 1024
+	// doctorLowFreeKB 数据盘可用空间低于此值时给出警告（5GB）
+	doctorLowFreeKB = 5 * 1024 * 1024
+	// doctorHTTPTimeout 网络检查的超时
+	doctorHTTPTimeout = 10 * time.Second
+	// defaultRegistry 没有配置镜像时 dockerd 拉取镜像的地址
+	defaultRegistry = "https://registry-1.docker.io"
+)
+
+// CheckStatus 检查结果
+type CheckStatus string
+
+const (
+	checkPass CheckStatus = "pass"
+	checkWarn CheckStatus = "warn"
+	checkFail CheckStatus = "fail"
+)
+
+// CheckResult 一项检查的结果，Remedy 为解决方法
+type CheckResult struct {
+	ID      string      `json:"id"`
+	Title   string      `json:"title"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+	Remedy  string      `json:"remedy,omitempty"`
+}
+
+// passed、warned 和 failed 生成检查结果，Message 按 key 翻译，remedy 由调用方用 T 翻译好
+
+func passed(key msgKey, args ...interface{}) CheckResult {
+	return CheckResult{Status: checkPass, Message: T(key, args...)}
+}
+
+func warned(remedy string, key msgKey, args ...interface{}) CheckResult {
+	return CheckResult{Status: checkWarn, Message: T(key, args...), Remedy: remedy}
+}
+
+func failed(remedy string, key msgKey, args ...interface{}) CheckResult {
+	return CheckResult{Status: checkFail, Message: T(key, args...), Remedy: remedy}
+}
+
+// doctorEnv 检查使用的系统接口，测试时替换为 fixture
+type doctorEnv struct {
+	// root docker 安装目录
+	root string
+	// sysRoot 读取 proc 和 sys 文件的根目录，"/" 时读取本机
+	sysRoot string
+	runner  CommandRunner
+	uid     int
+	arch    func() (string, error)
+	freeKB  func(path string) (uint64, error)
+	// dockerd 通过 docker.sock 访问 dockerd 的客户端
+	dockerd *http.Client
+	// http 访问下载服务器和镜像仓库的客户端，为 nil 时跳过网络检查
+	http *http.Client
+	now  func() time.Time
+}
+
+// newDoctorEnv 返回检查本机使用的环境
+func newDoctorEnv(offline bool) *doctorEnv {
+	env := &doctorEnv{
+		root:    dockerRoot,
+		sysRoot: "/",
+		runner:  execRunner{},
+		uid:     os.Getuid(),
+		arch:    detectArchitecture,
+		freeKB:  getFreeSpace,
+		dockerd: newUnixHTTPClient(dockerSocketPath, dockerdPingTimeout),
+		now:     time.Now,
+	}
+	if !offline {
+		env.http = &http.Client{Transport: CreateTimeoutTransport(doctorHTTPTimeout), Timeout: doctorHTTPTimeout}
+	}
+	return env
+}
+
+func (e *doctorEnv) sysPath(path string) string {
+	return filepath.Join(e.sysRoot, path)
+}
+
+// healthCheck 一项检查，Run 只需填写 Status、Message 和 Remedy
+type healthCheck struct {
+	ID    string
+	Title msgKey
+	Run   func(env *doctorEnv) CheckResult
+}
+
+// healthChecks 已注册的检查，按注册顺序执行
+var healthChecks []*healthCheck
+
+// registerCheck 注册检查，各模块可以在 init 中添加自己的检查
+func registerCheck(c *healthCheck) {
+	healthChecks = append(healthChecks, c)
+}
+
+// runChecks 执行 ids 指定的检查，ids 为空时执行全部
+func runChecks(env *doctorEnv, ids []string) ([]CheckResult, error) {
+	selected := healthChecks
+	if len(ids) > 0 {
+		selected = nil
+		for _, id := range ids {
+			c := findCheck(id)
+			if c == nil {
+				return nil, errorf(msgDoctorUnknownCheck, id)
+			}
+			selected = append(selected, c)
+		}
+	}
+	results := make([]CheckResult, 0, len(selected))
+	for _, c := range selected {
+		r := c.Run(env)
+		r.ID, r.Title = c.ID, T(c.Title)
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func findCheck(id string) *healthCheck {
+	for _, c := range healthChecks {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func init() {
+	registerCheck(&healthCheck{ID: "root", Title: msgCheckRoot, Run: checkRoot})
+	registerCheck(&healthCheck{ID: "arch", Title: msgCheckArch, Run: checkArch})
+	registerCheck(&healthCheck{ID: "kernel", Title: msgCheckKernel, Run: checkKernelConfig})
+	registerCheck(&healthCheck{ID: "cgroup", Title: msgCheckCgroup, Run: checkCgroup})
+	registerCheck(&healthCheck{ID: "data-disk", Title: msgCheckDataDisk, Run: checkDataDisk})
+	registerCheck(&healthCheck{ID: "install", Title: msgCheckInstall, Run: checkInstallDir})
+	registerCheck(&healthCheck{ID: "supervisord", Title: msgCheckSupervisord, Run: checkSupervisord})
+	registerCheck(&healthCheck{ID: "dockerd", Title: msgCheckDockerd, Run: checkDockerdHealth})
+	registerCheck(&healthCheck{ID: "nat", Title: msgCheckNAT, Run: checkNAT})
+	registerCheck(&healthCheck{ID: "ca", Title: msgCheckCA, Run: checkCABundle})
+	registerCheck(&healthCheck{ID: "registry", Title: msgCheckRegistry, Run: checkRegistry})
+}
+
+func checkRoot(env *doctorEnv) CheckResult {
+	if env.uid != 0 {
+		return failed(T(msgDoctorRootRemedy), msgDoctorRootUID, env.uid)
+	}
+	return passed(msgDoctorRootOK)
+}
+
+func checkArch(env *doctorEnv) CheckResult {
+	arch, err := env.arch()
+	if err != nil {
+		return failed(T(msgDoctorArchRemedy), msgDoctorDetail, err)
+	}
+	return passed(msgDoctorDetail, arch)
+}
+
+func checkKernelConfig(env *doctorEnv) CheckResult {
+	probe, err := loadKernelProbe(env.sysRoot)
+	if err != nil {
+		return warned("", msgDoctorDetail, err)
+	}
+	var missing, optional, unknown []string
+	for _, f := range probe.Features() {
+		item := T(msgDoctorFeatureItem, f.Feature, f.Evidence)
+		switch {
+		case f.State == featureUnknown:
+			unknown = append(unknown, f.Name)
+		case f.State == featureYes:
+		case f.Required:
+			missing = append(missing, item)
+		default:
+			optional = append(optional, item)
+		}
+	}
+	switch {
+	case len(missing) > 0:
+		return failed(T(msgDoctorKernelRemedy),
+			msgDoctorUnsupported, strings.Join(append(missing, optional...), "; "))
+	case len(optional) > 0:
+		return warned(T(msgDoctorKernelOptional),
+			msgDoctorUnsupported, strings.Join(optional, "; "))
+	case len(unknown) > 0:
+		return warned(T(msgDoctorKernelUnknownRemedy),
+			msgDoctorKernelUnknown, strings.Join(unknown, ", "))
+	}
+	return passed(msgDoctorKernelOK, probe.Release, probe.StorageDriver())
+}
+
+func checkCgroup(env *doctorEnv) CheckResult {
+	probe, err := loadCgroupProbe(env.sysRoot)
+	if err != nil {
+		return failed("", msgDoctorDetail, err)
+	}
+	plan := planCgroupMounts(probe, cgroupMountRoot)
+	if len(plan.Controllers) == 0 {
+		return failed(T(msgDoctorCgroupNoneRemedy), msgDoctorCgroupMode, plan.Mode)
+	}
+	if len(plan.Missing) > 0 {
+		var features []string
+		for _, m := range plan.Missing {
+			features = append(features, T(msgDoctorFeatureItem, m.Name, m.Feature))
+		}
+		return warned(T(msgDoctorCgroupMissingRemedy),
+			msgDoctorCgroupMissing, plan.Layout, strings.Join(features, ", "))
+	}
+	return passed(msgDoctorCgroupOK, plan.Layout, strings.Join(plan.Controllers, " "))
+}
+
+func checkDataDisk(env *doctorEnv) CheckResult {
+	id, err := loadDiskIdentity(filepath.Join(env.root, "etc", "data-disk.json"))
+	if err != nil {
+		return failed("", msgDoctorDetail, err)
+	}
+	if id == nil {
+		return warned(T(msgDoctorDiskNoRecordRemedy), msgDoctorDiskNoRecord)
+	}
+	f, err := os.Open(env.sysPath("proc/self/mountinfo"))
+	if err != nil {
+		return failed("", msgDoctorMountinfoFailed, err)
+	}
+	mounts, err := parseMountInfo(f)
+	f.Close()
+	if err != nil {
+		return failed("", msgDoctorDetail, err)
+	}
+	m := mountFor(mounts, id.Root)
+	if m == nil || m.MountPoint != id.MountPoint || m.Source != id.Source {
+		return failed(T(msgDoctorDiskMissingRemedy), msgDoctorDiskMissing, id.MountPoint, id.Source)
+	}
+
+	free, err := env.freeKB(id.Root)
+	if err != nil {
+		return failed("", msgDoctorFreeFailed, id.Root, err)
+	}
+	freeGB := float64(free) / 1024 / 1024
+	switch {
+	case m.FSType != "ext4":
+		return warned(T(msgDoctorDiskFSRemedy), msgDoctorDiskFS, id.Root, m.FSType, freeGB)
+	case free < doctorMinFreeKB:
+		return failed(T(msgDoctorPruneRemedy), msgDoctorDiskFull, id.Root, freeGB)
+	case free < doctorLowFreeKB:
+		return warned(T(msgDoctorPruneRemedy), msgDoctorDiskLow, id.Root, freeGB)
+	}
+	return passed(msgDoctorDiskOK, id.Root, m.Source, m.FSType, freeGB)
+}
+
+// installFiles 安装目录中必须存在的文件
+var installFiles = []struct {
+	path       string
+	executable bool
+}{
+	{"bin/docker", true},
+	{"bin/dockerd", true},
+	{"bin/containerd", true},
+	{"bin/supervisord", true},
+	{"docker.env", false},
+	{"supervisor.conf", false},
+	{"etc/docker/daemon.json", false},
+	{"etc/install.json", false},
+}
+
+func checkInstallDir(env *doctorEnv) CheckResult {
+	var problems []string
+	for _, f := range installFiles {
+		info, err := os.Stat(filepath.Join(env.root, f.path))
+		switch {
+		case err != nil:
+			problems = append(problems, T(msgDoctorFileMissing, f.path))
+		case f.executable && info.Mode()&0111 == 0:
+			problems = append(problems, T(msgDoctorFileNotExec, f.path))
+		}
+	}
+	if len(problems) > 0 {
+		return failed(T(msgDoctorReinstallRemedy), msgDoctorDetail, strings.Join(problems, ", "))
+	}
+	state, err := loadInstallState(filepath.Join(env.root, "etc", "install.json"))
+	if err != nil {
+		return failed(T(msgDoctorReinstallRemedy), msgDoctorDetail, err)
+	}
+	return passed(msgDoctorInstallOK, env.root, state.Version, state.Channel)
+}
+
+func checkSupervisord(env *doctorEnv) CheckResult {
+	output, err := env.runner.Run(filepath.Join(env.root, "bin", "supervisord"), "ctl", "status")
+	programs := parseSupervisorStatus(output)
+	if err != nil && len(programs) == 0 {
+		return failed(T(msgDoctorSupervisordRemedy), msgDoctorSupervisordDown, err)
+	}
+	var stopped []string
+	for _, p := range programs {
+		if p.State != "RUNNING" {
+			stopped = append(stopped, fmt.Sprintf("%s %s", p.Name, p.State))
+		}
+	}
+	if len(stopped) > 0 {
+		return warned(T(msgDoctorStoppedRemedy),
+			msgDoctorStopped, strings.Join(stopped, ", "))
+	}
+	return passed(msgDoctorServicesOK, len(programs))
+}
+
+func checkDockerdHealth(env *doctorEnv) CheckResult {
+	health := checkDockerd(env.dockerd)
+	if !health.Healthy {
+		return failed(T(msgDoctorDockerdRemedy, filepath.Join(env.root, "dockerd-stderr.log")), msgDoctorDockerdDown, health.Error)
+	}
+	return passed(msgDoctorDockerdOK, health.Version, health.APIVersion)
+}
+
+func checkNAT(env *doctorEnv) CheckResult {
+	uplinks, err := discoverUplinks(env.runner, env.sysPath(strings.TrimPrefix(procNetRoute, "/")))
+	if err != nil {
+		return warned(T(msgDoctorConnectRemedy), msgDoctorDetail, err)
+	}
+	uplink := uplinks[0].Interface
+	var missing []string
+	for _, s := range newNetworkRules(env.runner).Status(uplink) {
+		if !s.Present {
+			missing = append(missing, s.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return failed(T(msgDoctorNATRemedy),
+			msgDoctorNATMissing, strings.Join(missing, ", "))
+	}
+	return passed(msgDoctorNATOK, dockerBridge, uplink)
+}
+
+// caCheckTime 证书有效期的下限，系统时间早于它时证书校验必然失败
+var caCheckTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func checkCABundle(env *doctorEnv) CheckResult {
+	if RootCAsGlobal() == nil {
+		return failed(T(msgDoctorCARemedy), msgDoctorCALoadFailed)
+	}
+	if now := env.now(); now.Before(caCheckTime) {
+		return failed(T(msgDoctorClockRemedy),
+			msgDoctorClockWrong, now.Format("2006-01-02 15:04"))
+	}
+	if env.http == nil {
+		return passed(msgDoctorCALoaded)
+	}
+	err := probeURL(env.http, downloadMirrors[0].BaseURL+"/"+manifestName(defaultChannel))
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	switch {
+	case errors.As(err, &certErr) || errors.As(err, &unknownAuthority):
+		return failed(T(msgDoctorHijackRemedy), msgDoctorCertFailed, downloadMirrors[0].BaseURL, err)
+	case err != nil:
+		return warned(T(msgDoctorNetworkRemedy), msgDoctorConnectFailed, downloadMirrors[0].BaseURL, err)
+	}
+	return passed(msgDoctorCertOK, hostOf(downloadMirrors[0].BaseURL))
+}
+
+func checkRegistry(env *doctorEnv) CheckResult {
+	if env.http == nil {
+		return warned("", msgDoctorOffline)
+	}
+	registries := []string{defaultRegistry}
+	if cfg, err := loadDaemonConfigFile(filepath.Join(env.root, "etc", "docker", "daemon.json")); err == nil {
+		if mirrors, ok := cfg["registry-mirrors"].([]interface{}); ok {
+			registries = nil
+			for _, m := range mirrors {
+				if s, ok := m.(string); ok {
+					registries = append(registries, strings.TrimSuffix(s, "/"))
+				}
+			}
+			registries = append(registries, defaultRegistry)
+		}
+	}
+
+	var reachable, failures []string
+	for _, r := range registries {
+		if err := probeURL(env.http, r+"/v2/"); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", hostOf(r), err))
+		} else {
+			reachable = append(reachable, hostOf(r))
+		}
+	}
+	switch {
+	case len(reachable) == 0:
+		return failed(T(msgDoctorRegistryRemedy),
+			msgDoctorRegistryFailed, strings.Join(failures, "; "))
+	case len(failures) > 0:
+		return warned("", msgDoctorRegistryPartial, strings.Join(reachable, ", "), strings.Join(failures, "; "))
+	}
+	return passed(msgDoctorRegistryOK, strings.Join(reachable, ", "))
+}
+
+// probeURL 发送 GET 请求，服务器有响应即认为可以访问
+// 镜像仓库的 /v2/ 未登录时返回 401，也算可以访问
+func probeURL(client *http.Client, rawURL string) error {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+func hostOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// DoctorReport doctor -output json 的输出
+type DoctorReport struct {
+	Checks  []CheckResult       `json:"checks"`
+	Summary map[CheckStatus]int `json:"summary"`
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:    "doctor",
+		usage:   msgUsageDoctor,
+		network: networkOptional,
+		run:     runDoctor,
+	})
+}
+
+// runDoctor 实现 doctor 子命令，有检查失败时返回错误
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	output := fs.String("output", outputText, "输出格式 text/json")
+	only := fs.String("check", "", "只执行指定的检查，多个用逗号分隔")
+	offline := fs.Bool("offline", false, "跳过需要访问网络的检查")
+	list := fs.Bool("list", false, "列出所有检查")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *list {
+		for _, c := range healthChecks {
+			fmt.Printf("  %-12s %s\n", c.ID, T(c.Title))
+		}
+		return nil
+	}
+	if *output != outputText && *output != outputJSON {
+		return errorf(msgDoctorUnknownOutput, *output)
+	}
+
+	var ids []string
+	if *only != "" {
+		ids = strings.Split(*only, ",")
+	}
+	results, err := runChecks(newDoctorEnv(*offline), ids)
+	if err != nil {
+		return err
+	}
+	report := DoctorReport{Checks: results, Summary: map[CheckStatus]int{checkPass: 0, checkWarn: 0, checkFail: 0}}
+	for _, r := range results {
+		report.Summary[r.Status]++
+	}
+
+	if *output == outputJSON {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+		// stdout 只包含报告，检查失败的错误信息写到 stderr，调用方通过退出码判断结果
+		os.Stdout = os.Stderr
+	} else {
+		printDoctorReport(os.Stdout, report)
+	}
+	if n := report.Summary[checkFail]; n > 0 {
+		return errorf(msgDoctorFailedCount, n)
+	}
+	return nil
+}
+
+// printDoctorReport 以文字输出检查结果
+func printDoctorReport(w io.Writer, report DoctorReport) {
+	marks := map[CheckStatus]string{checkPass: "✓", checkWarn: "⚠", checkFail: "✗"}
+	for _, r := range report.Checks {
+		fmt.Fprintf(w, "%s %-18s %s\n", marks[r.Status], r.Title, r.Message)
+		if r.Status != checkPass && r.Remedy != "" {
+			fmt.Fprintf(w, "    → %s\n", r.Remedy)
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, T(msgDoctorSummary, report.Summary[checkPass], report.Summary[checkWarn], report.Summary[checkFail]))
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc 用函数实现 http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestCheckKernelConfig 测试内核功能缺失时的结果
+func TestCheckKernelConfig(t *testing.T) {
+	tests := []struct {
+		root string
+		want CheckStatus
+	}{
+		{"testdata/kernel/gki-5.10", checkPass},
+		{"testdata/kernel/no-overlay", checkWarn},
+		{"testdata/kernel/no-config", checkWarn},
+	}
+	for _, tt := range tests {
+		if r := checkKernelConfig(&doctorEnv{sysRoot: tt.root}); r.Status != tt.want {
+			t.Errorf("%s: 结果 = %+v，期望 %s", tt.root, r, tt.want)
+		}
+	}
+
+	sysRoot := t.TempDir()
+	writeKernelConfig(t, sysRoot, "CONFIG_NAMESPACES=y", "CONFIG_OVERLAY_FS=y")
+	r := checkKernelConfig(&doctorEnv{sysRoot: sysRoot})
+	if r.Status != checkFail || !strings.Contains(r.Message, "CONFIG_VETH") {
+		t.Errorf("缺少 veth 时应失败: %+v", r)
+	}
+}
+
+// TestCheckCgroup 测试使用 cgroup fixture 的检查结果
+func TestCheckCgroup(t *testing.T) {
+	if r := checkCgroup(&doctorEnv{sysRoot: "testdata/cgroup/android-hybrid"}); r.Status == checkFail {
+		t.Errorf("android-hybrid 不应失败: %+v", r)
+	}
+	r := checkCgroup(&doctorEnv{sysRoot: "testdata/cgroup/no-memory"})
+	if r.Status != checkWarn || !strings.Contains(r.Message, "memory") {
+		t.Errorf("缺少 memory 时应为警告: %+v", r)
+	}
+	if r := checkCgroup(&doctorEnv{sysRoot: t.TempDir()}); r.Status != checkFail {
+		t.Errorf("没有 /proc/cgroups 时应失败: %+v", r)
+	}
+}
+
+// TestCheckDataDisk 测试数据盘挂载和空间检查
+func TestCheckDataDisk(t *testing.T) {
+	root, sysRoot := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(sysRoot, "proc", "self"), 0755)
+	mountinfo := "36 25 8:1 / /mnt/media_rw/ABCD rw,nosuid - ext4 /dev/block/vold/public:8,1 rw\n"
+	os.WriteFile(filepath.Join(sysRoot, "proc", "self", "mountinfo"), []byte(mountinfo), 0644)
+	env := &doctorEnv{root: root, sysRoot: sysRoot, freeKB: func(string) (uint64, error) { return 20 * 1024 * 1024, nil }}
+
+	if r := checkDataDisk(env); r.Status != checkWarn {
+		t.Errorf("没有数据盘记录时应为警告: %+v", r)
+	}
+
+	id := &DiskIdentity{Root: "/mnt/media_rw/ABCD", MountPoint: "/mnt/media_rw/ABCD", Source: "/dev/block/vold/public:8,1", FSType: "ext4"}
+	if err := saveDiskIdentity(filepath.Join(root, "etc", "data-disk.json"), id); err != nil {
+		t.Fatal(err)
+	}
+	if r := checkDataDisk(env); r.Status != checkPass {
+		t.Errorf("数据盘正常时应通过: %+v", r)
+	}
+	env.freeKB = func(string) (uint64, error) { return 512 * 1024, nil }
+	if r := checkDataDisk(env); r.Status != checkFail {
+		t.Errorf("空间不足时应失败: %+v", r)
+	}
+
+	id.Source = "/dev/block/vold/public:8,17"
+	saveDiskIdentity(filepath.Join(root, "etc", "data-disk.json"), id)
+	if r := checkDataDisk(env); r.Status != checkFail || r.Remedy == "" {
+		t.Errorf("换了硬盘时应失败: %+v", r)
+	}
+}
+
+// TestCheckNAT 测试转发规则缺失时失败
+func TestCheckNAT(t *testing.T) {
+	runner := newFakeNetRunner("default via 192.168.1.1 dev wlan0 table wlan0 proto static\n")
+	env := &doctorEnv{sysRoot: t.TempDir(), runner: runner}
+	r := checkNAT(env)
+	if r.Status != checkFail || !strings.Contains(r.Message, "nat docker0 -> wlan0") {
+		t.Errorf("缺少规则时应失败: %+v", r)
+	}
+
+	if err := newNetworkRules(runner).Apply("wlan0"); err != nil {
+		t.Fatal(err)
+	}
+	if r := checkNAT(env); r.Status != checkPass {
+		t.Errorf("规则完整时应通过: %+v", r)
+	}
+}
+
+// TestCheckRegistry 测试镜像加速地址可用时 Docker Hub 不可访问只给出警告
+func TestCheckRegistry(t *testing.T) {
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/" {
+			t.Errorf("请求路径错误: %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer mirror.Close()
+
+	root := t.TempDir()
+	cfg := DaemonConfig{"registry-mirrors": []interface{}{mirror.URL + "/"}}
+	if err := writeDaemonConfigFile(filepath.Join(root, "etc", "docker", "daemon.json"), cfg); err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "registry-1.docker.io" {
+			return nil, errors.New("connection reset")
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	env := &doctorEnv{root: root, http: client}
+
+	r := checkRegistry(env)
+	if r.Status != checkWarn || !strings.Contains(r.Message, "registry-1.docker.io") {
+		t.Errorf("结果 = %+v，期望警告", r)
+	}
+
+	mirror.Close()
+	if r := checkRegistry(env); r.Status != checkFail {
+		t.Errorf("都无法访问时应失败: %+v", r)
+	}
+}
+
+// TestCheckCABundle 测试系统时间错误时失败
+func TestCheckCABundle(t *testing.T) {
+	env := &doctorEnv{now: func() time.Time { return time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC) }}
+	if r := checkCABundle(env); r.Status != checkFail || !strings.Contains(r.Message, "1970") {
+		t.Errorf("系统时间错误时应失败: %+v", r)
+	}
+	env.now = time.Now
+	if r := checkCABundle(env); r.Status != checkPass {
+		t.Errorf("离线时只检查证书加载: %+v", r)
+	}
+}
+
+// TestRunChecks 测试按注册顺序执行和选择检查
+func TestRunChecks(t *testing.T) {
+	saved := healthChecks
+	t.Cleanup(func() { healthChecks = saved })
+	healthChecks = nil
+	registerCheck(&healthCheck{ID: "a", Title: "检查 A", Run: func(*doctorEnv) CheckResult { return passed("正常") }})
+	registerCheck(&healthCheck{ID: "b", Title: "检查 B", Run: func(*doctorEnv) CheckResult { return failed("修复方法", "错误") }})
+
+	results, err := runChecks(&doctorEnv{}, nil)
+	if err != nil || len(results) != 2 || results[0].ID != "a" || results[1].Title != "检查 B" {
+		t.Fatalf("结果错误: %+v %v", results, err)
+	}
+	results, err = runChecks(&doctorEnv{}, []string{"b"})
+	if err != nil || len(results) != 1 || results[0].Status != checkFail {
+		t.Errorf("只执行 b 的结果错误: %+v %v", results, err)
+	}
+	if _, err := runChecks(&doctorEnv{}, []string{"c"}); err == nil {
+		t.Error("未知的检查应报错")
+	}
+
+	var out strings.Builder
+	printDoctorReport(&out, DoctorReport{Checks: results, Summary: map[CheckStatus]int{checkFail: 1}})
+	if !strings.Contains(out.String(), "✗ 检查 B") || !strings.Contains(out.String(), "→ 修复方法") {
+		t.Errorf("文字输出错误:\n%s", out.String())
+	}
+}
+
+// TestRunDoctorJSON 测试 -output json 检查失败时 stdout 只包含报告
+func TestRunDoctorJSON(t *testing.T) {
+	saved := healthChecks
+	t.Cleanup(func() { healthChecks = saved })
+	healthChecks = nil
+	registerCheck(&healthCheck{ID: "a", Title: "检查 A", Run: func(*doctorEnv) CheckResult { return passed("正常") }})
+	registerCheck(&healthCheck{ID: "b", Title: "检查 B", Run: func(*doctorEnv) CheckResult { return failed("修复方法", "错误") }})
+
+	stdout, stderr := os.Stdout, os.Stderr
+	t.Cleanup(func() { os.Stdout, os.Stderr = stdout, stderr })
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	devnull, _ := os.Open(os.DevNull)
+	defer devnull.Close()
+	os.Stdout, os.Stderr = w, devnull
+
+	err = runDoctor([]string{"-output", "json", "-offline"})
+	if err == nil {
+		t.Error("检查失败时应返回错误")
+	} else {
+		reportError(err)
+	}
+	w.Close()
+	os.Stdout, os.Stderr = stdout, stderr
+
+	var report DoctorReport
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&report); err != nil {
+		t.Fatalf("stdout 不是 JSON: %v", err)
+	}
+	if len(report.Checks) != 2 || report.Summary[checkFail] != 1 {
+		t.Errorf("报告错误: %+v", report)
+	}
+	if rest, _ := io.ReadAll(dec.Buffered()); strings.TrimSpace(string(rest)) != "" {
+		t.Errorf("报告之后不应有其他输出: %q", rest)
+	}
+	if rest, _ := io.ReadAll(r); len(rest) > 0 {
+		t.Errorf("报告之后不应有其他输出: %q", rest)
+	}
+}
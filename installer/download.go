@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,76 +21,304 @@ const (
 	serverURL = "https://fw.koolcenter.com/binary/docker-for-android"
 )
 
+// downloadMirror 下载源，Name 用于事件，Label 用于文字输出
+type downloadMirror struct {
+	Name    string
+	Label   msgKey
+	BaseURL string
+	// Peer 局域网中的其他设备，只用于有 SHA256 的文件，不能提供版本文件
+	Peer bool
+	// Files 局域网中的设备在发现响应中列出的安装包，只从设备下载其中的文件
+	Files []string
+}
+
+// downloadMirrors 按顺序尝试的下载源
+var downloadMirrors = []downloadMirror{
+	{Name: "cdn", Label: msgMirrorCDN, BaseURL: cdnURL},
+	{Name: "server", Label: msgMirrorServer, BaseURL: serverURL},
+}
+
+// label 文字输出中显示的下载源名称
+func (m downloadMirror) label() string {
+	if m.Label == "" {
+		return m.Name
+	}
+	return T(m.Label)
+}
+
 // CreateHTTPClient 创建统一的 HTTP 客户端
-// 使用 120 秒超时的自定义 Transport
+// 使用 120 秒超时的自定义 Transport，连接、握手和每次读取超过 120 秒没有进展时失败；
+// 不设置整体超时，限速下载的大文件可能需要很长时间
 func CreateHTTPClient() *http.Client {
 	transport := CreateTimeoutTransport(120 * time.Second)
 	return &http.Client{
 		Transport: CreateLogTransport(transport),
-		Timeout:   10 * time.Minute,
 	}
 }
 
+// errRangeMismatch 服务器返回的 Content-Range 与请求的续传位置不一致
+var errRangeMismatch = errors.New("Content-Range 与续传位置不一致")
+
 // downloadFile 下载文件并验证 SHA256
+// 下载源按 orderMirrors 的顺序尝试，全部失败时返回每个下载源的失败原因
+// 数据先写入 destPath.part，校验通过后再改名；有 SHA256 时可以校验续传的结果，
+// 上次中断留下的 .part 和其他下载源下载了一部分的数据都会继续使用，否则只在同一个下载源的重试中续传
 func downloadFile(client *http.Client, destPath, filename, expectedSHA256 string) error {
-	urls := []string{
-		fmt.Sprintf("%s/%s", cdnURL, filename),
-		fmt.Sprintf("%s/%s", serverURL, filename),
+	partPath := destPath + ".part"
+	resumable := expectedSHA256 != ""
+	mirrors := orderMirrors(client, filename, expectedSHA256 != "")
+	budget := &retryBudget{remaining: retryPolicy.Budget}
+	var failures mirrorErrors
+	fail := func(mirror downloadMirror, err error, elapsed time.Duration) {
+		failures = append(failures, mirrorFailure{Mirror: mirror.Name, Err: err})
+		recordDownload(mirror, err, 0, elapsed, time.Now())
+	}
+	tried := func(mirror downloadMirror, url string, err error) {
+		ev := Event{Type: eventMirrorTried, File: filename, Mirror: mirror.Name, URL: url, OK: boolPtr(err == nil)}
+		if err != nil {
+			ev.Message = err.Error()
+			ev.Reason, _ = classifyError(err)
+		}
+		emit(ev)
+	}
+
+	// 竞速模式下前两个下载源同时开始，胜出的排到第一位，竞速中失败的不再尝试
+	var raced *raceResult
+	if mirrorRace && len(mirrors) > 1 {
+		start := time.Now()
+		winner, failed := raceMirrors(client, mirrors[:2], filename)
+		skip := map[int]bool{}
+		for _, r := range failed {
+			mirror := mirrors[r.index]
+			fmt.Println(T(msgMirrorFailed, r.err))
+			tried(mirror, fmt.Sprintf("%s/%s", mirror.BaseURL, filename), r.err)
+			fail(mirror, r.err, time.Since(start))
+			skip[r.index] = true
+		}
+		var next []downloadMirror
+		if winner != nil {
+			raced = winner
+			skip[winner.index] = true
+			next = append(next, mirrors[winner.index])
+			fmt.Println(T(msgMirrorRaceWinner, mirrors[winner.index].label()))
+		}
+		for i, mirror := range mirrors {
+			if !skip[i] {
+				next = append(next, mirror)
+			}
+		}
+		mirrors = next
 	}
 
-	var lastErr error
-	for i, url := range urls {
-		source := "CDN"
-		if i > 0 {
-			source = "服务器"
+	for i, mirror := range mirrors {
+		url := fmt.Sprintf("%s/%s", mirror.BaseURL, filename)
+		fmt.Println(T(msgTryMirror, mirror.label()))
+		if !resumable {
+			os.Remove(partPath)
 		}
-		fmt.Printf("   尝试从%s下载...\n", source)
 
-		err := downloadFromURL(client, url, destPath)
+		start := time.Now()
+		var first *raceResult
+		if i == 0 {
+			first = raced
+		}
+		err := downloadFromMirror(client, mirror, filename, partPath, budget, first)
+		elapsed := time.Since(start)
 		if err != nil {
-			lastErr = err
-			fmt.Printf("   ✗ 下载失败: %v\n", err)
+			fail(mirror, err, elapsed)
+			fmt.Println(T(msgMirrorFailed, err))
+			tried(mirror, url, err)
+			if mirror.Peer {
+				// 不从局域网设备下载的部分续传，避免与其他下载源的内容混在一起
+				os.Remove(partPath)
+			}
 			continue
 		}
+		tried(mirror, url, nil)
 
 		// 验证 SHA256
 		if expectedSHA256 != "" {
-			if err := verifySHA256(destPath, expectedSHA256); err != nil {
-				lastErr = err
-				fmt.Printf("   ✗ SHA256 验证失败: %v\n", err)
-				os.Remove(destPath)
+			err := verifySHA256(partPath, expectedSHA256)
+			ev := Event{Type: eventChecksum, File: filename, Mirror: mirror.Name, OK: boolPtr(err == nil), Expected: strings.ToLower(expectedSHA256)}
+			var mismatch *checksumMismatchError
+			if errors.As(err, &mismatch) {
+				ev.Actual = mismatch.Actual
+			}
+			emit(ev)
+			if err != nil {
+				fail(mirror, err, elapsed)
+				fmt.Println(T(msgChecksumFailed, err))
+				os.Remove(partPath)
 				continue
 			}
-			fmt.Printf("   ✓ SHA256 验证通过\n")
+			fmt.Println(T(msgChecksumOK))
 		}
 
+		var size int64
+		if fi, err := os.Stat(partPath); err == nil {
+			size = fi.Size()
+		}
+		if err := os.Rename(partPath, destPath); err != nil {
+			return errorf(msgCreateFileFailed, err)
+		}
+		recordDownload(mirror, nil, size, elapsed, time.Now())
 		return nil
 	}
 
-	return fmt.Errorf("所有下载源均失败: %v", lastErr)
+	os.Remove(partPath)
+	return errorf(msgAllMirrorsFailed, failures)
+}
+
+// downloadFromMirror 从一个下载源下载到 partPath，临时错误按 retryPolicy 重试并从已下载的位置继续
+// first 不为 nil 时第一次尝试使用竞速中已打开的响应
+func downloadFromMirror(client *http.Client, mirror downloadMirror, filename, partPath string, budget *retryBudget, first *raceResult) error {
+	url := fmt.Sprintf("%s/%s", mirror.BaseURL, filename)
+	for attempt := 1; ; attempt++ {
+		var err error
+		if attempt == 1 && first != nil {
+			err = saveBody(io.MultiReader(bytes.NewReader(first.prefix), first.resp.Body), 0, first.resp.ContentLength, partPath)
+			first.close()
+			if errors.Is(err, errDownloadPaused) {
+				// 竞速中打开的响应已经关闭，恢复后从已下载的位置继续
+				currentThrottle.waitResume(filename)
+				err = downloadRange(client, url, partPath, partSize(partPath))
+			}
+		} else {
+			err = downloadRange(client, url, partPath, partSize(partPath))
+		}
+		if err == nil {
+			return nil
+		}
+
+		kind, transient := classifyError(err)
+		if !transient || attempt >= retryPolicy.Attempts {
+			return err
+		}
+		delay, ok := budget.take(retryPolicy, attempt, retryAfterOf(err))
+		if !ok {
+			return err
+		}
+		fmt.Println(T(msgRetrying, err, delay.Round(100*time.Millisecond), attempt+1, retryPolicy.Attempts))
+		emit(Event{Type: eventRetry, File: filename, Mirror: mirror.Name, URL: url,
+			Index: attempt + 1, Total: retryPolicy.Attempts, Reason: kind, Message: err.Error(), Duration: delay.Milliseconds()})
+		retrySleep(delay)
+	}
 }
 
 // downloadFromURL 从指定 URL 下载文件
 func downloadFromURL(client *http.Client, url, destPath string) error {
-	resp, err := client.Get(url)
+	return downloadRange(client, url, destPath, 0)
+}
+
+// partSize 返回已下载部分的大小，文件不存在时为 0
+func partSize(path string) int64 {
+	if fi, err := os.Stat(path); err == nil {
+		return fi.Size()
+	}
+	return 0
+}
+
+// downloadRange 从 offset 处继续下载到 destPath
+// 暂停时关闭响应，不占着连接等待，恢复后从已下载的位置用 Range 请求继续
+func downloadRange(client *http.Client, url, destPath string, offset int64) error {
+	for {
+		err := requestRange(client, url, destPath, offset)
+		if !errors.Is(err, errDownloadPaused) {
+			return err
+		}
+		currentThrottle.waitResume(filepath.Base(destPath))
+		offset = partSize(destPath)
+	}
+}
+
+// requestRange 发送一次请求，从 offset 处继续下载到 destPath
+// 服务器不支持 Range 时返回完整内容，从头写入；offset 已经是文件末尾时直接返回
+func requestRange(client *http.Client, url, destPath string, offset int64) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return errorf(msgHTTPRequestFailed, err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("HTTP 请求失败: %v", err)
+		return errorf(msgHTTPRequestFailed, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP 状态码: %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return saveBody(resp.Body, 0, resp.ContentLength, destPath)
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			// 丢弃不可信的部分数据，重试时从头下载
+			os.Remove(destPath)
+			return errRangeMismatch
+		}
+		return saveBody(resp.Body, offset, total, destPath)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == offset {
+			return nil
+		}
+		os.Remove(destPath)
+		return errRangeMismatch
+	default:
+		return newHTTPStatusError(resp, time.Now())
 	}
+}
 
-	out, err := os.Create(destPath)
+// parseContentRange 解析 bytes START-END/TOTAL 和 bytes */TOTAL，TOTAL 未知时为 -1
+func parseContentRange(value string) (start, total int64, ok bool) {
+	rest, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	span, size, found := strings.Cut(rest, "/")
+	if !found {
+		return 0, 0, false
+	}
+	total = -1
+	if size != "*" {
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		total = n
+	}
+	if span == "*" {
+		return -1, total, total >= 0
+	}
+	from, _, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+	n, err := strconv.ParseInt(from, 10, 64)
 	if err != nil {
-		return fmt.Errorf("创建文件失败: %v", err)
+		return 0, 0, false
+	}
+	return n, total, true
+}
+
+// saveBody 将响应内容写入 destPath 并显示进度
+// offset 大于 0 时追加到已有数据之后，total 为完整文件大小，未知时为 -1
+func saveBody(body io.Reader, offset, total int64, destPath string) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	out, err := os.OpenFile(destPath, flags, 0644)
+	if err != nil {
+		return errorf(msgCreateFileFailed, err)
 	}
 	defer out.Close()
 
 	// 创建进度显示
-	var written int64
-	contentLength := resp.ContentLength
+	written := offset
+	contentLength := total
+	file := filepath.Base(destPath)
+	body = currentThrottle.reader(body)
 
 	if contentLength > 0 {
 		// 带进度条的下载
@@ -94,41 +326,44 @@ func downloadFromURL(client *http.Client, url, destPath string) error {
 		lastPrintTime := time.Now()
 
 		for {
-			n, err := resp.Body.Read(buf)
+			n, err := body.Read(buf)
 			if n > 0 {
 				_, writeErr := out.Write(buf[:n])
 				if writeErr != nil {
-					return fmt.Errorf("写入文件失败: %v", writeErr)
+					return errorf(msgWriteFileFailed, writeErr)
 				}
 				written += int64(n)
 
 				// 每秒更新一次进度
 				if time.Since(lastPrintTime) >= time.Second {
 					progress := float64(written) / float64(contentLength) * 100
-					fmt.Printf("   进度: %.1f%% (%d/%d MB)\r",
-						progress,
-						written/(1024*1024),
-						contentLength/(1024*1024))
+					if limit := currentThrottle.limit(); limit > 0 {
+						fmt.Print(T(msgProgressLimited, progress, written/(1024*1024), contentLength/(1024*1024), formatRate(limit)) + "\r")
+					} else {
+						fmt.Print(T(msgProgress, progress, written/(1024*1024), contentLength/(1024*1024)) + "\r")
+					}
+					emit(Event{Type: eventDownloadProgress, File: file, Bytes: written, Size: contentLength})
 					lastPrintTime = time.Now()
 				}
 			}
 			if err != nil {
 				if err == io.EOF {
-					fmt.Printf("   进度: 100.0%% (%d/%d MB)\n",
-						written/(1024*1024),
-						contentLength/(1024*1024))
+					fmt.Println(T(msgProgressDone, written/(1024*1024), contentLength/(1024*1024)))
+					emit(Event{Type: eventDownloadProgress, File: file, Bytes: written, Size: contentLength})
 					break
 				}
-				return fmt.Errorf("读取数据失败: %v", err)
+				return errorf(msgReadBodyFailed, err)
 			}
 		}
 	} else {
 		// 无法获取大小时，简单复制
-		written, err = io.Copy(out, resp.Body)
+		n, err := io.Copy(out, body)
+		written += n
 		if err != nil {
-			return fmt.Errorf("下载失败: %v", err)
+			return errorf(msgCopyBodyFailed, err)
 		}
-		fmt.Printf("   下载完成: %d MB\n", written/(1024*1024))
+		fmt.Println(T(msgDownloadSize, written/(1024*1024)))
+		emit(Event{Type: eventDownloadProgress, File: file, Bytes: written})
 	}
 
 	return nil
@@ -138,19 +373,29 @@ func downloadFromURL(client *http.Client, url, destPath string) error {
 func verifySHA256(filePath, expectedHash string) error {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("打开文件失败: %v", err)
+		return errorf(msgOpenFileFailed, err)
 	}
 	defer file.Close()
 
 	hash := sha256.New()
 	if _, err := io.Copy(hash, file); err != nil {
-		return fmt.Errorf("计算哈希失败: %v", err)
+		return errorf(msgHashFailed, err)
 	}
 
 	actualHash := hex.EncodeToString(hash.Sum(nil))
 	if actualHash != strings.ToLower(expectedHash) {
-		return fmt.Errorf("SHA256 不匹配 (期望: %s, 实际: %s)", expectedHash, actualHash)
+		return &checksumMismatchError{Expected: expectedHash, Actual: actualHash}
 	}
 
 	return nil
 }
+
+// checksumMismatchError SHA256 不匹配
+type checksumMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return T(msgChecksumMismatch, e.Expected, e.Actual)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestDownloadFromURL 测试从 URL 下载文件
@@ -66,8 +68,8 @@ func TestDownloadFromURL_HTTPError(t *testing.T) {
 		t.Fatal("期望返回错误，但没有错误")
 	}
 
-	if !strings.Contains(err.Error(), "404") {
-		t.Errorf("错误信息不正确: %v", err)
+	if key := messageKey(err); key != msgHTTPStatus || !strings.Contains(err.Error(), "404") {
+		t.Errorf("错误信息不正确: %s %v", key, err)
 	}
 }
 
@@ -281,40 +283,12 @@ BIN_ARM64_SHA256=def456`,
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			info := &VersionInfo{
-				Architecture: "arm64",
+			_, err := parseVersionInfo([]byte(tt.content), "arm64")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("字段验证错误，期望错误: %v, 实际错误: %v", tt.wantErr, err)
 			}
-
-			lines := strings.Split(tt.content, "\n")
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if line == "" || strings.HasPrefix(line, "#") {
-					continue
-				}
-
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) != 2 {
-					continue
-				}
-
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-
-				switch key {
-				case "VERSION":
-					info.Version = value
-				case "DOCKER_SHA256":
-					info.DockerSHA256 = value
-				case "BIN_ARM64_SHA256":
-					info.BinSHA256 = value
-				}
-			}
-
-			// 检查必需字段
-			hasError := info.Version == "" || info.DockerSHA256 == "" || info.BinSHA256 == ""
-
-			if hasError != tt.wantErr {
-				t.Errorf("字段验证错误，期望错误: %v, 实际错误: %v", tt.wantErr, hasError)
+			if tt.wantErr && messageKey(err) != msgVersionMissingField {
+				t.Errorf("消息键 = %s，期望 %s", messageKey(err), msgVersionMissingField)
 			}
 		})
 	}
@@ -522,3 +496,40 @@ func TestLargeFileDownload(t *testing.T) {
 func stringReader(s string) io.Reader {
 	return strings.NewReader(s)
 }
+
+// TestDownloadPauseResume 测试暂停时关闭响应，恢复后用 Range 请求继续
+func TestDownloadPauseResume(t *testing.T) {
+	content := make([]byte, 200<<10)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "docker.tar.gz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	// 每次检查都刷新暂停状态，第二次读取时暂停，恢复后不再暂停
+	saved := currentThrottle
+	t.Cleanup(func() { currentThrottle = saved })
+	now, checks := time.Now(), 0
+	currentThrottle = &throttle{
+		schedule: &rateSchedule{},
+		paused:   func() bool { checks++; return checks == 2 },
+		now:      func() time.Time { now = now.Add(pausePollInterval); return now },
+		sleep:    func(time.Duration) {},
+	}
+
+	destPath := filepath.Join(t.TempDir(), "docker.tar.gz")
+	if err := downloadFromURL(CreateHTTPClient(), server.URL, destPath); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	data, _ := os.ReadFile(destPath)
+	if !bytes.Equal(data, content) {
+		t.Errorf("文件内容不一致，大小 %d", len(data))
+	}
+	if len(ranges) != 2 || ranges[0] != "" || !strings.HasPrefix(ranges[1], "bytes=") || ranges[1] == "bytes=0-" {
+		t.Errorf("请求的 Range = %q，期望恢复后从已下载的位置继续", ranges)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 输出格式
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// 事件类型，JSON 模式下每个事件一行写到 stdout
+const (
+	eventStepStarted      = "step_started"
+	eventStepFinished     = "step_finished"
+	eventMirrorProbed     = "mirror_probed"
+	eventMirrorTried      = "mirror_tried"
+	eventRetry            = "retry"
+	eventDownloadProgress = "download_progress"
+	eventDownloadPaused   = "download_paused"
+	eventDownloadResumed  = "download_resumed"
+	eventChecksum         = "checksum"
+	eventWarning          = "warning"
+	eventError            = "error"
+	eventDone             = "done"
+)
+
+// Event 供自动化工具（adb 批量部署、GUI 封装）读取的安装事件
+type Event struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	Step  string    `json:"step,omitempty"`
+	Index int       `json:"index,omitempty"`
+	Total int       `json:"total,omitempty"`
+	Title string    `json:"title,omitempty"`
+
+	File   string `json:"file,omitempty"`
+	Mirror string `json:"mirror,omitempty"`
+	URL    string `json:"url,omitempty"`
+	// Bytes 已下载字节数，Size 文件大小，未知时为 0
+	Bytes int64 `json:"bytes,omitempty"`
+	Size  int64 `json:"size,omitempty"`
+	// OK 用于 mirror_tried 和 checksum
+	OK *bool `json:"ok,omitempty"`
+	// Reason 下载失败的类别（dns、tls、timeout、connection、http_4xx、http_5xx、http_429、checksum、other）
+	Reason   string `json:"reason,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+
+	Code     string `json:"code,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Duration int64  `json:"duration_ms,omitempty"`
+}
+
+var (
+	eventsMu sync.Mutex
+	// eventsOut 为 nil 时不输出事件
+	eventsOut *json.Encoder
+)
+
+// setOutputMode 选择输出格式
+// 人类可读的输出都写到 os.Stdout，JSON 模式下把它换成 stderr，事件独占原来的 stdout，
+// 子进程（部署脚本）的输出也随之写到 stderr，不会混入事件流
+func setOutputMode(mode string) error {
+	switch mode {
+	case outputText:
+		return nil
+	case outputJSON:
+		setEventWriter(os.Stdout)
+		os.Stdout = os.Stderr
+		return nil
+	default:
+		return fmt.Errorf("未知的输出格式: %s（支持 text/json）", mode)
+	}
+}
+
+// addOutputFlag 为子命令添加 -output 参数
+func addOutputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", outputText, "输出格式 text/json，json 时 stdout 为逐行 JSON 事件，文字输出写到 stderr")
+}
+
+// setEventWriter 设置事件输出，w 为 nil 时关闭
+func setEventWriter(w io.Writer) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if w == nil {
+		eventsOut = nil
+		return
+	}
+	eventsOut = json.NewEncoder(w)
+}
+
+// emit 输出一个事件
+func emit(ev Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if eventsOut == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	eventsOut.Encode(ev)
+}
+
+// boolPtr 返回 b 的指针，用于 Event.OK
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// installStep 安装流程中的一步
+type installStep struct {
+	id    string
+	index int
+	title string
+	start time.Time
+}
+
+// installSteps 安装步骤总数，文字输出中停止服务为 3.5，事件中按顺序编号
+const installSteps = 6
+
+// startStep 打印步骤标题并输出 step_started 事件，label 为文字输出中的编号
+func startStep(id string, index int, label string, key msgKey) *installStep {
+	title := T(key)
+	fmt.Printf("[%s] %s...\n", label, title)
+	s := &installStep{id: id, index: index, title: title, start: time.Now()}
+	emit(Event{Type: eventStepStarted, Step: id, Index: index, Total: installSteps, Title: title})
+	return s
+}
+
+// finish 输出 step_finished 事件
+func (s *installStep) finish() {
+	emit(Event{Type: eventStepFinished, Step: s.id, Index: s.index, Total: installSteps, Duration: time.Since(s.start).Milliseconds()})
+}
+
+// ErrorCode 安装失败的原因，code 和退出码一经发布不再修改
+type ErrorCode struct {
+	Code     string
+	ExitCode int
+}
+
+// 安装失败的错误码，退出码 1 保留给未分类的错误
+var (
+	errCodeDiskNotFound     = ErrorCode{"disk_not_found", 10}
+	errCodeTmpDir           = ErrorCode{"tmp_dir", 11}
+	errCodeVersionInfo      = ErrorCode{"version_info", 12}
+	errCodeSelfUpdate       = ErrorCode{"self_update", 13}
+	errCodeCopyLocal        = ErrorCode{"copy_local", 14}
+	errCodeDownload         = ErrorCode{"download", 15}
+	errCodeStopServices     = ErrorCode{"stop_services", 16}
+	errCodeExtract          = ErrorCode{"extract", 17}
+	errCodeBinDir           = ErrorCode{"bin_dir", 18}
+	errCodeMoveBin          = ErrorCode{"move_bin", 19}
+	errCodeDaemonConfig     = ErrorCode{"daemon_config", 20}
+	errCodeServiceConfig    = ErrorCode{"service_config", 21}
+	errCodeDeployScriptMiss = ErrorCode{"deploy_script_missing", 22}
+	errCodeDeployScript     = ErrorCode{"deploy_script", 23}
+	errCodeBundle           = ErrorCode{"bundle", 24}
+	errCodeUnknown          = ErrorCode{"unknown", 1}
+)
+
+// InstallError 带错误码的安装失败
+type InstallError struct {
+	ErrorCode
+	Key  msgKey
+	Args []interface{}
+	Err  error
+}
+
+func (e *InstallError) Error() string {
+	if e.Err == nil {
+		return T(e.Key, e.Args...)
+	}
+	return fmt.Sprintf("%s: %v", T(e.Key, e.Args...), e.Err)
+}
+
+func (e *InstallError) Unwrap() error {
+	return e.Err
+}
+
+// installFailure 创建带错误码的错误，key 和 args 描述失败的步骤
+func installFailure(code ErrorCode, err error, key msgKey, args ...interface{}) error {
+	return &InstallError{ErrorCode: code, Key: key, Args: args, Err: err}
+}
+
+// reportError 打印错误并输出 error 事件，返回进程退出码
+func reportError(err error) int {
+	code := errCodeUnknown
+	var ie *InstallError
+	if errors.As(err, &ie) {
+		code = ie.ErrorCode
+	}
+	fmt.Println(T(msgErrorPrefix, err))
+	emit(Event{Type: eventError, Code: code.Code, ExitCode: code.ExitCode, Message: err.Error()})
+	return code.ExitCode
+}
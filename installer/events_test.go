@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// captureEvents 收集测试期间输出的事件
+func captureEvents(t *testing.T) func() []Event {
+	var buf bytes.Buffer
+	setEventWriter(&buf)
+	t.Cleanup(func() { setEventWriter(nil) })
+	return func() []Event {
+		var events []Event
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var ev Event
+			if err := dec.Decode(&ev); err != nil {
+				t.Fatalf("事件不是合法的 JSON: %v", err)
+			}
+			events = append(events, ev)
+		}
+		return events
+	}
+}
+
+// useTestMirrors 将下载源替换为本地测试服务器
+func useTestMirrors(t *testing.T, mirrors ...downloadMirror) {
+	saved := downloadMirrors
+	downloadMirrors = mirrors
+	t.Cleanup(func() { downloadMirrors = saved })
+}
+
+// TestDownloadFileEvents 测试下载过程输出的事件
+func TestDownloadFileEvents(t *testing.T) {
+	content := []byte("docker package")
+	sum := sha256.Sum256(content)
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.NotFoundHandler())
+	defer bad.Close()
+
+	t.Run("切换下载源", func(t *testing.T) {
+		events := captureEvents(t)
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: bad.URL}, downloadMirror{Name: "server", BaseURL: good.URL})
+
+		dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+		if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", hex.EncodeToString(sum[:])); err != nil {
+			t.Fatalf("下载失败: %v", err)
+		}
+
+		var types []string
+		for _, ev := range events() {
+			types = append(types, ev.Type)
+			switch ev.Type {
+			case eventMirrorTried:
+				if ev.File != "docker.tar.gz" || ev.OK == nil {
+					t.Errorf("mirror_tried 事件错误: %+v", ev)
+				}
+				if ev.Mirror == "cdn" && (*ev.OK || ev.Message == "") {
+					t.Errorf("CDN 应报告失败原因: %+v", ev)
+				}
+			case eventDownloadProgress:
+				if ev.Bytes != int64(len(content)) {
+					t.Errorf("下载字节数错误: %+v", ev)
+				}
+			case eventChecksum:
+				if ev.OK == nil || !*ev.OK || ev.Mirror != "server" {
+					t.Errorf("checksum 事件错误: %+v", ev)
+				}
+			}
+		}
+		want := fmt.Sprint([]string{eventMirrorTried, eventDownloadProgress, eventMirrorTried, eventChecksum})
+		if fmt.Sprint(types) != want {
+			t.Errorf("事件顺序 = %v，期望 %s", types, want)
+		}
+	})
+
+	t.Run("校验失败", func(t *testing.T) {
+		events := captureEvents(t)
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: good.URL})
+
+		dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+		if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", "deadbeef"); err == nil {
+			t.Fatal("SHA256 不匹配应失败")
+		}
+		var checksum *Event
+		for _, ev := range events() {
+			if ev.Type == eventChecksum {
+				ev := ev
+				checksum = &ev
+			}
+		}
+		if checksum == nil || *checksum.OK || checksum.Expected != "deadbeef" || checksum.Actual != hex.EncodeToString(sum[:]) {
+			t.Errorf("checksum 事件错误: %+v", checksum)
+		}
+	})
+}
+
+// TestReportError 测试错误码和 error 事件
+func TestReportError(t *testing.T) {
+	events := captureEvents(t)
+
+	err := fmt.Errorf("安装中断: %w", installFailure(errCodeDownload, errorf(msgHTTPStatus, 404), msgDownloadFailed, "docker.tar.gz"))
+	if key := messageKey(err); key != msgDownloadFailed {
+		t.Errorf("消息键 = %s，期望 %s", key, msgDownloadFailed)
+	}
+	if code := reportError(err); code != errCodeDownload.ExitCode {
+		t.Errorf("退出码 = %d，期望 %d", code, errCodeDownload.ExitCode)
+	}
+	if code := reportError(errors.New("未知命令: foo")); code != 1 {
+		t.Errorf("未分类错误的退出码 = %d，期望 1", code)
+	}
+
+	got := events()
+	if len(got) != 2 || got[0].Type != eventError || got[0].Code != "download" || got[0].ExitCode != 15 || got[1].Code != "unknown" {
+		t.Errorf("error 事件错误: %+v", got)
+	}
+}
+
+// TestErrorCodesUnique 测试错误码和退出码不重复
+func TestErrorCodesUnique(t *testing.T) {
+	codes := []ErrorCode{
+		errCodeDiskNotFound, errCodeTmpDir, errCodeVersionInfo, errCodeSelfUpdate,
+		errCodeCopyLocal, errCodeDownload, errCodeStopServices, errCodeExtract,
+		errCodeBinDir, errCodeMoveBin, errCodeDaemonConfig, errCodeServiceConfig,
+		errCodeDeployScriptMiss, errCodeDeployScript, errCodeBundle, errCodeUnknown,
+	}
+	names := map[string]bool{}
+	exits := map[int]bool{}
+	for _, c := range codes {
+		if names[c.Code] || exits[c.ExitCode] {
+			t.Errorf("重复的错误码: %+v", c)
+		}
+		names[c.Code] = true
+		exits[c.ExitCode] = true
+	}
+}
@@ -2,4 +2,4 @@ module github.com/linkease/docker-for-android/installer
 
 go 1.21
 
-require github.com/jannson/gocertifi v0.0.0-20230825033624-9b45a460050b // indirect
+require github.com/jannson/gocertifi v0.0.0-20230825033624-9b45a460050b
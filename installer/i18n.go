@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// 支持的语言
+const (
+	langZH = "zh-CN"
+	langEN = "en"
+)
+
+// msgKey 消息目录中的键，测试按键而不是按文字判断
+type msgKey string
+
+// catalogs 各语言的消息目录，缺少的键回退到中文
+var catalogs = map[string]map[msgKey]string{
+	langZH: messagesZH,
+	langEN: messagesEN,
+}
+
+// currentLang 当前使用的语言，由 dispatch 根据 --lang 和环境设置
+var currentLang = langZH
+
+// T 按当前语言格式化消息
+func T(key msgKey, args ...interface{}) string {
+	format, ok := catalogs[currentLang][key]
+	if !ok {
+		if format, ok = messagesZH[key]; !ok {
+			format = string(key)
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// MessageError 以消息键描述的错误，Error() 按当前语言输出
+type MessageError struct {
+	Key  msgKey
+	Args []interface{}
+}
+
+// errorf 创建以消息键描述的错误
+func errorf(key msgKey, args ...interface{}) error {
+	return &MessageError{Key: key, Args: args}
+}
+
+func (e *MessageError) Error() string {
+	return T(e.Key, e.Args...)
+}
+
+// Unwrap 返回参数中的第一个错误，使 errors.As 能找到原始错误
+func (e *MessageError) Unwrap() error {
+	for _, arg := range e.Args {
+		if err, ok := arg.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageKey 返回 err 链中最外层的消息键，没有时返回空字符串
+func messageKey(err error) msgKey {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch e := err.(type) {
+		case *MessageError:
+			return e.Key
+		case *InstallError:
+			return e.Key
+		case *httpStatusError:
+			return msgHTTPStatus
+		}
+	}
+	return ""
+}
+
+// parseLanguage 解析 --lang 的值
+func parseLanguage(s string) (string, error) {
+	lang, ok := normalizeLanguage(s)
+	if !ok || (lang == langEN && !strings.HasPrefix(strings.ToLower(s), "en")) {
+		return "", fmt.Errorf("unsupported language %q (supported: zh-CN, en)", s)
+	}
+	return lang, nil
+}
+
+// normalizeLanguage 将 zh_CN.UTF-8、en-US 等区域设置转换为支持的语言
+// 空值、C 和 POSIX 返回 false；其他不支持的语言使用英文
+func normalizeLanguage(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if i := strings.IndexAny(s, ".@"); i >= 0 {
+		s = s[:i]
+	}
+	switch {
+	case s == "" || s == "c" || s == "posix":
+		return "", false
+	case strings.HasPrefix(s, "zh"):
+		return langZH, true
+	default:
+		return langEN, true
+	}
+}
+
+// detectLanguage 依次使用 --lang、LC_ALL、LC_MESSAGES、LANG 和 Android 的 persist.sys.locale
+// adb shell 和开机脚本中通常没有设置 LANG，这时以系统语言为准，都没有时使用中文
+func detectLanguage(flagLang string, getenv, getprop func(string) string) string {
+	for _, s := range []string{flagLang, getenv("LC_ALL"), getenv("LC_MESSAGES"), getenv("LANG")} {
+		if lang, ok := normalizeLanguage(s); ok {
+			return lang
+		}
+	}
+	for _, prop := range []string{"persist.sys.locale", "ro.product.locale"} {
+		if lang, ok := normalizeLanguage(getprop(prop)); ok {
+			return lang
+		}
+	}
+	return langZH
+}
+
+// androidProp 读取 Android 系统属性，不是 Android 时返回空字符串
+func androidProp(name string) string {
+	out, err := exec.Command("getprop", name).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// extractLangFlag 从参数中取出 --lang，所有子命令都支持
+func extractLangFlag(args []string) (string, []string, error) {
+	var lang string
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--lang" || arg == "-lang":
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("--lang requires a value")
+			}
+			lang = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--lang=") || strings.HasPrefix(arg, "-lang="):
+			lang = arg[strings.Index(arg, "=")+1:]
+		case arg == "--":
+			rest = append(rest, args[i:]...)
+			i = len(args)
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if lang != "" {
+		parsed, err := parseLanguage(lang)
+		if err != nil {
+			return "", nil, err
+		}
+		lang = parsed
+	}
+	return lang, rest, nil
+}
+
+// setupLanguage 选择输出语言
+func setupLanguage(flagLang string) {
+	currentLang = detectLanguage(flagLang, os.Getenv, androidProp)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+// formatVerbs 匹配消息中的格式化动词
+var formatVerbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// TestCatalogsComplete 测试每种语言都包含全部消息，且格式化参数一致
+func TestCatalogsComplete(t *testing.T) {
+	for lang, catalog := range catalogs {
+		if len(catalog) != len(messagesZH) {
+			t.Errorf("%s 有 %d 条消息，中文有 %d 条", lang, len(catalog), len(messagesZH))
+		}
+		for key, zh := range messagesZH {
+			msg, ok := catalog[key]
+			if !ok {
+				t.Errorf("%s 缺少消息 %s", lang, key)
+				continue
+			}
+			want := fmt.Sprint(formatVerbs.FindAllString(zh, -1))
+			if got := fmt.Sprint(formatVerbs.FindAllString(msg, -1)); got != want {
+				t.Errorf("%s 的 %s 参数为 %s，中文为 %s", lang, key, got, want)
+			}
+		}
+	}
+}
+
+// useLanguage 在测试期间切换语言
+func useLanguage(t *testing.T, lang string) {
+	saved := currentLang
+	currentLang = lang
+	t.Cleanup(func() { currentLang = saved })
+}
+
+// TestT 测试按当前语言格式化和缺失消息的回退
+func TestT(t *testing.T) {
+	useLanguage(t, langEN)
+	if got := T(msgHTTPStatus, 404); got != "HTTP status: 404" {
+		t.Errorf("英文消息错误: %q", got)
+	}
+	if got := T(msgKey("no.such.key")); got != "no.such.key" {
+		t.Errorf("不存在的键应原样返回: %q", got)
+	}
+
+	err := errorf(msgArchUnsupported, "mips")
+	if messageKey(err) != msgArchUnsupported || err.Error() != "unsupported architecture: mips" {
+		t.Errorf("错误消息错误: %s %v", messageKey(err), err)
+	}
+	currentLang = langZH
+	if err.Error() != "不支持的架构: mips" {
+		t.Errorf("切换语言后应输出中文: %v", err)
+	}
+}
+
+// TestDetectLanguage 测试语言选择的优先级
+func TestDetectLanguage(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(name string) string { return vars[name] }
+	}
+	tests := []struct {
+		name  string
+		flag  string
+		env   map[string]string
+		props map[string]string
+		want  string
+	}{
+		{name: "默认中文", want: langZH},
+		{name: "参数优先", flag: "en", env: map[string]string{"LANG": "zh_CN.UTF-8"}, want: langEN},
+		{name: "LC_ALL 优先于 LANG", env: map[string]string{"LC_ALL": "en_US.UTF-8", "LANG": "zh_CN.UTF-8"}, want: langEN},
+		{name: "忽略 C", env: map[string]string{"LANG": "C"}, props: map[string]string{"persist.sys.locale": "en-US"}, want: langEN},
+		{name: "Android 系统语言", props: map[string]string{"persist.sys.locale": "zh-Hans-CN"}, want: langZH},
+		{name: "出厂语言", props: map[string]string{"ro.product.locale": "en-GB"}, want: langEN},
+		{name: "其他语言使用英文", env: map[string]string{"LANG": "de_DE.UTF-8"}, want: langEN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage(tt.flag, env(tt.env), env(tt.props)); got != tt.want {
+				t.Errorf("语言 = %s，期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractLangFlag 测试从任意位置取出 --lang
+func TestExtractLangFlag(t *testing.T) {
+	lang, rest, err := extractLangFlag([]string{"install", "--lang", "en", "-channel", "beta"})
+	if err != nil || lang != langEN || fmt.Sprint(rest) != "[install -channel beta]" {
+		t.Errorf("解析错误: %q %v %v", lang, rest, err)
+	}
+	lang, rest, err = extractLangFlag([]string{"--lang=zh_CN", "update", "check"})
+	if err != nil || lang != langZH || fmt.Sprint(rest) != "[update check]" {
+		t.Errorf("解析错误: %q %v %v", lang, rest, err)
+	}
+	if _, _, err := extractLangFlag([]string{"--lang", "fr"}); err == nil {
+		t.Error("不支持的语言应报错")
+	}
+	if _, _, err := extractLangFlag([]string{"--lang"}); err == nil {
+		t.Error("缺少参数值应报错")
+	}
+}
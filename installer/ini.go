@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// iniEntry INI 文件中的一行（键值对、注释或空行）
+type iniEntry struct {
+	key   string
+	value string
+	// verbatim 为 true 时表示注释或空行，raw 原样输出
+	verbatim bool
+	raw      string
+}
+
+// iniSection INI 文件中的一个段
+type iniSection struct {
+	name    string
+	entries []iniEntry
+}
+
+// iniDocument 保留顺序和注释的 INI 文档，用于读写 supervisord 配置
+type iniDocument struct {
+	preamble []string
+	sections []*iniSection
+}
+
+// parseINI 解析 supervisord 风格的 INI 文件
+// 以反斜杠结尾的行与下一行合并为同一个值，原样保留换行和缩进
+func parseINI(r io.Reader) (*iniDocument, error) {
+	doc := &iniDocument{}
+	var current *iniSection
+	var pending *iniEntry
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if pending != nil {
+			pending.value += "\n" + line
+			if !strings.HasSuffix(line, "\\") {
+				current.entries = append(current.entries, *pending)
+				pending = nil
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#"):
+			if current == nil {
+				doc.preamble = append(doc.preamble, line)
+			} else {
+				current.entries = append(current.entries, iniEntry{verbatim: true, raw: line})
+			}
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			current = &iniSection{name: strings.TrimSpace(trimmed[1 : len(trimmed)-1])}
+			doc.sections = append(doc.sections, current)
+		default:
+			if current == nil {
+				return nil, fmt.Errorf("第 %d 行: 键值对不在任何段中", lineNo)
+			}
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("第 %d 行: 无法解析 %q", lineNo, line)
+			}
+			entry := iniEntry{key: strings.TrimSpace(parts[0]), value: strings.TrimSpace(parts[1])}
+			if strings.HasSuffix(entry.value, "\\") {
+				pending = &entry
+				continue
+			}
+			current.entries = append(current.entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		current.entries = append(current.entries, *pending)
+	}
+	return doc, nil
+}
+
+// readINIFile 读取 INI 文件，文件不存在时返回空文档
+func readINIFile(path string) (*iniDocument, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &iniDocument{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	doc, err := parseINI(f)
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", path, err)
+	}
+	return doc, nil
+}
+
+// String 输出 INI 文本
+func (d *iniDocument) String() string {
+	var b strings.Builder
+	for _, line := range d.preamble {
+		b.WriteString(line + "\n")
+	}
+	for _, s := range d.sections {
+		b.WriteString("[" + s.name + "]\n")
+		for _, e := range s.entries {
+			if e.verbatim {
+				b.WriteString(e.raw + "\n")
+				continue
+			}
+			b.WriteString(e.key + "=" + e.value + "\n")
+		}
+	}
+	return b.String()
+}
+
+// section 返回指定名称的段，不存在时返回 nil
+func (d *iniDocument) section(name string) *iniSection {
+	for _, s := range d.sections {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// ensureSection 返回指定名称的段，不存在时在末尾创建
+func (d *iniDocument) ensureSection(name string) *iniSection {
+	if s := d.section(name); s != nil {
+		return s
+	}
+	s := &iniSection{name: name}
+	d.sections = append(d.sections, s)
+	return s
+}
+
+// get 读取键值
+func (s *iniSection) get(key string) (string, bool) {
+	for _, e := range s.entries {
+		if !e.verbatim && e.key == key {
+			return e.value, true
+		}
+	}
+	return "", false
+}
+
+// set 设置键值，已存在时原位替换，否则追加
+func (s *iniSection) set(key, value string) {
+	for i, e := range s.entries {
+		if !e.verbatim && e.key == key {
+			s.entries[i].value = value
+			return
+		}
+	}
+	s.entries = append(s.entries, iniEntry{key: key, value: value})
+}
+
+// unset 删除键
+func (s *iniSection) unset(key string) {
+	entries := s.entries[:0]
+	for _, e := range s.entries {
+		if !e.verbatim && e.key == key {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	s.entries = entries
+}
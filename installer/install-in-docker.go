@@ -1,11 +1,14 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 const (
@@ -13,9 +16,12 @@ const (
 	dockerRoot = "/data/local/docker"
 	binDir     = "/data/local/docker/bin"
 
+	// 安装到设备上的 installer，供 start.sh 等脚本调用子命令
+	installerBinPath = "/data/local/docker/bin/install-docker"
+
 	// 版本文件
 	versionFile = "version.txt"
-	
+
 	// 本地安装模式
 	localInstallDir = "/sdcard/docker-install"
 )
@@ -25,9 +31,58 @@ type VersionInfo struct {
 	DockerSHA256 string
 	BinSHA256    string
 	Architecture string
+
+	// installer 自身的版本信息，旧的 version.txt 中没有这些字段
+	InstallerVersion    string
+	InstallerMinVersion string
+	InstallerSHA256     string
+
+	// Mirrors 发布的其他下载源（MIRRORS=url1,url2），排在已配置的下载源之后
+	Mirrors []string
 }
 
 func main() {
+	if err := dispatch(os.Args[1:]); err != nil {
+		os.Exit(reportError(err))
+	}
+}
+
+// runInstall 执行完整的安装流程
+func runInstall(args []string) (err error) {
+	fs := flag.NewFlagSet("install", flag.ExitOnError)
+	channel := fs.String("channel", "", "发布通道，默认使用 update.json 中的设置")
+	noSelfUpdate := fs.Bool("no-self-update", false, "不检查 installer 自身的新版本")
+	bundle := fs.String("bundle", "", "从离线安装包安装，不访问网络")
+	reprobeStorage := fs.Bool("reprobe-storage", false, "按本次探测结果选择存储驱动，即使与正在使用的驱动不同")
+	bundlePublicKey := fs.String("bundle-key", "", "校验离线安装包签名的 ed25519 公钥（base64），默认使用发布公钥")
+	allowUnsigned := fs.Bool("allow-unsigned", false, "接受没有签名的离线安装包和 installer 更新，只校验 SHA256")
+	output := addOutputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := setOutputMode(*output); err != nil {
+		return err
+	}
+	if *channel == "" {
+		*channel = defaultChannel
+		if config, err := loadUpdateConfig(updateConfigPath); err == nil {
+			*channel = config.Channel
+		}
+	}
+
+	// 安装日志记录终端输出、脚本输出和 HTTP 请求，出问题时用 support-bundle 打包
+	if log, err := startInstallLog(installLogDir, os.Args); err != nil {
+		fmt.Println(T(msgInstallLogFailed, err))
+	} else {
+		defer func() {
+			if err != nil {
+				log.Printf("%s", T(msgErrorPrefix, err))
+			}
+			log.Close()
+		}()
+		fmt.Println(T(msgInstallLog, log.path))
+	}
+
 	fmt.Println("==========================================")
 	fmt.Println("Docker for Android - Installer")
 	fmt.Println("==========================================")
@@ -37,166 +92,233 @@ func main() {
 	httpClient := CreateHTTPClient()
 
 	// Step 1: 检测硬盘挂载
-	fmt.Println("[1/5] 检测硬盘挂载点...")
+	step := startStep("detect_disk", 1, "1/5", msgStepDetectDisk)
 	diskRoot, err := detectDiskMount()
 	if err != nil {
-		fmt.Printf("✗ 错误: %v\n", err)
-		fmt.Println("✗ Docker 需要 ext4 格式的外置硬盘才能运行")
-		fmt.Println("✗ 请确保已接入并格式化硬盘后再运行此程序")
-		os.Exit(1)
+		fmt.Println(T(msgDiskNeedExt4))
+		fmt.Println(T(msgDiskInsertHint))
+		return installFailure(errCodeDiskNotFound, err, msgDiskNotFound)
 	}
-	fmt.Printf("✓ 检测到硬盘挂载点: %s\n", diskRoot)
-	fmt.Println()
+	fmt.Println(T(msgDiskDetected, diskRoot))
 
-	// 设置临时文件夹
-	tmpDir := filepath.Join(diskRoot, "Cache", "installer")
-	if err := os.MkdirAll(tmpDir, 0755); err != nil {
-		fmt.Printf("✗ 错误: 无法创建临时目录 %s: %v\n", tmpDir, err)
-		os.Exit(1)
+	// 设置临时文件夹，安装包按 SHA256 缓存在其中的 blobs 目录，重装和回滚时不用重新下载
+	tmpDir := diskCacheDir(diskRoot)
+	cache, err := openArtifactCache(tmpDir)
+	if err != nil {
+		return installFailure(errCodeTmpDir, err, msgTmpDirFailed, tmpDir)
 	}
-	fmt.Printf("✓ 临时目录: %s\n", tmpDir)
+	fmt.Println(T(msgTmpDir, tmpDir))
+	step.finish()
 	fmt.Println()
 
 	// Step 2: 获取版本信息
-	fmt.Println("[2/5] 获取版本信息...")
-	version, err := getVersionInfo(httpClient, tmpDir)
-	if err != nil {
-		fmt.Printf("✗ 错误: 无法获取版本信息: %v\n", err)
-		os.Exit(1)
+	step = startStep("version_info", 2, "2/5", msgStepVersionInfo)
+	var version *VersionInfo
+	// images 离线安装包中的镜像，部署脚本在启动 dockerd 后导入
+	var images []string
+	imagesDir := filepath.Join(tmpDir, "images")
+	if *bundle != "" {
+		// 离线安装包中的安装包导入缓存，之后的下载步骤直接命中缓存
+		arch, err := detectArchitecture()
+		if err != nil {
+			return installFailure(errCodeVersionInfo, err, msgVersionInfoFailed)
+		}
+		fmt.Println(T(msgBundleReading, *bundle))
+		if version, images, err = importBundle(*bundle, bundleKey(*bundlePublicKey), *allowUnsigned, arch, cache, imagesDir); err != nil {
+			return installFailure(errCodeBundle, err, msgBundleFailed)
+		}
+		// 离线安装时不更新自身，低于最低版本时停止，改用离线安装包中附带的 installer
+		if !*noSelfUpdate && belowMinVersion(installerVersion, version) {
+			err := errorf(msgBundleInstallerTooOld, installerVersion, version.InstallerMinVersion, installerFileName(version.Architecture))
+			return installFailure(errCodeSelfUpdate, err, msgSelfUpdateFailed)
+		}
+	} else if version, err = getVersionInfo(httpClient, tmpDir, manifestName(*channel)); err != nil {
+		return installFailure(errCodeVersionInfo, err, msgVersionInfoFailed)
+	}
+	fmt.Println(T(msgVersion, version.Version))
+	fmt.Println(T(msgArch, version.Architecture))
+	addManifestMirrors(version.Mirrors)
+
+	// installer 低于发布要求时先更新自身，成功后以相同参数重新执行，不会返回
+	// 离线安装时不访问网络，离线安装包中附带了对应版本的 installer
+	if !*noSelfUpdate && *bundle == "" {
+		if err := checkSelfUpdate(httpClient, version, *allowUnsigned); err != nil {
+			return installFailure(errCodeSelfUpdate, err, msgSelfUpdateFailed)
+		}
 	}
-	fmt.Printf("✓ 版本: %s\n", version.Version)
-	fmt.Printf("✓ 架构: %s\n", version.Architecture)
+	step.finish()
 	fmt.Println()
 
 	// Step 3: 下载文件
-	fmt.Println("[3/5] 下载安装文件...")
+	step = startStep("download", 3, "3/5", msgStepDownload)
 
-	// 下载 docker 通用包
 	dockerTarFile := fmt.Sprintf("docker-%s.tar.gz", version.Version)
-	dockerTarPath := filepath.Join(tmpDir, dockerTarFile)
-	
-	// 检查本地是否有文件
-	localDockerPath := filepath.Join(localInstallDir, dockerTarFile)
-	if fileExists(localDockerPath) {
-		fmt.Printf("⏳ 使用本地文件 %s...\n", localDockerPath)
-		if err := copyFile(localDockerPath, dockerTarPath); err != nil {
-			fmt.Printf("✗ 错误: 复制本地文件失败: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("✓ %s 复制完成\n", dockerTarFile)
-	} else {
-		fmt.Printf("⏳ 下载 %s...\n", dockerTarFile)
-		if err := downloadFile(httpClient, dockerTarPath, dockerTarFile, version.DockerSHA256); err != nil {
-			fmt.Printf("✗ 错误: 下载失败: %v\n", err)
-			os.Exit(1)
+	binTarFile := fmt.Sprintf("docker-for-android-bin-%s-%s.tar.gz", version.Version, version.Architecture)
+	if peerDiscover && *bundle == "" && (!cache.has(version.DockerSHA256) || !cache.has(version.BinSHA256)) {
+		// 局域网中有这些安装包的设备作为最优先的下载源，下载后仍按 version.txt 校验 SHA256
+		peers, err := discoverPeers(peerBroadcastTargets(peerPort), []string{dockerTarFile, binTarFile}, peerDiscoverTimeout)
+		if err != nil {
+			fmt.Println(T(msgPeersWarn, err))
+		} else if len(peers) > 0 {
+			fmt.Println(T(msgPeersFound, len(peers)))
+			addPeerMirrors(peers)
 		}
-		fmt.Printf("✓ %s 下载完成\n", dockerTarFile)
+	}
+
+	// 下载 docker 通用包，依次使用缓存、本地文件和下载源
+	dockerTarPath, err := fetchArtifact(httpClient, cache, localInstallDir, dockerTarFile, version.DockerSHA256, version.Version)
+	if err != nil {
+		return err
 	}
 
 	// 下载架构特定二进制包
-	binTarFile := fmt.Sprintf("docker-for-android-bin-%s-%s.tar.gz", version.Version, version.Architecture)
-	binTarPath := filepath.Join(tmpDir, binTarFile)
-	
-	// 检查本地是否有文件
-	localBinPath := filepath.Join(localInstallDir, binTarFile)
-	if fileExists(localBinPath) {
-		fmt.Printf("⏳ 使用本地文件 %s...\n", localBinPath)
-		if err := copyFile(localBinPath, binTarPath); err != nil {
-			fmt.Printf("✗ 错误: 复制本地文件失败: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("✓ %s 复制完成\n", binTarFile)
-	} else {
-		fmt.Printf("⏳ 下载 %s...\n", binTarFile)
-		if err := downloadFile(httpClient, binTarPath, binTarFile, version.BinSHA256); err != nil {
-			fmt.Printf("✗ 错误: 下载失败: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("✓ %s 下载完成\n", binTarFile)
+	binTarPath, err := fetchArtifact(httpClient, cache, localInstallDir, binTarFile, version.BinSHA256, version.Version)
+	if err != nil {
+		return err
 	}
+	step.finish()
 	fmt.Println()
 
 	// Step 3.5: 停止正在运行的服务
-	fmt.Println("[3.5/5] 停止现有服务...")
+	step = startStep("stop_services", 4, "3.5/5", msgStepStopServices)
 	if err := stopSupervisord(); err != nil {
-		fmt.Printf("✗ 错误: 停止 supervisord 服务失败: %v\n", err)
-		os.Exit(1)
+		return installFailure(errCodeStopServices, err, msgStopServicesFailed)
 	}
+	step.finish()
 	fmt.Println()
 
 	// Step 4: 解压文件
-	fmt.Println("[4/5] 解压安装文件...")
+	step = startStep("extract", 5, "4/5", msgStepExtract)
 
 	// 解压 docker 包到 /data/local/docker（不去前缀）
-	fmt.Printf("⏳ 解压 %s 到 %s...\n", dockerTarFile, dockerRoot)
+	fmt.Println(T(msgExtracting, dockerTarFile, dockerRoot))
 	if err := extractTarGz(dockerTarPath, "/data/local", ""); err != nil {
-		fmt.Printf("✗ 错误: 解压失败: %v\n", err)
-		os.Exit(1)
+		return installFailure(errCodeExtract, err, msgExtractFailed, dockerTarFile)
 	}
-	fmt.Printf("✓ %s 解压完成\n", dockerTarFile)
+	fmt.Println(T(msgExtracted, dockerTarFile))
 
 	// 解压二进制包到临时目录
 	binExtractDir := filepath.Join(dockerRoot, "tmp_bin_extract")
 	os.RemoveAll(binExtractDir) // 保证干净
 	if err := os.MkdirAll(binExtractDir, 0755); err != nil {
-		fmt.Printf("✗ 错误: 创建临时解压目录失败: %v\n", err)
-		os.Exit(1)
+		return installFailure(errCodeExtract, err, msgExtractDirFailed)
 	}
-	fmt.Printf("⏳ 解压 %s 到临时目录 %s...\n", binTarFile, binExtractDir)
+	fmt.Println(T(msgExtractingTmp, binTarFile, binExtractDir))
 	if err := extractTarGz(binTarPath, binExtractDir, ""); err != nil {
-		fmt.Printf("✗ 错误: 解压失败: %v\n", err)
-		os.Exit(1)
+		return installFailure(errCodeExtract, err, msgExtractFailed, binTarFile)
 	}
-	fmt.Printf("✓ %s 解压完成\n", binTarFile)
+	fmt.Println(T(msgExtracted, binTarFile))
 
 	if _, err := os.Stat(binDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(binDir, 0755); err != nil {
-			fmt.Printf("✗ 错误: 创建二进制目录失败: %v\n", err)
-			os.Exit(1)
+			return installFailure(errCodeBinDir, err, msgBinDirFailed)
 		}
 	}
 
 	// 移动 arm64_bin/* 到 binDir
 	armBinDir := filepath.Join(binExtractDir, "arm64_bin")
 	if err := moveBinFiles(armBinDir, binDir); err != nil {
-		fmt.Printf("✗ 错误: 移动 arm64_bin 文件失败: %v\n", err)
-		os.Exit(1)
+		return installFailure(errCodeMoveBin, err, msgMoveBinFailed)
+	}
+	fmt.Println(T(msgBinMoved, binDir))
+
+	// 复制 installer 自身到 bin 目录
+	if err := installSelf(installerBinPath); err != nil {
+		fmt.Println(T(msgInstallSelfWarn, installerBinPath, err))
 	}
-	fmt.Printf("✓ arm64_bin 文件已移动到 %s\n", binDir)
 
 	// 设置二进制文件权限
 	if err := setBinPermissions(binDir); err != nil {
-		fmt.Printf("⚠ 警告: 设置二进制文件权限失败: %v\n", err)
+		fmt.Println(T(msgBinPermWarn, err))
+	}
+
+	// 合并安装包默认的 daemon.json 和用户配置
+	daemonPaths := defaultDaemonConfigPaths()
+	if err := snapshotDaemonDefaults(daemonPaths); err != nil {
+		return installFailure(errCodeDaemonConfig, err, msgDaemonSnapshotFailed)
+	}
+	if err := detectDaemonConfig(daemonPaths, diskRoot, *reprobeStorage); err != nil {
+		return installFailure(errCodeDaemonConfig, err, msgDaemonConfigFailed)
+	}
+	if _, err := applyDaemonConfig(daemonPaths); err != nil {
+		return installFailure(errCodeDaemonConfig, err, msgDaemonConfigFailed)
+	}
+	fmt.Println(T(msgDaemonConfigDone, daemonPaths.Output))
+
+	// 根据服务注册表生成 supervisord 配置
+	if err := renderServiceConfigs(serviceConfigDir); err != nil {
+		return installFailure(errCodeServiceConfig, err, msgServiceConfigFailed)
+	}
+	fmt.Println(T(msgServiceConfigDone, serviceConfigDir))
+
+	// 记录数据盘，开机时确认挂载的是同一块盘再启动 dockerd
+	if id, err := recordDataDisk(diskRoot); err != nil {
+		fmt.Println(T(msgDataDiskWarn, err))
+	} else if id.UUID != "" {
+		fmt.Println(T(msgDataDiskUUID, id.MountPoint, id.UUID))
+	} else {
+		fmt.Println(T(msgDataDiskFS, id.MountPoint, id.FSType))
 	}
+	step.finish()
 	fmt.Println()
 
 	// Step 5: 执行部署脚本
-	fmt.Println("[5/5] 执行部署脚本...")
+	step = startStep("deploy", 6, "5/5", msgStepDeploy)
 	deployScript := filepath.Join(dockerRoot, "deploy-in-android.sh")
 	if _, err := os.Stat(deployScript); os.IsNotExist(err) {
-		fmt.Printf("✗ 错误: 部署脚本不存在: %s\n", deployScript)
-		os.Exit(1)
+		return installFailure(errCodeDeployScriptMiss, nil, msgDeployScriptMissing, deployScript)
 	}
 
+	if *bundle != "" {
+		// 部署脚本在 dockerd 就绪后 docker load 离线安装包中的镜像，本地已有的镜像不再拉取
+		os.Setenv("DFA_OFFLINE", "1")
+		if len(images) > 0 {
+			os.Setenv("DFA_IMAGES_DIR", imagesDir)
+		}
+	}
 	if err := executeScript(deployScript, diskRoot); err != nil {
-		fmt.Printf("✗ 错误: 部署脚本执行失败: %v\n", err)
-		os.Exit(1)
+		return installFailure(errCodeDeployScript, err, msgDeployScriptFailed)
 	}
+	step.finish()
 	fmt.Println()
 
-	// 清理临时文件
-	fmt.Println("⏳ 清理临时文件...")
-	os.RemoveAll(tmpDir)
-	fmt.Println("✓ 清理完成")
+	// 记录已安装的版本
+	state := &InstallState{
+		Version:      version.Version,
+		Channel:      *channel,
+		Architecture: version.Architecture,
+		DiskRoot:     diskRoot,
+		InstalledAt:  time.Now(),
+	}
+	if err := saveInstallState(installStatePath, state); err != nil {
+		fmt.Println(T(msgSaveStateWarn, err))
+	}
+
+	// 清理临时文件，按保留策略清理旧版本的安装包
+	fmt.Println(T(msgCleaning))
+	cleanTmpDir(tmpDir)
+	cacheConfig, err := loadCacheConfig(cacheConfigPath)
+	if err != nil {
+		fmt.Println(T(msgCacheWarn, err))
+		cacheConfig = defaultCacheConfig()
+	}
+	if removed, err := cache.prune(cacheConfig, version.Version); err != nil {
+		fmt.Println(T(msgCacheWarn, err))
+	} else if len(removed) > 0 {
+		fmt.Println(T(msgCachePruned, len(removed)))
+	}
+	fmt.Println(T(msgCleaned))
 	fmt.Println()
 
 	fmt.Println("==========================================")
-	fmt.Println("安装完成！")
+	fmt.Println(T(msgInstallDone))
 	fmt.Println("==========================================")
+	emit(Event{Type: eventDone, Version: version.Version})
+	return nil
 }
 
-// getVersionInfo 获取版本信息
-func getVersionInfo(client *http.Client, tmpDir string) (*VersionInfo, error) {
+// getVersionInfo 获取版本信息，manifest 为通道对应的版本文件
+func getVersionInfo(client *http.Client, tmpDir, manifest string) (*VersionInfo, error) {
 	// 检测当前架构
 	arch, err := detectArchitecture()
 	if err != nil {
@@ -206,25 +328,29 @@ func getVersionInfo(client *http.Client, tmpDir string) (*VersionInfo, error) {
 	// 先尝试从本地获取 version.txt
 	localVersionPath := filepath.Join(localInstallDir, versionFile)
 	versionPath := filepath.Join(tmpDir, versionFile)
-	
+
 	if fileExists(localVersionPath) {
-		fmt.Printf("✓ 使用本地版本文件: %s\n", localVersionPath)
+		fmt.Println(T(msgUseLocalVersion, localVersionPath))
 		if err := copyFile(localVersionPath, versionPath); err != nil {
-			return nil, fmt.Errorf("无法复制本地 version.txt: %v", err)
+			return nil, errorf(msgCopyLocalVersionFailed, err)
 		}
 	} else {
 		// 从 CDN 下载 version.txt
-		if err := downloadFile(client, versionPath, versionFile, ""); err != nil {
-			return nil, fmt.Errorf("无法下载 version.txt: %v", err)
+		if err := downloadFile(client, versionPath, manifest, ""); err != nil {
+			return nil, errorf(msgManifestFailed, manifest, err)
 		}
 	}
 
 	// 解析 version.txt
 	content, err := os.ReadFile(versionPath)
 	if err != nil {
-		return nil, fmt.Errorf("无法读取 version.txt: %v", err)
+		return nil, errorf(msgReadVersionFailed, err)
 	}
+	return parseVersionInfo(content, arch)
+}
 
+// parseVersionInfo 解析 version.txt 内容，arch 决定读取哪个二进制包的 SHA256
+func parseVersionInfo(content []byte, arch string) (*VersionInfo, error) {
 	info := &VersionInfo{
 		Architecture: arch,
 	}
@@ -251,17 +377,29 @@ func getVersionInfo(client *http.Client, tmpDir string) (*VersionInfo, error) {
 			info.DockerSHA256 = value
 		case fmt.Sprintf("BIN_%s_SHA256", strings.ToUpper(arch)):
 			info.BinSHA256 = value
+		case "INSTALLER_VERSION":
+			info.InstallerVersion = value
+		case "INSTALLER_MIN_VERSION":
+			info.InstallerMinVersion = value
+		case fmt.Sprintf("INSTALLER_%s_SHA256", strings.ToUpper(arch)):
+			info.InstallerSHA256 = value
+		case "MIRRORS":
+			for _, m := range strings.Split(value, ",") {
+				if m = strings.TrimSpace(m); m != "" {
+					info.Mirrors = append(info.Mirrors, m)
+				}
+			}
 		}
 	}
 
 	if info.Version == "" {
-		return nil, fmt.Errorf("version.txt 中缺少 VERSION 字段")
+		return nil, errorf(msgVersionMissingField, "VERSION")
 	}
 	if info.DockerSHA256 == "" {
-		return nil, fmt.Errorf("version.txt 中缺少 DOCKER_SHA256 字段")
+		return nil, errorf(msgVersionMissingField, "DOCKER_SHA256")
 	}
 	if info.BinSHA256 == "" {
-		return nil, fmt.Errorf("version.txt 中缺少 BIN_%s_SHA256 字段", strings.ToUpper(arch))
+		return nil, errorf(msgVersionMissingField, fmt.Sprintf("BIN_%s_SHA256", strings.ToUpper(arch)))
 	}
 
 	return info, nil
@@ -273,17 +411,49 @@ func fileExists(path string) bool {
 	return err == nil
 }
 
-// copyFile 复制文件
+// copyFile 流式复制文件，安装包可能有几百 MB，不一次读入内存
 func copyFile(src, dst string) error {
-	input, err := os.ReadFile(src)
+	input, err := os.Open(src)
 	if err != nil {
 		return err
 	}
-	
+	defer input.Close()
+
 	// 确保目标目录存在
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return err
 	}
-	
-	return os.WriteFile(dst, input, 0644)
+
+	output, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
+// installSelf 将当前运行的 installer 复制到 dst
+func installSelf(dst string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return err
+	}
+	if self == dst {
+		return nil
+	}
+	// 先写临时文件再替换，避免覆盖正在运行的旧版本
+	tmp := dst + ".new"
+	if err := copyFile(self, tmp); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// installStatePath 记录已安装的版本，供 dfa-agent 和升级检查读取
+	installStatePath = dockerRoot + "/etc/install.json"
+	// defaultChannel 未指定时使用的发布通道
+	defaultChannel = "stable"
+)
+
+// InstallState 已安装版本的信息
+type InstallState struct {
+	Version      string    `json:"version"`
+	Channel      string    `json:"channel"`
+	Architecture string    `json:"architecture"`
+	DiskRoot     string    `json:"disk_root"`
+	InstalledAt  time.Time `json:"installed_at"`
+}
+
+// loadInstallState 读取安装记录，文件不存在时返回 nil
+func loadInstallState(path string) (*InstallState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state InstallState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", path, err)
+	}
+	if state.Channel == "" {
+		state.Channel = defaultChannel
+	}
+	return &state, nil
+}
+
+// saveInstallState 写入安装记录
+func saveInstallState(path string, state *InstallState) error {
+	return writeJSONFile(path, state)
+}
+
+// writeJSONFile 以缩进格式写入 JSON 文件
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
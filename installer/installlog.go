@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// installLogDir 安装日志目录，出问题时由 support-bundle 打包
+	installLogDir = dockerRoot + "/logs"
+	// installLogKeep 最多保留的安装日志数量
+	installLogKeep = 10
+	// logTimeFormat 日志每行的时间戳
+	logTimeFormat = "2006-01-02 15:04:05.000"
+)
+
+// timestampWriter 在每行前加时间戳，\r 分隔的进度输出也按行记录
+type timestampWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	now     func() time.Time
+	midLine bool
+}
+
+func newTimestampWriter(w io.Writer) *timestampWriter {
+	return &timestampWriter{w: w, now: time.Now}
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var b strings.Builder
+	for _, c := range string(p) {
+		if !t.midLine {
+			if c == '\n' || c == '\r' {
+				continue
+			}
+			b.WriteString(t.now().Format(logTimeFormat))
+			b.WriteByte(' ')
+			t.midLine = true
+		}
+		if c == '\r' {
+			c = '\n'
+		}
+		b.WriteRune(c)
+		if c == '\n' {
+			t.midLine = false
+		}
+	}
+	if _, err := io.WriteString(t.w, b.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// installLog 把安装过程的输出同时写到终端和日志文件
+type installLog struct {
+	path   string
+	file   *os.File
+	writer *timestampWriter
+
+	// stdout 被替换前的 os.Stdout，关闭时恢复
+	stdout *os.File
+	pipe   *os.File
+	done   chan struct{}
+}
+
+// startInstallLog 在 dir 中创建日志文件，并将 os.Stdout 的输出复制一份到日志
+// 部署脚本的输出经 streamOutput 打印，也会一并记录
+func startInstallLog(dir string, args []string) (*installLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	pruneInstallLogs(dir, installLogKeep-1)
+
+	path := filepath.Join(dir, "install-"+time.Now().Format("20060102-150405")+".log")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l := &installLog{path: path, file: file, writer: newTimestampWriter(file)}
+	writeEnvironment(l.writer, args)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	l.stdout, l.pipe, l.done = os.Stdout, w, make(chan struct{})
+	go func(console *os.File) {
+		defer close(l.done)
+		io.Copy(io.MultiWriter(console, l.writer), r)
+		r.Close()
+	}(os.Stdout)
+	os.Stdout = w
+
+	httpTraceLog = l.writer
+	return l, nil
+}
+
+// Printf 只写入日志，不输出到终端
+func (l *installLog) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(l.writer, format+"\n", args...)
+}
+
+// Close 恢复 os.Stdout，等待剩余输出写完后关闭日志
+func (l *installLog) Close() error {
+	httpTraceLog = nil
+	os.Stdout = l.stdout
+	l.pipe.Close()
+	<-l.done
+	return l.file.Close()
+}
+
+// writeEnvironment 在日志开头记录设备和运行环境
+func writeEnvironment(w io.Writer, args []string) {
+	fmt.Fprintf(w, "installer %s (%s/%s, %s)\n", installerVersion, runtime.GOOS, runtime.GOARCH, runtime.Version())
+	fmt.Fprintf(w, "args: %s\n", strings.Join(args, " "))
+	fmt.Fprintf(w, "uid: %d\n", os.Getuid())
+	if out, err := (execRunner{}).Run("uname", "-a"); err == nil {
+		fmt.Fprintf(w, "uname: %s\n", strings.TrimSpace(out))
+	}
+	for _, prop := range []string{"ro.product.model", "ro.build.version.release", "ro.build.version.sdk", "ro.product.cpu.abi", "persist.sys.locale"} {
+		if v := androidProp(prop); v != "" {
+			fmt.Fprintf(w, "%s: %s\n", prop, v)
+		}
+	}
+	for _, name := range []string{"PATH", "LANG", "LC_ALL", ISE_HTTP_LOG} {
+		if v := os.Getenv(name); v != "" {
+			fmt.Fprintf(w, "env %s=%s\n", name, v)
+		}
+	}
+	if state, err := loadInstallState(installStatePath); err == nil && state != nil {
+		fmt.Fprintf(w, "installed: %s (%s), disk %s\n", state.Version, state.Channel, state.DiskRoot)
+	}
+}
+
+// installLogs 返回 dir 中的安装日志，按时间从旧到新排列
+func installLogs(dir string) []string {
+	logs, _ := filepath.Glob(filepath.Join(dir, "install-*.log"))
+	sort.Strings(logs)
+	return logs
+}
+
+// pruneInstallLogs 只保留最近 keep 个安装日志
+func pruneInstallLogs(dir string, keep int) {
+	logs := installLogs(dir)
+	for len(logs) > keep {
+		os.Remove(logs[0])
+		logs = logs[1:]
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTimestampWriter 测试按行添加时间戳，跨多次写入的行只加一次
+func TestTimestampWriter(t *testing.T) {
+	var buf strings.Builder
+	w := newTimestampWriter(&buf)
+	w.now = func() time.Time { return time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC) }
+
+	w.Write([]byte("⏳ 下载中"))
+	w.Write([]byte(" 10%\r⏳ 下载中 100%\r\n"))
+	w.Write([]byte("\n✓ 完成\n"))
+
+	want := "2024-05-01 08:30:00.000 ⏳ 下载中 10%\n" +
+		"2024-05-01 08:30:00.000 ⏳ 下载中 100%\n" +
+		"2024-05-01 08:30:00.000 ✓ 完成\n"
+	if buf.String() != want {
+		t.Errorf("日志内容 =\n%s\n期望\n%s", buf.String(), want)
+	}
+}
+
+// TestPruneInstallLogs 测试只保留最近的安装日志
+func TestPruneInstallLogs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"install-20240101-100000.log", "install-20240301-100000.log", "install-20240201-100000.log", "dfa-agent.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pruneInstallLogs(dir, 2)
+
+	var names []string
+	for _, path := range installLogs(dir) {
+		names = append(names, filepath.Base(path))
+	}
+	if strings.Join(names, ",") != "install-20240201-100000.log,install-20240301-100000.log" {
+		t.Errorf("保留的日志错误: %v", names)
+	}
+	if !fileExists(filepath.Join(dir, "dfa-agent.log")) {
+		t.Error("不应删除其他日志")
+	}
+}
+
+// TestInstallLog 测试终端输出被复制到日志，关闭后恢复 os.Stdout
+func TestInstallLog(t *testing.T) {
+	dir := t.TempDir()
+	stdout := os.Stdout
+	log, err := startInstallLog(dir, []string{"installer", "install"})
+	if err != nil {
+		t.Fatalf("创建日志失败: %v", err)
+	}
+	if httpTraceLog == nil {
+		t.Error("应记录 HTTP 请求")
+	}
+	os.Stdout.WriteString("✓ 已检测到硬盘\n")
+	log.Printf("只写入日志")
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if os.Stdout != stdout || httpTraceLog != nil {
+		t.Error("关闭后应恢复 os.Stdout")
+	}
+
+	data, err := os.ReadFile(log.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"args: installer install", "✓ 已检测到硬盘", "只写入日志"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("日志中缺少 %q:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KernelProbe 内核配置和运行时信息，可以从 fixture 目录加载
+type KernelProbe struct {
+	Release string `json:"release"`
+	// Config 已启用（=y 或 =m）的内核选项，读不到内核配置时为 nil
+	Config map[string]string `json:"-"`
+	// ConfigSource 内核配置的来源，/proc/config.gz 或 /boot/config-<release>
+	ConfigSource string `json:"config_source,omitempty"`
+	// Filesystems /proc/filesystems 中的文件系统
+	Filesystems []string `json:"filesystems"`
+	// Namespaces /proc/self/ns 中的命名空间
+	Namespaces []string `json:"namespaces"`
+	// IPTables /proc/net/ip_tables_names 中已加载的表
+	IPTables []string `json:"iptables"`
+	// Seccomp /proc/self/status 中有 Seccomp 字段
+	Seccomp bool `json:"seccomp"`
+}
+
+// loadKernelProbe 从 root 下的 proc 和 boot 文件读取内核信息，root 为 "/" 时读取本机
+func loadKernelProbe(root string) (*KernelProbe, error) {
+	probe := &KernelProbe{}
+	if content, err := os.ReadFile(filepath.Join(root, "proc", "sys", "kernel", "osrelease")); err == nil {
+		probe.Release = strings.TrimSpace(string(content))
+	}
+
+	config, err := readKernelConfig(filepath.Join(root, "proc", "config.gz"))
+	switch {
+	case err == nil:
+		probe.Config, probe.ConfigSource = config, "/proc/config.gz"
+	case !os.IsNotExist(err):
+		return nil, err
+	case probe.Release != "":
+		source := "/boot/config-" + probe.Release
+		f, err := os.Open(filepath.Join(root, source))
+		if err == nil {
+			probe.Config, err = parseKernelConfig(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("读取 %s 失败: %v", source, err)
+			}
+			probe.ConfigSource = source
+		}
+	}
+
+	if content, err := os.ReadFile(filepath.Join(root, "proc", "filesystems")); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				probe.Filesystems = append(probe.Filesystems, fields[len(fields)-1])
+			}
+		}
+	}
+	if entries, err := os.ReadDir(filepath.Join(root, "proc", "self", "ns")); err == nil {
+		for _, e := range entries {
+			probe.Namespaces = append(probe.Namespaces, e.Name())
+		}
+	}
+	if content, err := os.ReadFile(filepath.Join(root, "proc", "net", "ip_tables_names")); err == nil {
+		probe.IPTables = strings.Fields(string(content))
+	}
+	if content, err := os.ReadFile(filepath.Join(root, "proc", "self", "status")); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.HasPrefix(line, "Seccomp:") {
+				probe.Seccomp = true
+			}
+		}
+	}
+	return probe, nil
+}
+
+// readKernelConfig 读取 /proc/config.gz，返回已启用（=y 或 =m）的选项
+func readKernelConfig(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("解压 %s 失败: %v", path, err)
+	}
+	defer gz.Close()
+	return parseKernelConfig(gz)
+}
+
+// parseKernelConfig 解析内核配置，忽略注释和未启用的选项
+func parseKernelConfig(r io.Reader) (map[string]string, error) {
+	config := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if ok && (value == "y" || value == "m") {
+			config[name] = value
+		}
+	}
+	return config, scanner.Err()
+}
+
+// FeatureState 内核功能是否可用
+type FeatureState string
+
+const (
+	featureYes     FeatureState = "yes"
+	featureNo      FeatureState = "no"
+	featureUnknown FeatureState = "unknown" // 没有内核配置，也没有运行时证据
+)
+
+// KernelFeature Docker 功能及判断依据
+type KernelFeature struct {
+	Name    string       `json:"name"`
+	Feature string       `json:"feature"`
+	State   FeatureState `json:"state"`
+	// Required 为 true 时缺失 dockerd 无法运行
+	Required bool `json:"required"`
+	// Evidence 判断依据，如 "/proc/filesystems: overlay" 或 "缺少 CONFIG_VETH"
+	Evidence string `json:"evidence"`
+}
+
+// kernelFeatureSpecs Docker 依赖的内核功能
+// options 中的选项都启用时功能可用，live 根据运行时信息判断，返回依据
+var kernelFeatureSpecs = []struct {
+	name     string
+	feature  string
+	required bool
+	options  [][]string // 每组中任意一个启用即可
+	live     func(p *KernelProbe) string
+}{
+	{
+		name: "namespaces", feature: "容器隔离（net/pid/ipc/uts/mnt 命名空间）", required: true,
+		options: [][]string{{"CONFIG_NAMESPACES"}, {"CONFIG_NET_NS"}, {"CONFIG_PID_NS"}, {"CONFIG_IPC_NS"}, {"CONFIG_UTS_NS"}},
+		live: func(p *KernelProbe) string {
+			for _, ns := range []string{"net", "pid", "ipc", "uts", "mnt"} {
+				if !containsString(p.Namespaces, ns) {
+					return ""
+				}
+			}
+			return "/proc/self/ns: net pid ipc uts mnt"
+		},
+	},
+	{
+		// veth 和 bridge 没有运行时证据，以内核配置为准
+		name: "bridge", feature: "bridge 网络（docker0、veth）", required: true,
+		options: [][]string{{"CONFIG_BRIDGE"}, {"CONFIG_VETH"}},
+	},
+	{
+		name: "iptables", feature: "iptables NAT（容器访问外网、端口映射）", required: true,
+		options: [][]string{
+			{"CONFIG_IP_NF_IPTABLES"}, {"CONFIG_NF_NAT", "CONFIG_NF_NAT_IPV4"},
+			{"CONFIG_IP_NF_TARGET_MASQUERADE", "CONFIG_NETFILTER_XT_TARGET_MASQUERADE"},
+			{"CONFIG_NETFILTER_XT_MATCH_ADDRTYPE"},
+		},
+		live: func(p *KernelProbe) string {
+			if containsString(p.IPTables, "nat") {
+				return "/proc/net/ip_tables_names: nat"
+			}
+			return ""
+		},
+	},
+	{
+		name: "overlay", feature: "overlay2 存储驱动",
+		options: [][]string{{"CONFIG_OVERLAY_FS"}},
+		live: func(p *KernelProbe) string {
+			if containsString(p.Filesystems, "overlay") {
+				return "/proc/filesystems: overlay"
+			}
+			return ""
+		},
+	},
+	{
+		name: "userns", feature: "用户命名空间（userns-remap、rootless）",
+		options: [][]string{{"CONFIG_USER_NS"}},
+		live: func(p *KernelProbe) string {
+			if containsString(p.Namespaces, "user") {
+				return "/proc/self/ns: user"
+			}
+			return ""
+		},
+	},
+	{
+		name: "seccomp", feature: "seccomp 系统调用过滤",
+		options: [][]string{{"CONFIG_SECCOMP"}, {"CONFIG_SECCOMP_FILTER"}},
+		live: func(p *KernelProbe) string {
+			if p.Seccomp {
+				return "/proc/self/status: Seccomp"
+			}
+			return ""
+		},
+	},
+}
+
+// Features 根据运行时信息和内核配置判断各项功能
+// 运行时有证据时直接可用，否则以内核配置为准，两者都没有时为 unknown
+func (p *KernelProbe) Features() []KernelFeature {
+	features := make([]KernelFeature, 0, len(kernelFeatureSpecs))
+	for _, spec := range kernelFeatureSpecs {
+		f := KernelFeature{Name: spec.name, Feature: spec.feature, Required: spec.required}
+		if spec.live != nil {
+			f.Evidence = spec.live(p)
+		}
+		switch {
+		case f.Evidence != "":
+			f.State = featureYes
+		case p.Config == nil:
+			f.State, f.Evidence = featureUnknown, "没有内核配置"
+		default:
+			var missing []string
+			for _, group := range spec.options {
+				if !p.hasAnyOption(group) {
+					missing = append(missing, strings.Join(group, "/"))
+				}
+			}
+			if len(missing) > 0 {
+				f.State, f.Evidence = featureNo, "缺少 "+strings.Join(missing, ", ")
+			} else {
+				f.State, f.Evidence = featureYes, p.ConfigSource
+			}
+		}
+		features = append(features, f)
+	}
+	return features
+}
+
+func (p *KernelProbe) hasAnyOption(options []string) bool {
+	for _, opt := range options {
+		if p.Config[opt] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Feature 返回指定名称的功能
+func (p *KernelProbe) Feature(name string) KernelFeature {
+	for _, f := range p.Features() {
+		if f.Name == name {
+			return f
+		}
+	}
+	return KernelFeature{Name: name, State: featureUnknown}
+}
+
+// StorageDriver 根据内核功能选择 dockerd 的存储驱动
+// 不支持 overlay 时 dockerd 会退回 vfs，这里显式写入，避免每次启动都重新探测
+func (p *KernelProbe) StorageDriver() string {
+	if p.Feature("overlay").State == featureYes {
+		return "overlay2"
+	}
+	return "vfs"
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "kernel",
+		usage: msgUsageKernel,
+		run:   runKernelCommand,
+	})
+}
+
+// runKernelCommand 实现 kernel 子命令
+func runKernelCommand(args []string) error {
+	fs := flag.NewFlagSet("kernel", flag.ExitOnError)
+	root := fs.String("root", "/", "读取 proc/boot 文件的根目录（用于离线分析）")
+	output := fs.String("output", outputText, "输出格式 text/json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	probe, err := loadKernelProbe(*root)
+	if err != nil {
+		return err
+	}
+	features := probe.Features()
+	if *output == outputJSON {
+		return printJSON(map[string]interface{}{
+			"kernel":         probe,
+			"features":       features,
+			"storage_driver": probe.StorageDriver(),
+		})
+	}
+
+	source := probe.ConfigSource
+	if source == "" {
+		source = "无（只根据运行时信息判断）"
+	}
+	fmt.Printf("内核版本: %s\n", probe.Release)
+	fmt.Printf("内核配置: %s\n", source)
+	marks := map[FeatureState]string{featureYes: "✓", featureNo: "✗", featureUnknown: "?"}
+	for _, f := range features {
+		fmt.Printf("%s %-10s %s（%s）\n", marks[f.State], f.Name, f.Feature, f.Evidence)
+	}
+	fmt.Printf("存储驱动: %s\n", probe.StorageDriver())
+	return nil
+}
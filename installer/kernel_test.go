@@ -0,0 +1,123 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeKernelConfig 生成 proc/config.gz
+func writeKernelConfig(t *testing.T, sysRoot string, options ...string) {
+	t.Helper()
+	path := filepath.Join(sysRoot, "proc", "config.gz")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	fmt.Fprintln(gz, "# Automatically generated file; DO NOT EDIT.")
+	fmt.Fprintln(gz, "# CONFIG_USER_NS is not set")
+	for _, opt := range options {
+		fmt.Fprintln(gz, opt)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// featureStates 返回功能名称到状态的映射
+func featureStates(p *KernelProbe) map[string]FeatureState {
+	states := map[string]FeatureState{}
+	for _, f := range p.Features() {
+		states[f.Name] = f.State
+	}
+	return states
+}
+
+// TestKernelProbeFixtures 测试从 fixture 目录探测内核功能
+func TestKernelProbeFixtures(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   map[string]FeatureState
+		driver string
+	}{
+		{
+			name:   "gki-5.10",
+			source: "/boot/config-5.10.198-android12-9-00085-g226a9632f13d",
+			want: map[string]FeatureState{
+				"namespaces": featureYes, "bridge": featureYes, "iptables": featureYes,
+				"overlay": featureYes, "userns": featureYes, "seccomp": featureYes,
+			},
+			driver: "overlay2",
+		},
+		{
+			name:   "no-overlay",
+			source: "/boot/config-4.14.186-perf+",
+			want: map[string]FeatureState{
+				"namespaces": featureYes, "bridge": featureYes, "iptables": featureYes,
+				"overlay": featureNo, "userns": featureNo, "seccomp": featureYes,
+			},
+			driver: "vfs",
+		},
+		{
+			name: "no-config",
+			want: map[string]FeatureState{
+				"namespaces": featureYes, "bridge": featureUnknown, "iptables": featureUnknown,
+				"overlay": featureUnknown, "userns": featureUnknown, "seccomp": featureUnknown,
+			},
+			driver: "vfs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe, err := loadKernelProbe(filepath.Join("testdata", "kernel", tt.name))
+			if err != nil {
+				t.Fatalf("探测失败: %v", err)
+			}
+			if probe.ConfigSource != tt.source {
+				t.Errorf("内核配置来源 = %q，期望 %q", probe.ConfigSource, tt.source)
+			}
+			got := featureStates(probe)
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s = %s，期望 %s", name, got[name], want)
+				}
+			}
+			if driver := probe.StorageDriver(); driver != tt.driver {
+				t.Errorf("存储驱动 = %s，期望 %s", driver, tt.driver)
+			}
+		})
+	}
+}
+
+// TestKernelProbeConfigGz 测试 /proc/config.gz 优先，模块（=m）也算启用
+func TestKernelProbeConfigGz(t *testing.T) {
+	root := t.TempDir()
+	writeKernelConfig(t, root, "CONFIG_OVERLAY_FS=m", "CONFIG_BRIDGE=y", "CONFIG_VETH=n")
+	probe, err := loadKernelProbe(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probe.ConfigSource != "/proc/config.gz" {
+		t.Errorf("内核配置来源 = %q", probe.ConfigSource)
+	}
+	overlay, bridge := probe.Feature("overlay"), probe.Feature("bridge")
+	if overlay.State != featureYes || probe.StorageDriver() != "overlay2" {
+		t.Errorf("overlay 为模块时应可用: %+v", overlay)
+	}
+	if bridge.State != featureNo || bridge.Evidence != "缺少 CONFIG_VETH" {
+		t.Errorf("bridge 结果错误: %+v", bridge)
+	}
+
+	os.WriteFile(filepath.Join(root, "proc", "config.gz"), []byte("not gzip"), 0644)
+	if _, err := loadKernelProbe(root); err == nil {
+		t.Error("config.gz 损坏时应报错")
+	}
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// dockerEnvPath 启动脚本使用的环境变量文件
+	dockerEnvPath = dockerRoot + "/docker.env"
+	// supervisorConfPath supervisord 主配置文件
+	supervisorConfPath = dockerRoot + "/supervisor.conf"
+	// nvmeBlockSource 外接 NVMe 硬盘在 vold 中的块设备
+	nvmeBlockSource = "/dev/block/vold/public:259,1"
+	// dataTmpfsOptions 找不到数据盘时用于测试的 tmpfs
+	dataTmpfsOptions = "size=100M,uid=0,gid=0,mode=0755"
+	// runTmpfsOptions var 和 /run 使用的 tmpfs
+	runTmpfsOptions = "size=4M,uid=0,gid=0,mode=0755"
+)
+
+// slaveMounts 进入新挂载命名空间后设为 slave 的挂载点，避免挂载传播回宿主
+var slaveMounts = []string{"/", "/sys", "/dev", "/proc", "/data"}
+
+// loadDockerEnv 解析 docker.env 中的 export 语句，变量按顺序展开
+func loadDockerEnv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %v", path, err)
+	}
+	defer f.Close()
+	return parseDockerEnv(f, os.Getenv)
+}
+
+// parseDockerEnv 解析 export 语句，未定义的变量从 getenv 中查找
+func parseDockerEnv(r io.Reader, getenv func(string) string) (map[string]string, error) {
+	env := map[string]string{}
+	lookup := func(name string) string {
+		if v, ok := env[name]; ok {
+			return v
+		}
+		return getenv(name)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("第 %d 行格式错误: %s", lineNo, line)
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[key] = os.Expand(value, lookup)
+	}
+	return env, scanner.Err()
+}
+
+// LaunchMode 命名空间准备好后启动的程序
+type LaunchMode string
+
+const (
+	launchSupervisord LaunchMode = "supervisord"
+	launchDockerd     LaunchMode = "dockerd"
+	launchShell       LaunchMode = "shell"
+)
+
+// launchModeFromEnv 按 AND_DEBUG/AND_DOCKER 选择启动模式，与 exec_dockerd.sh 一致
+func launchModeFromEnv(getenv func(string) string) LaunchMode {
+	switch {
+	case getenv("AND_DEBUG") == "1":
+		return launchShell
+	case getenv("AND_DOCKER") == "1":
+		return launchDockerd
+	default:
+		return launchSupervisord
+	}
+}
+
+// LaunchPlan 启动 dockerd 前的挂载计划
+type LaunchPlan struct {
+	Mode LaunchMode
+	Env  map[string]string
+	// DataRoot 绑定到 dockerRoot/data 的目录，为空时使用 tmpfs
+	DataRoot string
+	// Degraded 非空时表示数据盘不可用，以 tmpfs 降级启动的原因
+	Degraded string
+	// HostSteps 在宿主挂载命名空间中执行，var 需要对外可见以便访问 docker.sock
+	HostSteps []MountStep
+	// NamespaceSteps 在新挂载命名空间中执行
+	NamespaceSteps []MountStep
+	Cgroup         *CgroupPlan
+	// SSLSteps 用安装包中的证书覆盖 /system/etc/ssl
+	SSLSteps []MountStep
+	Argv     []string
+	Warnings []string
+}
+
+// launchInputs 生成计划需要的外部信息，便于在非 root 环境下测试
+type launchInputs struct {
+	Env    map[string]string
+	Mode   LaunchMode
+	Mounts []MountInfo
+	Cgroup *CgroupProbe
+	Exists func(path string) bool
+	// Policy 数据盘不可用时的处理方式：refuse 或 degraded
+	Policy string
+	// DiskErr 数据盘校验失败的原因
+	DiskErr error
+}
+
+// findNVMeMount 查找 vold 挂载的 ext4 NVMe 分区
+func findNVMeMount(mounts []MountInfo) string {
+	for _, m := range mounts {
+		if m.Source == nvmeBlockSource && m.FSType == "ext4" && strings.HasPrefix(m.MountPoint, "/mnt/media_rw/") {
+			return m.MountPoint
+		}
+	}
+	return ""
+}
+
+// planLaunch 生成启动计划
+func planLaunch(in launchInputs) (*LaunchPlan, error) {
+	root := in.Env["DOCKER_ROOT"]
+	if root == "" {
+		root = dockerRoot
+	}
+	varDir := filepath.Join(root, "var")
+	plan := &LaunchPlan{Mode: in.Mode, Env: in.Env}
+
+	if home := in.Env["HOME"]; home != "" {
+		plan.HostSteps = append(plan.HostSteps, MountStep{Action: "mkdir", Target: home})
+	}
+	plan.HostSteps = append(plan.HostSteps, MountStep{Action: "mkdir", Target: varDir})
+	if findMount(in.Mounts, varDir) == nil {
+		plan.HostSteps = append(plan.HostSteps, MountStep{Action: "mount", Source: "tmpfs", Target: varDir, FSType: "tmpfs", Options: runTmpfsOptions})
+	}
+	plan.HostSteps = append(plan.HostSteps, MountStep{Action: "mkdir", Target: filepath.Join(varDir, "run")})
+
+	for _, target := range slaveMounts {
+		plan.NamespaceSteps = append(plan.NamespaceSteps, MountStep{Action: "make-slave", Target: target})
+	}
+	if findMount(in.Mounts, "/system") != nil {
+		plan.NamespaceSteps = append(plan.NamespaceSteps, MountStep{Action: "make-slave", Target: "/system", Optional: true})
+	}
+
+	// DISK_ROOT 为空时 DOCKER_DATA_ROOT 只是相对于 / 的默认值，视为未配置
+	if in.Env["DISK_ROOT"] != "" {
+		plan.DataRoot = in.Env["DOCKER_DATA_ROOT"]
+	}
+	if plan.DataRoot == "" {
+		if nvme := findNVMeMount(in.Mounts); nvme != "" {
+			plan.DataRoot = filepath.Join(nvme, "opt", "dockerd", "docker")
+			plan.NamespaceSteps = append(plan.NamespaceSteps,
+				MountStep{Action: "mkdir", Target: plan.DataRoot},
+				MountStep{Action: "touch", Target: filepath.Join(nvme, "opt", ".nomedia")})
+		}
+	}
+
+	reason := ""
+	switch {
+	case in.DiskErr != nil:
+		reason = in.DiskErr.Error()
+	case plan.DataRoot == "":
+		reason = "未配置 DISK_ROOT，也未找到 NVMe ext4 分区"
+	}
+	if reason != "" {
+		// 不再静默使用 tmpfs，否则用户会以为镜像和容器丢失
+		if in.Policy != dataPolicyDegraded {
+			return nil, fmt.Errorf("数据盘不可用，拒绝启动 dockerd: %s（请确认硬盘已挂载，或设置 DATA_ROOT_POLICY=degraded 以临时数据目录启动）", reason)
+		}
+		plan.DataRoot = ""
+		plan.Degraded = reason
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("降级模式: %s，数据目录使用 100M tmpfs，重启后镜像和容器会丢失", reason))
+	}
+
+	dataDir := filepath.Join(root, "data")
+	plan.NamespaceSteps = append(plan.NamespaceSteps, MountStep{Action: "mkdir", Target: dataDir})
+	if plan.DataRoot == "" {
+		plan.NamespaceSteps = append(plan.NamespaceSteps,
+			MountStep{Action: "mount", Source: "tmpfs", Target: dataDir, FSType: "tmpfs", Options: dataTmpfsOptions})
+	} else {
+		plan.NamespaceSteps = append(plan.NamespaceSteps,
+			MountStep{Action: "bind", Source: plan.DataRoot, Target: dataDir})
+	}
+	plan.NamespaceSteps = append(plan.NamespaceSteps,
+		MountStep{Action: "mount", Source: "tmpfs", Target: "/run", FSType: "tmpfs", Options: runTmpfsOptions})
+
+	if in.Cgroup != nil {
+		plan.Cgroup = planCgroupMounts(in.Cgroup, cgroupMountRoot)
+	}
+
+	sslDir := filepath.Join(root, "etc", "ssl")
+	if in.Exists(sslDir) && in.Exists("/system/etc") {
+		upper := filepath.Join(varDir, "etc-upper")
+		work := filepath.Join(varDir, "etc-work")
+		plan.SSLSteps = []MountStep{
+			{Action: "mkdir", Target: upper},
+			{Action: "mkdir", Target: work},
+			{Action: "copy", Source: sslDir, Target: filepath.Join(upper, "ssl")},
+			{Action: "mount", Source: "overlayfs:/etc", Target: "/system/etc", FSType: "overlay",
+				Options: fmt.Sprintf("ro,noatime,lowerdir=/system/etc,upperdir=%s,workdir=%s", upper, work)},
+		}
+	} else {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s 不存在，容器内使用系统证书", sslDir))
+	}
+
+	switch in.Mode {
+	case launchShell:
+		plan.Argv = []string{"sh", "-i"}
+	case launchDockerd:
+		svc := findService("dockerd")
+		plan.Argv = append([]string{svc.Command}, svc.Args...)
+	default:
+		plan.Argv = []string{filepath.Join(root, "bin", "supervisord"), "-c", supervisorConfPath, "-d"}
+	}
+	if in.Mode != launchShell && !in.Exists(plan.Argv[0]) {
+		return nil, fmt.Errorf("%s 不存在", plan.Argv[0])
+	}
+	return plan, nil
+}
+
+// Environ 返回启动程序使用的环境变量，docker.env 中的值覆盖当前环境
+func (p *LaunchPlan) Environ(base []string) []string {
+	var env []string
+	for _, kv := range base {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := p.Env[key]; ok || key == "DOCKER_DATA_ROOT" {
+			continue
+		}
+		env = append(env, kv)
+	}
+	keys := make([]string, 0, len(p.Env))
+	for k := range p.Env {
+		// 与 exec_dockerd.sh 一致，数据目录已绑定到 dockerRoot/data
+		if k != "DOCKER_DATA_ROOT" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+p.Env[k])
+	}
+	return env
+}
+
+// launchHost 执行启动计划需要的系统操作
+type launchHost interface {
+	Mounter
+	IsMountpoint(path string) bool
+	CopyTree(src, dst string) error
+	Touch(path string) error
+	WriteFile(path string, data []byte) error
+	Unshare() error
+	Exec(argv []string, env []string) error
+}
+
+// runLaunchStep 执行一步，挂载后确认挂载点已生效
+func runLaunchStep(step MountStep, h launchHost) error {
+	var err error
+	switch step.Action {
+	case "mkdir":
+		return h.MkdirAll(step.Target)
+	case "touch":
+		return h.Touch(step.Target)
+	case "copy":
+		return h.CopyTree(step.Source, step.Target)
+	case "make-slave":
+		return h.Mount("none", step.Target, "", "slave")
+	case "bind":
+		if !h.Exists(step.Source) {
+			return fmt.Errorf("%s 不存在", step.Source)
+		}
+		err = h.Mount(step.Source, step.Target, "", "bind")
+	case "mount":
+		err = h.Mount(step.Source, step.Target, step.FSType, step.Options)
+	default:
+		return fmt.Errorf("未知操作: %s", step.Action)
+	}
+	if err != nil {
+		return err
+	}
+	if !h.IsMountpoint(step.Target) {
+		return fmt.Errorf("挂载后 %s 不是挂载点", step.Target)
+	}
+	return nil
+}
+
+// runLaunchSteps 依次执行，必需步骤失败时中断
+func runLaunchSteps(steps []MountStep, h launchHost, logf func(string, ...interface{})) error {
+	for _, step := range steps {
+		if err := runLaunchStep(step, h); err != nil {
+			if !step.Optional {
+				return fmt.Errorf("%s: %v", step, err)
+			}
+			logf("⚠ %s: %v", step, err)
+		}
+	}
+	return nil
+}
+
+// executeLaunchPlan 执行启动计划，成功时不返回（进程被替换）
+// configureNetwork 在进入新命名空间前调用，失败只记录警告
+func executeLaunchPlan(plan *LaunchPlan, h launchHost, configureNetwork func() error, logf func(string, ...interface{})) error {
+	for _, w := range plan.Warnings {
+		logf("⚠ %s", w)
+	}
+	if err := runLaunchSteps(plan.HostSteps, h, logf); err != nil {
+		return err
+	}
+	// 标记文件在宿主命名空间的 var/run 中，供其他命令判断是否处于降级模式
+	if plan.Degraded != "" {
+		if err := h.WriteFile(degradedMarkerPath, []byte(plan.Degraded+"\n")); err != nil {
+			logf("⚠ 写入 %s 失败: %v", degradedMarkerPath, err)
+		}
+	} else if h.Exists(degradedMarkerPath) {
+		h.Remove(degradedMarkerPath)
+	}
+	if configureNetwork != nil {
+		if err := configureNetwork(); err != nil {
+			logf("⚠ 配置容器网络失败: %v", err)
+		}
+	}
+
+	if err := h.Unshare(); err != nil {
+		return fmt.Errorf("创建挂载命名空间失败: %v", err)
+	}
+	if err := runLaunchSteps(plan.NamespaceSteps, h, logf); err != nil {
+		return err
+	}
+	if plan.DataRoot != "" {
+		logf("✓ 数据目录: %s", plan.DataRoot)
+	}
+
+	if plan.Cgroup != nil {
+		result, err := applyCgroupPlan(plan.Cgroup, h)
+		if err != nil {
+			return err
+		}
+		for name, reason := range result.Skipped {
+			logf("⚠ 跳过控制器 %s: %s", name, reason)
+		}
+	}
+
+	// 证书覆盖失败不影响 dockerd 启动
+	if err := runLaunchSteps(plan.SSLSteps, h, logf); err != nil {
+		logf("⚠ 覆盖系统证书失败: %v", err)
+	}
+
+	logf("启动 %s", strings.Join(plan.Argv, " "))
+	return h.Exec(plan.Argv, plan.Environ(os.Environ()))
+}
+
+// IsMountpoint 检查 path 是否出现在当前线程命名空间的 mountinfo 中
+func (syscallMounter) IsMountpoint(path string) bool {
+	mounts, err := readThreadMountInfo()
+	if err != nil {
+		return false
+	}
+	return findMount(mounts, filepath.Clean(path)) != nil
+}
+
+// readThreadMountInfo 读取当前线程的挂载信息
+// unshare 只作用于调用线程，/proc/self/mountinfo 显示的是主线程的命名空间，看不到 unshare 之后的挂载
+func readThreadMountInfo() ([]MountInfo, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/self/task/%d/mountinfo", syscall.Gettid()))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMountInfo(f)
+}
+
+// CopyTree 复制目录树，保留权限和符号链接（等同 cp -a）
+func (syscallMounter) CopyTree(src, dst string) error {
+	return copyTree(src, dst)
+}
+
+// Touch 创建空文件，已存在时不修改内容
+func (syscallMounter) Touch(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// WriteFile 写入文件
+func (syscallMounter) WriteFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0644)
+}
+
+// Unshare 为当前线程创建新的挂载命名空间，调用前必须锁定 OS 线程
+func (syscallMounter) Unshare() error {
+	return syscall.Unshare(syscall.CLONE_NEWNS)
+}
+
+// Exec 用目标程序替换当前进程
+func (syscallMounter) Exec(argv []string, env []string) error {
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, argv, env)
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "launch-dockerd",
+		usage: msgUsageLaunchDockerd,
+		run:   runLaunchDockerd,
+	})
+}
+
+// runLaunchDockerd 实现 launch-dockerd 子命令，替代 start.sh 中的 unshare + exec_dockerd.sh
+func runLaunchDockerd(args []string) error {
+	fs := flag.NewFlagSet("launch-dockerd", flag.ExitOnError)
+	envFile := fs.String("env", dockerEnvPath, "环境变量文件")
+	mode := fs.String("mode", "", "启动模式 supervisord/dockerd/shell，默认按 AND_DEBUG/AND_DOCKER 选择")
+	dryRun := fs.Bool("dry-run", false, "只显示计划，不执行")
+	wait := fs.Duration("wait", 0, "等待数据盘挂载的时间，默认取 docker.env 中的 DATA_ROOT_WAIT 秒数或 90s")
+	policy := fs.String("on-missing-disk", "", "数据盘不可用时 refuse（拒绝启动）或 degraded（以 tmpfs 降级启动），默认取 DATA_ROOT_POLICY")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	env, err := loadDockerEnv(*envFile)
+	if err != nil {
+		return err
+	}
+	in := launchInputs{
+		Env:    env,
+		Mode:   launchModeFromEnv(os.Getenv),
+		Exists: fileExists,
+		Policy: *policy,
+	}
+	if in.Policy == "" {
+		in.Policy = env["DATA_ROOT_POLICY"]
+	}
+	if in.Policy == "" {
+		in.Policy = dataPolicyRefuse
+	}
+	if in.Policy != dataPolicyRefuse && in.Policy != dataPolicyDegraded {
+		return fmt.Errorf("未知的数据盘策略: %s", in.Policy)
+	}
+	if *mode != "" {
+		in.Mode = LaunchMode(*mode)
+		if in.Mode != launchSupervisord && in.Mode != launchDockerd && in.Mode != launchShell {
+			return fmt.Errorf("未知启动模式: %s", *mode)
+		}
+	}
+	if in.Mounts, err = readMountInfo(); err != nil {
+		return err
+	}
+
+	// 开机时外接硬盘可能还没挂载，等待并确认是安装时的那块盘
+	if diskRoot := env["DISK_ROOT"]; diskRoot != "" {
+		identity, err := loadDiskIdentity(dataDiskPath)
+		if err != nil {
+			return err
+		}
+		waiter := &dataDiskWaiter{
+			diskRoot:   diskRoot,
+			dataRoot:   env["DOCKER_DATA_ROOT"],
+			identity:   identity,
+			timeout:    dataDiskTimeout(*wait, env["DATA_ROOT_WAIT"]),
+			interval:   dataDiskPollInterval,
+			loadMounts: readMountInfo,
+			exists:     fileExists,
+			readUUID:   readExt4UUID,
+		}
+		if *dryRun {
+			waiter.timeout = 0
+		}
+		mounts, err := waiter.Wait()
+		if mounts != nil {
+			in.Mounts = mounts
+		}
+		in.DiskErr = err
+	}
+	if probe, err := loadCgroupProbe("/"); err == nil {
+		in.Cgroup = probe
+	} else {
+		fmt.Fprintf(os.Stderr, "⚠ 检测 cgroup 失败，跳过挂载: %v\n", err)
+	}
+
+	plan, err := planLaunch(in)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		printLaunchPlan(plan)
+		return nil
+	}
+
+	// unshare 只作用于调用线程，挂载和 exec 必须在同一线程上完成
+	runtime.LockOSThread()
+	logf := func(format string, a ...interface{}) {
+		fmt.Fprintf(os.Stderr, format+"\n", a...)
+	}
+	configureNetwork := func() error {
+		_, err := newNetworkManager(execRunner{}).Reconcile()
+		return err
+	}
+	return executeLaunchPlan(plan, syscallMounter{}, configureNetwork, logf)
+}
+
+// dataDiskTimeout 命令行参数优先，其次是 docker.env 中以秒为单位的 DATA_ROOT_WAIT
+func dataDiskTimeout(flagValue time.Duration, envValue string) time.Duration {
+	if flagValue > 0 {
+		return flagValue
+	}
+	if secs, err := strconv.Atoi(envValue); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return defaultDataDiskWait
+}
+
+// printLaunchPlan 以 shell 命令形式显示启动计划
+func printLaunchPlan(plan *LaunchPlan) {
+	for _, w := range plan.Warnings {
+		fmt.Printf("⚠ %s\n", w)
+	}
+	fmt.Println("# 宿主命名空间")
+	for _, step := range plan.HostSteps {
+		fmt.Println(step)
+	}
+	fmt.Println("# 配置容器网络（network apply）")
+	fmt.Println("unshare -m")
+	for _, step := range plan.NamespaceSteps {
+		fmt.Println(step)
+	}
+	if plan.Cgroup != nil {
+		for _, step := range plan.Cgroup.Steps {
+			fmt.Println(step)
+		}
+	}
+	for _, step := range plan.SSLSteps {
+		fmt.Println(step)
+	}
+	fmt.Printf("exec %s\n", strings.Join(plan.Argv, " "))
+}
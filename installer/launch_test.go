@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestLoadDockerEnv 测试解析安装包中的 docker.env
+func TestLoadDockerEnv(t *testing.T) {
+	env, err := loadDockerEnv(filepath.Join("..", "docker", "docker.env"))
+	if err != nil {
+		t.Fatalf("解析 docker.env 失败: %v", err)
+	}
+	if env["DOCKER_HOST"] != "unix:///data/local/docker/var/run/docker.sock" {
+		t.Errorf("DOCKER_HOST 展开错误: %s", env["DOCKER_HOST"])
+	}
+	if env["DOCKER_DATA_ROOT"] != "/opt/dockerd/docker" {
+		t.Errorf("DOCKER_DATA_ROOT 展开错误: %s", env["DOCKER_DATA_ROOT"])
+	}
+
+	env, err = parseDockerEnv(strings.NewReader("# 注释\nexport A=\"x y\"\nB=$A/$C\n"), func(name string) string {
+		if name == "C" {
+			return "c"
+		}
+		return ""
+	})
+	if err != nil || env["A"] != "x y" || env["B"] != "x y/c" {
+		t.Errorf("变量展开错误: %v, %v", env, err)
+	}
+	if _, err := parseDockerEnv(strings.NewReader("export A\n"), func(string) string { return "" }); err == nil {
+		t.Error("缺少 = 时应返回错误")
+	}
+}
+
+// TestLaunchModeFromEnv 测试启动模式选择
+func TestLaunchModeFromEnv(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want LaunchMode
+	}{
+		{map[string]string{}, launchSupervisord},
+		{map[string]string{"AND_DOCKER": "1"}, launchDockerd},
+		{map[string]string{"AND_DEBUG": "1", "AND_DOCKER": "1"}, launchShell},
+	}
+	for _, tt := range tests {
+		got := launchModeFromEnv(func(k string) string { return tt.env[k] })
+		if got != tt.want {
+			t.Errorf("%v: 期望 %s, 实际 %s", tt.env, tt.want, got)
+		}
+	}
+}
+
+// testLaunchInputs 使用 android-legacy fixture 构造输入
+func testLaunchInputs(t *testing.T) launchInputs {
+	probe := loadCgroupFixture(t, "android-legacy")
+	return launchInputs{
+		Env: map[string]string{
+			"DISK_ROOT":        "",
+			"DOCKER_DATA_ROOT": "/opt/dockerd/docker",
+			"DOCKER_ROOT":      dockerRoot,
+			"HOME":             dockerRoot + "/root",
+		},
+		Mode:   launchSupervisord,
+		Mounts: probe.Mounts,
+		Cgroup: probe,
+		Exists: func(string) bool { return true },
+	}
+}
+
+// planText 将步骤转为 shell 命令文本
+func planText(steps []MountStep) string {
+	var lines []string
+	for _, step := range steps {
+		lines = append(lines, step.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TestPlanLaunch_NVMe 测试自动使用 NVMe 分区作为数据目录
+func TestPlanLaunch_NVMe(t *testing.T) {
+	plan, err := planLaunch(testLaunchInputs(t))
+	if err != nil {
+		t.Fatalf("生成计划失败: %v", err)
+	}
+	if plan.DataRoot != "/mnt/media_rw/0A1B-2C3D/opt/dockerd/docker" {
+		t.Errorf("数据目录错误: %s", plan.DataRoot)
+	}
+
+	text := planText(plan.NamespaceSteps)
+	for _, want := range []string{
+		"mount --make-slave /\n",
+		"mount --make-slave /data",
+		"touch /mnt/media_rw/0A1B-2C3D/opt/.nomedia",
+		"mount --bind /mnt/media_rw/0A1B-2C3D/opt/dockerd/docker /data/local/docker/data",
+		"mount -t tmpfs -o size=4M,uid=0,gid=0,mode=0755 tmpfs /run",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("计划缺少 %q:\n%s", want, text)
+		}
+	}
+	if !strings.Contains(planText(plan.HostSteps), "tmpfs /data/local/docker/var") {
+		t.Errorf("var 未挂载时应挂载 tmpfs:\n%s", planText(plan.HostSteps))
+	}
+	if plan.Cgroup == nil || plan.Cgroup.Layout != "v1" {
+		t.Errorf("应包含 cgroup 挂载计划: %+v", plan.Cgroup)
+	}
+	if !strings.Contains(planText(plan.SSLSteps), "-t overlay -o ro,noatime,lowerdir=/system/etc") {
+		t.Errorf("缺少证书覆盖:\n%s", planText(plan.SSLSteps))
+	}
+	if strings.Join(plan.Argv, " ") != "/data/local/docker/bin/supervisord -c /data/local/docker/supervisor.conf -d" {
+		t.Errorf("启动命令错误: %v", plan.Argv)
+	}
+}
+
+// TestPlanLaunch_Fallbacks 测试配置的数据目录、tmpfs 回退和缺少证书目录
+func TestPlanLaunch_Fallbacks(t *testing.T) {
+	in := testLaunchInputs(t)
+	in.Env["DISK_ROOT"] = "/mnt/media_rw/USB"
+	in.Env["DOCKER_DATA_ROOT"] = "/mnt/media_rw/USB/opt/dockerd/docker"
+	plan, err := planLaunch(in)
+	if err != nil || plan.DataRoot != "/mnt/media_rw/USB/opt/dockerd/docker" {
+		t.Fatalf("应使用 DOCKER_DATA_ROOT: %+v, %v", plan, err)
+	}
+
+	in = testLaunchInputs(t)
+	in.Mounts = nil
+	in.Exists = func(path string) bool { return !strings.HasSuffix(path, "/ssl") }
+	if _, err := planLaunch(in); err == nil || !strings.Contains(err.Error(), "拒绝启动") {
+		t.Errorf("默认策略下找不到数据盘时应拒绝启动: %v", err)
+	}
+
+	in.Policy = dataPolicyDegraded
+	plan, err = planLaunch(in)
+	if err != nil {
+		t.Fatalf("生成计划失败: %v", err)
+	}
+	if !strings.Contains(planText(plan.NamespaceSteps), "-o size=100M,uid=0,gid=0,mode=0755 tmpfs /data/local/docker/data") {
+		t.Errorf("降级模式应使用 tmpfs:\n%s", planText(plan.NamespaceSteps))
+	}
+	if plan.Degraded == "" || len(plan.SSLSteps) != 0 || len(plan.Warnings) != 2 {
+		t.Errorf("应标记降级并跳过证书覆盖: %q %v", plan.Degraded, plan.Warnings)
+	}
+
+	// 数据盘校验失败时即使找到 NVMe 也不能使用
+	in = testLaunchInputs(t)
+	in.Env["DISK_ROOT"] = "/mnt/media_rw/USB"
+	in.DiskErr = errors.New("/mnt/media_rw/USB 未挂载")
+	if _, err := planLaunch(in); err == nil || !strings.Contains(err.Error(), "未挂载") {
+		t.Errorf("数据盘校验失败时应拒绝启动: %v", err)
+	}
+	in.Policy = dataPolicyDegraded
+	if plan, err := planLaunch(in); err != nil || plan.DataRoot != "" || !strings.Contains(plan.Degraded, "未挂载") {
+		t.Errorf("降级模式应记录原因: %+v, %v", plan, err)
+	}
+
+	in = testLaunchInputs(t)
+	in.Mode = launchDockerd
+	in.Exists = func(path string) bool { return !strings.HasSuffix(path, "/dockerd") }
+	if _, err := planLaunch(in); err == nil {
+		t.Error("dockerd 不存在时应返回错误")
+	}
+}
+
+// fakeLaunchHost 记录执行顺序
+type fakeLaunchHost struct {
+	fakeMounter
+	notMounted map[string]bool
+	execArgv   []string
+	execEnv    []string
+}
+
+func (h *fakeLaunchHost) IsMountpoint(path string) bool {
+	return !h.notMounted[path]
+}
+
+func (h *fakeLaunchHost) CopyTree(src, dst string) error {
+	h.ops = append(h.ops, "copy "+dst)
+	return nil
+}
+
+func (h *fakeLaunchHost) Touch(path string) error {
+	h.ops = append(h.ops, "touch "+path)
+	return nil
+}
+
+func (h *fakeLaunchHost) WriteFile(path string, data []byte) error {
+	h.ops = append(h.ops, "write "+path)
+	return nil
+}
+
+func (h *fakeLaunchHost) Unshare() error {
+	h.ops = append(h.ops, "unshare")
+	return nil
+}
+
+func (h *fakeLaunchHost) Exec(argv []string, env []string) error {
+	h.ops = append(h.ops, "exec")
+	h.execArgv, h.execEnv = argv, env
+	return nil
+}
+
+// TestExecuteLaunchPlan 测试执行顺序和环境变量
+func TestExecuteLaunchPlan(t *testing.T) {
+	plan, err := planLaunch(testLaunchInputs(t))
+	if err != nil {
+		t.Fatalf("生成计划失败: %v", err)
+	}
+	h := &fakeLaunchHost{fakeMounter: fakeMounter{
+		present: map[string]bool{plan.DataRoot: true},
+		fail:    map[string]bool{"/system": true},
+	}}
+	networked := false
+	err = executeLaunchPlan(plan, h, func() error {
+		networked = true
+		if containsString(h.ops, "unshare") {
+			t.Error("应在进入新命名空间前配置网络")
+		}
+		return nil
+	}, t.Logf)
+	if err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if !networked {
+		t.Error("未配置网络")
+	}
+
+	ops := strings.Join(h.ops, "\n")
+	if !strings.Contains(ops, "mount /data/local/docker/var\nmkdir /data/local/docker/var/run\nunshare\nmount /\n") {
+		t.Errorf("执行顺序错误:\n%s", ops)
+	}
+	if h.ops[len(h.ops)-1] != "exec" || !strings.HasSuffix(h.execArgv[0], "supervisord") {
+		t.Errorf("最后应启动 supervisord:\n%s", ops)
+	}
+	for _, kv := range h.execEnv {
+		if strings.HasPrefix(kv, "DOCKER_DATA_ROOT=") {
+			t.Error("不应向 supervisord 传递 DOCKER_DATA_ROOT")
+		}
+	}
+	if !containsString(h.execEnv, "HOME=/data/local/docker/root") {
+		t.Error("应传递 docker.env 中的变量")
+	}
+}
+
+// TestExecuteLaunchPlan_Failure 测试必需步骤失败或挂载未生效时不启动
+func TestExecuteLaunchPlan_Failure(t *testing.T) {
+	plan, err := planLaunch(testLaunchInputs(t))
+	if err != nil {
+		t.Fatalf("生成计划失败: %v", err)
+	}
+
+	// 数据目录不存在，绑定挂载失败
+	h := &fakeLaunchHost{}
+	if err := executeLaunchPlan(plan, h, nil, t.Logf); err == nil || !strings.Contains(err.Error(), "不存在") {
+		t.Errorf("数据目录不存在时应返回错误: %v", err)
+	}
+	if containsString(h.ops, "exec") {
+		t.Error("失败后不应启动")
+	}
+
+	h = &fakeLaunchHost{
+		fakeMounter: fakeMounter{present: map[string]bool{plan.DataRoot: true}},
+		notMounted:  map[string]bool{"/run": true},
+	}
+	if err := executeLaunchPlan(plan, h, func() error { return errors.New("没有网络") }, t.Logf); err == nil {
+		t.Error("挂载未生效时应返回错误")
+	}
+}
+
+// TestExecuteLaunchPlan_Degraded 测试降级模式写入标记文件
+func TestExecuteLaunchPlan_Degraded(t *testing.T) {
+	in := testLaunchInputs(t)
+	in.Mounts = nil
+	in.Policy = dataPolicyDegraded
+	plan, err := planLaunch(in)
+	if err != nil {
+		t.Fatalf("生成计划失败: %v", err)
+	}
+	h := &fakeLaunchHost{}
+	if err := executeLaunchPlan(plan, h, nil, t.Logf); err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if !containsString(h.ops, "write "+degradedMarkerPath) {
+		t.Errorf("应写入降级标记:\n%s", strings.Join(h.ops, "\n"))
+	}
+
+	// 正常启动时清除上次的标记
+	plan, _ = planLaunch(testLaunchInputs(t))
+	h = &fakeLaunchHost{fakeMounter: fakeMounter{present: map[string]bool{plan.DataRoot: true, degradedMarkerPath: true}}}
+	if err := executeLaunchPlan(plan, h, nil, t.Logf); err != nil {
+		t.Fatalf("执行失败: %v", err)
+	}
+	if !containsString(h.ops, "rmdir "+degradedMarkerPath) {
+		t.Error("应删除降级标记")
+	}
+}
+
+// TestSyscallMounter_IsMountpointAfterUnshare 测试 unshare 之后的挂载在当前线程的 mountinfo 中可见
+func TestSyscallMounter_IsMountpointAfterUnshare(t *testing.T) {
+	dir := t.TempDir()
+	result := make(chan error, 1)
+	var run func()
+	run = func() {
+		// 不解锁，goroutine 结束时这个线程随之退出，不会把新命名空间带给其他 goroutine
+		runtime.LockOSThread()
+		if syscall.Gettid() == os.Getpid() {
+			// 在主线程上时 /proc/self 也能看到挂载，占住主线程换到其他线程上测试
+			done := make(chan struct{})
+			go func() { run(); close(done) }()
+			<-done
+			runtime.UnlockOSThread()
+			return
+		}
+		h := syscallMounter{}
+		if err := h.Unshare(); err != nil {
+			result <- errSkip{err}
+			return
+		}
+		if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+			result <- errSkip{err}
+			return
+		}
+		if err := syscall.Mount("tmpfs", dir, "tmpfs", 0, ""); err != nil {
+			result <- errSkip{err}
+			return
+		}
+		if !h.IsMountpoint(dir) {
+			result <- fmt.Errorf("挂载后 %s 不是挂载点", dir)
+			return
+		}
+		result <- nil
+	}
+	go run()
+	err := <-result
+	if skip, ok := err.(errSkip); ok {
+		t.Skipf("不支持挂载命名空间: %v", skip.err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// errSkip 测试环境不支持时跳过
+type errSkip struct{ err error }
+
+func (e errSkip) Error() string { return e.err.Error() }
@@ -0,0 +1,1102 @@
+package main
+
+// 安装流程（install-in-docker.go）
+const (
+	msgErrorPrefix            msgKey = "error.prefix"
+	msgStepDetectDisk         msgKey = "install.step.detect_disk"
+	msgStepVersionInfo        msgKey = "install.step.version_info"
+	msgStepDownload           msgKey = "install.step.download"
+	msgStepStopServices       msgKey = "install.step.stop_services"
+	msgStepExtract            msgKey = "install.step.extract"
+	msgStepDeploy             msgKey = "install.step.deploy"
+	msgDiskNeedExt4           msgKey = "install.disk.need_ext4"
+	msgDiskInsertHint         msgKey = "install.disk.insert_hint"
+	msgDiskNotFound           msgKey = "install.disk.not_found"
+	msgDiskDetected           msgKey = "install.disk.detected"
+	msgTmpDirFailed           msgKey = "install.tmp_dir.failed"
+	msgTmpDir                 msgKey = "install.tmp_dir"
+	msgVersionInfoFailed      msgKey = "install.version.failed"
+	msgVersion                msgKey = "install.version"
+	msgArch                   msgKey = "install.arch"
+	msgSelfUpdateFailed       msgKey = "install.self_update.failed"
+	msgUseLocalFile           msgKey = "install.local_file"
+	msgCopyLocalFailed        msgKey = "install.local_file.failed"
+	msgCopied                 msgKey = "install.local_file.copied"
+	msgDownloading            msgKey = "install.download.start"
+	msgDownloadFailed         msgKey = "install.download.failed"
+	msgDownloaded             msgKey = "install.download.done"
+	msgStopServicesFailed     msgKey = "install.stop_services.failed"
+	msgExtracting             msgKey = "install.extract.start"
+	msgExtractingTmp          msgKey = "install.extract.start_tmp"
+	msgExtractFailed          msgKey = "install.extract.failed"
+	msgExtractDirFailed       msgKey = "install.extract.dir_failed"
+	msgExtracted              msgKey = "install.extract.done"
+	msgBinDirFailed           msgKey = "install.bin_dir.failed"
+	msgMoveBinFailed          msgKey = "install.move_bin.failed"
+	msgBinMoved               msgKey = "install.move_bin.done"
+	msgInstallSelfWarn        msgKey = "install.install_self.warn"
+	msgBinPermWarn            msgKey = "install.bin_perm.warn"
+	msgDaemonSnapshotFailed   msgKey = "install.daemon.snapshot_failed"
+	msgDaemonConfigFailed     msgKey = "install.daemon.failed"
+	msgDaemonConfigDone       msgKey = "install.daemon.done"
+	msgKernelProbeWarn        msgKey = "install.kernel.warn"
+	msgStorageDriver          msgKey = "install.storage_driver"
+	msgStorageDriverVFS       msgKey = "install.storage_driver.vfs"
+	msgStorageDriverVFSHint   msgKey = "install.storage_driver.vfs_hint"
+	msgStorageDriverKept      msgKey = "install.storage_driver.kept"
+	msgServiceConfigFailed    msgKey = "install.services.failed"
+	msgServiceConfigDone      msgKey = "install.services.done"
+	msgDataDiskWarn           msgKey = "install.data_disk.warn"
+	msgDataDiskUUID           msgKey = "install.data_disk.uuid"
+	msgDataDiskFS             msgKey = "install.data_disk.fs"
+	msgDeployScriptMissing    msgKey = "install.deploy.missing"
+	msgDeployScriptFailed     msgKey = "install.deploy.failed"
+	msgSaveStateWarn          msgKey = "install.state.warn"
+	msgCleaning               msgKey = "install.cleanup.start"
+	msgCleaned                msgKey = "install.cleanup.done"
+	msgCacheHit               msgKey = "install.cache.hit"
+	msgCacheWarn              msgKey = "install.cache.warn"
+	msgPeersFound             msgKey = "install.peers.found"
+	msgPeersWarn              msgKey = "install.peers.warn"
+	msgCachePruned            msgKey = "install.cache.pruned"
+	msgBundleReading          msgKey = "install.bundle.reading"
+	msgBundleFailed           msgKey = "install.bundle.failed"
+	msgBundleSigned           msgKey = "install.bundle.signed"
+	msgBundleUnsigned         msgKey = "install.bundle.unsigned"
+	msgBundleImported         msgKey = "install.bundle.imported"
+	msgBundleImage            msgKey = "install.bundle.image"
+	msgInstallDone            msgKey = "install.done"
+	msgUseLocalVersion        msgKey = "version.local"
+	msgCopyLocalVersionFailed msgKey = "version.local.failed"
+	msgManifestFailed         msgKey = "version.download.failed"
+	msgReadVersionFailed      msgKey = "version.read.failed"
+	msgVersionMissingField    msgKey = "version.missing_field"
+	msgInstallLog             msgKey = "install.log"
+	msgInstallLogFailed       msgKey = "install.log.failed"
+)
+
+// 硬盘检测、脚本和 supervisord（cmd.go）
+const (
+	msgDiskCandidate           msgKey = "disk.candidate"
+	msgDiskUseCwd              msgKey = "disk.use_cwd"
+	msgDiskNoSpace             msgKey = "disk.no_space"
+	msgDiskSelected            msgKey = "disk.selected"
+	msgArchDetectFailed        msgKey = "arch.detect_failed"
+	msgArchUnsupported         msgKey = "arch.unsupported"
+	msgScriptPipeFailed        msgKey = "script.pipe_failed"
+	msgScriptStartFailed       msgKey = "script.start_failed"
+	msgScriptFailed            msgKey = "script.failed"
+	msgSupervisordNotInstalled msgKey = "supervisord.not_installed"
+	msgSupervisordStopping     msgKey = "supervisord.stopping"
+	msgSupervisordStopWarn     msgKey = "supervisord.stop_warn"
+	msgSupervisordOutput       msgKey = "supervisord.output"
+	msgSupervisordStopped      msgKey = "supervisord.stopped"
+	msgSupervisordKilling      msgKey = "supervisord.killing"
+	msgSupervisordKillFailed   msgKey = "supervisord.kill_failed"
+	msgSupervisordKilled       msgKey = "supervisord.killed"
+	msgSupervisordNoProcess    msgKey = "supervisord.no_process"
+	msgSupervisordAllKilled    msgKey = "supervisord.all_killed"
+	msgPkillFailed             msgKey = "supervisord.pkill_failed"
+	msgPsFailed                msgKey = "supervisord.ps_failed"
+)
+
+// 下载（download.go）
+const (
+	msgMirrorCDN         msgKey = "mirror.cdn"
+	msgMirrorServer      msgKey = "mirror.server"
+	msgTryMirror         msgKey = "download.try_mirror"
+	msgMirrorProbeOK     msgKey = "download.probe_ok"
+	msgMirrorProbeFailed msgKey = "download.probe_failed"
+	msgMirrorRaceWinner  msgKey = "download.race_winner"
+	msgRetrying          msgKey = "download.retrying"
+	msgMirrorFailed      msgKey = "download.mirror_failed"
+	msgChecksumFailed    msgKey = "download.checksum_failed"
+	msgChecksumOK        msgKey = "download.checksum_ok"
+	msgChecksumMismatch  msgKey = "download.checksum_mismatch"
+	msgProgress          msgKey = "download.progress"
+	msgProgressDone      msgKey = "download.progress_done"
+	msgProgressLimited   msgKey = "download.progress_limited"
+	msgDownloadPaused    msgKey = "download.paused"
+	msgDownloadResumed   msgKey = "download.resumed"
+	msgDownloadSize      msgKey = "download.size"
+	msgAllMirrorsFailed  msgKey = "download.all_failed"
+	msgHTTPRequestFailed msgKey = "download.http_failed"
+	msgHTTPStatus        msgKey = "download.http_status"
+	msgCreateFileFailed  msgKey = "download.create_failed"
+	msgWriteFileFailed   msgKey = "download.write_failed"
+	msgReadBodyFailed    msgKey = "download.read_failed"
+	msgCopyBodyFailed    msgKey = "download.copy_failed"
+	msgOpenFileFailed    msgKey = "checksum.open_failed"
+	msgHashFailed        msgKey = "checksum.hash_failed"
+	msgNetworkConfigWarn msgKey = "network.config_warn"
+)
+
+// 安装包缓存（cache.go）
+const (
+	msgCacheConfigInvalid msgKey = "cache.config_invalid"
+	msgCacheKeepInvalid   msgKey = "cache.keep_invalid"
+	msgCacheIndexCorrupt  msgKey = "cache.index_corrupt"
+	msgCacheEntryCorrupt  msgKey = "cache.entry_corrupt"
+	msgCacheIndexWarn     msgKey = "cache.index_warn"
+	msgCacheRemoved       msgKey = "cache.removed"
+	msgCachePruneDone     msgKey = "cache.prune_done"
+	msgCacheEmpty         msgKey = "cache.empty"
+	msgCacheTotal         msgKey = "cache.total"
+	msgCacheNotInstalled  msgKey = "cache.not_installed"
+	msgUnknownAction      msgKey = "command.unknown_action"
+)
+
+// installer 自身更新（selfupdate.go）
+const (
+	msgSignatureKeyInvalid msgKey = "signature.key_invalid"
+	msgSignatureInvalid    msgKey = "signature.invalid"
+	msgSignatureMismatch   msgKey = "signature.mismatch"
+	msgSignatureOK         msgKey = "signature.ok"
+	msgSelfUpdateLocal     msgKey = "self_update.local"
+	msgSelfUpdateFetching  msgKey = "self_update.fetching"
+	msgSelfUpdateFetchFail msgKey = "self_update.fetch_failed"
+	msgSelfUpdateProbeFail msgKey = "self_update.probe_failed"
+	msgSelfUpdateVersion   msgKey = "self_update.version_mismatch"
+	msgSelfUpdateReplace   msgKey = "self_update.replace_failed"
+	msgSelfUpdateStillOld  msgKey = "self_update.still_old"
+	msgSelfUpdateAvailable msgKey = "self_update.available"
+	msgSelfUpdateReexec    msgKey = "self_update.reexec"
+	msgSelfUpdateRequired  msgKey = "self_update.required_failed"
+	msgSelfUpdateWarn      msgKey = "self_update.warn"
+	msgSelfUpdateNoInfo    msgKey = "self_update.no_info"
+	msgSelfUpdateCurrent   msgKey = "self_update.current"
+	msgSelfUpdateLatest    msgKey = "self_update.latest"
+	msgSelfUpdateMinimum   msgKey = "self_update.minimum"
+	msgSelfUpdateUpToDate  msgKey = "self_update.up_to_date"
+	msgSelfUpdateCheckHint msgKey = "self_update.check_hint"
+	msgSelfUpdateDone      msgKey = "self_update.done"
+	msgSelfUpdateNoKey     msgKey = "self_update.no_key"
+	msgSelfUpdateUnsigned  msgKey = "self_update.unsigned"
+)
+
+// 离线安装包（bundle.go）
+const (
+	msgBundleSignKeyInvalid  msgKey = "bundle.sign_key_invalid"
+	msgBundleSignKeyLength   msgKey = "bundle.sign_key_length"
+	msgBundleNoArch          msgKey = "bundle.no_arch"
+	msgBundleFetching        msgKey = "bundle.fetching"
+	msgBundleFetchFailed     msgKey = "bundle.fetch_failed"
+	msgBundleNoInstallerSig  msgKey = "bundle.no_installer_sig"
+	msgBundlePullImage       msgKey = "bundle.pull_image"
+	msgBundleNotBundle       msgKey = "bundle.not_bundle"
+	msgBundleIndexInvalid    msgKey = "bundle.index_invalid"
+	msgBundleFormat          msgKey = "bundle.format"
+	msgBundleNoSignature     msgKey = "bundle.no_signature"
+	msgBundleUnlisted        msgKey = "bundle.unlisted"
+	msgBundleSizeMismatch    msgKey = "bundle.size_mismatch"
+	msgBundleArchMissing     msgKey = "bundle.arch_missing"
+	msgBundleVersionMismatch msgKey = "bundle.version_mismatch"
+	msgBundleManifestOrder   msgKey = "bundle.manifest_order"
+	msgBundleNoManifest      msgKey = "bundle.no_manifest"
+	msgBundleMissingKind     msgKey = "bundle.missing_kind"
+	msgBundleMissingFile     msgKey = "bundle.missing_file"
+	msgBundleUsage           msgKey = "bundle.usage"
+	msgBundleVerifyUsage     msgKey = "bundle.verify_usage"
+	msgBundleVerified        msgKey = "bundle.verified"
+	msgBundleVerifyUnsigned  msgKey = "bundle.verify_unsigned"
+	msgBundleCreated         msgKey = "bundle.created"
+	msgBundleNoKey           msgKey = "bundle.no_key"
+	msgBundleInstallerTooOld msgKey = "bundle.installer_too_old"
+)
+
+// 下载源配置和 mirrors 子命令（mirror.go）
+const (
+	msgMirrorConfigParse    msgKey = "mirror.config_parse"
+	msgMirrorConfigError    msgKey = "mirror.config_error"
+	msgMirrorRetriesInvalid msgKey = "mirror.retries_invalid"
+	msgMirrorPortInvalid    msgKey = "mirror.port_invalid"
+	msgMirrorURLInvalid     msgKey = "mirror.url_invalid"
+	msgMirrorRetriesFlag    msgKey = "mirror.retries_flag_invalid"
+	msgMirrorNone           msgKey = "mirror.none"
+	msgMirrorsNoArgs        msgKey = "mirrors.no_args"
+	msgMirrorsEntry         msgKey = "mirrors.entry"
+	msgMirrorsSpeed         msgKey = "mirrors.speed"
+	msgMirrorsCounts        msgKey = "mirrors.counts"
+	msgMirrorsLastError     msgKey = "mirrors.last_error"
+	msgMirrorsSeparator     msgKey = "mirrors.separator"
+)
+
+// 子命令（subcommand.go 和各模块注册的子命令说明）
+const (
+	msgUnknownCommand        msgKey = "command.unknown"
+	msgLowPriorityFailed     msgKey = "command.low_priority_failed"
+	msgUsageHeader           msgKey = "command.usage"
+	msgUsageLaunchDockerd    msgKey = "command.usage.launch-dockerd"
+	msgUsageInstall          msgKey = "command.usage.install"
+	msgUsageHelp             msgKey = "command.usage.help"
+	msgUsageService          msgKey = "command.usage.service"
+	msgUsageConfig           msgKey = "command.usage.config"
+	msgUsageNetwork          msgKey = "command.usage.network"
+	msgUsageMirrors          msgKey = "command.usage.mirrors"
+	msgUsageCgroup           msgKey = "command.usage.cgroup"
+	msgUsageCache            msgKey = "command.usage.cache"
+	msgUsageDoctor           msgKey = "command.usage.doctor"
+	msgUsageEnableAutostart  msgKey = "command.usage.enable-autostart"
+	msgUsageDisableAutostart msgKey = "command.usage.disable-autostart"
+	msgUsageKernel           msgKey = "command.usage.kernel"
+	msgUsageBundle           msgKey = "command.usage.bundle"
+	msgUsageAgent            msgKey = "command.usage.dfa-agent"
+	msgUsageSelfUpdate       msgKey = "command.usage.self-update"
+	msgUsageVersion          msgKey = "command.usage.version"
+	msgUsageUpdate           msgKey = "command.usage.update"
+	msgUsageSupportBundle    msgKey = "command.usage.support-bundle"
+)
+
+// 自动更新（update.go、update_apply.go）
+const (
+	msgUpdateChannelInvalid  msgKey = "update.channel_invalid"
+	msgUpdateIntervalInvalid msgKey = "update.interval_invalid"
+	msgTimezoneInvalid       msgKey = "update.timezone_invalid"
+	msgWindowInvalid         msgKey = "update.window_invalid"
+	msgUpdateConfigParse     msgKey = "update.config_parse"
+	msgUpdateConfigError     msgKey = "update.config_error"
+	msgUpdateManifestFailed  msgKey = "update.manifest_failed"
+	msgUpdateTickError       msgKey = "update.tick_error"
+	msgUpdateCheckFailed     msgKey = "update.check_failed"
+	msgUpdateFound           msgKey = "update.found"
+	msgUpdateSkipFailed      msgKey = "update.skip_failed"
+	msgUpdateAutoApply       msgKey = "update.auto_apply"
+	msgUpdateStartFailed     msgKey = "update.start_failed"
+	msgUpdateAvailable       msgKey = "update.available"
+	msgUpdateUpToDate        msgKey = "update.up_to_date"
+	msgUpdateConfigUsage     msgKey = "update.config_usage"
+	msgUpdateNeedBool        msgKey = "update.need_bool"
+	msgUpdateUnknownSetting  msgKey = "update.unknown_setting"
+	msgUpdateConfigSet       msgKey = "update.config_set"
+	msgUpgradeBackupFailed   msgKey = "upgrade.backup_failed"
+	msgUpgradeRestoreFailed  msgKey = "upgrade.restore_failed"
+	msgUpgradeBackingUp      msgKey = "upgrade.backing_up"
+	msgUpgradeInstalling     msgKey = "upgrade.installing"
+	msgUpgradeWaitDockerd    msgKey = "upgrade.wait_dockerd"
+	msgUpgradeDone           msgKey = "upgrade.done"
+	msgUpgradeRollingBack    msgKey = "upgrade.rolling_back"
+	msgUpgradeRollbackFailed msgKey = "upgrade.rollback_failed"
+	msgUpgradeRestartFailed  msgKey = "upgrade.restart_failed"
+	msgUpgradeRolledBack     msgKey = "upgrade.rolled_back"
+	msgUpgradeDockerdTimeout msgKey = "upgrade.dockerd_timeout"
+	msgUpgradeHistoryFailed  msgKey = "upgrade.history_failed"
+)
+
+// doctor 检查（doctor.go 和各模块注册的检查）
+const (
+	msgCheckRoot                 msgKey = "doctor.title.root"
+	msgCheckArch                 msgKey = "doctor.title.arch"
+	msgCheckKernel               msgKey = "doctor.title.kernel"
+	msgCheckCgroup               msgKey = "doctor.title.cgroup"
+	msgCheckDataDisk             msgKey = "doctor.title.data-disk"
+	msgCheckInstall              msgKey = "doctor.title.install"
+	msgCheckSupervisord          msgKey = "doctor.title.supervisord"
+	msgCheckDockerd              msgKey = "doctor.title.dockerd"
+	msgCheckNAT                  msgKey = "doctor.title.nat"
+	msgCheckCA                   msgKey = "doctor.title.ca"
+	msgCheckRegistry             msgKey = "doctor.title.registry"
+	msgCheckStorage              msgKey = "doctor.title.storage"
+	msgDoctorDetail              msgKey = "doctor.detail"
+	msgDoctorRootRemedy          msgKey = "doctor.root_remedy"
+	msgDoctorRootUID             msgKey = "doctor.root_uid"
+	msgDoctorRootOK              msgKey = "doctor.root_ok"
+	msgDoctorArchRemedy          msgKey = "doctor.arch_remedy"
+	msgDoctorFeatureItem         msgKey = "doctor.feature_item"
+	msgDoctorUnsupported         msgKey = "doctor.unsupported"
+	msgDoctorKernelRemedy        msgKey = "doctor.kernel_remedy"
+	msgDoctorKernelOptional      msgKey = "doctor.kernel_optional"
+	msgDoctorKernelUnknownRemedy msgKey = "doctor.kernel_unknown_remedy"
+	msgDoctorKernelUnknown       msgKey = "doctor.kernel_unknown"
+	msgDoctorKernelOK            msgKey = "doctor.kernel_ok"
+	msgDoctorCgroupNoneRemedy    msgKey = "doctor.cgroup_none_remedy"
+	msgDoctorCgroupMode          msgKey = "doctor.cgroup_mode"
+	msgDoctorCgroupMissingRemedy msgKey = "doctor.cgroup_missing_remedy"
+	msgDoctorCgroupMissing       msgKey = "doctor.cgroup_missing"
+	msgDoctorCgroupOK            msgKey = "doctor.cgroup_ok"
+	msgDoctorDiskNoRecordRemedy  msgKey = "doctor.disk_no_record_remedy"
+	msgDoctorDiskNoRecord        msgKey = "doctor.disk_no_record"
+	msgDoctorMountinfoFailed     msgKey = "doctor.mountinfo_failed"
+	msgDoctorDiskMissingRemedy   msgKey = "doctor.disk_missing_remedy"
+	msgDoctorDiskMissing         msgKey = "doctor.disk_missing"
+	msgDoctorFreeFailed          msgKey = "doctor.free_failed"
+	msgDoctorDiskFSRemedy        msgKey = "doctor.disk_fs_remedy"
+	msgDoctorDiskFS              msgKey = "doctor.disk_fs"
+	msgDoctorPruneRemedy         msgKey = "doctor.prune_remedy"
+	msgDoctorDiskFull            msgKey = "doctor.disk_full"
+	msgDoctorDiskLow             msgKey = "doctor.disk_low"
+	msgDoctorDiskOK              msgKey = "doctor.disk_ok"
+	msgDoctorFileMissing         msgKey = "doctor.file_missing"
+	msgDoctorFileNotExec         msgKey = "doctor.file_not_exec"
+	msgDoctorReinstallRemedy     msgKey = "doctor.reinstall_remedy"
+	msgDoctorInstallOK           msgKey = "doctor.install_ok"
+	msgDoctorSupervisordRemedy   msgKey = "doctor.supervisord_remedy"
+	msgDoctorSupervisordDown     msgKey = "doctor.supervisord_down"
+	msgDoctorStoppedRemedy       msgKey = "doctor.stopped_remedy"
+	msgDoctorStopped             msgKey = "doctor.stopped"
+	msgDoctorServicesOK          msgKey = "doctor.services_ok"
+	msgDoctorDockerdRemedy       msgKey = "doctor.dockerd_remedy"
+	msgDoctorDockerdDown         msgKey = "doctor.dockerd_down"
+	msgDoctorDockerdOK           msgKey = "doctor.dockerd_ok"
+	msgDoctorConnectRemedy       msgKey = "doctor.connect_remedy"
+	msgDoctorNATRemedy           msgKey = "doctor.nat_remedy"
+	msgDoctorNATMissing          msgKey = "doctor.nat_missing"
+	msgDoctorNATOK               msgKey = "doctor.nat_ok"
+	msgDoctorCARemedy            msgKey = "doctor.ca_remedy"
+	msgDoctorCALoadFailed        msgKey = "doctor.ca_load_failed"
+	msgDoctorClockRemedy         msgKey = "doctor.clock_remedy"
+	msgDoctorClockWrong          msgKey = "doctor.clock_wrong"
+	msgDoctorCALoaded            msgKey = "doctor.ca_loaded"
+	msgDoctorHijackRemedy        msgKey = "doctor.hijack_remedy"
+	msgDoctorCertFailed          msgKey = "doctor.cert_failed"
+	msgDoctorNetworkRemedy       msgKey = "doctor.network_remedy"
+	msgDoctorConnectFailed       msgKey = "doctor.connect_failed"
+	msgDoctorCertOK              msgKey = "doctor.cert_ok"
+	msgDoctorOffline             msgKey = "doctor.offline"
+	msgDoctorRegistryRemedy      msgKey = "doctor.registry_remedy"
+	msgDoctorRegistryFailed      msgKey = "doctor.registry_failed"
+	msgDoctorRegistryPartial     msgKey = "doctor.registry_partial"
+	msgDoctorRegistryOK          msgKey = "doctor.registry_ok"
+	msgDoctorUnknownCheck        msgKey = "doctor.unknown_check"
+	msgDoctorUnknownOutput       msgKey = "doctor.unknown_output"
+	msgDoctorFailedCount         msgKey = "doctor.failed_count"
+	msgDoctorSummary             msgKey = "doctor.summary"
+	msgDoctorStorageConfigRemedy msgKey = "doctor.storage_config_remedy"
+	msgDoctorStorageUnsetRemedy  msgKey = "doctor.storage_unset_remedy"
+	msgDoctorStorageUnset        msgKey = "doctor.storage_unset"
+	msgDoctorStorageVFSRemedy    msgKey = "doctor.storage_vfs_remedy"
+	msgDoctorStorageVFS          msgKey = "doctor.storage_vfs"
+)
+
+// 容器网络（network.go、network_watch.go）
+const (
+	msgNetworkRouteParse     msgKey = "network.route_parse"
+	msgNetworkNoUplink       msgKey = "network.no_uplink"
+	msgNetworkRemoveFailed   msgKey = "network.remove_failed"
+	msgNetworkUplink         msgKey = "network.uplink"
+	msgNetworkApplied        msgKey = "network.applied"
+	msgNetworkTornDown       msgKey = "network.torn_down"
+	msgNetworkWatchFailed    msgKey = "network.watch_failed"
+	msgNetworkWatchRecovered msgKey = "network.watch_recovered"
+	msgNetworkWatchUplink    msgKey = "network.watch_uplink"
+	msgNetworkWatchSwitch    msgKey = "network.watch_switch"
+	msgNetworkWatchClosed    msgKey = "network.watch_closed"
+	msgNetlinkSocket         msgKey = "network.netlink_socket"
+	msgNetlinkBind           msgKey = "network.netlink_bind"
+	msgNetlinkTimeout        msgKey = "network.netlink_timeout"
+	msgNetworkWatchPolling   msgKey = "network.watch_polling"
+	msgNetworkWatchStart     msgKey = "network.watch_start"
+)
+
+// messagesZH 中文消息
+var messagesZH = map[msgKey]string{
+	msgErrorPrefix:            "✗ 错误: %v",
+	msgStepDetectDisk:         "检测硬盘挂载点",
+	msgStepVersionInfo:        "获取版本信息",
+	msgStepDownload:           "下载安装文件",
+	msgStepStopServices:       "停止现有服务",
+	msgStepExtract:            "解压安装文件",
+	msgStepDeploy:             "执行部署脚本",
+	msgDiskNeedExt4:           "✗ Docker 需要 ext4 格式的外置硬盘才能运行",
+	msgDiskInsertHint:         "✗ 请确保已接入并格式化硬盘后再运行此程序",
+	msgDiskNotFound:           "未检测到可用的硬盘",
+	msgDiskDetected:           "✓ 检测到硬盘挂载点: %s",
+	msgTmpDirFailed:           "无法创建临时目录 %s",
+	msgTmpDir:                 "✓ 临时目录: %s",
+	msgVersionInfoFailed:      "无法获取版本信息",
+	msgVersion:                "✓ 版本: %s",
+	msgArch:                   "✓ 架构: %s",
+	msgSelfUpdateFailed:       "更新 installer 失败",
+	msgUseLocalFile:           "⏳ 使用本地文件 %s...",
+	msgCopyLocalFailed:        "复制本地文件失败",
+	msgCopied:                 "✓ %s 复制完成",
+	msgDownloading:            "⏳ 下载 %s...",
+	msgDownloadFailed:         "下载失败: %s",
+	msgDownloaded:             "✓ %s 下载完成",
+	msgStopServicesFailed:     "停止 supervisord 服务失败",
+	msgExtracting:             "⏳ 解压 %s 到 %s...",
+	msgExtractingTmp:          "⏳ 解压 %s 到临时目录 %s...",
+	msgExtractFailed:          "解压失败: %s",
+	msgExtractDirFailed:       "创建临时解压目录失败",
+	msgExtracted:              "✓ %s 解压完成",
+	msgBinDirFailed:           "创建二进制目录失败",
+	msgMoveBinFailed:          "移动 arm64_bin 文件失败",
+	msgBinMoved:               "✓ arm64_bin 文件已移动到 %s",
+	msgInstallSelfWarn:        "⚠ 警告: 复制 installer 到 %s 失败: %v",
+	msgBinPermWarn:            "⚠ 警告: 设置二进制文件权限失败: %v",
+	msgDaemonSnapshotFailed:   "保存 daemon.json 默认配置失败",
+	msgDaemonConfigFailed:     "生成 daemon.json 失败",
+	msgDaemonConfigDone:       "✓ daemon.json 已生成: %s",
+	msgKernelProbeWarn:        "⚠ 警告: 读取内核和挂载信息失败: %v",
+	msgStorageDriver:          "✓ 存储驱动: %s（数据盘 %s）",
+	msgStorageDriverVFS:       "⚠⚠ 警告: 只能使用 vfs 存储驱动: %s",
+	msgStorageDriverVFSHint:   "   vfs 不共享镜像层，每个容器都会完整复制一份镜像，磁盘空间会很快用完；\n   建议将数据盘格式化为 ext4 后重新安装",
+	msgStorageDriverKept:      "⚠ 保留正在使用的存储驱动 %s（本次探测结果为 %s）\n   切换驱动后已有的镜像和容器不可见，确需切换时使用 -reprobe-storage 重新安装",
+	msgServiceConfigFailed:    "生成服务配置失败",
+	msgServiceConfigDone:      "✓ 服务配置已生成: %s",
+	msgDataDiskWarn:           "⚠ 警告: 记录数据盘信息失败: %v",
+	msgDataDiskUUID:           "✓ 数据盘: %s (UUID %s)",
+	msgDataDiskFS:             "✓ 数据盘: %s (%s)",
+	msgDeployScriptMissing:    "部署脚本不存在: %s",
+	msgDeployScriptFailed:     "部署脚本执行失败",
+	msgSaveStateWarn:          "⚠ 警告: 保存安装记录失败: %v",
+	msgCleaning:               "⏳ 清理临时文件...",
+	msgCleaned:                "✓ 清理完成",
+	msgCacheHit:               "✓ 使用缓存的 %s",
+	msgCacheWarn:              "⚠ 警告: 清理安装包缓存失败: %v",
+	msgPeersFound:             "✓ 局域网中有 %d 台设备可提供安装包",
+	msgPeersWarn:              "⚠ 警告: 查找局域网设备失败: %v",
+	msgCachePruned:            "✓ 已删除 %d 个旧版本安装包",
+	msgBundleReading:          "⏳ 读取离线安装包 %s...",
+	msgBundleFailed:           "读取离线安装包失败",
+	msgBundleSigned:           "✓ 离线安装包签名校验通过",
+	msgBundleUnsigned:         "⚠ 警告: 离线安装包未校验签名，只校验 SHA256",
+	msgBundleImported:         "✓ %s 已导入",
+	msgBundleImage:            "✓ 镜像 %s 已导入",
+	msgInstallDone:            "安装完成！",
+	msgUseLocalVersion:        "✓ 使用本地版本文件: %s",
+	msgCopyLocalVersionFailed: "无法复制本地 version.txt: %v",
+	msgManifestFailed:         "无法下载 %s: %v",
+	msgReadVersionFailed:      "无法读取 version.txt: %v",
+	msgVersionMissingField:    "version.txt 中缺少 %s 字段",
+	msgInstallLog:             "安装日志: %s",
+	msgInstallLogFailed:       "⚠ 无法创建安装日志: %v",
+
+	msgDiskCandidate:           "  检测路径: %s, 可用空间: %.2f GB",
+	msgDiskUseCwd:              "  使用当前目录: %s, 可用空间: %.2f GB",
+	msgDiskNoSpace:             "未找到足够的可用空间（需要至少 1GB 空间）",
+	msgDiskSelected:            "✓ 选择存储路径: %s, 可用空间: %.2f GB",
+	msgArchDetectFailed:        "无法检测系统架构: %v",
+	msgArchUnsupported:         "不支持的架构: %s",
+	msgScriptPipeFailed:        "创建 %s 管道失败: %v",
+	msgScriptStartFailed:       "启动脚本失败: %v",
+	msgScriptFailed:            "脚本执行失败: %v",
+	msgSupervisordNotInstalled: "✓ 未检测到已安装的 supervisord，跳过停止服务",
+	msgSupervisordStopping:     "⏳ 检测到已安装的 supervisord，正在停止服务...",
+	msgSupervisordStopWarn:     "⚠ supervisorctl stop all 执行警告: %v",
+	msgSupervisordOutput:       "  输出: %s",
+	msgSupervisordStopped:      "✓ supervisord 服务已停止",
+	msgSupervisordKilling:      "⏳ 检查并终止 supervisord 进程...",
+	msgSupervisordKillFailed:   "终止 supervisord 进程失败: %v，但继续运行",
+	msgSupervisordKilled:       "✓ 所有 supervisord 进程已终止",
+	msgSupervisordNoProcess:    "  未检测到 supervisord 进程",
+	msgSupervisordAllKilled:    "  已终止所有 supervisord 进程",
+	msgPkillFailed:             "执行 pkill 失败: %v",
+	msgPsFailed:                "执行 ps 失败: %v",
+
+	msgMirrorCDN:         "CDN",
+	msgMirrorServer:      "服务器",
+	msgTryMirror:         "   尝试从%s下载...",
+	msgMirrorProbeOK:     "   下载源 %s 延迟 %d ms",
+	msgMirrorProbeFailed: "   下载源 %s 不可用: %v",
+	msgMirrorRaceWinner:  "   %s 响应最快",
+	msgRetrying:          "   %v，%s 后重试（第 %d/%d 次）",
+	msgMirrorFailed:      "   ✗ 下载失败: %v",
+	msgChecksumFailed:    "   ✗ SHA256 验证失败: %v",
+	msgChecksumOK:        "   ✓ SHA256 验证通过",
+	msgChecksumMismatch:  "SHA256 不匹配 (期望: %s, 实际: %s)",
+	msgProgress:          "   进度: %.1f%% (%d/%d MB)",
+	msgProgressDone:      "   进度: 100.0%% (%d/%d MB)",
+	msgProgressLimited:   "   进度: %.1f%% (%d/%d MB)，限速 %s/s",
+	msgDownloadPaused:    "   ⏸ 下载已暂停，等待恢复...",
+	msgDownloadResumed:   "   ▶ 继续下载",
+	msgDownloadSize:      "   下载完成: %d MB",
+	msgAllMirrorsFailed:  "所有下载源均失败: %v",
+	msgHTTPRequestFailed: "HTTP 请求失败: %v",
+	msgHTTPStatus:        "HTTP 状态码: %d",
+	msgCreateFileFailed:  "创建文件失败: %v",
+	msgWriteFileFailed:   "写入文件失败: %v",
+	msgReadBodyFailed:    "读取数据失败: %v",
+	msgCopyBodyFailed:    "下载失败: %v",
+	msgOpenFileFailed:    "打开文件失败: %v",
+	msgHashFailed:        "计算哈希失败: %v",
+	msgNetworkConfigWarn: "⚠ 网络或下载源配置无效，使用默认设置: %v",
+
+	msgCacheConfigInvalid: "解析 %s 失败: %v",
+	msgCacheKeepInvalid:   "无效的保留版本数 %d",
+	msgCacheIndexCorrupt:  "⚠ 缓存索引损坏，已忽略: %v",
+	msgCacheEntryCorrupt:  "⚠ 缓存的 %s 已损坏，重新获取: %v",
+	msgCacheIndexWarn:     "⚠ 写入缓存索引失败: %v",
+	msgCacheRemoved:       "  删除 %s（%s）",
+	msgCachePruneDone:     "✓ 已删除 %d 个安装包，释放 %.1f MB",
+	msgCacheEmpty:         "缓存为空: %s",
+	msgCacheTotal:         "共 %d 个，%.1f MB: %s",
+	msgCacheNotInstalled:  "没有安装记录，无法确定数据盘上的安装包缓存",
+	msgUnknownAction:      "未知操作: %s",
+
+	msgSignatureKeyInvalid: "无效的签名公钥",
+	msgSignatureInvalid:    "无效的签名文件: %v",
+	msgSignatureMismatch:   "签名校验失败",
+	msgSignatureOK:         "   ✓ 签名校验通过",
+	msgSelfUpdateLocal:     "⏳ 使用本地文件 %s...",
+	msgSelfUpdateFetching:  "⏳ 下载 %s...",
+	msgSelfUpdateFetchFail: "下载 %s 失败: %v",
+	msgSelfUpdateProbeFail: "新 installer 无法运行: %v",
+	msgSelfUpdateVersion:   "新 installer 版本为 %s，期望 %s",
+	msgSelfUpdateReplace:   "替换 %s 失败: %v",
+	msgSelfUpdateStillOld:  "installer 已更新到 %s，仍低于最低版本 %s",
+	msgSelfUpdateAvailable: "⏳ installer 有新版本 %s（当前 %s）",
+	msgSelfUpdateReexec:    "✓ installer 已更新到 %s，重新执行",
+	msgSelfUpdateRequired:  "installer %s 低于最低版本 %s，自动更新失败: %v",
+	msgSelfUpdateWarn:      "⚠ 警告: 更新 installer 失败，继续使用当前版本: %v",
+	msgSelfUpdateNoInfo:    "%s 中没有 installer 的版本信息",
+	msgSelfUpdateCurrent:   "当前版本: %s",
+	msgSelfUpdateLatest:    "最新版本: %s",
+	msgSelfUpdateMinimum:   "最低版本: %s",
+	msgSelfUpdateUpToDate:  "✓ 已是最新版本",
+	msgSelfUpdateCheckHint: "⚠ 有新版本，运行 self-update 更新",
+	msgSelfUpdateDone:      "✓ 已更新 %s 到 %s",
+	msgSelfUpdateNoKey:     "这个 installer 构建时没有发布公钥，无法校验新版本的签名；确认来源可信时可以加 -allow-unsigned",
+	msgSelfUpdateUnsigned:  "⚠ 没有发布公钥，只校验 SHA256",
+
+	msgBundleSignKeyInvalid:  "无效的签名私钥 %s: %v",
+	msgBundleSignKeyLength:   "无效的签名私钥 %s: 长度 %d",
+	msgBundleNoArch:          "至少需要一个架构",
+	msgBundleFetching:        "⏳ 下载 %s...",
+	msgBundleFetchFailed:     "下载 %s 失败: %v",
+	msgBundleNoInstallerSig:  "⚠ 警告: 没有 %s 的签名: %v",
+	msgBundlePullImage:       "⏳ 拉取镜像 %s（%s）...",
+	msgBundleNotBundle:       "不是离线安装包，第一个文件应为 %s",
+	msgBundleIndexInvalid:    "解析 %s 失败: %v",
+	msgBundleFormat:          "不支持的离线安装包格式 %d",
+	msgBundleNoSignature:     "离线安装包没有签名，确认来源可信时可以加 -allow-unsigned",
+	msgBundleUnlisted:        "离线安装包中有未记录的文件 %s",
+	msgBundleSizeMismatch:    "%s 大小为 %d，bundle.json 中为 %d",
+	msgBundleArchMissing:     "离线安装包不包含 %s 架构（包含 %s）",
+	msgBundleVersionMismatch: "版本 %s 与 bundle.json 中的 %s 不一致",
+	msgBundleManifestOrder:   "版本文件应在安装包之前",
+	msgBundleNoManifest:      "离线安装包中没有版本文件",
+	msgBundleMissingKind:     "离线安装包中缺少 %s 安装包",
+	msgBundleMissingFile:     "离线安装包中缺少 %s",
+	msgBundleUsage:           "用法: bundle <create|verify> [参数]",
+	msgBundleVerifyUsage:     "用法: bundle verify [-key 公钥] <文件>",
+	msgBundleVerified:        "✓ 版本 %s（%s），架构 %s，%d 个文件校验通过",
+	msgBundleVerifyUnsigned:  "⚠ 未校验签名",
+	msgBundleCreated:         "✓ 离线安装包: %s（版本 %s，架构 %s，%d 个文件）",
+	msgBundleNoKey:           "没有校验离线安装包签名的公钥，请指定公钥，或者确认来源可信后加 -allow-unsigned",
+	msgBundleInstallerTooOld: "installer %s 低于离线安装包要求的最低版本 %s，请使用离线安装包中的 %s",
+
+	msgMirrorConfigParse:    "解析 %s 失败: %v",
+	msgMirrorConfigError:    "%s: %v",
+	msgMirrorRetriesInvalid: "%s: 无效的重试次数 %d",
+	msgMirrorPortInvalid:    "%s: 无效的端口 %d",
+	msgMirrorURLInvalid:     "无效的下载源地址 %q",
+	msgMirrorRetriesFlag:    "无效的重试次数: %s",
+	msgMirrorNone:           "没有可用的下载源，检查 %s",
+	msgMirrorsNoArgs:        "mirrors 不接受参数: %s",
+	msgMirrorsEntry:         "%d. %-10s %s",
+	msgMirrorsSpeed:         "速度 %.1f MB/s",
+	msgMirrorsCounts:        "成功 %d 次，失败 %d 次",
+	msgMirrorsLastError:     "最近失败: %s",
+	msgMirrorsSeparator:     "，",
+
+	msgUnknownCommand:        "未知命令: %s",
+	msgLowPriorityFailed:     "⚠ 降低进程优先级失败: %v",
+	msgUsageHeader:           "用法: %s <命令> [参数]\n\n命令:",
+	msgUsageLaunchDockerd:    "准备挂载命名空间并启动 supervisord/dockerd",
+	msgUsageInstall:          "安装或升级 Docker（默认命令）",
+	msgUsageHelp:             "显示帮助信息",
+	msgUsageService:          "管理 supervisord 服务配置（list/enable/disable/render）",
+	msgUsageConfig:           "查看或修改 daemon.json（show/get/set/add/remove/unset/delete）",
+	msgUsageNetwork:          "配置容器网络转发和 NAT（status/apply/teardown/watch）",
+	msgUsageMirrors:          "探测下载源并显示排序和历史记录",
+	msgUsageCgroup:           "检测和挂载 cgroup（status/plan/mount）",
+	msgUsageCache:            "查看和清理安装包缓存（list/prune）",
+	msgUsageDoctor:           "检查 Docker 的运行环境和服务状态",
+	msgUsageEnableAutostart:  "安装开机自启动脚本（Magisk/KernelSU/service.d/init.d）",
+	msgUsageDisableAutostart: "删除开机自启动脚本",
+	msgUsageKernel:           "检测内核对 Docker 功能的支持",
+	msgUsageBundle:           "生成和校验离线安装包（create/verify）",
+	msgUsageAgent:            "运行本地管理服务，通过 unix socket 提供 JSON API",
+	msgUsageSelfUpdate:       "更新 installer 自身",
+	msgUsageVersion:          "显示 installer 版本",
+	msgUsageUpdate:           "检查和应用更新（status/check/apply/config/history）",
+	msgUsageSupportBundle:    "打包日志和系统状态，用于反馈问题",
+
+	msgUpdateChannelInvalid:  "无效的通道: %q",
+	msgUpdateIntervalInvalid: "无效的检查间隔: %q",
+	msgTimezoneInvalid:       "无效的时区: %q",
+	msgWindowInvalid:         "无效的维护窗口: %q（格式 03:00-05:00）",
+	msgUpdateConfigParse:     "解析 %s 失败: %v",
+	msgUpdateConfigError:     "%s: %v",
+	msgUpdateManifestFailed:  "无法下载 %s: %v",
+	msgUpdateTickError:       "✗ %v",
+	msgUpdateCheckFailed:     "✗ 检查更新失败: %v",
+	msgUpdateFound:           "发现新版本 %s（当前 %s，通道 %s）",
+	msgUpdateSkipFailed:      "⚠ %s 之前自动升级失败，跳过",
+	msgUpdateAutoApply:       "⏳ 在维护窗口内自动升级到 %s",
+	msgUpdateStartFailed:     "✗ 启动升级失败: %v",
+	msgUpdateAvailable:       "✓ 有新版本: %s（当前 %s）",
+	msgUpdateUpToDate:        "✓ 已是最新版本: %s",
+	msgUpdateConfigUsage:     "用法: update config <check|auto_apply|channel|interval|window|timezone> <值>",
+	msgUpdateNeedBool:        "%s 需要 true 或 false",
+	msgUpdateUnknownSetting:  "未知设置: %s",
+	msgUpdateConfigSet:       "✓ 已设置 %s = %s",
+	msgUpgradeBackupFailed:   "备份 %s 失败: %v",
+	msgUpgradeRestoreFailed:  "恢复 %s 失败: %v",
+	msgUpgradeBackingUp:      "⏳ 备份当前安装...",
+	msgUpgradeInstalling:     "⏳ 安装新版本...",
+	msgUpgradeWaitDockerd:    "⏳ 等待 dockerd 启动...",
+	msgUpgradeDone:           "✓ 升级完成",
+	msgUpgradeRollingBack:    "✗ 升级失败: %v，开始回滚",
+	msgUpgradeRollbackFailed: "%v；回滚失败: %v",
+	msgUpgradeRestartFailed:  "⚠ 回滚后重启服务失败: %v",
+	msgUpgradeRolledBack:     "✓ 已回滚到升级前的版本",
+	msgUpgradeDockerdTimeout: "dockerd 在 %s 内未就绪: %s",
+	msgUpgradeHistoryFailed:  "⚠ 保存升级记录失败: %v",
+
+	msgCheckRoot:                 "root 权限",
+	msgCheckArch:                 "CPU 架构",
+	msgCheckKernel:               "内核配置",
+	msgCheckCgroup:               "cgroup 控制器",
+	msgCheckDataDisk:             "数据盘",
+	msgCheckInstall:              "安装目录",
+	msgCheckSupervisord:          "supervisord",
+	msgCheckDockerd:              "dockerd",
+	msgCheckNAT:                  "docker0 转发和 NAT",
+	msgCheckCA:                   "CA 证书",
+	msgCheckRegistry:             "镜像仓库",
+	msgCheckStorage:              "存储驱动",
+	msgDoctorDetail:              "%v",
+	msgDoctorRootRemedy:          "使用 su 切换到 root 后重新运行",
+	msgDoctorRootUID:             "当前 uid 为 %d",
+	msgDoctorRootOK:              "以 root 运行",
+	msgDoctorArchRemedy:          "Docker for Android 只支持 arm64 和 x86_64 设备",
+	msgDoctorFeatureItem:         "%s（%s）",
+	msgDoctorUnsupported:         "不支持 %s",
+	msgDoctorKernelRemedy:        "需要使用开启这些选项的内核，联系设备厂商或刷入支持 Docker 的内核",
+	msgDoctorKernelOptional:      "这些功能不可用，其余功能正常；不支持 overlay 时使用 vfs 存储驱动，占用空间较多",
+	msgDoctorKernelUnknownRemedy: "内核未开启 CONFIG_IKCONFIG_PROC，无法确认内核支持，可以直接尝试启动 dockerd",
+	msgDoctorKernelUnknown:       "无法确认: %s",
+	msgDoctorKernelOK:            "%s，存储驱动 %s",
+	msgDoctorCgroupNoneRemedy:    "内核没有可用的 cgroup 控制器，dockerd 无法启动",
+	msgDoctorCgroupMode:          "cgroup 模式: %s",
+	msgDoctorCgroupMissingRemedy: "运行 cgroup 查看详情，缺少的控制器对应的资源限制不可用",
+	msgDoctorCgroupMissing:       "%s 布局，缺少 %s",
+	msgDoctorCgroupOK:            "%s 布局，控制器: %s",
+	msgDoctorDiskNoRecordRemedy:  "运行 install 重新安装以记录数据盘",
+	msgDoctorDiskNoRecord:        "没有数据盘记录",
+	msgDoctorMountinfoFailed:     "读取 mountinfo 失败: %v",
+	msgDoctorDiskMissingRemedy:   "检查硬盘是否接好，重新插拔后等待系统挂载",
+	msgDoctorDiskMissing:         "%s 未挂载（安装时为 %s）",
+	msgDoctorFreeFailed:          "无法获取 %s 的可用空间: %v",
+	msgDoctorDiskFSRemedy:        "建议将数据盘格式化为 ext4，其他文件系统可能不支持 overlay2",
+	msgDoctorDiskFS:              "%s 的文件系统为 %s，可用 %.2f GB",
+	msgDoctorPruneRemedy:         "清理不用的镜像和容器（docker system prune）",
+	msgDoctorDiskFull:            "%s 可用空间只有 %.2f GB",
+	msgDoctorDiskLow:             "%s 可用空间 %.2f GB",
+	msgDoctorDiskOK:              "%s（%s，%s），可用 %.2f GB",
+	msgDoctorFileMissing:         "%s 不存在",
+	msgDoctorFileNotExec:         "%s 不可执行",
+	msgDoctorReinstallRemedy:     "运行 install 重新安装",
+	msgDoctorInstallOK:           "%s 已安装 %s（%s）",
+	msgDoctorSupervisordRemedy:   "运行 launch-dockerd 启动服务，或重启设备",
+	msgDoctorSupervisordDown:     "supervisord 未运行: %v",
+	msgDoctorStoppedRemedy:       "查看 support-bundle 中的日志，或运行 supervisord ctl start <服务> 重新启动",
+	msgDoctorStopped:             "未运行的服务: %s",
+	msgDoctorServicesOK:          "%d 个服务运行中",
+	msgDoctorDockerdRemedy:       "查看 %s 中的错误",
+	msgDoctorDockerdDown:         "dockerd 无响应: %s",
+	msgDoctorDockerdOK:           "Docker %s（API %s）",
+	msgDoctorConnectRemedy:       "连接网络后再检查",
+	msgDoctorNATRemedy:           "运行 network apply 重新配置，或启用 network-watch 服务自动修复",
+	msgDoctorNATMissing:          "容器无法访问外网，缺少规则: %s",
+	msgDoctorNATOK:               "%s 经 %s 转发",
+	msgDoctorCARemedy:            "重新下载 installer",
+	msgDoctorCALoadFailed:        "内置 CA 证书加载失败",
+	msgDoctorClockRemedy:         "同步系统时间后重试（设置 → 日期和时间 → 自动确定时间）",
+	msgDoctorClockWrong:          "系统时间 %s 不正确，HTTPS 证书校验会失败",
+	msgDoctorCALoaded:            "内置 CA 证书已加载",
+	msgDoctorHijackRemedy:        "网络中可能有 HTTPS 劫持，检查代理设置或更换网络",
+	msgDoctorCertFailed:          "%s 的证书校验失败: %v",
+	msgDoctorNetworkRemedy:       "检查网络连接",
+	msgDoctorConnectFailed:       "无法连接 %s: %v",
+	msgDoctorCertOK:              "%s 证书校验通过",
+	msgDoctorOffline:             "离线模式，跳过",
+	msgDoctorRegistryRemedy:      "在 daemon.json 的 registry-mirrors 中配置可用的镜像加速地址",
+	msgDoctorRegistryFailed:      "无法访问镜像仓库: %s",
+	msgDoctorRegistryPartial:     "可以访问 %s；无法访问 %s",
+	msgDoctorRegistryOK:          "可以访问 %s",
+	msgDoctorUnknownCheck:        "未知的检查: %s",
+	msgDoctorUnknownOutput:       "未知的输出格式: %s（支持 text/json）",
+	msgDoctorFailedCount:         "%d 项检查未通过",
+	msgDoctorSummary:             "通过 %d，警告 %d，失败 %d",
+	msgDoctorStorageConfigRemedy: "运行 config show 检查配置",
+	msgDoctorStorageUnsetRemedy:  "运行 install 重新安装以选择存储驱动",
+	msgDoctorStorageUnset:        "未指定，由 dockerd 自动选择",
+	msgDoctorStorageVFSRemedy:    "将数据盘格式化为 ext4 后重新安装，或定期运行 docker system prune",
+	msgDoctorStorageVFS:          "使用 vfs，每个容器都会完整复制镜像",
+
+	msgNetworkRouteParse:     "解析 %s 失败: %v",
+	msgNetworkNoUplink:       "未找到默认路由接口",
+	msgNetworkRemoveFailed:   "⚠ 警告: 删除 %s 的规则失败: %v",
+	msgNetworkUplink:         "%s %-16s 网关: %-15s metric: %d",
+	msgNetworkApplied:        "✓ 已配置 %s -> %s 的转发和 NAT",
+	msgNetworkTornDown:       "✓ 已删除容器网络规则",
+	msgNetworkWatchFailed:    "✗ 配置容器网络失败: %v",
+	msgNetworkWatchRecovered: "✓ 容器网络已恢复",
+	msgNetworkWatchUplink:    "✓ 上行接口: %s",
+	msgNetworkWatchSwitch:    "⇄ 上行接口切换: %s -> %s",
+	msgNetworkWatchClosed:    "⚠ 路由事件通道已关闭，改为每 %s 轮询",
+	msgNetlinkSocket:         "创建 netlink socket 失败: %v",
+	msgNetlinkBind:           "绑定 netlink socket 失败: %v",
+	msgNetlinkTimeout:        "设置 netlink 超时失败: %v",
+	msgNetworkWatchPolling:   "⚠ %v，改为每 %s 轮询",
+	msgNetworkWatchStart:     "开始监听上行接口变化",
+}
+
+// messagesEN 英文消息
+var messagesEN = map[msgKey]string{
+	msgErrorPrefix:            "✗ Error: %v",
+	msgStepDetectDisk:         "Detecting disk mount point",
+	msgStepVersionInfo:        "Fetching version information",
+	msgStepDownload:           "Downloading packages",
+	msgStepStopServices:       "Stopping running services",
+	msgStepExtract:            "Extracting packages",
+	msgStepDeploy:             "Running deploy script",
+	msgDiskNeedExt4:           "✗ Docker needs an external ext4 disk to run",
+	msgDiskInsertHint:         "✗ Attach and format a disk, then run the installer again",
+	msgDiskNotFound:           "no usable disk found",
+	msgDiskDetected:           "✓ Disk mount point: %s",
+	msgTmpDirFailed:           "cannot create temporary directory %s",
+	msgTmpDir:                 "✓ Temporary directory: %s",
+	msgVersionInfoFailed:      "cannot fetch version information",
+	msgVersion:                "✓ Version: %s",
+	msgArch:                   "✓ Architecture: %s",
+	msgSelfUpdateFailed:       "installer update failed",
+	msgUseLocalFile:           "⏳ Using local file %s...",
+	msgCopyLocalFailed:        "copying local file failed",
+	msgCopied:                 "✓ %s copied",
+	msgDownloading:            "⏳ Downloading %s...",
+	msgDownloadFailed:         "download failed: %s",
+	msgDownloaded:             "✓ %s downloaded",
+	msgStopServicesFailed:     "stopping supervisord failed",
+	msgExtracting:             "⏳ Extracting %s to %s...",
+	msgExtractingTmp:          "⏳ Extracting %s to temporary directory %s...",
+	msgExtractFailed:          "extract failed: %s",
+	msgExtractDirFailed:       "cannot create temporary extract directory",
+	msgExtracted:              "✓ %s extracted",
+	msgBinDirFailed:           "cannot create binary directory",
+	msgMoveBinFailed:          "moving arm64_bin files failed",
+	msgBinMoved:               "✓ arm64_bin files moved to %s",
+	msgInstallSelfWarn:        "⚠ Warning: copying installer to %s failed: %v",
+	msgBinPermWarn:            "⚠ Warning: setting binary permissions failed: %v",
+	msgDaemonSnapshotFailed:   "saving default daemon.json failed",
+	msgDaemonConfigFailed:     "generating daemon.json failed",
+	msgDaemonConfigDone:       "✓ daemon.json generated: %s",
+	msgKernelProbeWarn:        "⚠ Warning: reading kernel and mount information failed: %v",
+	msgStorageDriver:          "✓ Storage driver: %s (data disk %s)",
+	msgStorageDriverVFS:       "⚠⚠ WARNING: only the vfs storage driver works: %s",
+	msgStorageDriverVFSHint:   "   vfs does not share image layers; every container gets a full copy of its image and the disk will fill up quickly.\n   Reformat the data disk as ext4 and reinstall.",
+	msgStorageDriverKept:      "⚠ Keeping the storage driver in use, %s (this probe found %s)\n   Existing images and containers are hidden after switching drivers; reinstall with -reprobe-storage to switch anyway",
+	msgServiceConfigFailed:    "generating service configs failed",
+	msgServiceConfigDone:      "✓ Service configs generated: %s",
+	msgDataDiskWarn:           "⚠ Warning: recording data disk failed: %v",
+	msgDataDiskUUID:           "✓ Data disk: %s (UUID %s)",
+	msgDataDiskFS:             "✓ Data disk: %s (%s)",
+	msgDeployScriptMissing:    "deploy script not found: %s",
+	msgDeployScriptFailed:     "deploy script failed",
+	msgSaveStateWarn:          "⚠ Warning: saving install record failed: %v",
+	msgCleaning:               "⏳ Removing temporary files...",
+	msgCleaned:                "✓ Cleanup done",
+	msgCacheHit:               "✓ Using cached %s",
+	msgCacheWarn:              "⚠ Warning: cleaning the package cache failed: %v",
+	msgPeersFound:             "✓ Found %d LAN device(s) sharing the packages",
+	msgPeersWarn:              "⚠ Warning: LAN peer discovery failed: %v",
+	msgCachePruned:            "✓ Removed %d package(s) of older versions",
+	msgBundleReading:          "⏳ Reading offline bundle %s...",
+	msgBundleFailed:           "reading offline bundle failed",
+	msgBundleSigned:           "✓ Offline bundle signature verified",
+	msgBundleUnsigned:         "⚠ Warning: offline bundle signature not verified, checking SHA256 only",
+	msgBundleImported:         "✓ %s imported",
+	msgBundleImage:            "✓ Image %s imported",
+	msgInstallDone:            "Installation complete!",
+	msgUseLocalVersion:        "✓ Using local version file: %s",
+	msgCopyLocalVersionFailed: "cannot copy local version.txt: %v",
+	msgManifestFailed:         "cannot download %s: %v",
+	msgReadVersionFailed:      "cannot read version.txt: %v",
+	msgVersionMissingField:    "version.txt is missing field %s",
+	msgInstallLog:             "Install log: %s",
+	msgInstallLogFailed:       "⚠ Cannot create install log: %v",
+
+	msgDiskCandidate:           "  Checking %s, free: %.2f GB",
+	msgDiskUseCwd:              "  Using current directory %s, free: %.2f GB",
+	msgDiskNoSpace:             "not enough free space (at least 1GB required)",
+	msgDiskSelected:            "✓ Selected storage path %s, free: %.2f GB",
+	msgArchDetectFailed:        "cannot detect architecture: %v",
+	msgArchUnsupported:         "unsupported architecture: %s",
+	msgScriptPipeFailed:        "cannot create %s pipe: %v",
+	msgScriptStartFailed:       "cannot start script: %v",
+	msgScriptFailed:            "script failed: %v",
+	msgSupervisordNotInstalled: "✓ supervisord is not installed, nothing to stop",
+	msgSupervisordStopping:     "⏳ supervisord is installed, stopping services...",
+	msgSupervisordStopWarn:     "⚠ supervisorctl stop all reported: %v",
+	msgSupervisordOutput:       "  Output: %s",
+	msgSupervisordStopped:      "✓ supervisord services stopped",
+	msgSupervisordKilling:      "⏳ Checking for and killing supervisord processes...",
+	msgSupervisordKillFailed:   "killing supervisord failed: %v, continuing",
+	msgSupervisordKilled:       "✓ All supervisord processes stopped",
+	msgSupervisordNoProcess:    "  No supervisord process found",
+	msgSupervisordAllKilled:    "  Killed all supervisord processes",
+	msgPkillFailed:             "pkill failed: %v",
+	msgPsFailed:                "ps failed: %v",
+
+	msgMirrorCDN:         "CDN",
+	msgMirrorServer:      "origin server",
+	msgTryMirror:         "   Trying %s...",
+	msgMirrorProbeOK:     "   Mirror %s latency %d ms",
+	msgMirrorProbeFailed: "   Mirror %s unavailable: %v",
+	msgMirrorRaceWinner:  "   %s responded first",
+	msgRetrying:          "   %v, retrying in %s (attempt %d/%d)",
+	msgMirrorFailed:      "   ✗ Download failed: %v",
+	msgChecksumFailed:    "   ✗ SHA256 verification failed: %v",
+	msgChecksumOK:        "   ✓ SHA256 verified",
+	msgChecksumMismatch:  "SHA256 mismatch (expected: %s, actual: %s)",
+	msgProgress:          "   Progress: %.1f%% (%d/%d MB)",
+	msgProgressDone:      "   Progress: 100.0%% (%d/%d MB)",
+	msgProgressLimited:   "   Progress: %.1f%% (%d/%d MB), limited to %s/s",
+	msgDownloadPaused:    "   ⏸ Download paused, waiting to resume...",
+	msgDownloadResumed:   "   ▶ Download resumed",
+	msgDownloadSize:      "   Downloaded: %d MB",
+	msgAllMirrorsFailed:  "all download sources failed: %v",
+	msgHTTPRequestFailed: "HTTP request failed: %v",
+	msgHTTPStatus:        "HTTP status: %d",
+	msgCreateFileFailed:  "cannot create file: %v",
+	msgWriteFileFailed:   "cannot write file: %v",
+	msgReadBodyFailed:    "cannot read response: %v",
+	msgCopyBodyFailed:    "download failed: %v",
+	msgOpenFileFailed:    "cannot open file: %v",
+	msgHashFailed:        "cannot compute hash: %v",
+	msgNetworkConfigWarn: "⚠ Invalid network or mirror configuration, using defaults: %v",
+
+	msgCacheConfigInvalid: "cannot parse %s: %v",
+	msgCacheKeepInvalid:   "invalid number of versions to keep: %d",
+	msgCacheIndexCorrupt:  "⚠ The cache index is corrupt and was ignored: %v",
+	msgCacheEntryCorrupt:  "⚠ Cached %s is corrupt, fetching it again: %v",
+	msgCacheIndexWarn:     "⚠ Writing the cache index failed: %v",
+	msgCacheRemoved:       "  Removed %s (%s)",
+	msgCachePruneDone:     "✓ Removed %d package(s), freed %.1f MB",
+	msgCacheEmpty:         "The cache is empty: %s",
+	msgCacheTotal:         "%d package(s), %.1f MB: %s",
+	msgCacheNotInstalled:  "no install record, cannot locate the package cache on the data disk",
+	msgUnknownAction:      "unknown action: %s",
+
+	msgSignatureKeyInvalid: "invalid signing public key",
+	msgSignatureInvalid:    "invalid signature file: %v",
+	msgSignatureMismatch:   "signature verification failed",
+	msgSignatureOK:         "   ✓ Signature verified",
+	msgSelfUpdateLocal:     "⏳ Using local file %s...",
+	msgSelfUpdateFetching:  "⏳ Downloading %s...",
+	msgSelfUpdateFetchFail: "downloading %s failed: %v",
+	msgSelfUpdateProbeFail: "the new installer does not run: %v",
+	msgSelfUpdateVersion:   "the new installer reports version %s, expected %s",
+	msgSelfUpdateReplace:   "replacing %s failed: %v",
+	msgSelfUpdateStillOld:  "installer was updated to %s but is still below the minimum version %s",
+	msgSelfUpdateAvailable: "⏳ installer %s is available (current %s)",
+	msgSelfUpdateReexec:    "✓ installer updated to %s, restarting",
+	msgSelfUpdateRequired:  "installer %s is below the minimum version %s and the automatic update failed: %v",
+	msgSelfUpdateWarn:      "⚠ Warning: updating the installer failed, continuing with the current version: %v",
+	msgSelfUpdateNoInfo:    "%s has no installer version information",
+	msgSelfUpdateCurrent:   "Current version: %s",
+	msgSelfUpdateLatest:    "Latest version: %s",
+	msgSelfUpdateMinimum:   "Minimum version: %s",
+	msgSelfUpdateUpToDate:  "✓ Already up to date",
+	msgSelfUpdateCheckHint: "⚠ A new version is available, run self-update to update",
+	msgSelfUpdateDone:      "✓ Updated %s to %s",
+	msgSelfUpdateNoKey:     "this installer was built without the release public key and cannot verify the new version's signature; add -allow-unsigned if you trust the source",
+	msgSelfUpdateUnsigned:  "⚠ No release public key, verifying SHA256 only",
+
+	msgBundleSignKeyInvalid:  "invalid signing private key %s: %v",
+	msgBundleSignKeyLength:   "invalid signing private key %s: length %d",
+	msgBundleNoArch:          "at least one architecture is required",
+	msgBundleFetching:        "⏳ Downloading %s...",
+	msgBundleFetchFailed:     "downloading %s failed: %v",
+	msgBundleNoInstallerSig:  "⚠ Warning: no signature for %s: %v",
+	msgBundlePullImage:       "⏳ Pulling image %s (%s)...",
+	msgBundleNotBundle:       "not an offline bundle, the first file should be %s",
+	msgBundleIndexInvalid:    "cannot parse %s: %v",
+	msgBundleFormat:          "unsupported offline bundle format %d",
+	msgBundleNoSignature:     "the offline bundle is not signed; add -allow-unsigned if you trust the source",
+	msgBundleUnlisted:        "the offline bundle contains an unlisted file %s",
+	msgBundleSizeMismatch:    "%s is %d bytes, bundle.json says %d",
+	msgBundleArchMissing:     "the offline bundle does not contain %s (it contains %s)",
+	msgBundleVersionMismatch: "version %s does not match %s in bundle.json",
+	msgBundleManifestOrder:   "the version file must come before the packages",
+	msgBundleNoManifest:      "the offline bundle has no version file",
+	msgBundleMissingKind:     "the offline bundle has no %s package",
+	msgBundleMissingFile:     "the offline bundle is missing %s",
+	msgBundleUsage:           "usage: bundle <create|verify> [options]",
+	msgBundleVerifyUsage:     "usage: bundle verify [-key public-key] <file>",
+	msgBundleVerified:        "✓ Version %s (%s), architectures %s, %d file(s) verified",
+	msgBundleVerifyUnsigned:  "⚠ Signature not verified",
+	msgBundleCreated:         "✓ Offline bundle: %s (version %s, architectures %s, %d file(s))",
+	msgBundleNoKey:           "no public key to verify the offline bundle signature; pass a key, or add -allow-unsigned if you trust the source",
+	msgBundleInstallerTooOld: "installer %s is below the minimum version %s required by the offline bundle; use %s from the bundle",
+
+	msgMirrorConfigParse:    "cannot parse %s: %v",
+	msgMirrorConfigError:    "%s: %v",
+	msgMirrorRetriesInvalid: "%s: invalid retry count %d",
+	msgMirrorPortInvalid:    "%s: invalid port %d",
+	msgMirrorURLInvalid:     "invalid mirror URL %q",
+	msgMirrorRetriesFlag:    "invalid retry count: %s",
+	msgMirrorNone:           "no download mirror available, check %s",
+	msgMirrorsNoArgs:        "mirrors takes no arguments: %s",
+	msgMirrorsEntry:         "%d. %-10s %s",
+	msgMirrorsSpeed:         "speed %.1f MB/s",
+	msgMirrorsCounts:        "%d succeeded, %d failed",
+	msgMirrorsLastError:     "last failure: %s",
+	msgMirrorsSeparator:     ", ",
+
+	msgUnknownCommand:        "unknown command: %s",
+	msgLowPriorityFailed:     "⚠ Lowering the process priority failed: %v",
+	msgUsageHeader:           "Usage: %s <command> [options]\n\nCommands:",
+	msgUsageLaunchDockerd:    "prepare the mount namespace and start supervisord/dockerd",
+	msgUsageInstall:          "install or upgrade Docker (default command)",
+	msgUsageHelp:             "show this help",
+	msgUsageService:          "manage supervisord service configuration (list/enable/disable/render)",
+	msgUsageConfig:           "show or edit daemon.json (show/get/set/add/remove/unset/delete)",
+	msgUsageNetwork:          "configure container forwarding and NAT (status/apply/teardown/watch)",
+	msgUsageMirrors:          "probe download mirrors and show their order and history",
+	msgUsageCgroup:           "detect and mount cgroups (status/plan/mount)",
+	msgUsageCache:            "list and prune the package cache (list/prune)",
+	msgUsageDoctor:           "check the Docker environment and service status",
+	msgUsageEnableAutostart:  "install the boot script (Magisk/KernelSU/service.d/init.d)",
+	msgUsageDisableAutostart: "remove the boot script",
+	msgUsageKernel:           "check kernel support for Docker features",
+	msgUsageBundle:           "create and verify offline bundles (create/verify)",
+	msgUsageAgent:            "run the local management service with a JSON API on a unix socket",
+	msgUsageSelfUpdate:       "update the installer itself",
+	msgUsageVersion:          "show the installer version",
+	msgUsageUpdate:           "check for and apply updates (status/check/apply/config/history)",
+	msgUsageSupportBundle:    "collect logs and system state for bug reports",
+
+	msgUpdateChannelInvalid:  "invalid channel: %q",
+	msgUpdateIntervalInvalid: "invalid check interval: %q",
+	msgTimezoneInvalid:       "invalid time zone: %q",
+	msgWindowInvalid:         "invalid maintenance window: %q (format 03:00-05:00)",
+	msgUpdateConfigParse:     "cannot parse %s: %v",
+	msgUpdateConfigError:     "%s: %v",
+	msgUpdateManifestFailed:  "cannot download %s: %v",
+	msgUpdateTickError:       "✗ %v",
+	msgUpdateCheckFailed:     "✗ Checking for updates failed: %v",
+	msgUpdateFound:           "Found version %s (current %s, channel %s)",
+	msgUpdateSkipFailed:      "⚠ An automatic upgrade to %s failed before, skipping",
+	msgUpdateAutoApply:       "⏳ Upgrading to %s within the maintenance window",
+	msgUpdateStartFailed:     "✗ Starting the upgrade failed: %v",
+	msgUpdateAvailable:       "✓ New version available: %s (current %s)",
+	msgUpdateUpToDate:        "✓ Already up to date: %s",
+	msgUpdateConfigUsage:     "usage: update config <check|auto_apply|channel|interval|window|timezone> <value>",
+	msgUpdateNeedBool:        "%s requires true or false",
+	msgUpdateUnknownSetting:  "unknown setting: %s",
+	msgUpdateConfigSet:       "✓ Set %s = %s",
+	msgUpgradeBackupFailed:   "backing up %s failed: %v",
+	msgUpgradeRestoreFailed:  "restoring %s failed: %v",
+	msgUpgradeBackingUp:      "⏳ Backing up the current installation...",
+	msgUpgradeInstalling:     "⏳ Installing the new version...",
+	msgUpgradeWaitDockerd:    "⏳ Waiting for dockerd to start...",
+	msgUpgradeDone:           "✓ Upgrade complete",
+	msgUpgradeRollingBack:    "✗ Upgrade failed: %v, rolling back",
+	msgUpgradeRollbackFailed: "%v; rollback failed: %v",
+	msgUpgradeRestartFailed:  "⚠ Restarting services after the rollback failed: %v",
+	msgUpgradeRolledBack:     "✓ Rolled back to the previous version",
+	msgUpgradeDockerdTimeout: "dockerd was not ready within %s: %s",
+	msgUpgradeHistoryFailed:  "⚠ Saving the upgrade history failed: %v",
+
+	msgCheckRoot:                 "root privileges",
+	msgCheckArch:                 "CPU architecture",
+	msgCheckKernel:               "kernel configuration",
+	msgCheckCgroup:               "cgroup controllers",
+	msgCheckDataDisk:             "data disk",
+	msgCheckInstall:              "install directory",
+	msgCheckSupervisord:          "supervisord",
+	msgCheckDockerd:              "dockerd",
+	msgCheckNAT:                  "docker0 forwarding and NAT",
+	msgCheckCA:                   "CA certificates",
+	msgCheckRegistry:             "registries",
+	msgCheckStorage:              "storage driver",
+	msgDoctorDetail:              "%v",
+	msgDoctorRootRemedy:          "switch to root with su and run again",
+	msgDoctorRootUID:             "current uid is %d",
+	msgDoctorRootOK:              "running as root",
+	msgDoctorArchRemedy:          "Docker for Android only supports arm64 and x86_64 devices",
+	msgDoctorFeatureItem:         "%s (%s)",
+	msgDoctorUnsupported:         "not supported: %s",
+	msgDoctorKernelRemedy:        "a kernel with these options enabled is required; contact the vendor or flash a kernel that supports Docker",
+	msgDoctorKernelOptional:      "these features are unavailable but everything else works; without overlay the vfs storage driver is used, which takes more space",
+	msgDoctorKernelUnknownRemedy: "the kernel lacks CONFIG_IKCONFIG_PROC so support cannot be confirmed; you can still try starting dockerd",
+	msgDoctorKernelUnknown:       "cannot confirm: %s",
+	msgDoctorKernelOK:            "%s, storage driver %s",
+	msgDoctorCgroupNoneRemedy:    "the kernel has no usable cgroup controllers, dockerd cannot start",
+	msgDoctorCgroupMode:          "cgroup mode: %s",
+	msgDoctorCgroupMissingRemedy: "run cgroup for details; resource limits of the missing controllers are unavailable",
+	msgDoctorCgroupMissing:       "%s layout, missing %s",
+	msgDoctorCgroupOK:            "%s layout, controllers: %s",
+	msgDoctorDiskNoRecordRemedy:  "run install again to record the data disk",
+	msgDoctorDiskNoRecord:        "no data disk record",
+	msgDoctorMountinfoFailed:     "reading mountinfo failed: %v",
+	msgDoctorDiskMissingRemedy:   "check the disk connection, replug it and wait for the system to mount it",
+	msgDoctorDiskMissing:         "%s is not mounted (it was %s at install time)",
+	msgDoctorFreeFailed:          "cannot get the free space of %s: %v",
+	msgDoctorDiskFSRemedy:        "format the data disk as ext4; other file systems may not support overlay2",
+	msgDoctorDiskFS:              "%s uses %s, %.2f GB free",
+	msgDoctorPruneRemedy:         "remove unused images and containers (docker system prune)",
+	msgDoctorDiskFull:            "%s has only %.2f GB free",
+	msgDoctorDiskLow:             "%s has %.2f GB free",
+	msgDoctorDiskOK:              "%s (%s, %s), %.2f GB free",
+	msgDoctorFileMissing:         "%s is missing",
+	msgDoctorFileNotExec:         "%s is not executable",
+	msgDoctorReinstallRemedy:     "run install again",
+	msgDoctorInstallOK:           "%s has %s installed (%s)",
+	msgDoctorSupervisordRemedy:   "run launch-dockerd to start the services, or reboot the device",
+	msgDoctorSupervisordDown:     "supervisord is not running: %v",
+	msgDoctorStoppedRemedy:       "check the logs in support-bundle, or run supervisord ctl start <service>",
+	msgDoctorStopped:             "services not running: %s",
+	msgDoctorServicesOK:          "%d service(s) running",
+	msgDoctorDockerdRemedy:       "check the errors in %s",
+	msgDoctorDockerdDown:         "dockerd is not responding: %s",
+	msgDoctorDockerdOK:           "Docker %s (API %s)",
+	msgDoctorConnectRemedy:       "connect to a network and check again",
+	msgDoctorNATRemedy:           "run network apply, or enable the network-watch service to repair it automatically",
+	msgDoctorNATMissing:          "containers cannot reach the internet, missing rules: %s",
+	msgDoctorNATOK:               "%s forwarded via %s",
+	msgDoctorCARemedy:            "download the installer again",
+	msgDoctorCALoadFailed:        "loading the built-in CA certificates failed",
+	msgDoctorClockRemedy:         "sync the system time and retry (Settings → Date & time → Set automatically)",
+	msgDoctorClockWrong:          "the system time %s is wrong, HTTPS certificate checks will fail",
+	msgDoctorCALoaded:            "built-in CA certificates loaded",
+	msgDoctorHijackRemedy:        "the network may be intercepting HTTPS; check the proxy settings or switch networks",
+	msgDoctorCertFailed:          "certificate verification for %s failed: %v",
+	msgDoctorNetworkRemedy:       "check the network connection",
+	msgDoctorConnectFailed:       "cannot connect to %s: %v",
+	msgDoctorCertOK:              "%s certificate verified",
+	msgDoctorOffline:             "offline mode, skipped",
+	msgDoctorRegistryRemedy:      "configure a working mirror in registry-mirrors of daemon.json",
+	msgDoctorRegistryFailed:      "no registry is reachable: %s",
+	msgDoctorRegistryPartial:     "reachable: %s; unreachable: %s",
+	msgDoctorRegistryOK:          "reachable: %s",
+	msgDoctorUnknownCheck:        "unknown check: %s",
+	msgDoctorUnknownOutput:       "unknown output format: %s (text/json)",
+	msgDoctorFailedCount:         "%d check(s) failed",
+	msgDoctorSummary:             "%d passed, %d warnings, %d failed",
+	msgDoctorStorageConfigRemedy: "run config show to check the configuration",
+	msgDoctorStorageUnsetRemedy:  "run install again to choose a storage driver",
+	msgDoctorStorageUnset:        "not set, dockerd chooses one automatically",
+	msgDoctorStorageVFSRemedy:    "format the data disk as ext4 and reinstall, or run docker system prune regularly",
+	msgDoctorStorageVFS:          "vfs in use, every container gets a full copy of its image",
+
+	msgNetworkRouteParse:     "parsing %s failed: %v",
+	msgNetworkNoUplink:       "no default route interface found",
+	msgNetworkRemoveFailed:   "⚠ Warning: removing the rules of %s failed: %v",
+	msgNetworkUplink:         "%s %-16s gateway: %-15s metric: %d",
+	msgNetworkApplied:        "✓ Configured forwarding and NAT for %s -> %s",
+	msgNetworkTornDown:       "✓ Container network rules removed",
+	msgNetworkWatchFailed:    "✗ Configuring the container network failed: %v",
+	msgNetworkWatchRecovered: "✓ Container network recovered",
+	msgNetworkWatchUplink:    "✓ Uplink: %s",
+	msgNetworkWatchSwitch:    "⇄ Uplink switched: %s -> %s",
+	msgNetworkWatchClosed:    "⚠ Route event channel closed, polling every %s",
+	msgNetlinkSocket:         "creating the netlink socket failed: %v",
+	msgNetlinkBind:           "binding the netlink socket failed: %v",
+	msgNetlinkTimeout:        "setting the netlink timeout failed: %v",
+	msgNetworkWatchPolling:   "⚠ %v, polling every %s",
+	msgNetworkWatchStart:     "Watching for uplink changes",
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// mirrorConfigPath 用户配置的下载源
+	mirrorConfigPath = dockerRoot + "/etc/mirrors.json"
+	// mirrorHealthPath 下载源的健康记录，跨多次运行保留
+	mirrorHealthPath = dockerRoot + "/etc/mirror-health.json"
+
+	// mirrorProbeTimeout 单个下载源的探测超时
+	mirrorProbeTimeout = 5 * time.Second
+	// raceBytes 竞速模式下先收到这么多数据的下载源胜出
+	raceBytes = 64 * 1024
+	// throughputMinSize 小于这个大小的下载不计入速度，version.txt 等小文件只反映延迟
+	throughputMinSize = 1 << 20
+	// failurePenalty 每次连续失败在排序时相当于增加的延迟
+	failurePenalty = 2 * time.Second
+)
+
+// DownloadOptions 下载源设置，命令行参数优先于配置文件
+type DownloadOptions struct {
+	// Mirrors 追加的下载源地址，逗号分隔，排在配置文件和内置下载源之前
+	Mirrors string
+	// Race 同时从排名前两位的下载源开始下载，先收到 raceBytes 的继续下载
+	Race bool
+	// NoProbe 不探测下载源，按配置顺序尝试
+	NoProbe bool
+	// Retries 每个下载源临时错误的重试次数，-1 表示使用配置文件的设置
+	Retries int
+	// LimitRate 限速，优先于配置文件中的限速
+	LimitRate string
+	// LowPriority 低优先级模式：按配置文件中的限速下载，并降低进程优先级
+	LowPriority bool
+	// Peers 在局域网中查找其他设备作为下载源，优先于配置文件的设置
+	Peers bool
+}
+
+// MirrorSpec 配置文件中的下载源
+type MirrorSpec struct {
+	// Name 显示名称，为空时使用主机名
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+}
+
+// MirrorConfig 下载源配置（/data/local/docker/etc/mirrors.json）
+type MirrorConfig struct {
+	Mirrors []MirrorSpec `json:"mirrors"`
+	// Builtin 是否保留内置的 CDN 和服务器
+	Builtin bool `json:"builtin"`
+	// Probe 下载前是否探测下载源并按速度排序
+	Probe bool `json:"probe"`
+	// Race 是否同时从前两个下载源开始下载
+	Race bool `json:"race"`
+	// Retries 每个下载源临时错误的重试次数
+	Retries int `json:"retries"`
+	// RateLimit 低优先级下载（后台自动升级）的限速，如 512K，为空表示不限速
+	RateLimit string `json:"rate_limit,omitempty"`
+	// RateSchedule 按时间段的限速，优先于 RateLimit，如晚上看视频时限速更低
+	RateSchedule []RateWindow `json:"rate_schedule,omitempty"`
+	// Timezone RateSchedule 的时区，如 Asia/Shanghai，只在 TZ 和 persist.sys.timezone 都没有时使用
+	Timezone string `json:"timezone,omitempty"`
+	// Peers 局域网中设备之间共享安装包
+	Peers PeerConfig `json:"peers"`
+}
+
+// defaultMirrorConfig 默认使用内置下载源并探测排序
+func defaultMirrorConfig() *MirrorConfig {
+	return &MirrorConfig{Builtin: true, Probe: true, Retries: defaultRetryPolicy.Attempts - 1, Peers: PeerConfig{Port: defaultPeerPort}}
+}
+
+// loadMirrorConfig 读取下载源配置，文件不存在时返回默认值
+func loadMirrorConfig(path string) (*MirrorConfig, error) {
+	config := defaultMirrorConfig()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, errorf(msgMirrorConfigParse, path, err)
+	}
+	if config.Retries < 0 {
+		return nil, errorf(msgMirrorRetriesInvalid, path, config.Retries)
+	}
+	if _, err := newRateSchedule(config.RateLimit, config.RateSchedule, config.Timezone); err != nil {
+		return nil, errorf(msgMirrorConfigError, path, err)
+	}
+	if config.Peers.Port <= 0 || config.Peers.Port > 65535 {
+		return nil, errorf(msgMirrorPortInvalid, path, config.Peers.Port)
+	}
+	for _, spec := range config.Mirrors {
+		if _, err := newMirror(spec.Name, spec.URL); err != nil {
+			return nil, errorf(msgMirrorConfigError, path, err)
+		}
+	}
+	return config, nil
+}
+
+// newMirror 根据地址创建下载源，名称为空时使用主机名
+func newMirror(name, rawURL string) (downloadMirror, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return downloadMirror{}, errorf(msgMirrorURLInvalid, rawURL)
+	}
+	if name == "" {
+		name = u.Host
+	}
+	return downloadMirror{Name: name, BaseURL: strings.TrimRight(u.String(), "/")}, nil
+}
+
+// mergeMirrors 合并下载源，地址相同的只保留第一个
+func mergeMirrors(lists ...[]downloadMirror) []downloadMirror {
+	seen := map[string]bool{}
+	var merged []downloadMirror
+	for _, list := range lists {
+		for _, m := range list {
+			if !seen[m.BaseURL] {
+				seen[m.BaseURL] = true
+				merged = append(merged, m)
+			}
+		}
+	}
+	return merged
+}
+
+// extractDownloadFlags 从参数中取出 --mirror、--mirror-race、--no-mirror-probe、--retries、--limit-rate、--low-priority 和 --peers，
+// 访问网络的子命令都支持
+func extractDownloadFlags(args []string) (DownloadOptions, []string, error) {
+	opts := DownloadOptions{Retries: -1}
+	var retries string
+	values := map[string]*string{"mirror": &opts.Mirrors, "retries": &retries, "limit-rate": &opts.LimitRate}
+	repeat := map[string]bool{"mirror": true}
+	switches := map[string]*bool{"mirror-race": &opts.Race, "no-mirror-probe": &opts.NoProbe, "low-priority": &opts.LowPriority, "peers": &opts.Peers}
+	rest, err := extractFlags(args, values, repeat, switches)
+	if err != nil {
+		return opts, nil, err
+	}
+	if retries != "" {
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			return opts, nil, errorf(msgMirrorRetriesFlag, retries)
+		}
+		opts.Retries = n
+	}
+	if _, err := parseRate(opts.LimitRate); err != nil {
+		return opts, nil, err
+	}
+	return opts, rest, nil
+}
+
+var (
+	// mirrorProbe 下载前探测下载源并按速度排序，由 configureDownload 设置
+	mirrorProbe bool
+	// mirrorRace 同时从前两个下载源开始下载，由 configureDownload 设置
+	mirrorRace bool
+	// mirrorHealthFile 保存健康记录的文件，为空时只在内存中记录
+	mirrorHealthFile string
+	// mirrorStats 下载源的健康记录
+	mirrorStats = newMirrorHealthStore()
+)
+
+// configureDownload 合并参数、配置文件和内置的下载源，设置探测、竞速、重试和限速
+// 配置文件中的限速只用于低优先级下载，前台安装时用户在等待，只有 --limit-rate 才限速
+func configureDownload(flagOpts DownloadOptions, configPath, healthPath string) error {
+	config, err := loadMirrorConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	var flagMirrors, configMirrors, builtin []downloadMirror
+	for _, raw := range strings.Split(flagOpts.Mirrors, ",") {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		m, err := newMirror("", raw)
+		if err != nil {
+			return err
+		}
+		flagMirrors = append(flagMirrors, m)
+	}
+	for _, spec := range config.Mirrors {
+		m, _ := newMirror(spec.Name, spec.URL)
+		configMirrors = append(configMirrors, m)
+	}
+	if config.Builtin {
+		builtin = downloadMirrors
+	}
+	mirrors := mergeMirrors(flagMirrors, configMirrors, builtin)
+	if len(mirrors) == 0 {
+		return errorf(msgMirrorNone, configPath)
+	}
+
+	stats := newMirrorHealthStore()
+	if healthPath != "" {
+		// 记录损坏时重新开始，不影响下载
+		stats.load(healthPath)
+	}
+
+	retries := config.Retries
+	if flagOpts.Retries >= 0 {
+		retries = flagOpts.Retries
+	}
+	schedule := &rateSchedule{}
+	switch {
+	case flagOpts.LimitRate != "":
+		schedule.base, _ = parseRate(flagOpts.LimitRate)
+	case flagOpts.LowPriority:
+		schedule, _ = newRateSchedule(config.RateLimit, config.RateSchedule, config.Timezone)
+	}
+
+	downloadMirrors = mirrors
+	retryPolicy.Attempts = retries + 1
+	mirrorProbe = config.Probe && !flagOpts.NoProbe
+	mirrorRace = config.Race || flagOpts.Race
+	mirrorStats, mirrorHealthFile = stats, healthPath
+	currentThrottle = newThrottle(schedule, downloadPausedPath)
+	peerDiscover, peerPort = config.Peers.Discover || flagOpts.Peers, config.Peers.Port
+	return nil
+}
+
+// addManifestMirrors 追加版本文件中发布的下载源，排在已有的下载源之后
+// 版本文件由发布流程生成，格式不对的地址直接跳过
+func addManifestMirrors(urls []string) {
+	var extra []downloadMirror
+	for _, raw := range urls {
+		if m, err := newMirror("", raw); err == nil {
+			extra = append(extra, m)
+		}
+	}
+	downloadMirrors = mergeMirrors(downloadMirrors, extra)
+}
+
+// mirrorHealth 一个下载源的历史记录
+type mirrorHealth struct {
+	// LatencyMS 最近一次探测的延迟
+	LatencyMS int64 `json:"latency_ms,omitempty"`
+	// Throughput 下载速度（字节/秒），指数加权平均
+	Throughput float64 `json:"throughput,omitempty"`
+	Successes  int     `json:"successes"`
+	Failures   int     `json:"failures"`
+	// ConsecutiveFailures 连续失败次数，成功后清零
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastFailure         time.Time `json:"last_failure,omitempty"`
+}
+
+// mirrorHealthStore 按下载源地址保存的健康记录
+type mirrorHealthStore struct {
+	mu      sync.Mutex
+	records map[string]*mirrorHealth
+}
+
+func newMirrorHealthStore() *mirrorHealthStore {
+	return &mirrorHealthStore{records: map[string]*mirrorHealth{}}
+}
+
+// load 读取健康记录
+func (s *mirrorHealthStore) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	records := map[string]*mirrorHealth{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.records = records
+	s.mu.Unlock()
+	return nil
+}
+
+// save 写入健康记录，目录不存在（还没有安装）时不创建
+func (s *mirrorHealthStore) save(path string) error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// get 返回记录的副本，没有记录时返回零值
+func (s *mirrorHealthStore) get(baseURL string) mirrorHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h := s.records[baseURL]; h != nil {
+		return *h
+	}
+	return mirrorHealth{}
+}
+
+// update 修改一个下载源的记录
+func (s *mirrorHealthStore) update(baseURL string, fn func(h *mirrorHealth)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.records[baseURL]
+	if h == nil {
+		h = &mirrorHealth{}
+		s.records[baseURL] = h
+	}
+	fn(h)
+}
+
+// recordDownload 记录一次下载的结果，size 为下载的字节数
+func recordDownload(m downloadMirror, err error, size int64, elapsed time.Duration, now time.Time) {
+	// 局域网中的设备每次安装时重新发现，不保存记录
+	if m.Peer {
+		return
+	}
+	mirrorStats.update(m.BaseURL, func(h *mirrorHealth) {
+		if err != nil {
+			h.Failures++
+			h.ConsecutiveFailures++
+			h.LastError = err.Error()
+			h.LastFailure = now
+			return
+		}
+		h.Successes++
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = now
+		if size >= throughputMinSize && elapsed > 0 {
+			speed := float64(size) / elapsed.Seconds()
+			if h.Throughput == 0 {
+				h.Throughput = speed
+			} else {
+				h.Throughput = 0.7*h.Throughput + 0.3*speed
+			}
+		}
+	})
+	if mirrorHealthFile != "" {
+		mirrorStats.save(mirrorHealthFile)
+	}
+}
+
+// mirrorProbeResult 一次 HEAD 探测的结果
+type mirrorProbeResult struct {
+	Latency time.Duration
+	Err     error
+}
+
+var (
+	probeMu sync.Mutex
+	// probeCache 本次运行中已探测的下载源，同一次安装的多个文件只探测一次
+	probeCache = map[string]mirrorProbeResult{}
+)
+
+// probeMirror 用 HEAD 请求 filename，测量收到响应头的时间
+// 部分服务器不支持 HEAD，返回 405 也算可用
+func probeMirror(client *http.Client, m downloadMirror, filename string) mirrorProbeResult {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", m.BaseURL+"/"+filename, nil)
+	if err != nil {
+		return mirrorProbeResult{Err: err}
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return mirrorProbeResult{Err: err}
+	}
+	resp.Body.Close()
+	latency := time.Since(start)
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusMethodNotAllowed {
+		return mirrorProbeResult{Latency: latency, Err: newHTTPStatusError(resp, time.Now())}
+	}
+	return mirrorProbeResult{Latency: latency}
+}
+
+// probeMirrors 并发探测还没有探测过的下载源
+func probeMirrors(client *http.Client, mirrors []downloadMirror, filename string) []mirrorProbeResult {
+	results := make([]mirrorProbeResult, len(mirrors))
+	var wg sync.WaitGroup
+	for i, m := range mirrors {
+		probeMu.Lock()
+		cached, ok := probeCache[m.BaseURL]
+		probeMu.Unlock()
+		if ok {
+			results[i] = cached
+			continue
+		}
+		wg.Add(1)
+		go func(i int, m downloadMirror) {
+			defer wg.Done()
+			results[i] = probeMirror(client, m, filename)
+		}(i, m)
+	}
+	wg.Wait()
+
+	for i, m := range mirrors {
+		r := results[i]
+		probeMu.Lock()
+		_, cached := probeCache[m.BaseURL]
+		probeCache[m.BaseURL] = r
+		probeMu.Unlock()
+		if cached {
+			continue
+		}
+		ev := Event{Type: eventMirrorProbed, Mirror: m.Name, URL: m.BaseURL, OK: boolPtr(r.Err == nil), Duration: r.Latency.Milliseconds()}
+		if r.Err != nil {
+			ev.Message = r.Err.Error()
+			fmt.Println(T(msgMirrorProbeFailed, m.label(), r.Err))
+		} else {
+			fmt.Println(T(msgMirrorProbeOK, m.label(), r.Latency.Milliseconds()))
+			mirrorStats.update(m.BaseURL, func(h *mirrorHealth) { h.LatencyMS = r.Latency.Milliseconds() })
+		}
+		emit(ev)
+	}
+	return results
+}
+
+// mirrorScore 估计从下载源获取 1 MiB 所需的时间，越小越好
+// 由探测延迟、历史下载速度和连续失败次数组成，没有速度记录时只看延迟
+func mirrorScore(probe mirrorProbeResult, h mirrorHealth) time.Duration {
+	score := probe.Latency + time.Duration(h.ConsecutiveFailures)*failurePenalty
+	if h.Throughput > 0 {
+		score += time.Duration(float64(time.Second) * (1 << 20) / h.Throughput)
+	}
+	return score
+}
+
+// rankMirrors 按探测结果和健康记录排序，探测失败的排在最后并保持原顺序
+func rankMirrors(mirrors []downloadMirror, probes []mirrorProbeResult, stats *mirrorHealthStore) []downloadMirror {
+	type ranked struct {
+		mirror downloadMirror
+		failed bool
+		score  time.Duration
+	}
+	list := make([]ranked, len(mirrors))
+	for i, m := range mirrors {
+		list[i] = ranked{mirror: m, failed: probes[i].Err != nil, score: mirrorScore(probes[i], stats.get(m.BaseURL))}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].failed != list[j].failed {
+			return !list[i].failed
+		}
+		if list[i].failed {
+			return false
+		}
+		return list[i].score < list[j].score
+	})
+	result := make([]downloadMirror, len(list))
+	for i, r := range list {
+		result[i] = r.mirror
+	}
+	return result
+}
+
+// orderMirrors 返回下载 filename 时尝试下载源的顺序
+// 局域网中的设备排在最前且不参与排序，只用于设备响应中列出的文件，withPeers 为 false（没有 SHA256 校验内容）时不使用
+func orderMirrors(client *http.Client, filename string, withPeers bool) []downloadMirror {
+	var peers, mirrors []downloadMirror
+	for _, m := range downloadMirrors {
+		if !m.Peer {
+			mirrors = append(mirrors, m)
+		} else if withPeers && m.hasFile(filename) {
+			peers = append(peers, m)
+		}
+	}
+	if mirrorProbe && len(mirrors) > 1 {
+		mirrors = rankMirrors(mirrors, probeMirrors(client, mirrors, filename), mirrorStats)
+	}
+	return append(peers, mirrors...)
+}
+
+// raceResult 竞速中一个下载源的结果
+type raceResult struct {
+	index int
+	resp  *http.Response
+	// prefix 竞速期间已读取的数据
+	prefix []byte
+	cancel context.CancelFunc
+	err    error
+}
+
+// close 结束请求
+func (r *raceResult) close() {
+	if r.resp != nil {
+		r.resp.Body.Close()
+	}
+	r.cancel()
+}
+
+// raceMirrors 同时从多个下载源请求 filename，先收到 raceBytes（或完整文件）的胜出
+// 返回胜出者和在它之前失败的下载源，其余请求被取消；全部失败时 winner 为 nil
+func raceMirrors(client *http.Client, mirrors []downloadMirror, filename string) (winner *raceResult, failed []*raceResult) {
+	results := make(chan *raceResult, len(mirrors))
+	cancels := make([]context.CancelFunc, len(mirrors))
+	for i, m := range mirrors {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		go func(r *raceResult, url string) {
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+			if err == nil {
+				r.resp, err = client.Do(req)
+			}
+			if err != nil {
+				r.resp, r.err = nil, errorf(msgHTTPRequestFailed, err)
+				results <- r
+				return
+			}
+			if r.resp.StatusCode != http.StatusOK {
+				r.err = newHTTPStatusError(r.resp, time.Now())
+				results <- r
+				return
+			}
+			buf := make([]byte, raceBytes)
+			n, err := io.ReadFull(r.resp.Body, buf)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				r.err = errorf(msgReadBodyFailed, err)
+			}
+			r.prefix = buf[:n]
+			results <- r
+		}(&raceResult{index: i, cancel: cancel}, m.BaseURL+"/"+filename)
+	}
+
+	for received := 0; received < len(mirrors); received++ {
+		r := <-results
+		if r.err != nil {
+			r.close()
+			failed = append(failed, r)
+			continue
+		}
+		winner = r
+		// 取消落选的请求，剩下的结果在后台关闭
+		for i, cancel := range cancels {
+			if i != r.index {
+				cancel()
+			}
+		}
+		go func(remaining int) {
+			for ; remaining > 0; remaining-- {
+				(<-results).close()
+			}
+		}(len(mirrors) - received - 1)
+		break
+	}
+	return winner, failed
+}
+
+// mirrorFailure 一个下载源的失败原因
+type mirrorFailure struct {
+	Mirror string
+	Err    error
+}
+
+// mirrorErrors 所有下载源的失败原因，按尝试顺序排列
+type mirrorErrors []mirrorFailure
+
+func (e mirrorErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, f := range e {
+		parts[i] = fmt.Sprintf("%s: %v", f.Mirror, f.Err)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap 使 errors.As 能找到各下载源的原始错误
+func (e mirrorErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, f := range e {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:    "mirrors",
+		usage:   msgUsageMirrors,
+		network: networkRequired,
+		run:     runMirrors,
+	})
+}
+
+// runMirrors 探测所有下载源，按下载时的顺序显示
+func runMirrors(args []string) error {
+	if len(args) > 0 {
+		return errorf(msgMirrorsNoArgs, strings.Join(args, " "))
+	}
+	client := CreateHTTPClient()
+	mirrors := append([]downloadMirror(nil), downloadMirrors...)
+	probes := probeMirrors(client, mirrors, manifestName(defaultChannel))
+	fmt.Println()
+	for i, m := range rankMirrors(mirrors, probes, mirrorStats) {
+		h := mirrorStats.get(m.BaseURL)
+		fmt.Println(T(msgMirrorsEntry, i+1, m.label(), m.BaseURL))
+		var parts []string
+		if h.Throughput > 0 {
+			parts = append(parts, T(msgMirrorsSpeed, h.Throughput/(1<<20)))
+		}
+		parts = append(parts, T(msgMirrorsCounts, h.Successes, h.Failures))
+		if h.ConsecutiveFailures > 0 {
+			parts = append(parts, T(msgMirrorsLastError, h.LastError))
+		}
+		fmt.Println("   " + strings.Join(parts, T(msgMirrorsSeparator)))
+	}
+	return nil
+}
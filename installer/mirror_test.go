@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useMirrorMode 在测试期间设置探测和竞速模式，并清空探测缓存和健康记录
+func useMirrorMode(t *testing.T, probe, race bool) {
+	useRetryPolicy(t, RetryPolicy{Attempts: 1})
+	savedProbe, savedRace, savedStats, savedFile := mirrorProbe, mirrorRace, mirrorStats, mirrorHealthFile
+	savedThrottle, savedPeerDiscover, savedPeerPort := currentThrottle, peerDiscover, peerPort
+	probeMu.Lock()
+	savedCache := probeCache
+	probeCache = map[string]mirrorProbeResult{}
+	probeMu.Unlock()
+	mirrorProbe, mirrorRace, mirrorStats, mirrorHealthFile = probe, race, newMirrorHealthStore(), ""
+	t.Cleanup(func() {
+		mirrorProbe, mirrorRace, mirrorStats, mirrorHealthFile = savedProbe, savedRace, savedStats, savedFile
+		currentThrottle, peerDiscover, peerPort = savedThrottle, savedPeerDiscover, savedPeerPort
+		probeMu.Lock()
+		probeCache = savedCache
+		probeMu.Unlock()
+	})
+}
+
+// mirrorServer 返回 content 的测试服务器，delay 为响应前的等待时间
+func mirrorServer(t *testing.T, content []byte, delay time.Duration) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write(content)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// triedMirrors 返回 mirror_tried 事件中的下载源和结果
+func triedMirrors(events []Event) []string {
+	var tried []string
+	for _, ev := range events {
+		if ev.Type == eventMirrorTried {
+			result := "ok"
+			if !*ev.OK {
+				result = "failed"
+			}
+			tried = append(tried, ev.Mirror+":"+result)
+		}
+	}
+	return tried
+}
+
+// TestConfigureDownload 测试参数、配置文件和内置下载源的合并
+func TestConfigureDownload(t *testing.T) {
+	useMirrorMode(t, false, false)
+	useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: "https://cdn.example.com/dfa"})
+	dir := t.TempDir()
+	config := filepath.Join(dir, "mirrors.json")
+	os.WriteFile(config, []byte(`{"mirrors": [{"name": "lan", "url": "http://192.168.1.10/dfa/"}, {"url": "https://cdn.example.com/dfa"}], "race": true}`), 0644)
+
+	opts := DownloadOptions{Mirrors: "https://m1.example.com/dfa,http://192.168.1.10/dfa", NoProbe: true, Retries: 5}
+	if err := configureDownload(opts, config, filepath.Join(dir, "health.json")); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range downloadMirrors {
+		got = append(got, m.Name+"="+m.BaseURL)
+	}
+	want := "m1.example.com=https://m1.example.com/dfa 192.168.1.10=http://192.168.1.10/dfa cdn.example.com=https://cdn.example.com/dfa"
+	if strings.Join(got, " ") != want {
+		t.Errorf("mirrors = %v", got)
+	}
+	if mirrorProbe || !mirrorRace || retryPolicy.Attempts != 6 {
+		t.Errorf("probe = %v, race = %v, attempts = %d", mirrorProbe, mirrorRace, retryPolicy.Attempts)
+	}
+
+	// 不保留内置下载源且没有其他下载源
+	os.WriteFile(config, []byte(`{"builtin": false}`), 0644)
+	if err := configureDownload(DownloadOptions{}, config, ""); err == nil {
+		t.Error("expected error for empty mirror list")
+	}
+	os.WriteFile(config, []byte(`{"mirrors": [{"url": "ftp://example.com"}]}`), 0644)
+	if err := configureDownload(DownloadOptions{}, config, ""); err == nil {
+		t.Error("expected error for invalid mirror url")
+	}
+	if err := configureDownload(DownloadOptions{Mirrors: "example.com"}, filepath.Join(dir, "missing.json"), ""); err == nil {
+		t.Error("expected error for mirror without scheme")
+	}
+}
+
+// TestAddManifestMirrors 测试版本文件中的下载源
+func TestAddManifestMirrors(t *testing.T) {
+	useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: "https://cdn.example.com/dfa"})
+	info, err := parseVersionInfo([]byte("VERSION=1\nDOCKER_SHA256=a\nBIN_ARM64_SHA256=b\nMIRRORS=https://m2.example.com/dfa, ,https://cdn.example.com/dfa,bad\n"), "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addManifestMirrors(info.Mirrors)
+	if len(downloadMirrors) != 2 || downloadMirrors[1].BaseURL != "https://m2.example.com/dfa" {
+		t.Errorf("mirrors = %+v", downloadMirrors)
+	}
+}
+
+// TestRankMirrors 测试按延迟、速度和失败次数排序
+func TestRankMirrors(t *testing.T) {
+	mirrors := []downloadMirror{{Name: "a", BaseURL: "a"}, {Name: "b", BaseURL: "b"}, {Name: "c", BaseURL: "c"}, {Name: "d", BaseURL: "d"}}
+	probes := []mirrorProbeResult{
+		{Latency: 100 * time.Millisecond},
+		{Latency: 20 * time.Millisecond},
+		{Err: errors.New("timeout")},
+		{Latency: 50 * time.Millisecond},
+	}
+	stats := newMirrorHealthStore()
+	name := func(list []downloadMirror) string {
+		var names []string
+		for _, m := range list {
+			names = append(names, m.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	if got := name(rankMirrors(mirrors, probes, stats)); got != "b,d,a,c" {
+		t.Errorf("按延迟排序 = %s", got)
+	}
+
+	// b 最近连续失败，d 的历史速度很慢（1 MiB 需要 1 秒）
+	stats.update("b", func(h *mirrorHealth) { h.ConsecutiveFailures = 1 })
+	stats.update("d", func(h *mirrorHealth) { h.Throughput = 1 << 20 })
+	stats.update("a", func(h *mirrorHealth) { h.Throughput = 100 << 20 })
+	if got := name(rankMirrors(mirrors, probes, stats)); got != "a,d,b,c" {
+		t.Errorf("按健康记录排序 = %s", got)
+	}
+}
+
+// TestDownloadFileProbe 测试探测后先从响应快的下载源下载
+func TestDownloadFileProbe(t *testing.T) {
+	useMirrorMode(t, true, false)
+	content := []byte("docker package")
+	slow := mirrorServer(t, content, 300*time.Millisecond)
+	fast := mirrorServer(t, content, 0)
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+	useTestMirrors(t,
+		downloadMirror{Name: "down", BaseURL: down.URL},
+		downloadMirror{Name: "slow", BaseURL: slow.URL},
+		downloadMirror{Name: "fast", BaseURL: fast.URL})
+	events := captureEvents(t)
+
+	dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+	if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", ""); err != nil {
+		t.Fatal(err)
+	}
+	got := events()
+	if tried := triedMirrors(got); strings.Join(tried, " ") != "fast:ok" {
+		t.Errorf("tried = %v", tried)
+	}
+	probed := 0
+	for _, ev := range got {
+		if ev.Type == eventMirrorProbed {
+			probed++
+			if ev.Mirror == "down" && *ev.OK {
+				t.Errorf("down 应探测失败: %+v", ev)
+			}
+		}
+	}
+	if probed != 3 {
+		t.Errorf("probed = %d", probed)
+	}
+
+	// 第二个文件使用缓存的探测结果
+	events = captureEvents(t)
+	if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range events() {
+		if ev.Type == eventMirrorProbed {
+			t.Errorf("不应重复探测: %+v", ev)
+		}
+	}
+	if h := mirrorStats.get(fast.URL); h.Successes != 2 || h.LatencyMS < 0 {
+		t.Errorf("fast 健康记录 = %+v", h)
+	}
+}
+
+// TestDownloadFileRace 测试竞速模式
+func TestDownloadFileRace(t *testing.T) {
+	content := bytes.Repeat([]byte("docker"), raceBytes/3)
+	slow := mirrorServer(t, content, 500*time.Millisecond)
+	fast := mirrorServer(t, content, 0)
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+
+	t.Run("快的胜出", func(t *testing.T) {
+		useMirrorMode(t, false, true)
+		useTestMirrors(t, downloadMirror{Name: "slow", BaseURL: slow.URL}, downloadMirror{Name: "fast", BaseURL: fast.URL})
+		events := captureEvents(t)
+
+		dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+		start := time.Now()
+		if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", ""); err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(start) > 400*time.Millisecond {
+			t.Errorf("应不等待慢的下载源，耗时 %v", time.Since(start))
+		}
+		if data, _ := os.ReadFile(dest); !bytes.Equal(data, content) {
+			t.Errorf("内容不一致，大小 %d", len(data))
+		}
+		if tried := triedMirrors(events()); strings.Join(tried, " ") != "fast:ok" {
+			t.Errorf("tried = %v", tried)
+		}
+	})
+
+	t.Run("竞速中失败", func(t *testing.T) {
+		useMirrorMode(t, false, true)
+		useTestMirrors(t, downloadMirror{Name: "down", BaseURL: down.URL}, downloadMirror{Name: "slow", BaseURL: slow.URL})
+		events := captureEvents(t)
+
+		dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+		if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", ""); err != nil {
+			t.Fatal(err)
+		}
+		if tried := triedMirrors(events()); strings.Join(tried, " ") != "down:failed slow:ok" {
+			t.Errorf("tried = %v", tried)
+		}
+		if h := mirrorStats.get(down.URL); h.ConsecutiveFailures != 1 || h.LastError == "" {
+			t.Errorf("down 健康记录 = %+v", h)
+		}
+	})
+}
+
+// TestDownloadFileFailureReasons 测试最终错误包含每个下载源的失败原因
+func TestDownloadFileFailureReasons(t *testing.T) {
+	useMirrorMode(t, false, false)
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	corrupt := mirrorServer(t, []byte("corrupt"), 0)
+	useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: notFound.URL}, downloadMirror{Name: "server", BaseURL: corrupt.URL})
+
+	dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+	err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", "deadbeef")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if messageKey(err) != msgAllMirrorsFailed {
+		t.Errorf("消息键 = %s", messageKey(err))
+	}
+	var failures mirrorErrors
+	if !errors.As(err, &failures) || len(failures) != 2 || failures[0].Mirror != "cdn" || failures[1].Mirror != "server" {
+		t.Fatalf("failures = %v", failures)
+	}
+	if !strings.Contains(err.Error(), "cdn: ") || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "server: ") {
+		t.Errorf("错误信息应包含每个下载源的原因: %v", err)
+	}
+	var mismatch *checksumMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Error("errors.As 应找到 checksumMismatchError")
+	}
+}
+
+// TestMirrorHealthPersist 测试健康记录的保存和下载速度
+func TestMirrorHealthPersist(t *testing.T) {
+	useMirrorMode(t, false, false)
+	path := filepath.Join(t.TempDir(), "mirror-health.json")
+	mirrorHealthFile = path
+	m := downloadMirror{Name: "cdn", BaseURL: "https://cdn.example.com"}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	recordDownload(m, errors.New("timeout"), 0, time.Second, now)
+	recordDownload(m, nil, 4<<20, 2*time.Second, now)
+	recordDownload(m, nil, 100, time.Millisecond, now)
+
+	stats := newMirrorHealthStore()
+	if err := stats.load(path); err != nil {
+		t.Fatal(err)
+	}
+	h := stats.get(m.BaseURL)
+	if h.Successes != 2 || h.Failures != 1 || h.ConsecutiveFailures != 0 || h.LastError != "timeout" || !h.LastSuccess.Equal(now) {
+		t.Errorf("health = %+v", h)
+	}
+	// 小文件不计入速度
+	if h.Throughput != 2<<20 {
+		t.Errorf("throughput = %v", h.Throughput)
+	}
+
+	// 目录不存在时不保存
+	mirrorHealthFile = filepath.Join(t.TempDir(), "missing", "mirror-health.json")
+	recordDownload(m, nil, 0, 0, now)
+	if _, err := os.Stat(filepath.Dir(mirrorHealthFile)); !os.IsNotExist(err) {
+		t.Error("不应创建目录")
+	}
+}
+
+// TestExtractDownloadFlags 测试从参数中取出下载源参数
+func TestExtractDownloadFlags(t *testing.T) {
+	args := []string{"install", "--mirror", "https://a", "-mirror=https://b", "--mirror-race", "--no-mirror-probe", "-channel", "beta", "--limit-rate", "1M", "--low-priority", "--peers"}
+	opts, rest, err := extractDownloadFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DownloadOptions{Mirrors: "https://a,https://b", Race: true, NoProbe: true, Retries: -1, LimitRate: "1M", LowPriority: true, Peers: true}
+	if opts != want {
+		t.Errorf("opts = %+v", opts)
+	}
+	if strings.Join(rest, " ") != "install -channel beta" {
+		t.Errorf("rest = %v", rest)
+	}
+
+	if opts, _, err := extractDownloadFlags([]string{"--retries", "0"}); err != nil || opts.Retries != 0 {
+		t.Errorf("retries = %d, err = %v", opts.Retries, err)
+	}
+	if _, _, err := extractDownloadFlags([]string{"--retries=-1"}); err == nil {
+		t.Error("expected error for negative retries")
+	}
+	if _, _, err := extractDownloadFlags([]string{"--limit-rate", "fast"}); err == nil {
+		t.Error("expected error for invalid rate")
+	}
+}
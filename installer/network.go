@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// dockerBridge Docker 默认网桥
+	dockerBridge = "docker0"
+
+	// procNetRoute 内核主路由表
+	procNetRoute = "/proc/net/route"
+
+	// ipRuleMainPrio 让容器网段走 main 表的策略路由优先级
+	ipRuleMainPrio = "20500"
+	// ipRuleForwardPrio ndc ipfwd 添加的转发规则优先级
+	ipRuleForwardPrio = "21000"
+)
+
+// uplinkSkipPrefixes 不作为上行接口的网卡前缀
+var uplinkSkipPrefixes = []string{"lo", "docker", "veth", "br-", "dummy"}
+
+// CommandRunner 执行系统命令，测试时可替换为假实现
+type CommandRunner interface {
+	Run(name string, args ...string) (string, error)
+}
+
+// execRunner 通过 os/exec 执行命令
+type execRunner struct{}
+
+func (execRunner) Run(name string, args ...string) (string, error) {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// Uplink 默认路由所在的上行接口
+type Uplink struct {
+	Interface string
+	Gateway   string
+	Metric    int
+}
+
+// parseProcNetRoute 解析 /proc/net/route 中的默认路由
+func parseProcNetRoute(r io.Reader) ([]Uplink, error) {
+	var uplinks []Uplink
+	scanner := bufio.NewScanner(r)
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		// 只关心目标和掩码都为 0 且处于 UP 状态的默认路由
+		if fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&0x1 == 0 {
+			continue
+		}
+		metric, _ := strconv.Atoi(fields[6])
+		uplinks = append(uplinks, Uplink{
+			Interface: fields[0],
+			Gateway:   parseHexIPv4(fields[2]),
+			Metric:    metric,
+		})
+	}
+	return uplinks, scanner.Err()
+}
+
+// parseHexIPv4 将 /proc/net/route 中小端序的十六进制地址转换为点分格式
+func parseHexIPv4(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return ""
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+	if ip.Equal(net.IPv4zero) {
+		return ""
+	}
+	return ip.String()
+}
+
+// parseIPRouteDefaults 解析 `ip -4 route show table all` 中的默认路由
+// Android 的默认路由位于以接口命名的策略路由表中，/proc/net/route 看不到
+func parseIPRouteDefaults(output string) []Uplink {
+	var uplinks []Uplink
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "default" {
+			continue
+		}
+		uplink := Uplink{}
+		for i := 1; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "via":
+				uplink.Gateway = fields[i+1]
+			case "dev":
+				uplink.Interface = fields[i+1]
+			case "metric":
+				uplink.Metric, _ = strconv.Atoi(fields[i+1])
+			}
+		}
+		if uplink.Interface != "" {
+			uplinks = append(uplinks, uplink)
+		}
+	}
+	return uplinks
+}
+
+// isUplinkCandidate 排除回环、网桥和容器虚拟网卡
+func isUplinkCandidate(iface string) bool {
+	for _, prefix := range uplinkSkipPrefixes {
+		if strings.HasPrefix(iface, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeUplinks 按接口去重，保留 metric 最小的路由，并按 metric 和名称排序
+func mergeUplinks(lists ...[]Uplink) []Uplink {
+	best := map[string]Uplink{}
+	for _, list := range lists {
+		for _, u := range list {
+			if !isUplinkCandidate(u.Interface) {
+				continue
+			}
+			if existing, ok := best[u.Interface]; !ok || u.Metric < existing.Metric {
+				if u.Gateway == "" {
+					u.Gateway = existing.Gateway
+				}
+				best[u.Interface] = u
+			}
+		}
+	}
+
+	result := make([]Uplink, 0, len(best))
+	for _, u := range best {
+		result = append(result, u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Metric != result[j].Metric {
+			return result[i].Metric < result[j].Metric
+		}
+		return result[i].Interface < result[j].Interface
+	})
+	return result
+}
+
+// discoverUplinks 从主路由表和策略路由表中查找所有默认路由接口
+func discoverUplinks(runner CommandRunner, routePath string) ([]Uplink, error) {
+	var fromProc []Uplink
+	if f, err := os.Open(routePath); err == nil {
+		fromProc, err = parseProcNetRoute(f)
+		f.Close()
+		if err != nil {
+			return nil, errorf(msgNetworkRouteParse, routePath, err)
+		}
+	}
+
+	var fromIP []Uplink
+	if output, err := runner.Run("ip", "-4", "route", "show", "table", "all"); err == nil {
+		fromIP = parseIPRouteDefaults(output)
+	}
+
+	uplinks := mergeUplinks(fromProc, fromIP)
+	if len(uplinks) == 0 {
+		return nil, errorf(msgNetworkNoUplink)
+	}
+
+	// 多个接口同时在线时（如以太网和 Wi-Fi），以 Android 选择的默认网络为准
+	if output, err := runner.Run("ip", "rule", "list"); err == nil {
+		uplinks = preferDefaultNetwork(uplinks, parseDefaultNetworkRule(output))
+	}
+	return uplinks, nil
+}
+
+// NetworkRules 通过 ndc/ip/iptables 配置容器网桥的转发和 NAT
+// 每条规则先检查再添加，重复执行不会产生重复规则
+type NetworkRules struct {
+	runner CommandRunner
+	bridge string
+}
+
+// newNetworkRules 创建网络规则管理器
+func newNetworkRules(runner CommandRunner) *NetworkRules {
+	return &NetworkRules{runner: runner, bridge: dockerBridge}
+}
+
+// RuleStatus 单条规则的状态
+type RuleStatus struct {
+	Name    string `json:"name"`
+	Present bool   `json:"present"`
+}
+
+func (n *NetworkRules) hasForward(uplink string) bool {
+	output, err := n.runner.Run("ip", "rule", "list", "prio", ipRuleForwardPrio, "from", "all", "iif", n.bridge)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "lookup" && fields[i+1] == uplink {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (n *NetworkRules) hasNAT(uplink string) bool {
+	output, err := n.runner.Run("iptables", "-S", "tetherctrl_FORWARD")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(output, fmt.Sprintf("-i %s -o %s -g", n.bridge, uplink))
+}
+
+// appliedUplinks 返回已有 docker0 转发或 NAT 规则的上行接口，包括切换后已经不存在的网卡
+func (n *NetworkRules) appliedUplinks() []string {
+	var uplinks []string
+	add := func(uplink string) {
+		if uplink != "" && !containsString(uplinks, uplink) {
+			uplinks = append(uplinks, uplink)
+		}
+	}
+	if output, err := n.runner.Run("ip", "rule", "list", "prio", ipRuleForwardPrio, "from", "all", "iif", n.bridge); err == nil {
+		for _, line := range strings.Split(output, "\n") {
+			fields := strings.Fields(line)
+			for i := 0; i+1 < len(fields); i++ {
+				if fields[i] == "lookup" {
+					add(fields[i+1])
+				}
+			}
+		}
+	}
+	if output, err := n.runner.Run("iptables", "-S", "tetherctrl_FORWARD"); err == nil {
+		for _, line := range strings.Split(output, "\n") {
+			fields := strings.Fields(line)
+			for i := 0; i+3 < len(fields); i++ {
+				if fields[i] == "-i" && fields[i+1] == n.bridge && fields[i+2] == "-o" {
+					add(fields[i+3])
+				}
+			}
+		}
+	}
+	sort.Strings(uplinks)
+	return uplinks
+}
+
+func (n *NetworkRules) hasMainRule() bool {
+	output, err := n.runner.Run("ip", "rule", "list", "prio", ipRuleMainPrio, "from", "all", "table", "main")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(output, "main")
+}
+
+func (n *NetworkRules) hasBridgeAccept() bool {
+	_, err := n.runner.Run("iptables", "-C", "oem_fwd", "-i", n.bridge, "-o", n.bridge, "-j", "ACCEPT")
+	return err == nil
+}
+
+// Apply 为指定上行接口配置转发、NAT、策略路由和容器互通规则
+func (n *NetworkRules) Apply(uplink string) error {
+	if !n.hasForward(uplink) {
+		if _, err := n.runner.Run("ndc", "ipfwd", "add", n.bridge, uplink); err != nil {
+			return err
+		}
+	}
+	if _, err := n.runner.Run("ndc", "ipfwd", "enable", "dockerd"); err != nil {
+		return err
+	}
+	if !n.hasNAT(uplink) {
+		if _, err := n.runner.Run("ndc", "nat", "enable", n.bridge, uplink, "1"); err != nil {
+			return err
+		}
+	}
+	if !n.hasMainRule() {
+		if _, err := n.runner.Run("ip", "rule", "add", "prio", ipRuleMainPrio, "from", "all", "table", "main"); err != nil {
+			return err
+		}
+	}
+	if !n.hasBridgeAccept() {
+		if _, err := n.runner.Run("iptables", "-A", "oem_fwd", "-i", n.bridge, "-o", n.bridge, "-j", "ACCEPT"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveUplink 删除指定上行接口的转发和 NAT 规则，保留公共规则
+func (n *NetworkRules) RemoveUplink(uplink string) error {
+	var errs []string
+	if n.hasNAT(uplink) {
+		if _, err := n.runner.Run("ndc", "nat", "disable", n.bridge, uplink, "1"); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if n.hasForward(uplink) {
+		if _, err := n.runner.Run("ndc", "ipfwd", "remove", n.bridge, uplink); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Teardown 删除 uplinks 和所有已有规则的上行接口的规则以及公共规则
+func (n *NetworkRules) Teardown(uplinks []string) error {
+	var errs []string
+	all := append([]string(nil), uplinks...)
+	for _, uplink := range n.appliedUplinks() {
+		if !containsString(all, uplink) {
+			all = append(all, uplink)
+		}
+	}
+	for _, uplink := range all {
+		if err := n.RemoveUplink(uplink); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if n.hasBridgeAccept() {
+		if _, err := n.runner.Run("iptables", "-D", "oem_fwd", "-i", n.bridge, "-o", n.bridge, "-j", "ACCEPT"); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if n.hasMainRule() {
+		if _, err := n.runner.Run("ip", "rule", "del", "prio", ipRuleMainPrio, "from", "all", "table", "main"); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if _, err := n.runner.Run("ndc", "ipfwd", "disable", "dockerd"); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Status 返回指定上行接口相关规则的状态
+func (n *NetworkRules) Status(uplink string) []RuleStatus {
+	return []RuleStatus{
+		{Name: fmt.Sprintf("ipfwd %s -> %s", n.bridge, uplink), Present: n.hasForward(uplink)},
+		{Name: fmt.Sprintf("nat %s -> %s", n.bridge, uplink), Present: n.hasNAT(uplink)},
+		{Name: "ip rule prio " + ipRuleMainPrio + " table main", Present: n.hasMainRule()},
+		{Name: fmt.Sprintf("oem_fwd %s <-> %s", n.bridge, n.bridge), Present: n.hasBridgeAccept()},
+	}
+}
+
+// NetworkManager 跟踪已配置的上行接口，上行接口变化时重新配置规则
+type NetworkManager struct {
+	rules     *NetworkRules
+	discover  func() ([]Uplink, error)
+	applied   string
+	routePath string
+}
+
+// newNetworkManager 创建网络管理器
+func newNetworkManager(runner CommandRunner) *NetworkManager {
+	m := &NetworkManager{rules: newNetworkRules(runner), routePath: procNetRoute}
+	m.discover = func() ([]Uplink, error) {
+		return discoverUplinks(runner, m.routePath)
+	}
+	return m
+}
+
+// Current 返回当前已配置规则的上行接口
+func (m *NetworkManager) Current() string {
+	return m.applied
+}
+
+// Reconcile 查找当前默认上行接口，与已配置的不同时删除旧规则并应用新规则
+// 返回值表示上行接口是否发生了变化
+func (m *NetworkManager) Reconcile() (bool, error) {
+	uplinks, err := m.discover()
+	if err != nil {
+		return false, err
+	}
+	primary := uplinks[0].Interface
+
+	if primary == m.applied {
+		// 上行接口未变化时仍然检查一遍，补回被系统清除的规则
+		if err := m.rules.Apply(primary); err != nil {
+			return false, err
+		}
+		m.removeStale(primary)
+		return false, nil
+	}
+
+	if err := m.rules.Apply(primary); err != nil {
+		return true, err
+	}
+	m.applied = primary
+	m.removeStale(primary)
+	return true, nil
+}
+
+// removeStale 删除 primary 以外上行接口的规则，包括之前删除失败和其他进程留下的规则
+func (m *NetworkManager) removeStale(primary string) {
+	for _, uplink := range m.rules.appliedUplinks() {
+		if uplink == primary {
+			continue
+		}
+		if err := m.rules.RemoveUplink(uplink); err != nil {
+			fmt.Println(T(msgNetworkRemoveFailed, uplink, err))
+		}
+	}
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "network",
+		usage: msgUsageNetwork,
+		run: func(args []string) error {
+			return runNetworkCommand(execRunner{}, args)
+		},
+	})
+}
+
+// runNetworkCommand 实现 network 子命令
+func runNetworkCommand(runner CommandRunner, args []string) error {
+	if len(args) == 0 {
+		args = []string{"status"}
+	}
+
+	manager := newNetworkManager(runner)
+	switch args[0] {
+	case "watch":
+		return runNetworkWatch(runner, args[1:])
+	case "status":
+		uplinks, err := manager.discover()
+		if err != nil {
+			return err
+		}
+		for i, u := range uplinks {
+			marker := " "
+			if i == 0 {
+				marker = "*"
+			}
+			fmt.Println(T(msgNetworkUplink, marker, u.Interface, u.Gateway, u.Metric))
+		}
+		for _, s := range manager.rules.Status(uplinks[0].Interface) {
+			mark := "✗"
+			if s.Present {
+				mark = "✓"
+			}
+			fmt.Printf("  %s %s\n", mark, s.Name)
+		}
+		return nil
+	case "apply":
+		if _, err := manager.Reconcile(); err != nil {
+			return err
+		}
+		fmt.Println(T(msgNetworkApplied, dockerBridge, manager.Current()))
+		return nil
+	case "teardown":
+		// 没有上行接口时仍然删除已有规则的上行接口
+		uplinks, _ := manager.discover()
+		names := make([]string, 0, len(uplinks))
+		for _, u := range uplinks {
+			names = append(names, u.Interface)
+		}
+		if err := manager.rules.Teardown(names); err != nil {
+			return err
+		}
+		fmt.Println(T(msgNetworkTornDown))
+		return nil
+	default:
+		return errorf(msgUnknownAction, args[0])
+	}
+}
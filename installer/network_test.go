@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeNetRunner 模拟 ndc/ip/iptables 的规则状态
+type fakeNetRunner struct {
+	routes     string
+	forwards   map[string]bool
+	nats       map[string]bool
+	mainRule   bool
+	accept     bool
+	calls      []string
+	failOnCall string
+}
+
+func newFakeNetRunner(routes string) *fakeNetRunner {
+	return &fakeNetRunner{routes: routes, forwards: map[string]bool{}, nats: map[string]bool{}}
+}
+
+func (f *fakeNetRunner) Run(name string, args ...string) (string, error) {
+	call := strings.TrimSpace(name + " " + strings.Join(args, " "))
+	f.calls = append(f.calls, call)
+	if f.failOnCall != "" && call == f.failOnCall {
+		return "", fmt.Errorf("模拟失败: %s", call)
+	}
+
+	switch {
+	case call == "ip -4 route show table all":
+		return f.routes, nil
+	case call == "ip rule list prio 21000 from all iif docker0":
+		var b strings.Builder
+		for uplink, ok := range f.forwards {
+			if ok {
+				fmt.Fprintf(&b, "21000:\tfrom all iif docker0 lookup %s\n", uplink)
+			}
+		}
+		return b.String(), nil
+	case call == "iptables -S tetherctrl_FORWARD":
+		var b strings.Builder
+		b.WriteString("-N tetherctrl_FORWARD\n")
+		for uplink, ok := range f.nats {
+			if ok {
+				fmt.Fprintf(&b, "-A tetherctrl_FORWARD -i docker0 -o %s -g tetherctrl_counters\n", uplink)
+			}
+		}
+		return b.String(), nil
+	case call == "ip rule list prio 20500 from all table main":
+		if f.mainRule {
+			return "20500:\tfrom all lookup main\n", nil
+		}
+		return "", nil
+	case call == "iptables -C oem_fwd -i docker0 -o docker0 -j ACCEPT":
+		if f.accept {
+			return "", nil
+		}
+		return "", fmt.Errorf("规则不存在")
+	case strings.HasPrefix(call, "ndc ipfwd add docker0 "):
+		f.forwards[args[3]] = true
+	case strings.HasPrefix(call, "ndc ipfwd remove docker0 "):
+		delete(f.forwards, args[3])
+	case strings.HasPrefix(call, "ndc nat enable docker0 "):
+		f.nats[args[3]] = true
+	case strings.HasPrefix(call, "ndc nat disable docker0 "):
+		delete(f.nats, args[3])
+	case call == "ip rule add prio 20500 from all table main":
+		f.mainRule = true
+	case call == "ip rule del prio 20500 from all table main":
+		f.mainRule = false
+	case call == "iptables -A oem_fwd -i docker0 -o docker0 -j ACCEPT":
+		f.accept = true
+	case call == "iptables -D oem_fwd -i docker0 -o docker0 -j ACCEPT":
+		f.accept = false
+	}
+	return "", nil
+}
+
+// countCalls 统计以 prefix 开头的调用次数
+func (f *fakeNetRunner) countCalls(prefix string) int {
+	n := 0
+	for _, c := range f.calls {
+		if strings.HasPrefix(c, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// TestParseProcNetRoute 测试解析 /proc/net/route
+func TestParseProcNetRoute(t *testing.T) {
+	content := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wlan0	00000000	0101A8C0	0003	0	0	600	00000000	0	0	0
+wlan0	0001A8C0	00000000	0001	0	0	600	00FFFFFF	0	0	0
+eth0	00000000	010AA8C0	0003	0	0	100	00000000	0	0	0
+docker0	000011AC	00000000	0001	0	0	0	0000FFFF	0	0	0
+`
+	uplinks, err := parseProcNetRoute(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(uplinks) != 2 {
+		t.Fatalf("应找到 2 条默认路由, 实际: %v", uplinks)
+	}
+	if uplinks[0].Interface != "wlan0" || uplinks[0].Gateway != "192.168.1.1" || uplinks[0].Metric != 600 {
+		t.Errorf("wlan0 解析错误: %+v", uplinks[0])
+	}
+	if uplinks[1].Gateway != "192.168.10.1" {
+		t.Errorf("eth0 网关解析错误: %+v", uplinks[1])
+	}
+}
+
+// TestParseIPRouteDefaults 测试解析 Android 策略路由表中的默认路由
+func TestParseIPRouteDefaults(t *testing.T) {
+	output := `default via 192.168.1.1 dev wlan0 table wlan0 proto static
+192.168.1.0/24 dev wlan0 table wlan0 proto static scope link
+default dev rmnet_data0 table rmnet_data0 proto static scope link metric 50
+default via 10.0.0.1 dev eth0 table eth0 proto static metric 10
+`
+	uplinks := mergeUplinks(parseIPRouteDefaults(output))
+	var names []string
+	for _, u := range uplinks {
+		names = append(names, u.Interface)
+	}
+	if strings.Join(names, ",") != "wlan0,eth0,rmnet_data0" {
+		t.Errorf("上行接口顺序错误: %v", names)
+	}
+}
+
+// TestMergeUplinks 测试去重和排除虚拟网卡
+func TestMergeUplinks(t *testing.T) {
+	uplinks := mergeUplinks(
+		[]Uplink{{Interface: "eth0", Gateway: "10.0.0.1", Metric: 100}, {Interface: "docker0"}},
+		[]Uplink{{Interface: "eth0", Metric: 10}, {Interface: "veth123"}, {Interface: "lo"}},
+	)
+	if len(uplinks) != 1 {
+		t.Fatalf("应只有 eth0, 实际: %v", uplinks)
+	}
+	if uplinks[0].Metric != 10 || uplinks[0].Gateway != "10.0.0.1" {
+		t.Errorf("合并结果错误: %+v", uplinks[0])
+	}
+}
+
+// TestDiscoverUplinks 测试同时读取 /proc/net/route 和 ip route
+func TestDiscoverUplinks(t *testing.T) {
+	routePath := filepath.Join(t.TempDir(), "route")
+	os.WriteFile(routePath, []byte("Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\n"), 0644)
+
+	runner := newFakeNetRunner("default via 192.168.1.1 dev wlan0 table wlan0 proto static\n")
+	uplinks, err := discoverUplinks(runner, routePath)
+	if err != nil {
+		t.Fatalf("查找上行接口失败: %v", err)
+	}
+	if uplinks[0].Interface != "wlan0" {
+		t.Errorf("上行接口错误: %v", uplinks)
+	}
+
+	if _, err := discoverUplinks(newFakeNetRunner(""), routePath); err == nil {
+		t.Error("没有默认路由时应返回错误")
+	}
+}
+
+// TestNetworkRules_ApplyIdempotent 测试重复应用不会重复添加规则
+func TestNetworkRules_ApplyIdempotent(t *testing.T) {
+	runner := newFakeNetRunner("")
+	rules := newNetworkRules(runner)
+
+	for i := 0; i < 3; i++ {
+		if err := rules.Apply("wlan0"); err != nil {
+			t.Fatalf("应用规则失败: %v", err)
+		}
+	}
+
+	for _, prefix := range []string{
+		"ndc ipfwd add docker0 wlan0",
+		"ndc nat enable docker0 wlan0 1",
+		"ip rule add prio 20500",
+		"iptables -A oem_fwd",
+	} {
+		if n := runner.countCalls(prefix); n != 1 {
+			t.Errorf("%s 应执行 1 次, 实际: %d", prefix, n)
+		}
+	}
+	for _, s := range rules.Status("wlan0") {
+		if !s.Present {
+			t.Errorf("规则未生效: %s", s.Name)
+		}
+	}
+}
+
+// TestNetworkRules_ApplyError 测试命令失败时返回错误
+func TestNetworkRules_ApplyError(t *testing.T) {
+	runner := newFakeNetRunner("")
+	runner.failOnCall = "ndc nat enable docker0 eth0 1"
+	if err := newNetworkRules(runner).Apply("eth0"); err == nil {
+		t.Error("期望返回错误")
+	}
+}
+
+// TestNetworkRules_Teardown 测试删除规则
+func TestNetworkRules_Teardown(t *testing.T) {
+	runner := newFakeNetRunner("")
+	rules := newNetworkRules(runner)
+	rules.Apply("eth0")
+
+	if err := rules.Teardown([]string{"eth0", "wlan0"}); err != nil {
+		t.Fatalf("删除规则失败: %v", err)
+	}
+	if len(runner.forwards) != 0 || len(runner.nats) != 0 || runner.mainRule || runner.accept {
+		t.Errorf("规则未完全删除: %+v", runner)
+	}
+	if runner.countCalls("ndc nat disable docker0 wlan0") != 0 {
+		t.Error("不存在的规则不应尝试删除")
+	}
+}
+
+// TestNetworkRules_TeardownStale 测试删除切换后已不存在的上行接口留下的规则
+func TestNetworkRules_TeardownStale(t *testing.T) {
+	runner := newFakeNetRunner("")
+	rules := newNetworkRules(runner)
+	rules.Apply("eth0")
+	rules.Apply("wlan0")
+
+	if got := strings.Join(rules.appliedUplinks(), ","); got != "eth0,wlan0" {
+		t.Errorf("appliedUplinks = %s", got)
+	}
+	if err := rules.Teardown([]string{"wlan0"}); err != nil {
+		t.Fatalf("删除规则失败: %v", err)
+	}
+	if len(runner.forwards) != 0 || len(runner.nats) != 0 {
+		t.Errorf("eth0 的规则未删除: %+v", runner)
+	}
+}
+
+// TestNetworkManager_Reconcile 测试上行接口变化时重新配置
+func TestNetworkManager_Reconcile(t *testing.T) {
+	runner := newFakeNetRunner("default via 10.0.0.1 dev eth0 table eth0 proto static\n")
+	manager := newNetworkManager(runner)
+	manager.routePath = filepath.Join(t.TempDir(), "missing")
+
+	changed, err := manager.Reconcile()
+	if err != nil || !changed || manager.Current() != "eth0" {
+		t.Fatalf("首次配置错误: changed=%v err=%v current=%s", changed, err, manager.Current())
+	}
+
+	changed, err = manager.Reconcile()
+	if err != nil || changed {
+		t.Fatalf("上行接口未变化时不应报告变化: changed=%v err=%v", changed, err)
+	}
+
+	runner.routes = "default via 192.168.1.1 dev wlan0 table wlan0 proto static\n"
+	changed, err = manager.Reconcile()
+	if err != nil || !changed || manager.Current() != "wlan0" {
+		t.Fatalf("切换上行接口错误: changed=%v err=%v current=%s", changed, err, manager.Current())
+	}
+	if runner.nats["eth0"] || runner.forwards["eth0"] {
+		t.Error("旧上行接口的规则应被删除")
+	}
+	if !runner.nats["wlan0"] || !runner.forwards["wlan0"] {
+		t.Error("新上行接口的规则未添加")
+	}
+}
+
+// TestNetworkManager_ReconcileStale 测试删除旧上行接口失败后在下次检查时重试
+func TestNetworkManager_ReconcileStale(t *testing.T) {
+	runner := newFakeNetRunner("default via 10.0.0.1 dev eth0 table eth0 proto static\n")
+	manager := newNetworkManager(runner)
+	manager.routePath = filepath.Join(t.TempDir(), "missing")
+	if _, err := manager.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+
+	runner.routes = "default via 192.168.1.1 dev wlan0 table wlan0 proto static\n"
+	runner.failOnCall = "ndc nat disable docker0 eth0 1"
+	if changed, err := manager.Reconcile(); err != nil || !changed {
+		t.Fatalf("changed=%v err=%v", changed, err)
+	}
+	if !runner.nats["eth0"] {
+		t.Fatal("模拟删除失败后 eth0 的 NAT 应仍然存在")
+	}
+
+	runner.failOnCall = ""
+	if _, err := manager.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if runner.nats["eth0"] || runner.forwards["eth0"] {
+		t.Error("下次检查时应删除 eth0 留下的规则")
+	}
+	if !runner.nats["wlan0"] || !runner.forwards["wlan0"] {
+		t.Error("wlan0 的规则不应被删除")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultWatchInterval 没有 netlink 事件时的轮询间隔
+	defaultWatchInterval = 30 * time.Second
+	// routeSettleDelay 收到路由事件后等待路由稳定的时间，网卡切换时会连续产生多个事件
+	routeSettleDelay = 2 * time.Second
+	// netlinkReadTimeout 读取 netlink 事件的超时，取消后最多等这么久读取的 goroutine 退出
+	netlinkReadTimeout = time.Second
+
+	// netlink 多播组，syscall 包未导出
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4Ifaddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+)
+
+// NetworkWatcher 监听链路和路由变化，保持 docker0 的转发和 NAT 指向当前默认上行接口
+type NetworkWatcher struct {
+	manager  *NetworkManager
+	interval time.Duration
+	settle   time.Duration
+	logger   *log.Logger
+	// events 路由变化通知，为 nil 时只轮询
+	events <-chan struct{}
+
+	lastErr string
+}
+
+// newNetworkWatcher 创建网络监听器
+func newNetworkWatcher(manager *NetworkManager, interval time.Duration, logger *log.Logger) *NetworkWatcher {
+	return &NetworkWatcher{
+		manager:  manager,
+		interval: interval,
+		settle:   routeSettleDelay,
+		logger:   logger,
+	}
+}
+
+// check 执行一次检查，上行接口或错误状态变化时记录日志
+func (w *NetworkWatcher) check() {
+	previous := w.manager.Current()
+	changed, err := w.manager.Reconcile()
+	if err != nil {
+		if err.Error() != w.lastErr {
+			w.logger.Print(T(msgNetworkWatchFailed, err))
+			w.lastErr = err.Error()
+		}
+		return
+	}
+	if w.lastErr != "" {
+		w.logger.Print(T(msgNetworkWatchRecovered))
+		w.lastErr = ""
+	}
+	if changed {
+		if previous == "" {
+			w.logger.Print(T(msgNetworkWatchUplink, w.manager.Current()))
+		} else {
+			w.logger.Print(T(msgNetworkWatchSwitch, previous, w.manager.Current()))
+		}
+	}
+}
+
+// Run 持续监听直到 ctx 取消
+func (w *NetworkWatcher) Run(ctx context.Context) error {
+	w.check()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			w.check()
+		case _, ok := <-w.events:
+			if !ok {
+				w.logger.Print(T(msgNetworkWatchClosed, w.interval))
+				w.events = nil
+				continue
+			}
+			// 等待路由稳定，并合并这段时间内的事件
+			timer := time.NewTimer(w.settle)
+		drain:
+			for {
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil
+				case <-w.events:
+				case <-timer.C:
+					break drain
+				}
+			}
+			w.check()
+		}
+	}
+}
+
+// subscribeRouteEvents 通过 netlink 订阅链路和 IPv4 路由变化
+func subscribeRouteEvents(ctx context.Context) (<-chan struct{}, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, errorf(msgNetlinkSocket, err)
+	}
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4Route | rtmgrpIPv4Ifaddr,
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, errorf(msgNetlinkBind, err)
+	}
+
+	// 关闭 fd 不会唤醒阻塞在 Recvfrom 中的读取，用接收超时定期检查 ctx
+	timeout := syscall.NsecToTimeval(netlinkReadTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, errorf(msgNetlinkTimeout, err)
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		defer syscall.Close(fd)
+		buf := make([]byte, 64*1024)
+		for ctx.Err() == nil {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == syscall.EINTR || err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
+					continue
+				}
+				return
+			}
+			if n == 0 {
+				continue
+			}
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
+
+// parseDefaultNetworkRule 从 `ip rule list` 中找出 Android 当前默认网络使用的路由表
+// netd 为默认网络添加形如 "from all fwmark 0x0/0xffff iif lo lookup wlan0" 的规则
+func parseDefaultNetworkRule(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, "fwmark 0x0/0xffff") || !strings.Contains(line, "iif lo") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "lookup" {
+				return fields[i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// preferDefaultNetwork 将 Android 默认网络对应的接口排到最前
+func preferDefaultNetwork(uplinks []Uplink, iface string) []Uplink {
+	for i, u := range uplinks {
+		if u.Interface == iface && i > 0 {
+			result := append([]Uplink{u}, uplinks[:i]...)
+			return append(result, uplinks[i+1:]...)
+		}
+	}
+	return uplinks
+}
+
+// runNetworkWatch 实现 network watch 子命令
+func runNetworkWatch(runner CommandRunner, args []string) error {
+	fs := flag.NewFlagSet("network watch", flag.ExitOnError)
+	interval := fs.Duration("interval", defaultWatchInterval, "轮询间隔")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	watcher := newNetworkWatcher(newNetworkManager(runner), *interval, logger)
+	if events, err := subscribeRouteEvents(ctx); err != nil {
+		logger.Print(T(msgNetworkWatchPolling, err, *interval))
+	} else {
+		watcher.events = events
+	}
+
+	logger.Print(T(msgNetworkWatchStart))
+	return watcher.Run(ctx)
+}
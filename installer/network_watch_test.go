@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer 可并发写入的日志缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestParseDefaultNetworkRule 测试识别 Android 默认网络
+func TestParseDefaultNetworkRule(t *testing.T) {
+	output := `0:	from all lookup local
+10000:	from all fwmark 0xc0000/0xd0000 lookup legacy_system
+13000:	from all fwmark 0x10063/0x1ffff iif lo lookup local_network
+22000:	from all fwmark 0x0/0xffff iif lo lookup wlan0
+32000:	from all unreachable
+`
+	if got := parseDefaultNetworkRule(output); got != "wlan0" {
+		t.Errorf("默认网络识别错误: %q", got)
+	}
+	if got := parseDefaultNetworkRule("0:\tfrom all lookup local\n"); got != "" {
+		t.Errorf("没有默认网络规则时应返回空: %q", got)
+	}
+
+	uplinks := []Uplink{{Interface: "eth0"}, {Interface: "rmnet0"}, {Interface: "wlan0"}}
+	ordered := preferDefaultNetwork(uplinks, "wlan0")
+	if ordered[0].Interface != "wlan0" || ordered[1].Interface != "eth0" || ordered[2].Interface != "rmnet0" {
+		t.Errorf("排序错误: %v", ordered)
+	}
+	if got := preferDefaultNetwork(uplinks, "tun0"); got[0].Interface != "eth0" {
+		t.Errorf("默认网络不在列表中时应保持原顺序: %v", got)
+	}
+}
+
+// TestNetworkWatcher_Failover 测试以太网断开后切换到 Wi-Fi
+func TestNetworkWatcher_Failover(t *testing.T) {
+	var mu sync.Mutex
+	routes := "default via 10.0.0.1 dev eth0 table eth0 proto static\n"
+	runner := newFakeNetRunner("")
+	manager := newNetworkManager(runner)
+	manager.discover = func() ([]Uplink, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		runner.routes = routes
+		return discoverUplinks(runner, filepath.Join(t.TempDir(), "missing"))
+	}
+
+	var logs syncBuffer
+	watcher := newNetworkWatcher(manager, time.Hour, log.New(&logs, "", 0))
+	watcher.settle = 10 * time.Millisecond
+	events := make(chan struct{}, 1)
+	watcher.events = events
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watcher.Run(ctx)
+		close(done)
+	}()
+
+	waitForLog := func(substr string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !strings.Contains(logs.String(), substr) {
+			if time.Now().After(deadline) {
+				t.Fatalf("等待日志 %q 超时, 实际:\n%s", substr, logs.String())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitForLog("上行接口: eth0")
+
+	// 以太网断开，没有默认路由
+	mu.Lock()
+	routes = ""
+	mu.Unlock()
+	events <- struct{}{}
+	waitForLog("配置容器网络失败")
+
+	// Wi-Fi 连接成功
+	mu.Lock()
+	routes = "default via 192.168.1.1 dev wlan0 table wlan0 proto static\n"
+	mu.Unlock()
+	events <- struct{}{}
+	waitForLog("上行接口切换: eth0 -> wlan0")
+
+	cancel()
+	<-done
+
+	if !strings.Contains(logs.String(), "容器网络已恢复") {
+		t.Errorf("恢复时应记录日志:\n%s", logs.String())
+	}
+	if strings.Count(logs.String(), "配置容器网络失败") != 1 {
+		t.Errorf("相同错误只应记录一次:\n%s", logs.String())
+	}
+}
+
+// TestSubscribeRouteEvents_Cancel 测试取消后读取 netlink 的 goroutine 退出并关闭通道
+func TestSubscribeRouteEvents_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := subscribeRouteEvents(ctx)
+	if err != nil {
+		cancel()
+		t.Skipf("不支持 netlink: %v", err)
+	}
+	// 等读取的 goroutine 阻塞在 Recvfrom 中再取消
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	deadline := time.After(netlinkReadTimeout + 2*time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("取消后事件通道未关闭")
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPeerPort 局域网共享使用的端口，UDP 用于发现，TCP 用于下载
+	defaultPeerPort = 9110
+	// peerService 发现请求和响应中的服务名，其他程序的广播直接忽略
+	peerService = "dfa-peer"
+	// peerDiscoverTimeout 等待其他设备响应的时间
+	peerDiscoverTimeout = 1500 * time.Millisecond
+	// peerMessageLimit 发现请求和响应的大小上限
+	peerMessageLimit = 8 << 10
+)
+
+// PeerConfig 局域网共享设置，保存在 mirrors.json 的 peers 中
+type PeerConfig struct {
+	// Share dfa-agent 在局域网中提供本机缓存的安装包
+	Share bool `json:"share"`
+	// Discover 安装前在局域网中查找有这些安装包的设备，作为最优先的下载源
+	Discover bool `json:"discover"`
+	// Port 发现使用的 UDP 端口和下载使用的 TCP 端口
+	Port int `json:"port"`
+}
+
+var (
+	// peerDiscover 安装前是否查找局域网中的设备，由 configureDownload 设置
+	peerDiscover bool
+	// peerPort 局域网共享的端口，由 configureDownload 设置
+	peerPort = defaultPeerPort
+)
+
+// peerQuery 安装时广播的发现请求，Files 为需要的安装包
+type peerQuery struct {
+	Service string   `json:"service"`
+	Files   []string `json:"files"`
+}
+
+// peerAnnounce 有安装包的设备对发现请求的响应，下载地址由响应的来源 IP 和 Port 组成
+type peerAnnounce struct {
+	Service string   `json:"service"`
+	Port    int      `json:"port"`
+	Files   []string `json:"files"`
+}
+
+// peerServer 在局域网中提供本机缓存的安装包
+// 只提供缓存中存入时已校验过 SHA256 的安装包，下载方仍按版本文件中的 SHA256 校验
+type peerServer struct {
+	// cacheDir 数据盘上的安装包缓存目录，启动时从安装状态确定
+	cacheDir string
+	// port 响应中告诉对方的下载端口
+	port   int
+	logger *log.Logger
+}
+
+// newPeerServer 创建提供数据盘上安装包缓存的 peerServer
+// 缓存目录取自 statePath 中的安装记录，没有安装记录时返回错误，不在每次请求时检测数据盘
+func newPeerServer(statePath string, port int, logger *log.Logger) (*peerServer, error) {
+	state, err := loadInstallState(statePath)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || state.DiskRoot == "" {
+		return nil, errorf(msgCacheNotInstalled)
+	}
+	return &peerServer{
+		cacheDir: diskCacheDir(state.DiskRoot),
+		port:     port,
+		logger:   logger,
+	}, nil
+}
+
+// entries 返回缓存中按名称索引的安装包，同名时使用最近使用的
+func (p *peerServer) entries() (map[string]string, error) {
+	cache, err := openArtifactCache(p.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for _, e := range cache.list() {
+		if _, ok := files[e.Name]; !ok {
+			files[e.Name] = cache.path(e.SHA256)
+		}
+	}
+	return files, nil
+}
+
+// Handler 提供 GET/HEAD /<文件名>，支持 Range 续传
+func (p *peerServer) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "只支持 GET 和 HEAD", http.StatusMethodNotAllowed)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		files, err := p.entries()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		path, ok := files[name]
+		if !ok || strings.Contains(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		p.logger.Printf("向 %s 提供 %s", r.RemoteAddr, name)
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	})
+}
+
+// answer 返回对发现请求的响应，没有请求的安装包时返回 nil
+func (p *peerServer) answer(data []byte) []byte {
+	var q peerQuery
+	if json.Unmarshal(data, &q) != nil || q.Service != peerService {
+		return nil
+	}
+	files, err := p.entries()
+	if err != nil {
+		return nil
+	}
+	a := peerAnnounce{Service: peerService, Port: p.port}
+	for _, name := range q.Files {
+		if _, ok := files[name]; ok {
+			a.Files = append(a.Files, name)
+		}
+	}
+	if len(a.Files) == 0 {
+		return nil
+	}
+	resp, _ := json.Marshal(a)
+	return resp
+}
+
+// serveDiscovery 响应发现请求，直到 conn 关闭
+func (p *peerServer) serveDiscovery(conn net.PacketConn) error {
+	buf := make([]byte, peerMessageLimit)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if resp := p.answer(buf[:n]); resp != nil {
+			conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// Run 在 addr（如 :9110）上同时监听 UDP 发现请求和 TCP 下载，ctx 结束时停止
+func (p *peerServer) Run(ctx context.Context, addr string) error {
+	udp, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return err
+	}
+	defer udp.Close()
+	l, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: p.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 2)
+	go func() { errs <- server.Serve(l) }()
+	go func() { errs <- p.serveDiscovery(udp) }()
+	p.logger.Printf("局域网共享安装包: %s", l.Addr())
+
+	select {
+	case <-ctx.Done():
+		server.Close()
+		return nil
+	case err := <-errs:
+		server.Close()
+		return err
+	}
+}
+
+// peerBroadcastTargets 返回发现请求的目标：受限广播地址和每个网卡的定向广播地址
+func peerBroadcastTargets(port int) []string {
+	targets := []string{net.JoinHostPort("255.255.255.255", strconv.Itoa(port))}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return targets
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			ip, mask := ipnet.IP.To4(), ipnet.Mask
+			if len(mask) == net.IPv6len {
+				mask = mask[12:]
+			}
+			bcast := make(net.IP, net.IPv4len)
+			for i := range bcast {
+				bcast[i] = ip[i] | ^mask[i]
+			}
+			targets = append(targets, net.JoinHostPort(bcast.String(), strconv.Itoa(port)))
+		}
+	}
+	return targets
+}
+
+// discoverPeers 向 targets 发送发现请求，在 timeout 内收集有 files 中安装包的设备，按响应顺序返回
+func discoverPeers(targets, files []string, timeout time.Duration) ([]downloadMirror, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query, _ := json.Marshal(peerQuery{Service: peerService, Files: files})
+	sent := 0
+	for _, target := range targets {
+		addr, err := net.ResolveUDPAddr("udp4", target)
+		if err != nil {
+			continue
+		}
+		if _, err := conn.WriteTo(query, addr); err == nil {
+			sent++
+		}
+	}
+	if sent == 0 {
+		return nil, fmt.Errorf("无法发送发现请求")
+	}
+
+	var peers []downloadMirror
+	seen := map[string]bool{}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, peerMessageLimit)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			// 超时表示收集结束
+			break
+		}
+		var a peerAnnounce
+		if json.Unmarshal(buf[:n], &a) != nil || a.Service != peerService || a.Port <= 0 || len(a.Files) == 0 {
+			continue
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		// Android 的主机名通常都是 localhost，用响应的 IP 和端口区分设备
+		host := net.JoinHostPort(udpAddr.IP.String(), strconv.Itoa(a.Port))
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+		peers = append(peers, downloadMirror{Name: "peer:" + host, BaseURL: "http://" + host, Peer: true, Files: a.Files})
+	}
+	return peers, nil
+}
+
+// hasFile 判断局域网中的设备是否在发现响应中列出了 filename
+func (m downloadMirror) hasFile(filename string) bool {
+	for _, f := range m.Files {
+		if f == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// isPeerHost 判断 host（host:port）是否为发现的局域网设备，访问局域网设备不经过代理
+func isPeerHost(host string) bool {
+	for _, m := range downloadMirrors {
+		if !m.Peer {
+			continue
+		}
+		if u, err := url.Parse(m.BaseURL); err == nil && u.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// addPeerMirrors 把局域网中的设备加到下载源的最前面
+func addPeerMirrors(peers []downloadMirror) {
+	downloadMirrors = mergeMirrors(peers, downloadMirrors)
+}
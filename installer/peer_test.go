@@ -0,0 +1,287 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPeer 回环地址上的一台局域网设备
+type testPeer struct {
+	cache    *artifactCache
+	http     *httptest.Server
+	udp      net.PacketConn
+	requests int32
+	files    []string
+}
+
+// startTestPeer 启动缓存中有 files 的 peerServer，HTTP 和 UDP 都使用随机端口
+func startTestPeer(t *testing.T, files map[string][]byte) *testPeer {
+	t.Helper()
+	dir := t.TempDir()
+	cache, err := openArtifactCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range files {
+		addCacheEntry(t, cache, file, "1.0", content, time.Now())
+	}
+	p := &testPeer{cache: cache}
+	for file := range files {
+		p.files = append(p.files, file)
+	}
+	server := &peerServer{
+		cacheDir: dir,
+		logger:   log.New(io.Discard, "", 0),
+	}
+	handler := server.Handler()
+	p.http = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&p.requests, 1)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(p.http.Close)
+	server.port = p.http.Listener.Addr().(*net.TCPAddr).Port
+
+	if p.udp, err = net.ListenPacket("udp4", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.udp.Close() })
+	go server.serveDiscovery(p.udp)
+	return p
+}
+
+// mirror 返回这台设备作为下载源
+func (p *testPeer) mirror() downloadMirror {
+	return downloadMirror{Name: "peer", BaseURL: p.http.URL, Peer: true, Files: p.files}
+}
+
+// TestDiscoverPeers 测试只有缓存中有请求的安装包的设备响应
+func TestDiscoverPeers(t *testing.T) {
+	a := startTestPeer(t, map[string][]byte{"docker-1.0.tar.gz": []byte("docker")})
+	b := startTestPeer(t, map[string][]byte{"other-1.0.tar.gz": []byte("other")})
+	c := startTestPeer(t, map[string][]byte{"docker-1.0.tar.gz": []byte("docker"), "bin-1.0.tar.gz": []byte("bin")})
+
+	targets := []string{a.udp.LocalAddr().String(), b.udp.LocalAddr().String(), c.udp.LocalAddr().String()}
+	peers, err := discoverPeers(targets, []string{"docker-1.0.tar.gz", "bin-1.0.tar.gz"}, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]string{}
+	for _, p := range peers {
+		if !p.Peer {
+			t.Errorf("应标记为局域网设备: %+v", p)
+		}
+		found[p.BaseURL] = p.Name
+	}
+	if len(peers) != 2 || found[a.http.URL] != "peer:"+a.http.Listener.Addr().String() || found[c.http.URL] != "peer:"+c.http.Listener.Addr().String() {
+		t.Errorf("peers = %+v", peers)
+	}
+
+	if peers, err := discoverPeers([]string{b.udp.LocalAddr().String()}, []string{"docker-1.0.tar.gz"}, 200*time.Millisecond); err != nil || len(peers) != 0 {
+		t.Errorf("peers = %+v, err = %v", peers, err)
+	}
+}
+
+// TestNewPeerServer 测试缓存目录取自安装记录，没有安装记录时不共享
+func TestNewPeerServer(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "install.json")
+	logger := log.New(io.Discard, "", 0)
+	if _, err := newPeerServer(statePath, defaultPeerPort, logger); err == nil {
+		t.Error("没有安装记录时应返回错误")
+	}
+
+	saveInstallState(statePath, &InstallState{Version: "1.0", DiskRoot: "/mnt/media_rw/disk"})
+	p, err := newPeerServer(statePath, defaultPeerPort, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.cacheDir != "/mnt/media_rw/disk/Cache/installer" {
+		t.Errorf("cacheDir = %s", p.cacheDir)
+	}
+}
+
+// TestPeerServerHandler 测试只提供缓存中的安装包并支持续传
+func TestPeerServerHandler(t *testing.T) {
+	p := startTestPeer(t, map[string][]byte{"docker-1.0.tar.gz": []byte("docker package")})
+
+	req, _ := http.NewRequest(http.MethodGet, p.http.URL+"/docker-1.0.tar.gz", nil)
+	req.Header.Set("Range", "bytes=7-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "package" {
+		t.Errorf("status = %d, body = %q", resp.StatusCode, body)
+	}
+
+	for path, status := range map[string]int{
+		"/bin-1.0.tar.gz":              http.StatusNotFound,
+		"/blobs/docker-1.0.tar.gz":     http.StatusNotFound,
+		"/index.json":                  http.StatusNotFound,
+		"/../etc/docker-1.0.tar.gz":    http.StatusNotFound,
+		"/" + p.cache.list()[0].SHA256: http.StatusNotFound,
+	} {
+		resp, err := http.Get(p.http.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("%s: status = %d", path, resp.StatusCode)
+		}
+	}
+
+	resp, err = http.Post(p.http.URL+"/docker-1.0.tar.gz", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d", resp.StatusCode)
+	}
+}
+
+// TestDownloadFromPeer 测试局域网设备优先，内容被修改时校验失败并使用其他下载源
+func TestDownloadFromPeer(t *testing.T) {
+	useMirrorMode(t, true, false)
+	content := []byte("docker package")
+	sum := sha256Hex(content)
+	var cdnRequests int32
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&cdnRequests, 1)
+		w.Write(content)
+	}))
+	defer cdn.Close()
+
+	good := startTestPeer(t, map[string][]byte{"docker-1.0.tar.gz": content})
+	useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: cdn.URL})
+	addPeerMirrors([]downloadMirror{good.mirror()})
+	dest := filepath.Join(t.TempDir(), "docker-1.0.tar.gz")
+	if err := downloadFile(http.DefaultClient, dest, "docker-1.0.tar.gz", sum); err != nil {
+		t.Fatal(err)
+	}
+	if cdnRequests != 0 || good.requests != 1 {
+		t.Errorf("应只从局域网设备下载: cdn = %d, peer = %d", cdnRequests, good.requests)
+	}
+	if h := mirrorStats.get(good.http.URL); h.Successes != 0 || h.Failures != 0 {
+		t.Errorf("不应记录局域网设备: %+v", h)
+	}
+
+	// 缓存内容被修改的设备不能提供安装包
+	evil := startTestPeer(t, map[string][]byte{"docker-1.0.tar.gz": content})
+	os.WriteFile(evil.cache.path(sum), []byte("docker package with a backdoor"), 0644)
+	useTestMirrors(t, evil.mirror(), downloadMirror{Name: "cdn", BaseURL: cdn.URL})
+	dest = filepath.Join(t.TempDir(), "docker-1.0.tar.gz")
+	if err := downloadFile(http.DefaultClient, dest, "docker-1.0.tar.gz", sum); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != string(content) || evil.requests != 1 || cdnRequests != 1 {
+		t.Errorf("content = %q, peer = %d, cdn = %d", data, evil.requests, cdnRequests)
+	}
+
+	// 没有 SHA256 的文件（如 version.txt）不从局域网设备下载
+	dest = filepath.Join(t.TempDir(), "version.txt")
+	if err := downloadFile(http.DefaultClient, dest, "version.txt", ""); err != nil {
+		t.Fatal(err)
+	}
+	if evil.requests != 1 || cdnRequests != 2 {
+		t.Errorf("peer = %d, cdn = %d", evil.requests, cdnRequests)
+	}
+}
+
+// TestConfigurePeers 测试配置文件和 --peers 开启局域网发现
+func TestConfigurePeers(t *testing.T) {
+	useMirrorMode(t, false, false)
+	useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: "https://cdn.example.com/dfa"})
+	config := filepath.Join(t.TempDir(), "mirrors.json")
+
+	if err := configureDownload(DownloadOptions{Peers: true}, config, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !peerDiscover || peerPort != defaultPeerPort {
+		t.Errorf("discover = %v, port = %d", peerDiscover, peerPort)
+	}
+
+	os.WriteFile(config, []byte(`{"peers": {"share": true, "discover": true, "port": 9200}}`), 0644)
+	if err := configureDownload(DownloadOptions{}, config, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !peerDiscover || peerPort != 9200 {
+		t.Errorf("discover = %v, port = %d", peerDiscover, peerPort)
+	}
+
+	os.WriteFile(config, []byte(`{"peers": {"port": 70000}}`), 0644)
+	if _, err := loadMirrorConfig(config); err == nil {
+		t.Error("expected error for invalid port")
+	}
+}
+
+// TestPeerAnnouncedFiles 测试只从局域网设备下载它在发现响应中列出的文件
+func TestPeerAnnouncedFiles(t *testing.T) {
+	useMirrorMode(t, false, false)
+	content := []byte("bin package")
+	var cdnRequests int32
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&cdnRequests, 1)
+		w.Write(content)
+	}))
+	defer cdn.Close()
+
+	p := startTestPeer(t, map[string][]byte{"docker-1.0.tar.gz": []byte("docker")})
+	peers, err := discoverPeers([]string{p.udp.LocalAddr().String()}, []string{"docker-1.0.tar.gz", "bin-1.0.tar.gz"}, 500*time.Millisecond)
+	if err != nil || len(peers) != 1 {
+		t.Fatalf("peers = %+v, err = %v", peers, err)
+	}
+	if files := peers[0].Files; len(files) != 1 || files[0] != "docker-1.0.tar.gz" {
+		t.Errorf("files = %q", files)
+	}
+
+	useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: cdn.URL})
+	addPeerMirrors(peers)
+	dest := filepath.Join(t.TempDir(), "bin-1.0.tar.gz")
+	if err := downloadFile(http.DefaultClient, dest, "bin-1.0.tar.gz", sha256Hex(content)); err != nil {
+		t.Fatal(err)
+	}
+	if p.requests != 0 || cdnRequests != 1 {
+		t.Errorf("设备没有列出的文件不应从设备下载: peer = %d, cdn = %d", p.requests, cdnRequests)
+	}
+}
+
+// TestPeerBypassProxy 测试访问局域网设备不经过代理
+func TestPeerBypassProxy(t *testing.T) {
+	restoreNetwork(t)
+	useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: "http://cdn.example.com/dfa"})
+	addPeerMirrors([]downloadMirror{{Name: "peer:192.168.1.20:9110", BaseURL: "http://192.168.1.20:9110", Peer: true, Files: []string{"docker-1.0.tar.gz"}}})
+	env := envMap(map[string]string{"HTTP_PROXY": "http://proxy.example.com:3128"})
+	if err := configureNetwork(NetworkOptions{}, env); err != nil {
+		t.Fatal(err)
+	}
+	transport := CreateTimeoutTransport(time.Second)
+	for target, want := range map[string]string{
+		"http://192.168.1.20:9110/docker-1.0.tar.gz": "",
+		"http://192.168.1.20:8080/docker-1.0.tar.gz": "proxy.example.com:3128",
+		"http://cdn.example.com/dfa/version.txt":     "proxy.example.com:3128",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		proxy, err := transport.Proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if proxy != nil {
+			got = proxy.Host
+		}
+		if got != want {
+			t.Errorf("%s: proxy = %q，期望 %q", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// downloadPausedPath 存在时所有下载暂停，由 agent 的 /v1/downloads/pause 创建
+	downloadPausedPath = dockerRoot + "/var/run/download-paused"
+
+	// pausePollInterval 暂停期间检查是否恢复的间隔
+	pausePollInterval = time.Second
+	// minBurst 令牌桶的最小容量，保证一次读取不会被拆得太碎
+	minBurst = 4 * 1024
+	// lowPriorityNice 低优先级下载时进程的 nice 值
+	lowPriorityNice = 10
+)
+
+// RateWindow 一个时间段内的限速，Window 格式与维护窗口相同
+type RateWindow struct {
+	Window string `json:"window"`
+	Rate   string `json:"rate"`
+}
+
+// parseRate 解析速度，格式与 parseSize 相同，可以带 /s，0 或空表示不限速
+func parseRate(s string) (int64, error) {
+	v := strings.TrimSpace(s)
+	if strings.HasSuffix(strings.ToLower(v), "/s") {
+		v = v[:len(v)-2]
+	}
+	n, err := parseSize(v)
+	if err != nil {
+		return 0, fmt.Errorf("无效的速度 %q（例如 512K、2M）", s)
+	}
+	return n, nil
+}
+
+// parseSize 解析字节数，支持 K、M、G 后缀（1024 进制）和可选的 B，空表示 0
+func parseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(v, "B")
+	if v == "" {
+		return 0, nil
+	}
+	unit := int64(1)
+	switch v[len(v)-1] {
+	case 'K':
+		unit = 1 << 10
+	case 'M':
+		unit = 1 << 20
+	case 'G':
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小 %q（例如 512M、2G）", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// formatRate 以 K/M 显示速度
+func formatRate(rate int64) string {
+	switch {
+	case rate >= 1<<20:
+		return strconv.FormatFloat(float64(rate)/(1<<20), 'f', -1, 64) + "M"
+	case rate >= 1<<10:
+		return strconv.FormatFloat(float64(rate)/(1<<10), 'f', -1, 64) + "K"
+	default:
+		return strconv.FormatInt(rate, 10)
+	}
+}
+
+// scheduledRate 解析后的限速时间段
+type scheduledRate struct {
+	window MaintenanceWindow
+	rate   int64
+}
+
+// rateSchedule 按时间段变化的限速，没有匹配的时间段时使用 base
+type rateSchedule struct {
+	base    int64
+	windows []scheduledRate
+	// loc 时间段使用的时区，为 nil 时使用 time.Local
+	loc *time.Location
+}
+
+// newRateSchedule 解析默认限速和时间段，前面的时间段优先，时间段按 windowLocation(timezone) 的时区计算
+func newRateSchedule(base string, windows []RateWindow, timezone string) (*rateSchedule, error) {
+	rate, err := parseRate(base)
+	if err != nil {
+		return nil, err
+	}
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, errorf(msgTimezoneInvalid, timezone)
+		}
+	}
+	s := &rateSchedule{base: rate, loc: windowLocation(timezone)}
+	for _, w := range windows {
+		if w.Window == "" {
+			return nil, fmt.Errorf("限速时间段缺少 window")
+		}
+		window, err := parseMaintenanceWindow(w.Window)
+		if err != nil {
+			return nil, err
+		}
+		rate, err := parseRate(w.Rate)
+		if err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, scheduledRate{window: window, rate: rate})
+	}
+	return s, nil
+}
+
+// rateAt 返回 t 时刻的限速，0 表示不限速
+func (s *rateSchedule) rateAt(t time.Time) int64 {
+	loc := s.loc
+	if loc == nil {
+		loc = time.Local
+	}
+	for _, w := range s.windows {
+		if w.window.Contains(t, loc) {
+			return w.rate
+		}
+	}
+	return s.base
+}
+
+// throttle 下载限速和暂停，同一进程的所有下载共享一个令牌桶
+type throttle struct {
+	schedule *rateSchedule
+	// paused 返回是否暂停下载
+	paused func() bool
+	now    func() time.Time
+	sleep  func(time.Duration)
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	// checked/wasPaused 缓存暂停状态，避免每次读取都检查
+	checked   time.Time
+	wasPaused bool
+}
+
+// newThrottle 创建使用系统时钟和暂停标记文件的限速器
+func newThrottle(schedule *rateSchedule, pausedPath string) *throttle {
+	return &throttle{
+		schedule: schedule,
+		paused:   func() bool { return fileExists(pausedPath) },
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// currentThrottle 下载使用的限速器，由 configureDownload 设置
+var currentThrottle = newThrottle(&rateSchedule{}, downloadPausedPath)
+
+// limit 返回当前的限速，0 表示不限速
+func (l *throttle) limit() int64 {
+	return l.schedule.rateAt(l.now())
+}
+
+// isPaused 返回是否暂停，状态最多每 pausePollInterval 检查一次
+func (l *throttle) isPaused() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if l.checked.IsZero() || now.Sub(l.checked) >= pausePollInterval {
+		l.wasPaused = l.paused()
+		l.checked = now
+	}
+	return l.wasPaused
+}
+
+// waitResume 暂停时阻塞到恢复下载
+func (l *throttle) waitResume(file string) {
+	if !l.isPaused() {
+		return
+	}
+	fmt.Println(T(msgDownloadPaused))
+	emit(Event{Type: eventDownloadPaused, File: file})
+	for l.isPaused() {
+		l.sleep(pausePollInterval)
+	}
+	fmt.Println(T(msgDownloadResumed))
+	emit(Event{Type: eventDownloadResumed, File: file})
+	// 暂停期间不积累令牌
+	l.mu.Lock()
+	l.last = time.Time{}
+	l.mu.Unlock()
+}
+
+// burst 令牌桶容量，最多积累一秒的流量
+func burst(rate int64) int64 {
+	if rate < minBurst {
+		return minBurst
+	}
+	return rate
+}
+
+// take 取出 n 字节的令牌，不足时等待；令牌可以透支，透支的部分用等待补足
+func (l *throttle) take(n int) {
+	l.mu.Lock()
+	now := l.now()
+	rate := l.schedule.rateAt(now)
+	if rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	if l.last.IsZero() {
+		l.tokens = float64(burst(rate))
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+		if capacity := float64(burst(rate)); l.tokens > capacity {
+			l.tokens = capacity
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait > 0 {
+		l.sleep(wait)
+	}
+}
+
+// errDownloadPaused 暂停时读取返回的错误，调用方关闭响应，waitResume 之后用 Range 请求继续
+// 暂停可能持续很久，不能占着连接等待，服务器和读超时都会断开空闲的连接
+var errDownloadPaused = errors.New("下载已暂停")
+
+// reader 返回限速和可暂停的 Reader，暂停时返回 errDownloadPaused
+func (l *throttle) reader(r io.Reader) io.Reader {
+	return &throttledReader{r: r, l: l}
+}
+
+type throttledReader struct {
+	r io.Reader
+	l *throttle
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.l.isPaused() {
+		return 0, errDownloadPaused
+	}
+	if rate := t.l.limit(); rate > 0 && int64(len(p)) > burst(rate) {
+		p = p[:burst(rate)]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.l.take(n)
+	}
+	return n, err
+}
+
+// lowerPriority 降低进程的 CPU 优先级，后台升级时不影响设备上的其他应用
+func lowerPriority() error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, lowPriorityNice)
+}
+
+// setDownloadPaused 创建或删除暂停标记
+func setDownloadPaused(path string, paused bool) error {
+	if !paused {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(time.Now().Format(time.RFC3339)+"\n"), 0644)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock 测试用的时钟，sleep 只推进时间
+type fakeClock struct {
+	now    time.Time
+	slept  time.Duration
+	onTick func()
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+	c.slept += d
+	if c.onTick != nil {
+		c.onTick()
+	}
+}
+
+// newFakeThrottle 创建使用假时钟的限速器
+func newFakeThrottle(schedule *rateSchedule, paused func() bool) (*throttle, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)}
+	if paused == nil {
+		paused = func() bool { return false }
+	}
+	return &throttle{schedule: schedule, paused: paused, now: clock.Now, sleep: clock.Sleep}, clock
+}
+
+// TestParseRate 测试解析速度
+func TestParseRate(t *testing.T) {
+	cases := map[string]int64{
+		"":        0,
+		"0":       0,
+		"1000":    1000,
+		"512K":    512 << 10,
+		"512kb":   512 << 10,
+		"1.5M":    3 << 19,
+		"2MB/s":   2 << 20,
+		" 1G ":    1 << 30,
+		"100KB/S": 100 << 10,
+	}
+	for in, want := range cases {
+		if got, err := parseRate(in); err != nil || got != want {
+			t.Errorf("parseRate(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"fast", "-1K", "K", "1T"} {
+		if _, err := parseRate(in); err == nil {
+			t.Errorf("parseRate(%q) expected error", in)
+		}
+	}
+	if got := formatRate(512 << 10); got != "512K" {
+		t.Errorf("formatRate = %s", got)
+	}
+	if got := formatRate(3 << 19); got != "1.5M" {
+		t.Errorf("formatRate = %s", got)
+	}
+}
+
+// TestRateSchedule 测试按时间段限速
+func TestRateSchedule(t *testing.T) {
+	s, err := newRateSchedule("1M", []RateWindow{{Window: "19:00-23:00", Rate: "128K"}, {Window: "01:00-07:00", Rate: "0"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour int) int64 { return s.rateAt(time.Date(2026, 1, 1, hour, 30, 0, 0, time.Local)) }
+	if at(12) != 1<<20 || at(20) != 128<<10 || at(3) != 0 {
+		t.Errorf("rates = %d %d %d", at(12), at(20), at(3))
+	}
+
+	if _, err := newRateSchedule("", []RateWindow{{Rate: "1M"}}, ""); err == nil {
+		t.Error("expected error for missing window")
+	}
+	if _, err := newRateSchedule("", []RateWindow{{Window: "25:00-26:00", Rate: "1M"}}, ""); err == nil {
+		t.Error("expected error for invalid window")
+	}
+	if _, err := newRateSchedule("", nil, "Mars/Olympus"); err == nil {
+		t.Error("expected error for invalid timezone")
+	}
+}
+
+// TestRateScheduleTimezone 测试时间段按设备时区计算，而不是进程的 time.Local
+func TestRateScheduleTimezone(t *testing.T) {
+	saved := windowLocation
+	t.Cleanup(func() { windowLocation = saved })
+	windowLocation = func(configured string) *time.Location {
+		return resolveLocation(func(string) string { return "" }, func(string) string { return "" }, configured)
+	}
+	s, err := newRateSchedule("1M", []RateWindow{{Window: "19:00-23:00", Rate: "128K"}}, "Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// UTC 12:30 是上海 20:30，UTC 20:30 是上海 04:30
+	if got := s.rateAt(time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)); got != 128<<10 {
+		t.Errorf("UTC 12:30: rate = %d", got)
+	}
+	if got := s.rateAt(time.Date(2026, 1, 1, 20, 30, 0, 0, time.UTC)); got != 1<<20 {
+		t.Errorf("UTC 20:30: rate = %d", got)
+	}
+
+	fixed := &rateSchedule{base: 1 << 20, windows: s.windows, loc: time.FixedZone("UTC+8", 8*3600)}
+	if got := fixed.rateAt(time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)); got != 128<<10 {
+		t.Errorf("FixedZone: rate = %d", got)
+	}
+}
+
+// TestThrottleRate 测试令牌桶限速：除了初始的一秒容量，之后按速度等待
+func TestThrottleRate(t *testing.T) {
+	l, clock := newFakeThrottle(&rateSchedule{base: 100 << 10}, nil)
+	r := l.reader(bytes.NewReader(make([]byte, 500<<10)))
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 500<<10 {
+		t.Fatalf("读取了 %d 字节", buf.Len())
+	}
+	if clock.slept < 3900*time.Millisecond || clock.slept > 4100*time.Millisecond {
+		t.Errorf("等待时间 %v，应约为 4s", clock.slept)
+	}
+
+	// 不限速时不等待
+	l, clock = newFakeThrottle(&rateSchedule{}, nil)
+	buf.Reset()
+	buf.ReadFrom(l.reader(bytes.NewReader(make([]byte, 1<<20))))
+	if clock.slept != 0 || buf.Len() != 1<<20 {
+		t.Errorf("不限速时等待了 %v", clock.slept)
+	}
+}
+
+// TestThrottlePause 测试暂停时读取返回 errDownloadPaused，waitResume 阻塞到恢复
+func TestThrottlePause(t *testing.T) {
+	events := captureEvents(t)
+	paused := true
+	l, clock := newFakeThrottle(&rateSchedule{}, func() bool { return paused })
+	clock.onTick = func() {
+		if clock.slept >= 5*time.Second {
+			paused = false
+		}
+	}
+	r := l.reader(strings.NewReader("hello"))
+	if _, err := r.Read(make([]byte, 8)); err != errDownloadPaused {
+		t.Fatalf("暂停时应返回 errDownloadPaused: %v", err)
+	}
+	l.waitResume("test.tar.gz")
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "hello" || clock.slept != 5*time.Second {
+		t.Errorf("读取 %q，等待 %v", buf.String(), clock.slept)
+	}
+	var types []string
+	for _, e := range events() {
+		types = append(types, e.Type)
+	}
+	if strings.Join(types, " ") != "download_paused download_resumed" {
+		t.Errorf("events = %v", types)
+	}
+}
+
+// TestSetDownloadPaused 测试暂停标记文件
+func TestSetDownloadPaused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "download-paused")
+	l := newThrottle(&rateSchedule{}, path)
+	if err := setDownloadPaused(path, true); err != nil {
+		t.Fatal(err)
+	}
+	if !l.isPaused() {
+		t.Error("应为暂停状态")
+	}
+	if err := setDownloadPaused(path, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("暂停标记未删除: %v", err)
+	}
+	if err := setDownloadPaused(path, false); err != nil {
+		t.Errorf("重复恢复不应出错: %v", err)
+	}
+}
+
+// TestConfigureDownloadRate 测试限速只在 --limit-rate 或低优先级模式下生效
+func TestConfigureDownloadRate(t *testing.T) {
+	useMirrorMode(t, false, false)
+	dir := t.TempDir()
+	config := filepath.Join(dir, "mirrors.json")
+	os.WriteFile(config, []byte(`{"rate_limit": "256K"}`), 0644)
+
+	cases := []struct {
+		opts DownloadOptions
+		want int64
+	}{
+		{DownloadOptions{Retries: -1}, 0},
+		{DownloadOptions{Retries: -1, LowPriority: true}, 256 << 10},
+		{DownloadOptions{Retries: -1, LowPriority: true, LimitRate: "2M"}, 2 << 20},
+	}
+	for _, c := range cases {
+		if err := configureDownload(c.opts, config, ""); err != nil {
+			t.Fatal(err)
+		}
+		if got := currentThrottle.limit(); got != c.want {
+			t.Errorf("%+v: limit = %d, want %d", c.opts, got, c.want)
+		}
+	}
+
+	os.WriteFile(config, []byte(`{"rate_limit": "fast"}`), 0644)
+	if err := configureDownload(DownloadOptions{Retries: -1}, config, ""); err == nil {
+		t.Error("expected error for invalid rate limit")
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	resolvConfPath = "/etc/resolv.conf"
+
+	// dohMessageType DNS-over-HTTPS 请求和响应的类型（RFC 8484）
+	dohMessageType = "application/dns-message"
+
+	dnsDialTimeout = 5 * time.Second
+)
+
+// androidDNSProps Android 的 DNS 服务器属性，由 netd 维护，较新的系统上可能为空
+var androidDNSProps = []string{"net.dns1", "net.dns2", "net.dns3", "net.dns4"}
+
+// defaultDNSServers 没有 resolv.conf 也读不到 Android 属性时使用的公共 DNS
+var defaultDNSServers = []string{"223.5.5.5", "119.29.29.29", "8.8.8.8"}
+
+// currentResolver 解析下载服务器的域名，nil 时使用 Go 默认的解析器，由 configureDNS 设置
+var currentResolver *net.Resolver
+
+// hostOverrides 静态域名映射，优先于 DNS 解析，由 configureDNS 设置
+var hostOverrides map[string]string
+
+// parseDNSServers 解析逗号分隔的 DNS 服务器，省略端口时使用 53
+func parseDNSServers(s string) ([]string, error) {
+	var servers []string
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil {
+			host, port = strings.Trim(entry, "[]"), "53"
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("无效的 DNS 服务器 %q，需要 IP 地址", entry)
+		}
+		servers = append(servers, net.JoinHostPort(host, port))
+	}
+	return servers, nil
+}
+
+// parseHostOverrides 解析逗号分隔的 host=ip 映射
+func parseHostOverrides(s string) (map[string]string, error) {
+	hosts := map[string]string{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, ip, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		ip = strings.Trim(strings.TrimSpace(ip), "[]")
+		if !ok || host == "" || net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("无效的域名映射 %q，格式为 host=ip", entry)
+		}
+		hosts[host] = ip
+	}
+	return hosts, nil
+}
+
+// parseDoHURL 校验 DNS-over-HTTPS 地址，主机必须是 IP，否则解析 DoH 服务器本身又需要 DNS
+func parseDoHURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 DoH 地址 %q: %v", s, err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("DoH 地址 %q 必须使用 https", s)
+	}
+	if net.ParseIP(u.Hostname()) == nil {
+		return nil, fmt.Errorf("DoH 地址 %q 的主机必须是 IP 地址", s)
+	}
+	if u.Path == "" {
+		u.Path = "/dns-query"
+	}
+	return u, nil
+}
+
+// hasNameserver 判断 resolv.conf 中是否配置了 DNS 服务器
+func hasNameserver(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return true
+		}
+	}
+	return false
+}
+
+// selectDNSServers 选择 DNS 服务器：参数或环境变量指定的优先，其次是 resolv.conf，
+// 没有 resolv.conf 时使用 Android 属性中的服务器，都没有时使用公共 DNS
+// 返回 nil 表示使用 Go 默认的解析器
+func selectDNSServers(dns string, getprop func(string) string, resolvConf string) ([]string, error) {
+	if dns != "" {
+		return parseDNSServers(dns)
+	}
+	if hasNameserver(resolvConf) {
+		return nil, nil
+	}
+	var props []string
+	for _, name := range androidDNSProps {
+		if v := getprop(name); v != "" {
+			props = append(props, v)
+		}
+	}
+	// 属性中的值由系统填写，格式不对的跳过，不影响安装
+	servers, err := parseDNSServers(strings.Join(props, ","))
+	if err != nil || len(servers) == 0 {
+		return parseDNSServers(strings.Join(defaultDNSServers, ","))
+	}
+	return servers, nil
+}
+
+// configureDNS 设置之后创建的 HTTP 客户端使用的 DNS 服务器、DoH 和静态域名映射
+// 静态编译的 Go 程序不经过 Android 的 netd 解析域名，设备上又通常没有 /etc/resolv.conf
+func configureDNS(flagOpts NetworkOptions, getenv, getprop func(string) string, resolvConf string) error {
+	pick := func(flagValue, name string) string {
+		if flagValue != "" {
+			return flagValue
+		}
+		return getenv(name)
+	}
+	hosts, err := parseHostOverrides(pick(flagOpts.Hosts, "DFA_HOSTS"))
+	if err != nil {
+		return err
+	}
+
+	var resolver *net.Resolver
+	if doh := pick(flagOpts.DoH, "DFA_DOH"); doh != "" {
+		u, err := parseDoHURL(doh)
+		if err != nil {
+			return err
+		}
+		resolver = &net.Resolver{PreferGo: true, Dial: dohDialer(u.String())}
+	} else {
+		servers, err := selectDNSServers(pick(flagOpts.DNS, "DFA_DNS"), getprop, resolvConf)
+		if err != nil {
+			return err
+		}
+		if len(servers) > 0 {
+			resolver = &net.Resolver{PreferGo: true, Dial: dnsDialer(servers)}
+		}
+	}
+	currentResolver, hostOverrides = resolver, hosts
+	return nil
+}
+
+// dnsDialer 忽略 Go 解析器选择的服务器地址，轮流连接指定的服务器
+// 解析器每次重试都会重新拨号，一个服务器不可用时下一次重试会换到其他服务器
+func dnsDialer(servers []string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	var next uint32
+	dialer := &net.Dialer{Timeout: dnsDialTimeout}
+	return func(ctx context.Context, network, _ string) (net.Conn, error) {
+		server := servers[int(atomic.AddUint32(&next, 1)-1)%len(servers)]
+		return dialer.DialContext(ctx, network, server)
+	}
+}
+
+// overrideAddr 将 addr 中有静态映射的主机替换为 IP
+func overrideAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip, ok := hostOverrides[strings.ToLower(host)]; ok {
+		return net.JoinHostPort(ip, port)
+	}
+	return addr
+}
+
+// dohDialer 返回经 DNS-over-HTTPS 查询的连接，DoH 服务器是 IP，直连且不使用代理
+func dohDialer(endpoint string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: RootCAsGlobal()},
+			DialContext:     (&net.Dialer{Timeout: dnsDialTimeout}).DialContext,
+		},
+	}
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return &dohConn{ctx: ctx, client: client, endpoint: endpoint}, nil
+	}
+}
+
+// dohConn 把 Go 解析器的 TCP 格式查询（2 字节长度 + DNS 消息）转为 DoH 请求
+// 它不是 net.PacketConn，解析器会按流式连接读写
+type dohConn struct {
+	ctx      context.Context
+	client   *http.Client
+	endpoint string
+	deadline time.Time
+	req      bytes.Buffer
+	resp     bytes.Buffer
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	return c.req.Write(b)
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.resp.Len() == 0 {
+		if err := c.roundTrip(); err != nil {
+			return 0, err
+		}
+	}
+	return c.resp.Read(b)
+}
+
+// roundTrip 发送已写入的一条查询，响应按 TCP 格式放入 resp
+func (c *dohConn) roundTrip() error {
+	if c.req.Len() < 2 {
+		return io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint16(c.req.Bytes()))
+	if c.req.Len() < 2+n {
+		return io.ErrUnexpectedEOF
+	}
+	msg := c.req.Next(2 + n)[2:]
+
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", dohMessageType)
+	req.Header.Set("Accept", dohMessageType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("DoH 请求失败: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 0xffff))
+	if err != nil {
+		return err
+	}
+	var size [2]byte
+	binary.BigEndian.PutUint16(size[:], uint16(len(body)))
+	c.resp.Write(size[:])
+	c.resp.Write(body)
+	return nil
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr("local") }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.endpoint) }
+func (c *dohConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { c.deadline = t; return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dnsStub 本地 DNS 服务器，A 记录查询返回 records 中的地址，AAAA 查询返回空结果
+type dnsStub struct {
+	records map[string]net.IP
+
+	mu      sync.Mutex
+	queries []string
+}
+
+// answer 根据查询生成响应，只保留头部和问题部分，去掉查询中的 EDNS 记录
+func (s *dnsStub) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	off := 12
+	var labels []string
+	for off < len(query) && query[off] != 0 {
+		n := int(query[off])
+		if off+1+n > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[off+1:off+1+n]))
+		off += 1 + n
+	}
+	off++
+	if off+4 > len(query) {
+		return nil
+	}
+	name := strings.ToLower(strings.Join(labels, "."))
+	qtype := binary.BigEndian.Uint16(query[off:])
+	off += 4
+
+	s.mu.Lock()
+	s.queries = append(s.queries, name)
+	s.mu.Unlock()
+
+	resp := append([]byte(nil), query[:off]...)
+	binary.BigEndian.PutUint16(resp[2:], 0x8580) // QR、AA、RD、RA
+	binary.BigEndian.PutUint16(resp[6:], 0)
+	binary.BigEndian.PutUint16(resp[8:], 0)
+	binary.BigEndian.PutUint16(resp[10:], 0)
+	ip, ok := s.records[name]
+	if !ok {
+		binary.BigEndian.PutUint16(resp[2:], 0x8583) // NXDOMAIN
+		return resp
+	}
+	if qtype == 1 {
+		binary.BigEndian.PutUint16(resp[6:], 1)
+		resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		resp = append(resp, ip.To4()...)
+	}
+	return resp
+}
+
+func (s *dnsStub) seen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// serveUDP 在本地 UDP 端口上提供 DNS 服务，返回地址
+func (s *dnsStub) serveUDP(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := s.answer(buf[:n]); resp != nil {
+				pc.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func noProps(string) string { return "" }
+
+func newHTTPServer(t *testing.T) (*httptest.Server, string) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	return srv, port
+}
+
+// TestDNSServerResolve 测试 --dns 指定的服务器用于下载请求
+func TestDNSServerResolve(t *testing.T) {
+	restoreNetwork(t)
+	stub := &dnsStub{records: map[string]net.IP{"fw.test": net.ParseIP("127.0.0.1")}}
+	addr := stub.serveUDP(t)
+	_, port := newHTTPServer(t)
+
+	if err := configureDNS(NetworkOptions{DNS: addr}, envMap(nil), noProps, "/nonexistent"); err != nil {
+		t.Fatal(err)
+	}
+	if body, err := get("http://fw.test:" + port + "/"); err != nil || body != "ok" {
+		t.Fatalf("body = %q, err = %v", body, err)
+	}
+	if seen := stub.seen(); len(seen) == 0 || seen[0] != "fw.test" {
+		t.Errorf("queries = %v", seen)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := currentResolver.LookupHost(ctx, "missing.test"); err == nil {
+		t.Error("expected error for unknown host")
+	}
+}
+
+// TestDNSFromEnv 测试 DFA_DNS 环境变量
+func TestDNSFromEnv(t *testing.T) {
+	restoreNetwork(t)
+	stub := &dnsStub{records: map[string]net.IP{"fw.test": net.ParseIP("127.0.0.1")}}
+	addr := stub.serveUDP(t)
+
+	if err := configureDNS(NetworkOptions{}, envMap(map[string]string{"DFA_DNS": addr}), noProps, "/nonexistent"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := currentResolver.LookupHost(ctx, "fw.test")
+	if err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("addrs = %v, err = %v", addrs, err)
+	}
+}
+
+// TestDoHResolve 测试 DNS-over-HTTPS 查询
+func TestDoHResolve(t *testing.T) {
+	restoreNetwork(t)
+	stub := &dnsStub{records: map[string]net.IP{"fw.test": net.ParseIP("127.0.0.1")}}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/dns-query" || r.Header.Get("Content-Type") != dohMessageType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", dohMessageType)
+		w.Write(stub.answer(query))
+	}))
+	defer srv.Close()
+	bundle := filepath.Join(t.TempDir(), "doh.pem")
+	writeServerCert(t, srv, bundle)
+
+	// 证书在 DoH 客户端创建前设置
+	if err := configureNetwork(NetworkOptions{CABundle: bundle, DoH: srv.URL}, envMap(nil)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := currentResolver.LookupHost(ctx, "fw.test")
+	if err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("addrs = %v, err = %v", addrs, err)
+	}
+	if seen := stub.seen(); len(seen) == 0 {
+		t.Error("DoH server received no queries")
+	}
+}
+
+// TestHostOverride 测试静态域名映射优先于 DNS
+func TestHostOverride(t *testing.T) {
+	restoreNetwork(t)
+	stub := &dnsStub{records: map[string]net.IP{}}
+	addr := stub.serveUDP(t)
+	_, port := newHTTPServer(t)
+
+	opts := NetworkOptions{DNS: addr, Hosts: "FW.test=127.0.0.1"}
+	if err := configureDNS(opts, envMap(nil), noProps, "/nonexistent"); err != nil {
+		t.Fatal(err)
+	}
+	if body, err := get("http://fw.test:" + port + "/"); err != nil || body != "ok" {
+		t.Fatalf("body = %q, err = %v", body, err)
+	}
+	if seen := stub.seen(); len(seen) != 0 {
+		t.Errorf("overridden host should not be resolved, queries = %v", seen)
+	}
+}
+
+// TestSelectDNSServers 测试 DNS 服务器的选择顺序
+func TestSelectDNSServers(t *testing.T) {
+	dir := t.TempDir()
+	withNS := filepath.Join(dir, "resolv.conf")
+	os.WriteFile(withNS, []byte("# local\nsearch lan\nnameserver 192.168.1.1\n"), 0644)
+	withoutNS := filepath.Join(dir, "empty.conf")
+	os.WriteFile(withoutNS, []byte("search lan\n"), 0644)
+	props := envMap(map[string]string{"net.dns1": "10.0.0.1", "net.dns2": "fe80::1"})
+	badProps := envMap(map[string]string{"net.dns1": "not-an-ip"})
+
+	tests := []struct {
+		name       string
+		dns        string
+		getprop    func(string) string
+		resolvConf string
+		want       []string
+	}{
+		{"flag", "8.8.8.8, [2001:db8::1]:5353", props, withNS, []string{"8.8.8.8:53", "[2001:db8::1]:5353"}},
+		{"resolv.conf", "", props, withNS, nil},
+		{"android props", "", props, withoutNS, []string{"10.0.0.1:53", "[fe80::1]:53"}},
+		{"missing resolv.conf", "", props, filepath.Join(dir, "missing"), []string{"10.0.0.1:53", "[fe80::1]:53"}},
+		{"default", "", noProps, withoutNS, []string{"223.5.5.5:53", "119.29.29.29:53", "8.8.8.8:53"}},
+		{"invalid props", "", badProps, withoutNS, []string{"223.5.5.5:53", "119.29.29.29:53", "8.8.8.8:53"}},
+	}
+	for _, tt := range tests {
+		got, err := selectDNSServers(tt.dns, tt.getprop, tt.resolvConf)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: servers = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := selectDNSServers("dns.google", noProps, withNS); err == nil {
+		t.Error("expected error for hostname DNS server")
+	}
+}
+
+// TestDNSOptionsInvalid 测试无效的域名映射和 DoH 地址
+func TestDNSOptionsInvalid(t *testing.T) {
+	restoreNetwork(t)
+	invalid := []NetworkOptions{
+		{Hosts: "fw.test"},
+		{Hosts: "fw.test=example.com"},
+		{Hosts: "=1.2.3.4"},
+		{DoH: "http://1.1.1.1/dns-query"},
+		{DoH: "https://dns.google/dns-query"},
+	}
+	for _, opts := range invalid {
+		if err := configureDNS(opts, envMap(nil), noProps, "/nonexistent"); err == nil {
+			t.Errorf("%+v: expected error", opts)
+		}
+	}
+
+	hosts, err := parseHostOverrides("a.test=1.2.3.4, B.test=[2001:db8::1]")
+	want := map[string]string{"a.test": "1.2.3.4", "b.test": "2001:db8::1"}
+	if err != nil || !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts = %v, err = %v", hosts, err)
+	}
+	if u, err := parseDoHURL("https://223.5.5.5"); err != nil || u.String() != "https://223.5.5.5/dns-query" {
+		t.Errorf("doh = %v, err = %v", u, err)
+	}
+}
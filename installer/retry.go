@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// 下载错误的类别，用于事件和决定是否重试
+const (
+	errKindDNS        = "dns"
+	errKindTLS        = "tls"
+	errKindTimeout    = "timeout"
+	errKindConnection = "connection"
+	errKindClient     = "http_4xx"
+	errKindServer     = "http_5xx"
+	errKindRateLimit  = "http_429"
+	errKindChecksum   = "checksum"
+	errKindOther      = "other"
+)
+
+// RetryPolicy 同一个下载源的重试策略
+type RetryPolicy struct {
+	// Attempts 每个下载源最多尝试的次数，1 表示不重试
+	Attempts int
+	// BaseDelay 第一次重试前的等待时间，之后每次翻倍
+	BaseDelay time.Duration
+	// MaxDelay 单次等待的上限，Retry-After 不受此限制
+	MaxDelay time.Duration
+	// Budget 下载一个文件时所有重试等待的总时间，用完后换下一个下载源
+	Budget time.Duration
+}
+
+// defaultRetryPolicy 默认每个下载源最多尝试 3 次
+var defaultRetryPolicy = RetryPolicy{Attempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second, Budget: 2 * time.Minute}
+
+var (
+	// retryPolicy 当前的重试策略，由 configureDownload 设置
+	retryPolicy = defaultRetryPolicy
+	// retrySleep 重试前等待，测试中替换
+	retrySleep = time.Sleep
+)
+
+// httpStatusError 非 200 的 HTTP 响应，RetryAfter 来自 Retry-After 响应头
+type httpStatusError struct {
+	Code       int
+	RetryAfter time.Duration
+}
+
+// newHTTPStatusError 根据响应创建错误
+func newHTTPStatusError(resp *http.Response, now time.Time) *httpStatusError {
+	return &httpStatusError{Code: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), now)}
+}
+
+func (e *httpStatusError) Error() string {
+	return T(msgHTTPStatus, e.Code)
+}
+
+// parseRetryAfter 解析秒数或 HTTP 日期格式的 Retry-After，无效时返回 0
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// classifyError 返回错误的类别，以及在同一个下载源上重试是否可能成功
+// 超时、连接中断、5xx 和 429 是临时错误；域名不存在、证书错误和其他 4xx 换下载源也许能成功，重试没有意义
+func classifyError(err error) (kind string, transient bool) {
+	var status *httpStatusError
+	if errors.As(err, &status) {
+		switch {
+		case status.Code == http.StatusTooManyRequests:
+			return errKindRateLimit, true
+		case status.Code == http.StatusRequestTimeout:
+			return errKindClient, true
+		case status.Code >= 500:
+			return errKindServer, status.Code != http.StatusNotImplemented
+		default:
+			return errKindClient, false
+		}
+	}
+	var mismatch *checksumMismatchError
+	if errors.As(err, &mismatch) {
+		return errKindChecksum, false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return errKindDNS, dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		verification     *tls.CertificateVerificationError
+		record           tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) ||
+		errors.As(err, &verification) || errors.As(err, &record) {
+		return errKindTLS, false
+	}
+	if errors.Is(err, context.Canceled) {
+		return errKindOther, false
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return errKindTimeout, true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errRangeMismatch) {
+		return errKindConnection, true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return errKindConnection, true
+	}
+	return errKindOther, false
+}
+
+// backoff 第 attempt 次失败后的等待时间，在 [d/2, d] 之间随机，避免多台设备同时重试
+func backoff(p RetryPolicy, attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryBudget 下载一个文件时剩余的重试等待时间
+type retryBudget struct {
+	remaining time.Duration
+}
+
+// take 返回第 attempt 次失败后的等待时间，服务器指定了 Retry-After 时以它为准
+// 剩余额度不够时返回 false
+func (b *retryBudget) take(p RetryPolicy, attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	d := backoff(p, attempt)
+	if retryAfter > 0 {
+		d = retryAfter
+	}
+	if d > b.remaining {
+		return 0, false
+	}
+	b.remaining -= d
+	return d, true
+}
+
+// retryAfterOf 返回错误中服务器要求的等待时间
+func retryAfterOf(err error) time.Duration {
+	var status *httpStatusError
+	if errors.As(err, &status) {
+		return status.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// useRetryPolicy 在测试期间使用 policy，重试不实际等待，返回记录的等待时间
+func useRetryPolicy(t *testing.T, policy RetryPolicy) func() []time.Duration {
+	savedPolicy, savedSleep := retryPolicy, retrySleep
+	var mu sync.Mutex
+	var delays []time.Duration
+	retryPolicy = policy
+	retrySleep = func(d time.Duration) {
+		mu.Lock()
+		delays = append(delays, d)
+		mu.Unlock()
+	}
+	t.Cleanup(func() { retryPolicy, retrySleep = savedPolicy, savedSleep })
+	return func() []time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]time.Duration(nil), delays...)
+	}
+}
+
+// flakyServer 前 failures 次请求按 fail 处理，之后返回 content（支持 Range）
+func flakyServer(t *testing.T, content []byte, failures int, fail func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n := len(requests)
+		requests = append(requests, r.Header.Get("Range"))
+		mu.Unlock()
+		if n < failures {
+			fail(w, r)
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+// cutConnection 发送一半内容后断开连接
+func cutConnection(content []byte) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestClassifyError 测试错误分类
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		kind      string
+		transient bool
+	}{
+		{"503", errorf(msgHTTPRequestFailed, &httpStatusError{Code: 503}), errKindServer, true},
+		{"501", &httpStatusError{Code: 501}, errKindServer, false},
+		{"429", &httpStatusError{Code: 429}, errKindRateLimit, true},
+		{"404", &httpStatusError{Code: 404}, errKindClient, false},
+		{"408", &httpStatusError{Code: 408}, errKindClient, true},
+		{"nxdomain", &net.DNSError{Err: "no such host", Name: "fw.test", IsNotFound: true}, errKindDNS, false},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "fw.test", IsTimeout: true}, errKindDNS, true},
+		{"unknown ca", errorf(msgHTTPRequestFailed, x509.UnknownAuthorityError{}), errKindTLS, false},
+		{"hostname", x509.HostnameError{Host: "fw.test", Certificate: &x509.Certificate{}}, errKindTLS, false},
+		{"deadline", context.DeadlineExceeded, errKindTimeout, true},
+		{"reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, errKindConnection, true},
+		{"refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, errKindConnection, true},
+		{"truncated", errorf(msgReadBodyFailed, io.ErrUnexpectedEOF), errKindConnection, true},
+		{"checksum", &checksumMismatchError{Expected: "a", Actual: "b"}, errKindChecksum, false},
+		{"canceled", context.Canceled, errKindOther, false},
+		{"disk", errorf(msgCreateFileFailed, os.ErrPermission), errKindOther, false},
+	}
+	for _, tt := range tests {
+		kind, transient := classifyError(tt.err)
+		if kind != tt.kind || transient != tt.transient {
+			t.Errorf("%s: classifyError = %s/%v, want %s/%v", tt.name, kind, transient, tt.kind, tt.transient)
+		}
+	}
+	if key := messageKey(&httpStatusError{Code: 503}); key != msgHTTPStatus {
+		t.Errorf("messageKey = %s", key)
+	}
+}
+
+// TestBackoff 测试指数退避、随机抖动和总时间额度
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := backoff(p, attempt); d < max/2 || d > max {
+				t.Fatalf("attempt %d: backoff = %v, want [%v, %v]", attempt, d, max/2, max)
+			}
+		}
+	}
+
+	budget := &retryBudget{remaining: 10 * time.Second}
+	if d, ok := budget.take(p, 1, 7*time.Second); !ok || d != 7*time.Second {
+		t.Errorf("Retry-After: %v %v", d, ok)
+	}
+	if _, ok := budget.take(p, 1, 4*time.Second); ok {
+		t.Error("超出额度时不应重试")
+	}
+	if d, ok := budget.take(p, 1, 0); !ok || d > time.Second {
+		t.Errorf("剩余额度内应继续重试: %v %v", d, ok)
+	}
+}
+
+// TestParseRetryAfter 测试 Retry-After 的两种格式
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"soon":                          0,
+		"Fri, 02 Jan 2026 03:05:05 GMT": time.Minute,
+		"Fri, 02 Jan 2026 03:00:00 GMT": 0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+// TestDownloadFileRetry 测试临时错误在同一个下载源上重试
+func TestDownloadFileRetry(t *testing.T) {
+	content := []byte("docker package")
+
+	t.Run("503 后成功", func(t *testing.T) {
+		useMirrorMode(t, false, false)
+		delays := useRetryPolicy(t, RetryPolicy{Attempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Budget: time.Minute})
+		srv, requests := flakyServer(t, content, 2, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: srv.URL})
+		events := captureEvents(t)
+
+		dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+		if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", sha256Hex(content)); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(requests()); n != 3 {
+			t.Errorf("requests = %d", n)
+		}
+		if d := delays(); len(d) != 2 || d[0] > 100*time.Millisecond || d[1] < 100*time.Millisecond {
+			t.Errorf("delays = %v", d)
+		}
+		var retries []string
+		for _, ev := range events() {
+			if ev.Type == eventRetry {
+				retries = append(retries, fmt.Sprintf("%d/%d %s", ev.Index, ev.Total, ev.Reason))
+			}
+		}
+		if strings.Join(retries, ",") != "2/3 http_5xx,3/3 http_5xx" {
+			t.Errorf("retry events = %v", retries)
+		}
+		if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+			t.Error("完成后不应留下 .part")
+		}
+	})
+
+	t.Run("Retry-After", func(t *testing.T) {
+		useMirrorMode(t, false, false)
+		delays := useRetryPolicy(t, RetryPolicy{Attempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Budget: time.Minute})
+		srv, _ := flakyServer(t, content, 1, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: srv.URL})
+
+		if err := downloadFile(http.DefaultClient, filepath.Join(t.TempDir(), "f"), "f", ""); err != nil {
+			t.Fatal(err)
+		}
+		if d := delays(); len(d) != 1 || d[0] != 7*time.Second {
+			t.Errorf("delays = %v", d)
+		}
+	})
+
+	t.Run("超出额度换下载源", func(t *testing.T) {
+		useMirrorMode(t, false, false)
+		delays := useRetryPolicy(t, RetryPolicy{Attempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Budget: time.Minute})
+		busy, busyRequests := flakyServer(t, content, 10, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		good, _ := flakyServer(t, content, 0, nil)
+		useTestMirrors(t, downloadMirror{Name: "busy", BaseURL: busy.URL}, downloadMirror{Name: "good", BaseURL: good.URL})
+
+		if err := downloadFile(http.DefaultClient, filepath.Join(t.TempDir(), "f"), "f", ""); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(busyRequests()); n != 1 || len(delays()) != 0 {
+			t.Errorf("busy requests = %d, delays = %v", n, delays())
+		}
+	})
+
+	t.Run("永久错误不重试", func(t *testing.T) {
+		useMirrorMode(t, false, false)
+		useRetryPolicy(t, RetryPolicy{Attempts: 3, Budget: time.Minute})
+		srv, requests := flakyServer(t, content, 10, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		})
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: srv.URL})
+
+		err := downloadFile(http.DefaultClient, filepath.Join(t.TempDir(), "f"), "f", "")
+		if err == nil || len(requests()) != 1 {
+			t.Errorf("err = %v, requests = %d", err, len(requests()))
+		}
+	})
+
+	t.Run("用完重试次数", func(t *testing.T) {
+		useMirrorMode(t, false, false)
+		useRetryPolicy(t, RetryPolicy{Attempts: 3, Budget: time.Minute})
+		srv, requests := flakyServer(t, content, 10, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: srv.URL})
+
+		err := downloadFile(http.DefaultClient, filepath.Join(t.TempDir(), "f"), "f", "")
+		var status *httpStatusError
+		if !errors.As(err, &status) || status.Code != 502 || len(requests()) != 3 {
+			t.Errorf("err = %v, requests = %d", err, len(requests()))
+		}
+	})
+}
+
+// TestDownloadFileResume 测试连接中断后从已下载的位置继续
+func TestDownloadFileResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	t.Run("断点续传", func(t *testing.T) {
+		useMirrorMode(t, false, false)
+		useRetryPolicy(t, RetryPolicy{Attempts: 2, Budget: time.Minute})
+		srv, requests := flakyServer(t, content, 1, cutConnection(content))
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: srv.URL})
+
+		dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+		if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", sha256Hex(content)); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(dest); !bytes.Equal(data, content) {
+			t.Errorf("内容不一致，大小 %d", len(data))
+		}
+		if got := requests(); len(got) != 2 || got[0] != "" || got[1] != fmt.Sprintf("bytes=%d-", len(content)/2) {
+			t.Errorf("requests = %q", got)
+		}
+	})
+
+	t.Run("服务器不支持 Range", func(t *testing.T) {
+		useMirrorMode(t, false, false)
+		useRetryPolicy(t, RetryPolicy{Attempts: 2, Budget: time.Minute})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(content)
+		}))
+		defer srv.Close()
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: srv.URL})
+
+		dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+		os.WriteFile(dest+".part", []byte("stale"), 0644)
+		if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", sha256Hex(content)); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(dest); !bytes.Equal(data, content) {
+			t.Errorf("内容不一致，大小 %d", len(data))
+		}
+	})
+
+	t.Run("上次中断的文件", func(t *testing.T) {
+		useMirrorMode(t, false, false)
+		useRetryPolicy(t, RetryPolicy{Attempts: 1, Budget: time.Minute})
+		srv, requests := flakyServer(t, content, 0, nil)
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: srv.URL})
+
+		dir := t.TempDir()
+		// 有 SHA256 时继续使用上次的 .part
+		dest := filepath.Join(dir, "docker.tar.gz")
+		os.WriteFile(dest+".part", content[:1000], 0644)
+		if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", sha256Hex(content)); err != nil {
+			t.Fatal(err)
+		}
+		// 没有 SHA256 时从头下载
+		version := filepath.Join(dir, "version.txt")
+		os.WriteFile(version+".part", []byte("stale"), 0644)
+		if err := downloadFile(http.DefaultClient, version, "version.txt", ""); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(version); !bytes.Equal(data, content) {
+			t.Errorf("内容不一致，大小 %d", len(data))
+		}
+		if got := requests(); len(got) != 2 || got[0] != "bytes=1000-" || got[1] != "" {
+			t.Errorf("requests = %q", got)
+		}
+	})
+
+	t.Run("已完整下载", func(t *testing.T) {
+		useMirrorMode(t, false, false)
+		useRetryPolicy(t, RetryPolicy{Attempts: 1, Budget: time.Minute})
+		srv, _ := flakyServer(t, content, 0, nil)
+		useTestMirrors(t, downloadMirror{Name: "cdn", BaseURL: srv.URL})
+
+		dest := filepath.Join(t.TempDir(), "docker.tar.gz")
+		os.WriteFile(dest+".part", content, 0644)
+		if err := downloadFile(http.DefaultClient, dest, "docker.tar.gz", sha256Hex(content)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// TestParseContentRange 测试 Content-Range 的解析
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value        string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 100-199/*", 100, -1, true},
+		{"bytes */200", -1, 200, true},
+		{"bytes */*", 0, 0, false},
+		{"items 0-1/2", 0, 0, false},
+		{"bytes x-1/2", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, total, ok := parseContentRange(tt.value)
+		if ok != tt.ok || (ok && (start != tt.start || total != tt.total)) {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v", tt.value, start, total, ok)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+var (
+	// installerVersion 由 Makefile 通过 -ldflags "-X main.installerVersion=..." 写入，开发构建为 dev
+	installerVersion = "dev"
+	// installerPublicKey 校验 installer 签名的 ed25519 公钥（base64），为空时拒绝更新 installer，除非指定 -allow-unsigned
+	installerPublicKey = ""
+)
+
+// selfUpdatedEnv 重新执行时设置，避免新版本仍低于要求时反复更新
+const selfUpdatedEnv = "DFA_SELF_UPDATED"
+
+// installerFileName 发布目录中对应架构的 installer 文件名
+func installerFileName(arch string) string {
+	return "install-docker-" + arch
+}
+
+// selfUpdateNeeded 判断当前 installer 是否需要更新，required 表示低于最低版本，不能继续安装
+func selfUpdateNeeded(current string, info *VersionInfo) (need, required bool) {
+	if current == "dev" || info.InstallerVersion == "" || info.InstallerSHA256 == "" {
+		return false, false
+	}
+	need = compareVersions(current, info.InstallerVersion) < 0
+	required = info.InstallerMinVersion != "" && compareVersions(current, info.InstallerMinVersion) < 0
+	return need, required
+}
+
+// belowMinVersion 返回 current 是否低于发布要求的最低版本，开发版本不检查
+func belowMinVersion(current string, info *VersionInfo) bool {
+	return current != "dev" && info.InstallerMinVersion != "" && compareVersions(current, info.InstallerMinVersion) < 0
+}
+
+// verifyInstallerSignature 用 ed25519 公钥校验 installer，sig 为 base64 编码的签名
+func verifyInstallerSignature(path string, sig []byte, publicKey string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return verifySignature(data, sig, publicKey)
+}
+
+// verifySignature 用 ed25519 公钥（base64）校验 data，sig 为 base64 编码的签名
+func verifySignature(data, sig []byte, publicKey string) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errorf(msgSignatureKeyInvalid)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return errorf(msgSignatureInvalid, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), data, signature) {
+		return errorf(msgSignatureMismatch)
+	}
+	return nil
+}
+
+// selfUpdater 下载新的 installer 并替换正在运行的可执行文件
+type selfUpdater struct {
+	// exe 正在运行的 installer
+	exe       string
+	publicKey string
+	// allowUnsigned 没有公钥时只校验 SHA256，否则拒绝更新
+	allowUnsigned bool
+
+	// fetch 下载发布目录中的文件到 dest，sha 为空时不校验
+	fetch func(name, dest, sha string) error
+	// probe 运行新 installer 的 version 命令，确认能在本机执行
+	probe func(path string) (string, error)
+}
+
+// newSelfUpdater 创建替换当前可执行文件的 updater
+func newSelfUpdater(client *http.Client, allowUnsigned bool) (*selfUpdater, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, err
+	}
+	return &selfUpdater{
+		exe:           exe,
+		publicKey:     installerPublicKey,
+		allowUnsigned: allowUnsigned,
+		fetch: func(name, dest, sha string) error {
+			// 与安装包一样优先使用本地文件
+			if local := filepath.Join(localInstallDir, name); fileExists(local) {
+				fmt.Println(T(msgSelfUpdateLocal, local))
+				if err := copyFile(local, dest); err != nil {
+					return err
+				}
+				if sha != "" {
+					return verifySHA256(dest, sha)
+				}
+				return nil
+			}
+			return downloadFile(client, dest, name, sha)
+		},
+		probe: func(path string) (string, error) {
+			out, err := exec.Command(path, "version").Output()
+			return strings.TrimSpace(string(out)), err
+		},
+	}, nil
+}
+
+// Update 下载、校验并原子替换 installer
+// 新文件写在可执行文件同目录，保证 rename 不跨文件系统
+func (u *selfUpdater) Update(info *VersionInfo) error {
+	if u.publicKey == "" && !u.allowUnsigned {
+		return errorf(msgSelfUpdateNoKey)
+	}
+	name := installerFileName(info.Architecture)
+	tmp := filepath.Join(filepath.Dir(u.exe), "."+filepath.Base(u.exe)+".new")
+	defer os.Remove(tmp)
+
+	fmt.Println(T(msgSelfUpdateFetching, name))
+	if err := u.fetch(name, tmp, info.InstallerSHA256); err != nil {
+		return errorf(msgSelfUpdateFetchFail, name, err)
+	}
+
+	if u.publicKey != "" {
+		sigPath := tmp + ".sig"
+		defer os.Remove(sigPath)
+		if err := u.fetch(name+".sig", sigPath, ""); err != nil {
+			return errorf(msgSelfUpdateFetchFail, name+".sig", err)
+		}
+		sig, err := os.ReadFile(sigPath)
+		if err != nil {
+			return err
+		}
+		if err := verifyInstallerSignature(tmp, sig, u.publicKey); err != nil {
+			return err
+		}
+		fmt.Println(T(msgSignatureOK))
+	} else {
+		fmt.Println(T(msgSelfUpdateUnsigned))
+	}
+
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	version, err := u.probe(tmp)
+	if err != nil {
+		return errorf(msgSelfUpdateProbeFail, err)
+	}
+	if version != info.InstallerVersion {
+		return errorf(msgSelfUpdateVersion, version, info.InstallerVersion)
+	}
+
+	if err := os.Rename(tmp, u.exe); err != nil {
+		return errorf(msgSelfUpdateReplace, u.exe, err)
+	}
+	return nil
+}
+
+// reexec 以相同参数执行更新后的 installer，成功时不会返回
+func reexec(exe, version string) error {
+	env := append(os.Environ(), selfUpdatedEnv+"="+version)
+	return syscall.Exec(exe, os.Args, env)
+}
+
+// checkSelfUpdate 安装开始前检查 installer 版本
+// 有新版本时更新并重新执行；低于最低版本且无法更新时返回错误，allowUnsigned 见 selfUpdater
+func checkSelfUpdate(client *http.Client, info *VersionInfo, allowUnsigned bool) error {
+	need, required := selfUpdateNeeded(installerVersion, info)
+	if !need {
+		return nil
+	}
+	if updated := os.Getenv(selfUpdatedEnv); updated != "" {
+		// 已经更新过一次仍不满足，说明发布信息有误，不再循环
+		if required {
+			return errorf(msgSelfUpdateStillOld, updated, info.InstallerMinVersion)
+		}
+		return nil
+	}
+
+	fmt.Println(T(msgSelfUpdateAvailable, info.InstallerVersion, installerVersion))
+	err := func() error {
+		u, err := newSelfUpdater(client, allowUnsigned)
+		if err != nil {
+			return err
+		}
+		if err := u.Update(info); err != nil {
+			return err
+		}
+		fmt.Println(T(msgSelfUpdateReexec, info.InstallerVersion))
+		return reexec(u.exe, info.InstallerVersion)
+	}()
+	if required {
+		return errorf(msgSelfUpdateRequired, installerVersion, info.InstallerMinVersion, err)
+	}
+	fmt.Println(T(msgSelfUpdateWarn, err))
+	return nil
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:    "self-update",
+		usage:   msgUsageSelfUpdate,
+		network: networkRequired,
+		run:     runSelfUpdate,
+	})
+	registerSubcommand(&subcommand{
+		name:  "version",
+		usage: msgUsageVersion,
+		run: func(args []string) error {
+			fmt.Println(installerVersion)
+			return nil
+		},
+	})
+}
+
+// runSelfUpdate 实现 self-update 子命令
+func runSelfUpdate(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	channel := fs.String("channel", "", "发布通道，默认使用 update.json 中的设置")
+	check := fs.Bool("check", false, "只检查，不更新")
+	force := fs.Bool("force", false, "版本相同也重新下载")
+	allowUnsigned := fs.Bool("allow-unsigned", false, "installer 没有发布公钥时只校验 SHA256")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if installerPublicKey == "" && !*allowUnsigned && !*check {
+		return errorf(msgSelfUpdateNoKey)
+	}
+	if *channel == "" {
+		*channel = defaultChannel
+		if config, err := loadUpdateConfig(updateConfigPath); err == nil {
+			*channel = config.Channel
+		}
+	}
+
+	client := CreateHTTPClient()
+	info, err := fetchManifest(client, *channel)
+	if err != nil {
+		return err
+	}
+	if info.InstallerVersion == "" || info.InstallerSHA256 == "" {
+		return errorf(msgSelfUpdateNoInfo, manifestName(*channel))
+	}
+
+	fmt.Println(T(msgSelfUpdateCurrent, installerVersion))
+	fmt.Println(T(msgSelfUpdateLatest, info.InstallerVersion))
+	if info.InstallerMinVersion != "" {
+		fmt.Println(T(msgSelfUpdateMinimum, info.InstallerMinVersion))
+	}
+	need, _ := selfUpdateNeeded(installerVersion, info)
+	if !need && !*force {
+		fmt.Println(T(msgSelfUpdateUpToDate))
+		return nil
+	}
+	if *check {
+		fmt.Println(T(msgSelfUpdateCheckHint))
+		return nil
+	}
+
+	u, err := newSelfUpdater(client, *allowUnsigned)
+	if err != nil {
+		return err
+	}
+	if err := u.Update(info); err != nil {
+		return err
+	}
+	fmt.Println(T(msgSelfUpdateDone, u.exe, info.InstallerVersion))
+	return nil
+}
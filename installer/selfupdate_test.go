@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParseVersionInfo_Installer 测试解析 installer 版本字段
+func TestParseVersionInfo_Installer(t *testing.T) {
+	content := `VERSION=28.0.1.10
+DOCKER_SHA256=abc123
+BIN_ARM64_SHA256=def456
+INSTALLER_VERSION=28.0.1.10
+INSTALLER_MIN_VERSION=28.0.1.05
+INSTALLER_ARM64_SHA256=aaa
+INSTALLER_X86_64_SHA256=bbb
+`
+	info, err := parseVersionInfo([]byte(content), "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.InstallerVersion != "28.0.1.10" || info.InstallerMinVersion != "28.0.1.05" || info.InstallerSHA256 != "aaa" {
+		t.Errorf("installer 字段解析错误: %+v", info)
+	}
+}
+
+// TestSelfUpdateNeeded 测试是否需要更新 installer
+func TestSelfUpdateNeeded(t *testing.T) {
+	info := &VersionInfo{InstallerVersion: "28.0.1.10", InstallerMinVersion: "28.0.1.05", InstallerSHA256: "aaa"}
+	tests := []struct {
+		current        string
+		need, required bool
+	}{
+		{"28.0.1.10", false, false},
+		{"28.0.1.11", false, false},
+		{"28.0.1.08", true, false},
+		{"28.0.1.03", true, true},
+		{"dev", false, false},
+	}
+	for _, tt := range tests {
+		need, required := selfUpdateNeeded(tt.current, info)
+		if need != tt.need || required != tt.required {
+			t.Errorf("%s: need=%v required=%v，期望 %v %v", tt.current, need, required, tt.need, tt.required)
+		}
+	}
+
+	// 旧的 version.txt 没有 installer 字段
+	if need, _ := selfUpdateNeeded("28.0.1.03", &VersionInfo{Version: "28.0.1.10"}); need {
+		t.Error("没有 installer 版本信息时不应更新")
+	}
+}
+
+// TestBelowMinVersion 测试离线安装时的最低版本检查，不依赖 installer 的下载信息
+func TestBelowMinVersion(t *testing.T) {
+	info := &VersionInfo{Version: "28.0.1.10", InstallerMinVersion: "28.0.1.05"}
+	for current, want := range map[string]bool{"28.0.1.03": true, "28.0.1.05": false, "28.0.1.10": false, "dev": false} {
+		if got := belowMinVersion(current, info); got != want {
+			t.Errorf("belowMinVersion(%s) = %v，期望 %v", current, got, want)
+		}
+	}
+	if belowMinVersion("28.0.1.03", &VersionInfo{Version: "28.0.1.10"}) {
+		t.Error("没有最低版本时不应拒绝")
+	}
+}
+
+// TestVerifyInstallerSignature 测试 ed25519 签名校验
+func TestVerifyInstallerSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "install-docker")
+	os.WriteFile(path, []byte("installer"), 0755)
+
+	key := base64.StdEncoding.EncodeToString(pub)
+	sig := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("installer"))) + "\n")
+	if err := verifyInstallerSignature(path, sig, key); err != nil {
+		t.Errorf("签名应校验通过: %v", err)
+	}
+
+	os.WriteFile(path, []byte("tampered"), 0755)
+	if err := verifyInstallerSignature(path, sig, key); err == nil {
+		t.Error("文件被修改后签名应校验失败")
+	}
+}
+
+// newTestSelfUpdater 创建从内存提供文件的 updater，没有公钥，只校验 SHA256
+func newTestSelfUpdater(t *testing.T, files map[string][]byte) *selfUpdater {
+	exe := filepath.Join(t.TempDir(), "install-docker")
+	os.WriteFile(exe, []byte("old"), 0755)
+	return &selfUpdater{
+		exe:           exe,
+		allowUnsigned: true,
+		fetch: func(name, dest, sha string) error {
+			data, ok := files[name]
+			if !ok {
+				return errors.New("HTTP 状态码: 404")
+			}
+			if err := os.WriteFile(dest, data, 0644); err != nil {
+				return err
+			}
+			if sha != "" {
+				return verifySHA256(dest, sha)
+			}
+			return nil
+		},
+		probe: func(path string) (string, error) { return "28.0.1.10", nil },
+	}
+}
+
+// TestSelfUpdater 测试下载、校验并替换 installer
+func TestSelfUpdater(t *testing.T) {
+	newBinary := []byte("new installer")
+	sum := sha256.Sum256(newBinary)
+	info := &VersionInfo{Architecture: "arm64", InstallerVersion: "28.0.1.10", InstallerSHA256: hex.EncodeToString(sum[:])}
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	t.Run("替换", func(t *testing.T) {
+		u := newTestSelfUpdater(t, map[string][]byte{
+			"install-docker-arm64":     newBinary,
+			"install-docker-arm64.sig": []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, newBinary))),
+		})
+		u.publicKey = base64.StdEncoding.EncodeToString(pub)
+		if err := u.Update(info); err != nil {
+			t.Fatalf("更新失败: %v", err)
+		}
+		data, _ := os.ReadFile(u.exe)
+		st, _ := os.Stat(u.exe)
+		if string(data) != "new installer" || st.Mode().Perm() != 0755 {
+			t.Errorf("替换结果错误: %q %v", data, st.Mode())
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(u.exe)); len(entries) != 1 {
+			t.Errorf("不应留下临时文件: %v", entries)
+		}
+	})
+
+	t.Run("-allow-unsigned", func(t *testing.T) {
+		u := newTestSelfUpdater(t, map[string][]byte{"install-docker-arm64": newBinary})
+		if err := u.Update(info); err != nil {
+			t.Fatalf("允许没有签名时应只校验 SHA256: %v", err)
+		}
+		if data, _ := os.ReadFile(u.exe); string(data) != "new installer" {
+			t.Errorf("替换结果错误: %q", data)
+		}
+	})
+
+	failures := map[string]func(u *selfUpdater){
+		"SHA256 不匹配": func(u *selfUpdater) {
+			u.fetch = newTestSelfUpdater(t, map[string][]byte{"install-docker-arm64": []byte("corrupted")}).fetch
+		},
+		"签名错误": func(u *selfUpdater) {
+			_, other, _ := ed25519.GenerateKey(rand.Reader)
+			u.fetch = newTestSelfUpdater(t, map[string][]byte{
+				"install-docker-arm64":     newBinary,
+				"install-docker-arm64.sig": []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(other, newBinary))),
+			}).fetch
+			u.publicKey = base64.StdEncoding.EncodeToString(pub)
+		},
+		"缺少签名": func(u *selfUpdater) {
+			u.publicKey = base64.StdEncoding.EncodeToString(pub)
+		},
+		"没有公钥": func(u *selfUpdater) {
+			u.allowUnsigned = false
+		},
+		"无法运行": func(u *selfUpdater) {
+			u.probe = func(path string) (string, error) { return "", errors.New("exec format error") }
+		},
+		"版本不符": func(u *selfUpdater) {
+			u.probe = func(path string) (string, error) { return "28.0.1.08", nil }
+		},
+	}
+	for name, setup := range failures {
+		t.Run(name, func(t *testing.T) {
+			u := newTestSelfUpdater(t, map[string][]byte{"install-docker-arm64": newBinary})
+			setup(u)
+			if err := u.Update(info); err == nil {
+				t.Fatal("应更新失败")
+			}
+			if data, _ := os.ReadFile(u.exe); string(data) != "old" {
+				t.Errorf("失败时不应替换: %q", data)
+			}
+			if entries, _ := os.ReadDir(filepath.Dir(u.exe)); len(entries) != 1 {
+				t.Errorf("不应留下临时文件: %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Service supervisord 管理的服务定义
+type Service struct {
+	Name        string
+	Description string
+	Command     string
+	Args        []string
+	// EnvFile 非空时通过 sh 先加载该文件再启动，参数中可以引用其中的变量
+	EnvFile     string
+	Env         map[string]string
+	StdoutLog   string
+	StderrLog   string
+	LogMaxBytes string
+	LogBackups  int
+	AutoStart   bool
+	AutoRestart bool
+	DependsOn   []string
+	// Optional 可选服务允许用户禁用
+	Optional bool
+}
+
+// serviceRegistry 安装包提供的服务，按启动顺序排列
+var serviceRegistry = []*Service{
+	{
+		Name:        "dockerd",
+		Description: "Docker 守护进程",
+		Command:     filepath.Join(binDir, "dockerd"),
+		Args: []string{
+			"--config-file", filepath.Join(dockerRoot, "etc", "docker", "daemon.json"),
+			"--data-root", filepath.Join(dockerRoot, "data"),
+			"--host", "unix://" + filepath.Join(dockerRoot, "var", "run", "docker.sock"),
+			"--pidfile", filepath.Join(dockerRoot, "var", "run", "docker.pid"),
+			"--exec-root", filepath.Join(dockerRoot, "var", "run", "docker"),
+		},
+		StdoutLog:   filepath.Join(dockerRoot, "dockerd-stdout.log"),
+		StderrLog:   filepath.Join(dockerRoot, "dockerd-stderr.log"),
+		LogMaxBytes: "50MB",
+		LogBackups:  10,
+		AutoStart:   true,
+		AutoRestart: true,
+	},
+	{
+		Name:        "kspeeder",
+		Description: "镜像加速缓存服务",
+		Command:     filepath.Join(binDir, "kspeeder"),
+		Args:        []string{"-cachePath", "${DISK_CACHE}/Kspeeder"},
+		EnvFile:     filepath.Join(dockerRoot, "docker.env"),
+		AutoStart:   true,
+		AutoRestart: true,
+		Optional:    true,
+	},
+	{
+		Name:        "netwatch",
+		Description: "上行接口切换时更新容器 NAT",
+		Command:     installerBinPath,
+		Args:        []string{"network", "watch"},
+		StdoutLog:   filepath.Join(dockerRoot, "netwatch.log"),
+		StderrLog:   filepath.Join(dockerRoot, "netwatch.log"),
+		LogMaxBytes: "1MB",
+		LogBackups:  2,
+		AutoStart:   true,
+		AutoRestart: true,
+		Optional:    true,
+	},
+	{
+		Name:        "dfa-agent",
+		Description: "本地管理 API",
+		Command:     installerBinPath,
+		Args:        []string{"dfa-agent"},
+		StdoutLog:   filepath.Join(dockerRoot, "dfa-agent.log"),
+		StderrLog:   filepath.Join(dockerRoot, "dfa-agent.log"),
+		LogMaxBytes: "1MB",
+		LogBackups:  2,
+		AutoStart:   true,
+		AutoRestart: true,
+		Optional:    true,
+	},
+}
+
+// serviceConfigDir supervisord 通过 [include] 加载的配置目录
+var serviceConfigDir = filepath.Join(dockerRoot, "etc")
+
+// serviceStateFile 记录用户禁用的服务，不随安装包分发
+const serviceStateFile = "services.json"
+
+// ServiceState 用户对服务的启用/禁用设置
+type ServiceState struct {
+	Disabled []string `json:"disabled"`
+}
+
+// findService 按名称查找服务
+func findService(name string) *Service {
+	for _, svc := range serviceRegistry {
+		if svc.Name == name {
+			return svc
+		}
+	}
+	return nil
+}
+
+// loadServiceState 读取服务状态，文件不存在时返回默认状态
+func loadServiceState(dir string) (*ServiceState, error) {
+	state := &ServiceState{}
+	content, err := os.ReadFile(filepath.Join(dir, serviceStateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", serviceStateFile, err)
+	}
+	return state, nil
+}
+
+// saveServiceState 保存服务状态
+func saveServiceState(dir string, state *ServiceState) error {
+	sort.Strings(state.Disabled)
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, serviceStateFile), append(content, '\n'), 0644)
+}
+
+// isEnabled 判断服务是否启用
+func (s *ServiceState) isEnabled(name string) bool {
+	return !containsString(s.Disabled, name)
+}
+
+// setEnabled 启用或禁用服务
+func (s *ServiceState) setEnabled(name string, enabled bool) {
+	var disabled []string
+	for _, n := range s.Disabled {
+		if n != name {
+			disabled = append(disabled, n)
+		}
+	}
+	if !enabled {
+		disabled = append(disabled, name)
+	}
+	s.Disabled = disabled
+}
+
+// validate 检查禁用设置是否合法
+func (s *ServiceState) validate() error {
+	for _, name := range s.Disabled {
+		svc := findService(name)
+		if svc == nil {
+			continue
+		}
+		if !svc.Optional {
+			return fmt.Errorf("服务 %s 是必需服务，不能禁用", name)
+		}
+	}
+	for _, svc := range serviceRegistry {
+		if !s.isEnabled(svc.Name) {
+			continue
+		}
+		for _, dep := range svc.DependsOn {
+			if !s.isEnabled(dep) {
+				return fmt.Errorf("服务 %s 依赖 %s，不能禁用 %s", svc.Name, dep, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// commandLine 生成 supervisord 的 command 值
+func (svc *Service) commandLine() string {
+	if svc.EnvFile != "" {
+		parts := []string{"exec", svc.Command}
+		for _, arg := range svc.Args {
+			parts = append(parts, shellQuote(arg))
+		}
+		return fmt.Sprintf("/bin/sh -c \"source %s && %s\"", svc.EnvFile, strings.Join(parts, " "))
+	}
+
+	if len(svc.Args) == 0 {
+		return svc.Command
+	}
+
+	// 每个参数（及其值）单独一行，便于阅读
+	lines := []string{svc.Command}
+	for i := 0; i < len(svc.Args); i++ {
+		arg := svc.Args[i]
+		if strings.HasPrefix(arg, "-") && i+1 < len(svc.Args) && !strings.HasPrefix(svc.Args[i+1], "-") {
+			lines = append(lines, "    "+arg+" "+strconv.Quote(svc.Args[i+1]))
+			i++
+			continue
+		}
+		lines = append(lines, "    "+strconv.Quote(arg))
+	}
+	return strings.Join(lines, " \\\n")
+}
+
+// shellQuote 包含空格的参数用单引号包裹，引用变量的参数保持原样以便展开
+func shellQuote(arg string) string {
+	if !strings.ContainsAny(arg, " \t'") || strings.Contains(arg, "$") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// programKeys 生成 [program:x] 段中由注册表管理的键，按输出顺序排列
+func (svc *Service) programKeys() [][2]string {
+	keys := [][2]string{{"command", svc.commandLine()}}
+
+	if len(svc.Env) > 0 {
+		names := make([]string, 0, len(svc.Env))
+		for k := range svc.Env {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, len(names))
+		for _, k := range names {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", k, strconv.Quote(svc.Env[k])))
+		}
+		keys = append(keys, [2]string{"environment", strings.Join(pairs, ",")})
+	}
+
+	if svc.StdoutLog != "" {
+		keys = append(keys,
+			[2]string{"stdout_logfile", svc.StdoutLog},
+			[2]string{"stdout_logfile_maxbytes", svc.LogMaxBytes},
+			[2]string{"stdout_logfile_backups", strconv.Itoa(svc.LogBackups)},
+			[2]string{"stdout_capture_maxbytes", "0"},
+			[2]string{"stdout_events_enabled", "true"},
+		)
+	}
+	if svc.StderrLog != "" {
+		keys = append(keys,
+			[2]string{"stderr_logfile", svc.StderrLog},
+			[2]string{"stderr_logfile_maxbytes", svc.LogMaxBytes},
+			[2]string{"stderr_logfile_backups", strconv.Itoa(svc.LogBackups)},
+			[2]string{"stderr_capture_maxbytes", "0"},
+		)
+	}
+
+	keys = append(keys,
+		[2]string{"autostart", strconv.FormatBool(svc.AutoStart)},
+		[2]string{"autorestart", strconv.FormatBool(svc.AutoRestart)},
+	)
+	if len(svc.DependsOn) > 0 {
+		keys = append(keys, [2]string{"depends_on", strings.Join(svc.DependsOn, ",")})
+	}
+	return keys
+}
+
+// applyTo 将服务定义写入 INI 文档，保留文档中用户添加的其他键和段
+func (svc *Service) applyTo(doc *iniDocument) {
+	section := doc.ensureSection("program:" + svc.Name)
+	for _, kv := range svc.programKeys() {
+		section.set(kv[0], kv[1])
+	}
+}
+
+// renderServiceConfigs 根据注册表和用户设置生成 dir 下的 <name>.conf
+// 禁用的服务保存为 <name>.conf.disabled，不会被 supervisord 的 [include] 加载
+func renderServiceConfigs(dir string) error {
+	state, err := loadServiceState(dir)
+	if err != nil {
+		return err
+	}
+	if err := state.validate(); err != nil {
+		return err
+	}
+
+	for _, svc := range serviceRegistry {
+		enabledPath := filepath.Join(dir, svc.Name+".conf")
+		disabledPath := enabledPath + ".disabled"
+
+		target, stale := enabledPath, disabledPath
+		if !state.isEnabled(svc.Name) {
+			target, stale = disabledPath, enabledPath
+		}
+
+		// 优先基于现有文件修改，保留用户自定义内容
+		source := target
+		if !fileExists(source) {
+			source = stale
+		}
+		doc, err := readINIFile(source)
+		if err != nil {
+			return err
+		}
+		svc.applyTo(doc)
+
+		if err := os.WriteFile(target, []byte(doc.String()), 0644); err != nil {
+			return fmt.Errorf("写入 %s 失败: %v", target, err)
+		}
+		if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:  "service",
+		usage: msgUsageService,
+		run: func(args []string) error {
+			return runServiceCommand(serviceConfigDir, args)
+		},
+	})
+}
+
+// runServiceCommand 实现 service 子命令
+func runServiceCommand(dir string, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	state, err := loadServiceState(dir)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		for _, svc := range serviceRegistry {
+			status := "启用"
+			if !state.isEnabled(svc.Name) {
+				status = "禁用"
+			}
+			kind := "必需"
+			if svc.Optional {
+				kind = "可选"
+			}
+			fmt.Printf("  %-12s %s  %s  %s\n", svc.Name, status, kind, svc.Description)
+		}
+		return nil
+	case "render":
+		if err := renderServiceConfigs(dir); err != nil {
+			return err
+		}
+		fmt.Printf("✓ 服务配置已生成: %s\n", dir)
+		return nil
+	case "enable", "disable":
+		if len(args) != 2 {
+			return fmt.Errorf("用法: service %s <name>", args[0])
+		}
+		if findService(args[1]) == nil {
+			return fmt.Errorf("未知服务: %s", args[1])
+		}
+		state.setEnabled(args[1], args[0] == "enable")
+		if err := state.validate(); err != nil {
+			return err
+		}
+		if err := saveServiceState(dir, state); err != nil {
+			return err
+		}
+		if err := renderServiceConfigs(dir); err != nil {
+			return err
+		}
+		action := "启用"
+		if args[0] == "disable" {
+			action = "禁用"
+		}
+		fmt.Printf("✓ 已%s服务 %s\n", action, args[1])
+		fmt.Println("  重新加载后生效: supervisord ctl reload")
+		return nil
+	default:
+		return fmt.Errorf("未知操作: %s", args[0])
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyShippedServiceConfigs 复制安装包中的 etc/*.conf 到临时目录
+func copyShippedServiceConfigs(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"dockerd.conf", "kspeeder.conf"} {
+		content, err := os.ReadFile(filepath.Join("..", "docker", "etc", name))
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatalf("写入 %s 失败: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// TestParseINI_RoundTrip 测试 INI 解析后原样输出
+func TestParseINI_RoundTrip(t *testing.T) {
+	for _, name := range []string{"dockerd.conf", "kspeeder.conf"} {
+		content, err := os.ReadFile(filepath.Join("..", "docker", "etc", name))
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", name, err)
+		}
+		doc, err := parseINI(strings.NewReader(string(content)))
+		if err != nil {
+			t.Fatalf("解析 %s 失败: %v", name, err)
+		}
+		if doc.String() != string(content) {
+			t.Errorf("%s 往返后内容不一致:\n%s", name, doc.String())
+		}
+	}
+
+	custom := "; 用户注释\n[program:custom]\ncommand=/bin/true\n\n# 注释\nautostart=false\n"
+	doc, err := parseINI(strings.NewReader(custom))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if doc.String() != custom {
+		t.Errorf("注释和空行未保留:\n%s", doc.String())
+	}
+}
+
+// TestParseINI_Continuation 测试反斜杠续行
+func TestParseINI_Continuation(t *testing.T) {
+	doc, err := parseINI(strings.NewReader("[program:a]\ncommand=/bin/a \\\n    --flag \"x\"\nautostart=true\n"))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	section := doc.section("program:a")
+	command, _ := section.get("command")
+	if command != "/bin/a \\\n    --flag \"x\"" {
+		t.Errorf("续行解析错误: %q", command)
+	}
+	if v, _ := section.get("autostart"); v != "true" {
+		t.Errorf("续行后的键解析错误: %q", v)
+	}
+}
+
+// TestParseINI_Invalid 测试无效的 INI 内容
+func TestParseINI_Invalid(t *testing.T) {
+	if _, err := parseINI(strings.NewReader("command=/bin/true\n")); err == nil {
+		t.Error("段外的键值对应返回错误")
+	}
+	if _, err := parseINI(strings.NewReader("[program:a]\nnot a pair\n")); err == nil {
+		t.Error("无法解析的行应返回错误")
+	}
+}
+
+// TestRenderServiceConfigs_MatchesShipped 测试注册表生成的配置与安装包一致
+func TestRenderServiceConfigs_MatchesShipped(t *testing.T) {
+	dir := copyShippedServiceConfigs(t)
+	fresh := t.TempDir()
+
+	for _, d := range []string{dir, fresh} {
+		if err := renderServiceConfigs(d); err != nil {
+			t.Fatalf("生成服务配置失败: %v", err)
+		}
+	}
+
+	for _, name := range []string{"dockerd.conf", "kspeeder.conf"} {
+		shipped, _ := os.ReadFile(filepath.Join("..", "docker", "etc", name))
+		for _, d := range []string{dir, fresh} {
+			rendered, err := os.ReadFile(filepath.Join(d, name))
+			if err != nil {
+				t.Fatalf("读取生成的 %s 失败: %v", name, err)
+			}
+			if string(rendered) != string(shipped) {
+				t.Errorf("%s 与安装包不一致:\n%s", name, rendered)
+			}
+		}
+	}
+}
+
+// TestRenderServiceConfigs_PreservesCustom 测试保留用户自定义的键、段和程序
+func TestRenderServiceConfigs_PreservesCustom(t *testing.T) {
+	dir := copyShippedServiceConfigs(t)
+
+	custom := "[program:custom]\ncommand=/data/local/docker/bin/custom\n"
+	if err := os.WriteFile(filepath.Join(dir, "custom.conf"), []byte(custom), 0644); err != nil {
+		t.Fatalf("写入自定义配置失败: %v", err)
+	}
+	f, _ := os.OpenFile(filepath.Join(dir, "kspeeder.conf"), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("startsecs=10\n")
+	f.Close()
+
+	if err := renderServiceConfigs(dir); err != nil {
+		t.Fatalf("生成服务配置失败: %v", err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "custom.conf"))
+	if string(content) != custom {
+		t.Error("自定义程序配置被修改")
+	}
+	content, _ = os.ReadFile(filepath.Join(dir, "kspeeder.conf"))
+	if !strings.Contains(string(content), "startsecs=10") {
+		t.Errorf("用户添加的键丢失:\n%s", content)
+	}
+}
+
+// TestServiceCommand_EnableDisable 测试禁用和启用可选服务
+func TestServiceCommand_EnableDisable(t *testing.T) {
+	dir := copyShippedServiceConfigs(t)
+	enabledPath := filepath.Join(dir, "kspeeder.conf")
+
+	if err := runServiceCommand(dir, []string{"disable", "kspeeder"}); err != nil {
+		t.Fatalf("禁用 kspeeder 失败: %v", err)
+	}
+	if fileExists(enabledPath) || !fileExists(enabledPath+".disabled") {
+		t.Fatal("禁用后应只保留 kspeeder.conf.disabled")
+	}
+
+	// 模拟重新安装：安装包重新写入 kspeeder.conf
+	content, _ := os.ReadFile(filepath.Join("..", "docker", "etc", "kspeeder.conf"))
+	os.WriteFile(enabledPath, content, 0644)
+	if err := renderServiceConfigs(dir); err != nil {
+		t.Fatalf("生成服务配置失败: %v", err)
+	}
+	if fileExists(enabledPath) {
+		t.Fatal("重新安装后禁用状态应保持")
+	}
+
+	if err := runServiceCommand(dir, []string{"enable", "kspeeder"}); err != nil {
+		t.Fatalf("启用 kspeeder 失败: %v", err)
+	}
+	if !fileExists(enabledPath) || fileExists(enabledPath+".disabled") {
+		t.Fatal("启用后应只保留 kspeeder.conf")
+	}
+}
+
+// TestServiceCommand_Errors 测试不允许的操作
+func TestServiceCommand_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := runServiceCommand(dir, []string{"disable", "dockerd"}); err == nil {
+		t.Error("必需服务不应允许禁用")
+	}
+	if err := runServiceCommand(dir, []string{"disable", "nosuch"}); err == nil {
+		t.Error("未知服务应返回错误")
+	}
+
+	state := &ServiceState{}
+	original := serviceRegistry
+	defer func() { serviceRegistry = original }()
+	serviceRegistry = append([]*Service{}, original...)
+	serviceRegistry = append(serviceRegistry, &Service{Name: "dpanel", Command: "/bin/true", DependsOn: []string{"kspeeder"}})
+	state.setEnabled("kspeeder", false)
+	if err := state.validate(); err == nil {
+		t.Error("被依赖的服务不应允许禁用")
+	}
+}
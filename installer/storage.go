@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	// storageProbeDir 在数据盘上测试 overlay 的临时目录，位于 DOCKER_DATA_ROOT 旁边
+	storageProbeDir = "opt/dockerd/.storage-probe"
+	// dtypeProbeFile 检查 d_type 时创建的文件
+	dtypeProbeFile = "dtype-probe"
+	// dockerDataDir DOCKER_DATA_ROOT 相对数据盘的位置，与 docker.env 一致
+	dockerDataDir = "opt/dockerd/docker"
+)
+
+// overlayUnsupportedFS 不能作为 overlay upperdir 的文件系统
+// Android 的 sdcardfs、esdfs 和 FUSE 存储不支持 overlay 需要的扩展属性和 whiteout
+var overlayUnsupportedFS = []string{
+	"fuse", "fuseblk", "sdcardfs", "esdfs", "ecryptfs",
+	"vfat", "exfat", "ntfs", "ntfs3", "overlay",
+}
+
+// StorageChoice 存储驱动的选择结果
+type StorageChoice struct {
+	Driver string
+	// FSType 数据目录所在的文件系统
+	FSType string
+	// Reason 不能使用 overlay2 的原因
+	Reason string
+}
+
+// storageProber 在数据盘上实际测试 overlay，选择 dockerd 的存储驱动
+type storageProber struct {
+	kernel  *KernelProbe
+	mounts  []MountInfo
+	mounter Mounter
+	// dtype 检查目录所在文件系统是否在 readdir 中返回文件类型
+	dtype func(dir string) (bool, error)
+}
+
+// Select 返回 dir 所在文件系统上可用的最佳存储驱动
+// 只有 overlay 在数据盘上挂载成功时才使用 overlay2，否则使用 vfs
+func (p *storageProber) Select(dir string) StorageChoice {
+	choice := StorageChoice{Driver: "vfs"}
+	if m := mountFor(p.mounts, dir); m != nil {
+		choice.FSType = m.FSType
+	}
+
+	if p.kernel != nil {
+		if f := p.kernel.Feature("overlay"); f.State == featureNo {
+			choice.Reason = fmt.Sprintf("内核不支持 overlay（%s）", f.Evidence)
+			return choice
+		}
+	}
+	if containsString(overlayUnsupportedFS, choice.FSType) {
+		choice.Reason = fmt.Sprintf("数据盘文件系统 %s 不支持 overlay", choice.FSType)
+		return choice
+	}
+
+	scratch := filepath.Join(dir, storageProbeDir)
+	defer os.RemoveAll(scratch)
+	if err := p.mounter.MkdirAll(scratch); err != nil {
+		choice.Reason = fmt.Sprintf("无法创建测试目录: %v", err)
+		return choice
+	}
+	ok, err := p.dtype(scratch)
+	switch {
+	case err != nil:
+		choice.Reason = fmt.Sprintf("无法检查 d_type: %v", err)
+		return choice
+	case !ok:
+		choice.Reason = fmt.Sprintf("数据盘文件系统 %s 不支持 d_type（xfs 需要 ftype=1）", choice.FSType)
+		return choice
+	}
+	if err := testOverlayMount(p.mounter, scratch); err != nil {
+		choice.Reason = fmt.Sprintf("overlay 挂载测试失败: %v", err)
+		return choice
+	}
+	choice.Driver, choice.Reason = "overlay2", ""
+	return choice
+}
+
+// testOverlayMount 在 scratch 中挂载一个 overlay，成功后立即卸载
+func testOverlayMount(m Mounter, scratch string) error {
+	dirs := map[string]string{}
+	for _, name := range []string{"lower", "upper", "work", "merged"} {
+		dirs[name] = filepath.Join(scratch, name)
+		if err := m.MkdirAll(dirs[name]); err != nil {
+			return err
+		}
+	}
+	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", dirs["lower"], dirs["upper"], dirs["work"])
+	if err := m.Mount("overlay", dirs["merged"], "overlay", options); err != nil {
+		return err
+	}
+	return m.Unmount(dirs["merged"])
+}
+
+// supportsDType 在 dir 中创建文件，通过 getdents64 检查返回的 d_type
+// os.ReadDir 遇到 DT_UNKNOWN 时会自动 lstat，无法用来判断
+func supportsDType(dir string) (bool, error) {
+	probe := filepath.Join(dir, dtypeProbeFile)
+	if err := os.WriteFile(probe, nil, 0644); err != nil {
+		return false, err
+	}
+	defer os.Remove(probe)
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := syscall.Getdents(int(f.Fd()), buf)
+		if err != nil {
+			return false, err
+		}
+		if n <= 0 {
+			return false, fmt.Errorf("%s 中没有找到 %s", dir, dtypeProbeFile)
+		}
+		if dtype, ok := findDirentType(buf[:n], dtypeProbeFile); ok {
+			return dtype != syscall.DT_UNKNOWN, nil
+		}
+	}
+}
+
+// findDirentType 在 linux_dirent64 记录中查找 name 的 d_type
+// 记录格式: d_ino(8) d_off(8) d_reclen(2) d_type(1) d_name，arm64 和 x86_64 均为小端
+func findDirentType(buf []byte, name string) (byte, bool) {
+	for len(buf) >= 19 {
+		reclen := int(binary.LittleEndian.Uint16(buf[16:18]))
+		if reclen < 19 || reclen > len(buf) {
+			return 0, false
+		}
+		entry := buf[19:reclen]
+		for i, c := range entry {
+			if c == 0 {
+				entry = entry[:i]
+				break
+			}
+		}
+		if string(entry) == name {
+			return buf[18], true
+		}
+		buf = buf[reclen:]
+	}
+	return 0, false
+}
+
+// currentStorageDriver 返回已经在使用的存储驱动
+// 优先使用上次探测的结果，旧版本安装没有探测配置时看 DOCKER_DATA_ROOT 下已有的驱动目录
+func currentStorageDriver(paths DaemonConfigPaths, dataRoot string) string {
+	if detected, err := loadDaemonConfigFile(paths.Detected); err == nil {
+		if driver, _ := detected["storage-driver"].(string); driver != "" {
+			return driver
+		}
+	}
+	for _, driver := range []string{"overlay2", "vfs"} {
+		if info, err := os.Stat(filepath.Join(dataRoot, driver)); err == nil && info.IsDir() {
+			return driver
+		}
+	}
+	return ""
+}
+
+// detectDaemonConfig 在数据盘上选择存储驱动，写入 daemon.json 的探测配置
+// 已有镜像和容器时保留正在使用的驱动，一次失败的探测不会让 overlay2 降级为 vfs，
+// 切换后旧驱动下的数据不可见；reprobe 为 true 时使用本次探测的结果
+// 用户在 override 中指定的值优先
+func detectDaemonConfig(paths DaemonConfigPaths, diskRoot string, reprobe bool) error {
+	probe := &storageProber{mounter: syscallMounter{}, dtype: supportsDType}
+	var err error
+	if probe.kernel, err = loadKernelProbe("/"); err != nil {
+		fmt.Println(T(msgKernelProbeWarn, err))
+	}
+	if probe.mounts, err = readMountInfo(); err != nil {
+		fmt.Println(T(msgKernelProbeWarn, err))
+	}
+
+	choice := probe.Select(diskRoot)
+	current := currentStorageDriver(paths, filepath.Join(diskRoot, dockerDataDir))
+	switch {
+	case current != "" && current != choice.Driver && !reprobe:
+		detected := choice.Driver
+		if choice.Reason != "" {
+			detected += ": " + choice.Reason
+		}
+		fmt.Println(T(msgStorageDriverKept, current, detected))
+		choice.Driver = current
+	case choice.Driver == "vfs":
+		fmt.Println(T(msgStorageDriverVFS, choice.Reason))
+		fmt.Println(T(msgStorageDriverVFSHint))
+		emit(Event{Type: eventWarning, Code: "storage_vfs", Message: choice.Reason})
+	default:
+		fmt.Println(T(msgStorageDriver, choice.Driver, choice.FSType))
+	}
+	return saveDetectedDaemonConfig(paths, DaemonConfig{"storage-driver": choice.Driver})
+}
+
+func init() {
+	registerCheck(&healthCheck{ID: "storage", Title: msgCheckStorage, Run: checkStorageDriver})
+}
+
+// checkStorageDriver 检查 daemon.json 中的存储驱动，vfs 会很快占满数据盘
+func checkStorageDriver(env *doctorEnv) CheckResult {
+	cfg, err := loadDaemonConfigFile(filepath.Join(env.root, "etc", "docker", "daemon.json"))
+	if err != nil {
+		return failed(T(msgDoctorStorageConfigRemedy), msgDoctorDetail, err)
+	}
+	driver, _ := cfg["storage-driver"].(string)
+	switch driver {
+	case "":
+		return warned(T(msgDoctorStorageUnsetRemedy), msgDoctorStorageUnset)
+	case "vfs":
+		return warned(T(msgDoctorStorageVFSRemedy), msgDoctorStorageVFS)
+	}
+	return passed(msgDoctorDetail, driver)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStorageProberSelect 测试存储驱动的选择
+func TestStorageProberSelect(t *testing.T) {
+	loadKernel := func(name string) *KernelProbe {
+		p, err := loadKernelProbe(filepath.Join("testdata", "kernel", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	dtypeOK := func(string) (bool, error) { return true, nil }
+	mounts := func(fstype string) []MountInfo {
+		return []MountInfo{{MountPoint: "/mnt/media_rw/ABCD", FSType: fstype, Source: "/dev/block/vold/public:8,1"}}
+	}
+	scratch := "/mnt/media_rw/ABCD/" + storageProbeDir
+
+	tests := []struct {
+		name   string
+		kernel string
+		fstype string
+		dtype  func(string) (bool, error)
+		fail   map[string]bool
+		want   string
+		reason string
+	}{
+		{name: "ext4", kernel: "gki-5.10", fstype: "ext4", dtype: dtypeOK, want: "overlay2"},
+		{name: "没有内核配置时以挂载测试为准", kernel: "no-config", fstype: "ext4", dtype: dtypeOK, want: "overlay2"},
+		{name: "内核不支持", kernel: "no-overlay", fstype: "ext4", dtype: dtypeOK, want: "vfs", reason: "CONFIG_OVERLAY_FS"},
+		{name: "sdcardfs", kernel: "gki-5.10", fstype: "sdcardfs", dtype: dtypeOK, want: "vfs", reason: "sdcardfs"},
+		{name: "fuse", kernel: "gki-5.10", fstype: "fuse", dtype: dtypeOK, want: "vfs", reason: "fuse"},
+		{
+			name: "不支持 d_type", kernel: "gki-5.10", fstype: "xfs", want: "vfs", reason: "d_type",
+			dtype: func(string) (bool, error) { return false, nil },
+		},
+		{
+			name: "挂载失败", kernel: "gki-5.10", fstype: "f2fs", dtype: dtypeOK, want: "vfs", reason: "挂载测试失败",
+			fail: map[string]bool{scratch + "/merged": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &fakeMounter{fail: tt.fail}
+			p := &storageProber{kernel: loadKernel(tt.kernel), mounts: mounts(tt.fstype), mounter: m, dtype: tt.dtype}
+			choice := p.Select("/mnt/media_rw/ABCD")
+			if choice.Driver != tt.want || !strings.Contains(choice.Reason, tt.reason) {
+				t.Errorf("结果 = %+v，期望 %s（%s）", choice, tt.want, tt.reason)
+			}
+			if choice.FSType != tt.fstype {
+				t.Errorf("文件系统 = %s，期望 %s", choice.FSType, tt.fstype)
+			}
+			if tt.want == "overlay2" {
+				ops := strings.Join(m.ops, "\n")
+				if !strings.Contains(ops, "mount "+scratch+"/merged\numount "+scratch+"/merged") {
+					t.Errorf("应挂载后卸载:\n%s", ops)
+				}
+			}
+		})
+	}
+}
+
+// TestSupportsDType 测试临时目录（ext4 或 tmpfs）支持 d_type
+func TestSupportsDType(t *testing.T) {
+	ok, err := supportsDType(t.TempDir())
+	if err != nil || !ok {
+		t.Errorf("supportsDType = %v, %v", ok, err)
+	}
+	if _, err := supportsDType(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("目录不存在时应报错")
+	}
+}
+
+// TestFindDirentType 测试解析 linux_dirent64 记录
+func TestFindDirentType(t *testing.T) {
+	record := func(name string, dtype byte) []byte {
+		reclen := (19 + len(name) + 1 + 7) &^ 7
+		b := make([]byte, reclen)
+		b[16], b[17] = byte(reclen), byte(reclen>>8)
+		b[18] = dtype
+		copy(b[19:], name)
+		return b
+	}
+	buf := append(record(".", 4), record("dtype-probe", 8)...)
+	if dtype, ok := findDirentType(buf, "dtype-probe"); !ok || dtype != 8 {
+		t.Errorf("d_type = %d, %v", dtype, ok)
+	}
+	if _, ok := findDirentType(buf, "other"); ok {
+		t.Error("不存在的文件不应找到")
+	}
+	if _, ok := findDirentType(buf[:10], "dtype-probe"); ok {
+		t.Error("不完整的记录不应找到")
+	}
+}
+
+// TestDetectedDaemonConfig 测试探测的存储驱动写入 daemon.json，用户配置优先
+func TestDetectedDaemonConfig(t *testing.T) {
+	paths := daemonConfigPathsIn(t.TempDir())
+	if err := writeDaemonConfigFile(paths.Output, DaemonConfig{"log-level": "warn"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshotDaemonDefaults(paths); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveDetectedDaemonConfig(paths, DaemonConfig{"storage-driver": "vfs"}); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := applyDaemonConfig(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged["storage-driver"] != "vfs" || merged["log-level"] != "warn" {
+		t.Errorf("合并结果错误: %v", merged)
+	}
+
+	writeDaemonConfigFile(paths.Override, DaemonConfig{"storage-driver": "overlay2"})
+	if merged, _ = applyDaemonConfig(paths); merged["storage-driver"] != "overlay2" {
+		t.Errorf("用户配置应优先: %v", merged)
+	}
+
+	root := t.TempDir()
+	writeDaemonConfigFile(filepath.Join(root, "etc", "docker", "daemon.json"), DaemonConfig{"storage-driver": "vfs"})
+	if r := checkStorageDriver(&doctorEnv{root: root}); r.Status != checkWarn {
+		t.Errorf("vfs 应给出警告: %+v", r)
+	}
+}
+
+// TestCurrentStorageDriver 测试正在使用的驱动优先取上次探测的结果，其次看数据目录
+func TestCurrentStorageDriver(t *testing.T) {
+	paths := daemonConfigPathsIn(t.TempDir())
+	dataRoot := t.TempDir()
+	if driver := currentStorageDriver(paths, dataRoot); driver != "" {
+		t.Errorf("新安装不应有正在使用的驱动: %q", driver)
+	}
+	os.MkdirAll(filepath.Join(dataRoot, "overlay2"), 0755)
+	if driver := currentStorageDriver(paths, dataRoot); driver != "overlay2" {
+		t.Errorf("应识别数据目录中的 overlay2: %q", driver)
+	}
+	saveDetectedDaemonConfig(paths, DaemonConfig{"storage-driver": "vfs"})
+	if driver := currentStorageDriver(paths, dataRoot); driver != "vfs" {
+		t.Errorf("应优先使用上次探测的结果: %q", driver)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// subcommand 描述一个 installer 子命令
+type subcommand struct {
+	name    string
+	usage   msgKey
+	network networkMode
+	run     func(args []string) error
+}
+
+// networkMode 子命令对网络和下载源参数的处理方式
+type networkMode int
+
+const (
+	// networkNone 不访问网络，网络和下载源参数原样交给子命令，配置文件出错也不受影响
+	networkNone networkMode = iota
+	// networkOptional 可能访问网络，配置出错时给出警告并使用默认设置
+	networkOptional
+	// networkRequired 下载安装文件，配置出错时停止
+	networkRequired
+)
+
+// subcommands 已注册的子命令，由各模块在 init 中注册
+var subcommands = map[string]*subcommand{}
+
+// networkConfigErr networkOptional 的子命令忽略的配置错误，只在部分操作访问网络的子命令用 requireNetwork 检查
+var networkConfigErr error
+
+// registerSubcommand 注册子命令
+func registerSubcommand(cmd *subcommand) {
+	subcommands[cmd.name] = cmd
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:    "install",
+		usage:   msgUsageInstall,
+		network: networkRequired,
+		run:     runInstall,
+	})
+	registerSubcommand(&subcommand{
+		name:  "help",
+		usage: msgUsageHelp,
+		run: func(args []string) error {
+			printUsage()
+			return nil
+		},
+	})
+}
+
+// dispatch 根据命令行参数选择子命令，未指定时执行 install
+// --lang 可以出现在任意位置；网络和下载源参数也可以出现在任意位置，但只对访问网络的子命令生效
+func dispatch(args []string) error {
+	lang, args, err := extractLangFlag(args)
+	if err != nil {
+		return err
+	}
+	setupLanguage(lang)
+
+	name, global, args := splitSubcommand(args)
+	cmd, ok := subcommands[name]
+	if !ok {
+		printUsage()
+		return errorf(msgUnknownCommand, name)
+	}
+	if cmd.network != networkNone {
+		if args, err = configureCommandNetwork(cmd, append(global, args...)); err != nil {
+			return err
+		}
+	}
+	return cmd.run(args)
+}
+
+// splitSubcommand 找出子命令名，返回子命令之前的全局参数和之后的参数
+// 子命令名是第一个前面只有网络和下载源参数的非 - 开头的参数，没有时执行 install
+func splitSubcommand(args []string) (name string, global, rest []string) {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if before, err := stripNetworkFlags(args[:i]); err == nil && len(before) == 0 {
+			return arg, args[:i:i], args[i+1:]
+		}
+	}
+	return "install", nil, args
+}
+
+// stripNetworkFlags 去掉网络和下载源参数
+func stripNetworkFlags(args []string) ([]string, error) {
+	_, rest, err := extractNetworkFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	_, rest, err = extractDownloadFlags(rest)
+	return rest, err
+}
+
+// configureCommandNetwork 取出网络和下载源参数并设置，返回剩余的参数
+// 参数写错总是报错；环境变量和配置文件出错时，networkOptional 的子命令在 stderr 给出警告并使用默认设置，
+// 错误保存在 networkConfigErr 中
+func configureCommandNetwork(cmd *subcommand, args []string) ([]string, error) {
+	networkConfigErr = nil
+	netOpts, args, err := extractNetworkFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	downloadOpts, args, err := extractDownloadFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := configureNetwork(netOpts, os.Getenv); err != nil {
+		if cmd.network == networkRequired {
+			return nil, err
+		}
+		networkConfigErr = err
+		fmt.Fprintln(os.Stderr, T(msgNetworkConfigWarn, err))
+	}
+	if err := configureDownload(downloadOpts, mirrorConfigPath, mirrorHealthPath); err != nil {
+		if cmd.network == networkRequired {
+			return nil, err
+		}
+		if networkConfigErr == nil {
+			networkConfigErr = err
+		}
+		fmt.Fprintln(os.Stderr, T(msgNetworkConfigWarn, err))
+	}
+	if downloadOpts.LowPriority {
+		if err := lowerPriority(); err != nil {
+			fmt.Println(T(msgLowPriorityFailed, err))
+		}
+	}
+	return args, nil
+}
+
+// requireNetwork 在 networkOptional 子命令中需要访问网络的操作开始前调用，配置有误时返回错误
+func requireNetwork() error {
+	return networkConfigErr
+}
+
+// printUsage 打印所有子命令
+func printUsage() {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, T(msgUsageHeader, os.Args[0]))
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", name, T(subcommands[name].usage))
+	}
+}
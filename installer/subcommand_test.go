@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSplitSubcommand 测试子命令前的全局参数和子命令自己的参数
+func TestSplitSubcommand(t *testing.T) {
+	tests := []struct {
+		args   []string
+		name   string
+		global []string
+		rest   []string
+	}{
+		{nil, "install", nil, nil},
+		{[]string{"-channel", "beta"}, "install", nil, []string{"-channel", "beta"}},
+		{[]string{"--proxy", "http://p:3128", "doctor", "-offline"}, "doctor", []string{"--proxy", "http://p:3128"}, []string{"-offline"}},
+		{[]string{"--peers", "cache", "--limit-rate", "1M"}, "cache", []string{"--peers"}, []string{"--limit-rate", "1M"}},
+		{[]string{"--mirror=http://m", "--system-ca", "update", "check"}, "update", []string{"--mirror=http://m", "--system-ca"}, []string{"check"}},
+	}
+	for _, tt := range tests {
+		name, global, rest := splitSubcommand(tt.args)
+		if name != tt.name || len(global)+len(tt.global) > 0 && !reflect.DeepEqual(global, tt.global) ||
+			len(rest)+len(tt.rest) > 0 && !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("splitSubcommand(%q) = %q %q %q，期望 %q %q %q", tt.args, name, global, rest, tt.name, tt.global, tt.rest)
+		}
+	}
+}
+
+// TestDispatchNetworkMode 测试网络参数和配置错误只影响访问网络的子命令
+func TestDispatchNetworkMode(t *testing.T) {
+	restoreNetwork(t)
+	mirrors, policy, probe, race, stats, healthFile, throttle, discover, port := downloadMirrors, retryPolicy, mirrorProbe, mirrorRace, mirrorStats, mirrorHealthFile, currentThrottle, peerDiscover, peerPort
+	t.Cleanup(func() {
+		downloadMirrors, retryPolicy, mirrorProbe, mirrorRace, mirrorStats, mirrorHealthFile, currentThrottle, peerDiscover, peerPort = mirrors, policy, probe, race, stats, healthFile, throttle, discover, port
+	})
+	saved := subcommands
+	t.Cleanup(func() { subcommands = saved })
+	subcommands = map[string]*subcommand{}
+
+	var got map[string][]string
+	for name, mode := range map[string]networkMode{"local": networkNone, "diag": networkOptional, "fetch": networkRequired} {
+		name := name
+		registerSubcommand(&subcommand{name: name, network: mode, run: func(args []string) error {
+			got[name] = args
+			return nil
+		}})
+	}
+
+	// 无效的代理环境变量
+	t.Setenv("HTTPS_PROXY", "ftp://proxy")
+	got = map[string][]string{}
+	if err := dispatch([]string{"local", "--mirror", "x", "--peers"}); err != nil {
+		t.Errorf("不访问网络的子命令不应受代理设置影响: %v", err)
+	}
+	if !reflect.DeepEqual(got["local"], []string{"--mirror", "x", "--peers"}) {
+		t.Errorf("不访问网络的子命令应原样收到参数: %q", got["local"])
+	}
+	if err := dispatch([]string{"diag", "-x"}); err != nil || !reflect.DeepEqual(got["diag"], []string{"-x"}) {
+		t.Errorf("配置错误时应给出警告并继续: %v %q", err, got["diag"])
+	}
+	if err := dispatch([]string{"fetch"}); err == nil {
+		t.Error("下载的子命令应报告配置错误")
+	}
+	if _, ok := got["fetch"]; ok {
+		t.Error("配置错误时不应执行下载的子命令")
+	}
+
+	t.Setenv("HTTPS_PROXY", "")
+	if err := dispatch([]string{"--retries", "3", "fetch", "--limit-rate", "1M", "-y"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got["fetch"], []string{"-y"}) || retryPolicy.Attempts != 4 {
+		t.Errorf("应取出下载参数: %q，重试 %d", got["fetch"], retryPolicy.Attempts)
+	}
+	if err := dispatch([]string{"diag", "--retries"}); err == nil {
+		t.Error("参数缺少值时应报错")
+	}
+}
+
+// TestUpdateNetworkOptional 测试代理设置有误时 update 只有访问网络的操作报错
+func TestUpdateNetworkOptional(t *testing.T) {
+	restoreNetwork(t)
+	mirrors, policy, probe, race, stats, healthFile, throttle, discover, port := downloadMirrors, retryPolicy, mirrorProbe, mirrorRace, mirrorStats, mirrorHealthFile, currentThrottle, peerDiscover, peerPort
+	t.Cleanup(func() {
+		downloadMirrors, retryPolicy, mirrorProbe, mirrorRace, mirrorStats, mirrorHealthFile, currentThrottle, peerDiscover, peerPort = mirrors, policy, probe, race, stats, healthFile, throttle, discover, port
+		networkConfigErr = nil
+	})
+
+	t.Setenv("HTTPS_PROXY", "ftp://proxy")
+	if err := dispatch([]string{"update", "history"}); err != nil {
+		t.Errorf("update history 不访问网络，不应受代理设置影响: %v", err)
+	}
+	for _, action := range []string{"check", "apply"} {
+		err := dispatch([]string{"update", action})
+		if err == nil || !strings.Contains(err.Error(), "ftp") {
+			t.Errorf("update %s 应报告代理设置错误: %v", action, err)
+		}
+	}
+}
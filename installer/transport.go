@@ -4,10 +4,13 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -16,58 +19,314 @@ const (
 )
 
 func CreateTimeoutTransport(timeout time.Duration) *http.Transport {
-	certPool := RootCAsGlobal()
-	cfg := &tls.Config{RootCAs: certPool}
+	dialer := &net.Dialer{Timeout: timeout, Resolver: currentResolver}
+	proxy := currentProxy
 	return &http.Transport{
-		TLSClientConfig: cfg,
-		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			host, _, err := net.SplitHostPort(addr)
-			if err != nil {
-				return nil, err
+		// 局域网中的设备直连，代理服务器通常无法访问局域网地址
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			if isPeerHost(req.URL.Host) {
+				return nil, nil
 			}
-			tconn, err := net.DialTimeout(network, addr, timeout)
+			return proxy(req)
+		},
+		TLSClientConfig: &tls.Config{RootCAs: RootCAsGlobal()},
+		// 连接代理服务器和直连使用同一个 dialer，TLS 在读超时的连接之上握手
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, overrideAddr(addr))
 			if err != nil {
 				return nil, err
 			}
-			return NewTimeoutConn(tls.Client(tconn, &tls.Config{
-				ServerName: host,
-				RootCAs:    certPool,
-			}), timeout), nil
+			return NewTimeoutConn(conn, timeout), nil
 		},
+		TLSHandshakeTimeout: timeout,
+	}
+}
+
+// NetworkOptions 代理和 CA 证书设置，命令行参数优先于环境变量
+type NetworkOptions struct {
+	// Proxy 代理地址，支持 http://、https://、socks5://，direct 表示不使用代理
+	Proxy string
+	// NoProxy 不使用代理的主机，逗号分隔，支持 .example.com 后缀和 CIDR
+	NoProxy string
+	// CABundle 追加信任的 PEM 证书文件
+	CABundle string
+	// SystemCA 追加 Android 系统证书（/system/etc/security/cacerts）
+	SystemCA bool
+	// DNS 使用的 DNS 服务器，逗号分隔，可以带端口
+	DNS string
+	// DoH DNS-over-HTTPS 地址，主机必须是 IP，设置后不再使用 DNS 服务器
+	DoH string
+	// Hosts 静态域名映射，逗号分隔的 host=ip
+	Hosts string
+}
+
+// currentProxy 为请求选择代理，由 configureNetwork 设置
+var currentProxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+
+// networkOptionsFromEnv 从环境变量读取代理和证书设置
+// 与 curl 一致，https 请求使用 HTTPS_PROXY，http 请求使用 HTTP_PROXY，都没有时使用 ALL_PROXY
+func networkOptionsFromEnv(getenv func(string) string, scheme string) NetworkOptions {
+	env := func(names ...string) string {
+		for _, name := range names {
+			if v := getenv(name); v != "" {
+				return v
+			}
+			if v := getenv(strings.ToLower(name)); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	opts := NetworkOptions{
+		NoProxy:  env("NO_PROXY"),
+		CABundle: getenv("SSL_CERT_FILE"),
+		SystemCA: getenv("DFA_SYSTEM_CA") == "1",
+	}
+	if scheme == "https" {
+		opts.Proxy = env("HTTPS_PROXY", "ALL_PROXY")
+	} else {
+		opts.Proxy = env("HTTP_PROXY", "ALL_PROXY")
+	}
+	return opts
+}
+
+// parseProxyURL 解析代理地址，省略协议时按 http 代理处理
+func parseProxyURL(s string) (*url.URL, error) {
+	if s == "" || s == "direct" {
+		return nil, nil
+	}
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("无效的代理地址 %q: %v", s, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	case "socks5h":
+		// net/http 的 socks5 本来就把域名交给代理解析
+		u.Scheme = "socks5"
+	default:
+		return nil, fmt.Errorf("不支持的代理协议 %q（支持 http、https、socks5）", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("代理地址 %q 缺少主机名", s)
+	}
+	return u, nil
+}
+
+// useProxy 判断 host 是否需要经过代理，回环地址和 NO_PROXY 中的主机直连
+func useProxy(host, noProxy string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return false
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "*":
+			return false
+		case strings.Contains(entry, "/"):
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && ip != nil && cidr.Contains(ip) {
+				return false
+			}
+		case strings.HasPrefix(entry, "."):
+			if strings.HasSuffix(host, entry) || host == entry[1:] {
+				return false
+			}
+		case host == entry || strings.HasSuffix(host, "."+entry):
+			return false
+		}
+	}
+	return true
+}
+
+// proxyFunc 根据参数和环境变量生成 http.Transport.Proxy
+func proxyFunc(flagOpts NetworkOptions, getenv func(string) string) (func(*http.Request) (*url.URL, error), error) {
+	// 参数指定的代理用于所有请求，先解析一次以便尽早报错
+	fixed, err := parseProxyURL(flagOpts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	for _, scheme := range []string{"http", "https"} {
+		if _, err := parseProxyURL(networkOptionsFromEnv(getenv, scheme).Proxy); err != nil {
+			return nil, err
+		}
 	}
+	return func(req *http.Request) (*url.URL, error) {
+		env := networkOptionsFromEnv(getenv, req.URL.Scheme)
+		noProxy := env.NoProxy
+		if flagOpts.NoProxy != "" {
+			noProxy = flagOpts.NoProxy
+		}
+		if !useProxy(req.URL.Host, noProxy) {
+			return nil, nil
+		}
+		if flagOpts.Proxy != "" {
+			return fixed, nil
+		}
+		return parseProxyURL(env.Proxy)
+	}, nil
 }
 
+// configureNetwork 设置之后创建的 HTTP 客户端使用的代理和 CA 证书
+func configureNetwork(flagOpts NetworkOptions, getenv func(string) string) error {
+	proxy, err := proxyFunc(flagOpts, getenv)
+	if err != nil {
+		return err
+	}
+	env := networkOptionsFromEnv(getenv, "https")
+	bundle, system := flagOpts.CABundle, flagOpts.SystemCA || env.SystemCA
+	if bundle == "" {
+		bundle = env.CABundle
+	}
+	if bundle != "" || system {
+		systemDir := ""
+		if system {
+			systemDir = androidSystemCADir
+		}
+		pool, err := buildRootCAs(bundle, systemDir)
+		if err != nil {
+			return err
+		}
+		rootCAs = pool
+	}
+	// DoH 客户端使用上面设置的证书
+	if err := configureDNS(flagOpts, getenv, androidProp, resolvConfPath); err != nil {
+		return err
+	}
+	currentProxy = proxy
+	return nil
+}
+
+// extractNetworkFlags 从参数中取出 --proxy、--no-proxy、--ca-bundle、--system-ca、--dns、--doh 和 --add-host，访问网络的子命令都支持
+// --dns 和 --add-host 可以重复指定
+func extractNetworkFlags(args []string) (NetworkOptions, []string, error) {
+	var opts NetworkOptions
+	values := map[string]*string{
+		"proxy": &opts.Proxy, "no-proxy": &opts.NoProxy, "ca-bundle": &opts.CABundle,
+		"dns": &opts.DNS, "doh": &opts.DoH, "add-host": &opts.Hosts,
+	}
+	repeat := map[string]bool{"dns": true, "add-host": true}
+	switches := map[string]*bool{"system-ca": &opts.SystemCA}
+	rest, err := extractFlags(args, values, repeat, switches)
+	return opts, rest, err
+}
+
+// extractFlags 从参数中取出全局参数，其余参数按原顺序返回
+// values 为带值的参数，repeat 中的参数可以重复指定，值以逗号连接；switches 为不带值的开关
+func extractFlags(args []string, values map[string]*string, repeat map[string]bool, switches map[string]*bool) ([]string, error) {
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if sw, ok := switches[name]; ok && !hasValue {
+			*sw = true
+			continue
+		}
+		target, ok := values[name]
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("--%s 需要参数值", name)
+			}
+			i++
+			value = args[i]
+		}
+		if repeat[name] && *target != "" {
+			value = *target + "," + value
+		}
+		*target = value
+	}
+	return rest, nil
+}
+
+// httpTraceLog 安装日志，不为 nil 时 HTTP 请求记录到日志中
+var httpTraceLog io.Writer
+
 type LogTransport struct {
 	lower http.RoundTripper
+	// verbose 为 true 时输出到终端（ISE_HTTP_LOG=1），否则只写入安装日志
+	verbose bool
+}
+
+// traceRedactHeaders 记录请求时隐藏的头，避免凭据写入安装日志
+var traceRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// redactHeader 返回隐藏了凭据的头副本
+func redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range traceRedactHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, redactedValue)
+		}
+	}
+	return h
 }
 
 func (lt *LogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	reqd, err0 := httputil.DumpRequestOut(req, false)
+	// 记录的是隐藏了凭据的副本，URL 中的用户名密码会被 DumpRequestOut 转成 Authorization
+	logged := req.Clone(req.Context())
+	logged.Header = redactHeader(req.Header)
+	if logged.URL.User != nil {
+		logged.URL.User = nil
+		logged.Header.Set("Authorization", redactedValue)
+	}
+	reqd, err0 := httputil.DumpRequestOut(logged, false)
 	if err0 != nil {
 		return nil, err0
 	}
 	timeStart := time.Now().Unix()
 	resp, err := lt.lower.RoundTrip(req)
 	if err != nil {
-		fmt.Println(string(reqd))
-		fmt.Println("Failed ", err)
-		fmt.Println()
+		lt.trace(string(reqd), fmt.Sprintln("Failed ", err))
 		return resp, err
 	}
-	respd, err0 := httputil.DumpResponse(resp, false)
+	loggedResp := *resp
+	loggedResp.Header = redactHeader(resp.Header)
+	respd, err0 := httputil.DumpResponse(&loggedResp, false)
 	if err0 != nil {
 		return nil, err0
 	}
-	fmt.Println(string(reqd))
-	fmt.Println(string(respd))
-	fmt.Println("Success in ", time.Now().Unix()-timeStart, " seconds")
+	lt.trace(string(reqd), string(respd), fmt.Sprintln("Success in ", time.Now().Unix()-timeStart, " seconds"))
 	return resp, err
 }
 
+// trace 输出请求记录，终端输出已被安装日志记录，不再重复写入
+func (lt *LogTransport) trace(parts ...string) {
+	var w io.Writer = os.Stdout
+	if !lt.verbose {
+		if w = httpTraceLog; w == nil {
+			return
+		}
+	}
+	for _, p := range parts {
+		fmt.Fprintln(w, p)
+	}
+}
+
 func CreateLogTransport(lower http.RoundTripper) http.RoundTripper {
-	if os.Getenv(ISE_HTTP_LOG) == "1" {
+	if os.Getenv(ISE_HTTP_LOG) == "1" || httpTraceLog != nil {
 		return &LogTransport{
-			lower: lower,
+			lower:   lower,
+			verbose: os.Getenv(ISE_HTTP_LOG) == "1",
 		}
 	} else {
 		return lower
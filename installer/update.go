@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	// Android 的时区数据不是标准的 zoneinfo 格式，LoadLocation 使用编译进来的时区数据
+	_ "time/tzdata"
+)
+
+const (
+	// updateConfigPath 自动更新设置
+	updateConfigPath = dockerRoot + "/etc/update.json"
+	// updateStatusPath 最近一次检查的结果
+	updateStatusPath = dockerRoot + "/etc/update-status.json"
+	// updateHistoryPath 升级记录
+	updateHistoryPath = dockerRoot + "/etc/update-history.json"
+
+	// updateHistoryLimit 最多保留的升级记录
+	updateHistoryLimit = 50
+	// updateTickInterval agent 检查是否需要更新的间隔，实际请求按配置的 interval 进行
+	updateTickInterval = time.Minute
+	// updateRetryDelay 检查失败后重试的间隔，不超过配置的 interval
+	updateRetryDelay = 15 * time.Minute
+)
+
+// UpdateConfig 自动更新设置
+type UpdateConfig struct {
+	// Check 是否定期检查新版本
+	Check bool `json:"check"`
+	// AutoApply 发现新版本后是否在维护窗口内自动升级
+	AutoApply bool   `json:"auto_apply"`
+	Channel   string `json:"channel"`
+	// Interval 检查间隔，time.ParseDuration 格式
+	Interval string `json:"interval"`
+	// Window 维护窗口，形如 03:00-05:00，为空表示任意时间
+	Window string `json:"window,omitempty"`
+	// Timezone 维护窗口的时区，如 Asia/Shanghai，只在 TZ 和 persist.sys.timezone 都没有时使用
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// defaultUpdateConfig 默认只检查不自动升级
+func defaultUpdateConfig() *UpdateConfig {
+	return &UpdateConfig{Check: true, Channel: defaultChannel, Interval: "6h", Window: "03:00-05:00"}
+}
+
+// validate 检查设置
+func (c *UpdateConfig) validate() error {
+	if c.Channel == "" || strings.ContainsAny(c.Channel, "/ ") {
+		return errorf(msgUpdateChannelInvalid, c.Channel)
+	}
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil || d < time.Minute {
+		return errorf(msgUpdateIntervalInvalid, c.Interval)
+	}
+	if _, err := parseMaintenanceWindow(c.Window); err != nil {
+		return err
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return errorf(msgTimezoneInvalid, c.Timezone)
+		}
+	}
+	return nil
+}
+
+// interval 返回检查间隔
+func (c *UpdateConfig) interval() time.Duration {
+	d, _ := time.ParseDuration(c.Interval)
+	return d
+}
+
+// loadUpdateConfig 读取设置，文件不存在时返回默认值
+func loadUpdateConfig(path string) (*UpdateConfig, error) {
+	config := defaultUpdateConfig()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, errorf(msgUpdateConfigParse, path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// MaintenanceWindow 每天允许自动升级的时间段
+type MaintenanceWindow struct {
+	// start/end 为一天中的分钟数，end 小于 start 表示跨越午夜
+	start, end int
+	always     bool
+}
+
+// parseMaintenanceWindow 解析 HH:MM-HH:MM，空字符串表示任意时间
+func parseMaintenanceWindow(s string) (MaintenanceWindow, error) {
+	if s == "" {
+		return MaintenanceWindow{always: true}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return MaintenanceWindow{}, errorf(msgWindowInvalid, s)
+	}
+	start, err1 := parseClock(from)
+	end, err2 := parseClock(to)
+	if err1 != nil || err2 != nil || start == end {
+		return MaintenanceWindow{}, errorf(msgWindowInvalid, s)
+	}
+	return MaintenanceWindow{start: start, end: end}, nil
+}
+
+// parseClock 解析 HH:MM 为分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains 判断 t 在 loc 时区的时间是否在窗口内
+func (w MaintenanceWindow) Contains(t time.Time, loc *time.Location) bool {
+	if w.always {
+		return true
+	}
+	t = t.In(loc)
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// resolveLocation 返回维护窗口和限速时间段使用的时区，依次使用 TZ、persist.sys.timezone 和 configured，
+// 都没有或无法识别时使用 time.Local。静态编译的 installer 在 Android 上没有 /etc/localtime，time.Local 是 UTC
+func resolveLocation(getenv, getprop func(string) string, configured string) *time.Location {
+	for _, name := range []string{strings.TrimPrefix(getenv("TZ"), ":"), getprop("persist.sys.timezone"), configured} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// windowLocation 返回 configured 对应的时区，见 resolveLocation
+var windowLocation = func(configured string) *time.Location {
+	return resolveLocation(os.Getenv, androidProp, configured)
+}
+
+// manifestName 通道对应的版本文件，stable 使用原来的 version.txt
+func manifestName(channel string) string {
+	if channel == "" || channel == defaultChannel {
+		return versionFile
+	}
+	return fmt.Sprintf("version-%s.txt", channel)
+}
+
+// compareVersions 按点分隔的数字比较版本，返回 -1/0/1，非数字部分按字符串比较
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y string
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		nx, errx := strconv.Atoi(x)
+		ny, erry := strconv.Atoi(y)
+		switch {
+		case errx == nil && erry == nil:
+			if nx != ny {
+				if nx < ny {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// UpdateStatus 最近一次检查的结果
+type UpdateStatus struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Channel   string    `json:"channel"`
+	Current   string    `json:"current"`
+	Latest    string    `json:"latest,omitempty"`
+	Available bool      `json:"available"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// loadUpdateStatus 读取检查结果，从未检查过时返回 nil
+func loadUpdateStatus(path string) (*UpdateStatus, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var status UpdateStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// UpdateAttempt 一次升级尝试
+type UpdateAttempt struct {
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	Channel    string    `json:"channel"`
+	Trigger    string    `json:"trigger"` // auto 或 manual
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Outcome 为 success、failed（备份失败，未改动安装）或 rolled-back
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// loadUpdateHistory 读取升级记录
+func loadUpdateHistory(path string) ([]UpdateAttempt, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []UpdateAttempt
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, errorf(msgUpdateConfigParse, path, err)
+	}
+	return history, nil
+}
+
+// appendUpdateHistory 追加记录，只保留最近 updateHistoryLimit 条
+func appendUpdateHistory(path string, attempt UpdateAttempt) error {
+	history, err := loadUpdateHistory(path)
+	if err != nil {
+		return err
+	}
+	history = append(history, attempt)
+	if len(history) > updateHistoryLimit {
+		history = history[len(history)-updateHistoryLimit:]
+	}
+	return writeJSONFile(path, history)
+}
+
+// failedBefore 该版本是否自动升级失败过，避免每个维护窗口反复回滚
+func failedBefore(history []UpdateAttempt, version string) bool {
+	for _, a := range history {
+		if a.To == version && a.Trigger == "auto" && a.Outcome != "success" {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateChecker 定期检查新版本，在维护窗口内触发自动升级
+type UpdateChecker struct {
+	configPath  string
+	statusPath  string
+	historyPath string
+	statePath   string
+
+	// fetch 获取通道的版本信息
+	fetch func(channel string) (*VersionInfo, error)
+	// apply 开始分阶段升级，升级在独立进程中进行
+	apply  func(version, channel string) error
+	logger *log.Logger
+
+	// mu 保护 lastCheck 和 retryAt，手动检查和定时检查可能同时进行
+	mu        sync.Mutex
+	lastCheck time.Time
+	// retryAt 检查失败后下次重试的时间，成功后清零
+	retryAt time.Time
+}
+
+// newUpdateChecker 创建使用默认路径的检查器
+func newUpdateChecker(client *http.Client, apply func(version, channel string) error, logger *log.Logger) *UpdateChecker {
+	return &UpdateChecker{
+		configPath:  updateConfigPath,
+		statusPath:  updateStatusPath,
+		historyPath: updateHistoryPath,
+		statePath:   installStatePath,
+		fetch: func(channel string) (*VersionInfo, error) {
+			return fetchManifest(client, channel)
+		},
+		apply:  apply,
+		logger: logger,
+	}
+}
+
+// fetchManifest 下载并解析通道的版本文件
+func fetchManifest(client *http.Client, channel string) (*VersionInfo, error) {
+	arch, err := detectArchitecture()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "version-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	name := manifestName(channel)
+	if err := downloadFile(client, f.Name(), name, ""); err != nil {
+		return nil, errorf(msgUpdateManifestFailed, name, err)
+	}
+	content, err := os.ReadFile(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	return parseVersionInfo(content, arch)
+}
+
+// Check 获取最新版本并保存检查结果
+func (c *UpdateChecker) Check(now time.Time) (*UpdateStatus, error) {
+	config, err := loadUpdateConfig(c.configPath)
+	if err != nil {
+		return nil, err
+	}
+	status := &UpdateStatus{CheckedAt: now, Channel: config.Channel, Current: "unknown"}
+	installedChannel := config.Channel
+	if state, err := loadInstallState(c.statePath); err == nil && state != nil {
+		status.Current, installedChannel = state.Version, state.Channel
+	}
+
+	info, err := c.fetch(config.Channel)
+	c.mu.Lock()
+	if err != nil {
+		delay := updateRetryDelay
+		if interval := config.interval(); interval < delay {
+			delay = interval
+		}
+		c.retryAt = now.Add(delay)
+	} else {
+		c.lastCheck, c.retryAt = now, time.Time{}
+	}
+	c.mu.Unlock()
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Latest = info.Version
+		// 切换通道后即使版本号更低也视为需要更新
+		switched := installedChannel != config.Channel && info.Version != status.Current
+		status.Available = status.Current == "unknown" || switched || compareVersions(info.Version, status.Current) > 0
+	}
+	if err := writeJSONFile(c.statusPath, status); err != nil {
+		return status, err
+	}
+	if status.Error != "" {
+		return status, fmt.Errorf("%s", status.Error)
+	}
+	return status, nil
+}
+
+// Tick 到达检查间隔时检查，在维护窗口内自动升级
+func (c *UpdateChecker) Tick(now time.Time) {
+	config, err := loadUpdateConfig(c.configPath)
+	if err != nil {
+		c.logger.Print(T(msgUpdateTickError, err))
+		return
+	}
+	c.mu.Lock()
+	due := now.Sub(c.lastCheck) >= config.interval()
+	if !c.retryAt.IsZero() {
+		// 检查失败后按 updateRetryDelay 重试，不等完整的 interval
+		due = !now.Before(c.retryAt)
+	}
+	c.mu.Unlock()
+	if !config.Check || !due {
+		return
+	}
+
+	status, err := c.Check(now)
+	if err != nil {
+		c.logger.Print(T(msgUpdateCheckFailed, err))
+		return
+	}
+	if !status.Available {
+		return
+	}
+	c.logger.Print(T(msgUpdateFound, status.Latest, status.Current, status.Channel))
+
+	window, _ := parseMaintenanceWindow(config.Window)
+	if !config.AutoApply || !window.Contains(now, windowLocation(config.Timezone)) {
+		return
+	}
+	history, err := loadUpdateHistory(c.historyPath)
+	if err != nil {
+		c.logger.Print(T(msgUpdateTickError, err))
+		return
+	}
+	if failedBefore(history, status.Latest) {
+		c.logger.Print(T(msgUpdateSkipFailed, status.Latest))
+		return
+	}
+	c.logger.Print(T(msgUpdateAutoApply, status.Latest))
+	if err := c.apply(status.Latest, config.Channel); err != nil {
+		c.logger.Print(T(msgUpdateStartFailed, err))
+	}
+}
+
+// Run 定期调用 Tick 直到 ctx 取消
+func (c *UpdateChecker) Run(ctx context.Context, tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	c.Tick(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.Tick(now)
+		}
+	}
+}
+
+func init() {
+	registerSubcommand(&subcommand{
+		name:    "update",
+		usage:   msgUsageUpdate,
+		network: networkOptional,
+		run:     runUpdateCommand,
+	})
+}
+
+// runUpdateCommand 实现 update 子命令
+func runUpdateCommand(args []string) error {
+	action := "status"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "status":
+		config, err := loadUpdateConfig(updateConfigPath)
+		if err != nil {
+			return err
+		}
+		status, err := loadUpdateStatus(updateStatusPath)
+		if err != nil {
+			return err
+		}
+		return printJSON(map[string]interface{}{"config": config, "status": status})
+	case "check":
+		if err := requireNetwork(); err != nil {
+			return err
+		}
+		checker := newUpdateChecker(CreateHTTPClient(), nil, log.New(os.Stdout, "", 0))
+		status, err := checker.Check(time.Now())
+		if err != nil {
+			return err
+		}
+		if status.Available {
+			fmt.Println(T(msgUpdateAvailable, status.Latest, status.Current))
+		} else {
+			fmt.Println(T(msgUpdateUpToDate, status.Current))
+		}
+		return nil
+	case "apply":
+		if err := requireNetwork(); err != nil {
+			return err
+		}
+		return runUpdateApply(args)
+	case "config":
+		return runUpdateConfig(args)
+	case "history":
+		history, err := loadUpdateHistory(updateHistoryPath)
+		if err != nil {
+			return err
+		}
+		if history == nil {
+			history = []UpdateAttempt{}
+		}
+		return printJSON(history)
+	default:
+		return errorf(msgUnknownAction, action)
+	}
+}
+
+// runUpdateConfig 查看或修改自动更新设置
+func runUpdateConfig(args []string) error {
+	config, err := loadUpdateConfig(updateConfigPath)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return printJSON(config)
+	}
+	if len(args) != 2 {
+		return errorf(msgUpdateConfigUsage)
+	}
+
+	key, value := args[0], args[1]
+	switch key {
+	case "check", "auto_apply":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errorf(msgUpdateNeedBool, key)
+		}
+		if key == "check" {
+			config.Check = b
+		} else {
+			config.AutoApply = b
+		}
+	case "channel":
+		config.Channel = value
+	case "interval":
+		config.Interval = value
+	case "window":
+		config.Window = value
+	case "timezone":
+		config.Timezone = value
+	default:
+		return errorf(msgUpdateUnknownSetting, key)
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if err := writeJSONFile(updateConfigPath, config); err != nil {
+		return err
+	}
+	fmt.Println(T(msgUpdateConfigSet, key, value))
+	return nil
+}
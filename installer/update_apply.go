@@ -0,0 +1,235 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// upgradeBackupDir 升级前的备份，回滚时从这里恢复
+	upgradeBackupDir = dockerRoot + "/backup"
+	// dockerdHealthTimeout 升级后等待 dockerd 正常响应的时间
+	dockerdHealthTimeout = 2 * time.Minute
+)
+
+// upgradeBackupPaths 升级会覆盖的文件，相对于 dockerRoot
+// data 绑定在数据盘上，升级不会修改
+var upgradeBackupPaths = []string{
+	"bin", "etc", "scripts",
+	"docker.env", "start.sh", "supervisor.conf", "deploy-in-android.sh",
+}
+
+// upgradeStager 分阶段升级：备份、安装、健康检查，失败时回滚
+type upgradeStager struct {
+	root      string
+	backupDir string
+
+	install func(channel string, w io.Writer) error
+	healthy func() error
+	// restart 回滚后重新启动服务
+	restart func(w io.Writer) error
+}
+
+// newUpgradeStager 创建操作真实安装目录的 stager
+func newUpgradeStager() *upgradeStager {
+	return &upgradeStager{
+		root:      dockerRoot,
+		backupDir: upgradeBackupDir,
+		install:   func(channel string, w io.Writer) error { return runInstallProcess(channel, w) },
+		healthy:   waitDockerdHealthy,
+		restart:   restartServices,
+	}
+}
+
+// Backup 复制当前安装到备份目录
+func (s *upgradeStager) Backup() error {
+	os.RemoveAll(s.backupDir)
+	for _, p := range upgradeBackupPaths {
+		src := filepath.Join(s.root, p)
+		if !fileExists(src) {
+			continue
+		}
+		if err := copyTree(src, filepath.Join(s.backupDir, p)); err != nil {
+			return errorf(msgUpgradeBackupFailed, p, err)
+		}
+	}
+	return nil
+}
+
+// Restore 用备份替换当前安装
+func (s *upgradeStager) Restore() error {
+	for _, p := range upgradeBackupPaths {
+		dst := filepath.Join(s.root, p)
+		src := filepath.Join(s.backupDir, p)
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		if !fileExists(src) {
+			continue
+		}
+		if err := copyTree(src, dst); err != nil {
+			return errorf(msgUpgradeRestoreFailed, p, err)
+		}
+	}
+	return nil
+}
+
+// Run 执行升级，返回 UpdateAttempt 中的 outcome
+func (s *upgradeStager) Run(channel string, w io.Writer) (string, error) {
+	fmt.Fprintln(w, T(msgUpgradeBackingUp))
+	if err := s.Backup(); err != nil {
+		return "failed", err
+	}
+
+	fmt.Fprintln(w, T(msgUpgradeInstalling))
+	err := s.install(channel, w)
+	if err == nil {
+		fmt.Fprintln(w, T(msgUpgradeWaitDockerd))
+		err = s.healthy()
+	}
+	if err == nil {
+		fmt.Fprintln(w, T(msgUpgradeDone))
+		return "success", nil
+	}
+
+	fmt.Fprintln(w, T(msgUpgradeRollingBack, err))
+	if rerr := s.Restore(); rerr != nil {
+		return "failed", errorf(msgUpgradeRollbackFailed, err, rerr)
+	}
+	if rerr := s.restart(w); rerr != nil {
+		fmt.Fprintln(w, T(msgUpgradeRestartFailed, rerr))
+	}
+	fmt.Fprintln(w, T(msgUpgradeRolledBack))
+	return "rolled-back", err
+}
+
+// copyTree 复制文件或目录树，保留权限和符号链接
+func copyTree(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		case info.IsDir():
+			if err := os.MkdirAll(target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		default:
+			if err := copyFile(path, target); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		}
+	})
+}
+
+// runInstallProcess 以子进程运行 install，避免 install 中的 os.Exit 中断回滚
+// 初始化时作为 upgradeStager.install 使用，extra 为追加的全局参数
+func runInstallProcess(channel string, w io.Writer, extra ...string) error {
+	args := append([]string{"install", "-channel", channel}, extra...)
+	cmd := exec.Command(installerBinPath, args...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return cmd.Run()
+}
+
+// waitDockerdHealthy 等待 dockerd 响应 /_ping
+func waitDockerdHealthy() error {
+	client := newUnixHTTPClient(dockerSocketPath, dockerdPingTimeout)
+	deadline := time.Now().Add(dockerdHealthTimeout)
+	for {
+		health := checkDockerd(client)
+		if health.Healthy {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errorf(msgUpgradeDockerdTimeout, dockerdHealthTimeout, health.Error)
+		}
+		time.Sleep(3 * time.Second)
+	}
+}
+
+// restartServices 停止 supervisord 后用 start.sh 重新启动
+func restartServices(w io.Writer) error {
+	if err := stopSupervisord(); err != nil {
+		return err
+	}
+	cmd := exec.Command("sh", filepath.Join(dockerRoot, "start.sh"))
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return cmd.Run()
+}
+
+// runUpdateApply 实现 update apply：分阶段升级并记录结果
+// agent 以独立会话启动此命令，升级过程中 supervisord 和 agent 会被停止
+func runUpdateApply(args []string) error {
+	fs := flag.NewFlagSet("update apply", flag.ExitOnError)
+	channel := fs.String("channel", "", "发布通道，默认使用 update.json 中的设置")
+	trigger := fs.String("trigger", "manual", "触发方式 auto/manual，记录在升级历史中")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := loadUpdateConfig(updateConfigPath)
+	if err != nil {
+		return err
+	}
+	if *channel == "" {
+		*channel = config.Channel
+	}
+
+	attempt := UpdateAttempt{Channel: *channel, Trigger: *trigger, StartedAt: time.Now(), From: "unknown"}
+	if state, err := loadInstallState(installStatePath); err == nil && state != nil {
+		attempt.From = state.Version
+	}
+
+	stager := newUpgradeStager()
+	if *trigger == "auto" {
+		// 自动升级在后台进行，按 mirrors.json 中的限速下载，不占满设备的网络
+		stager.install = func(channel string, w io.Writer) error {
+			return runInstallProcess(channel, w, "--low-priority")
+		}
+	}
+	outcome, runErr := stager.Run(*channel, os.Stdout)
+	attempt.Outcome = outcome
+	attempt.FinishedAt = time.Now()
+	if runErr != nil {
+		attempt.Error = runErr.Error()
+	}
+	attempt.To = attempt.From
+	if state, err := loadInstallState(installStatePath); err == nil && state != nil {
+		attempt.To = state.Version
+	}
+	// 回滚后 install.json 已恢复为旧版本，目标版本取检查结果
+	if outcome != "success" {
+		if status, err := loadUpdateStatus(updateStatusPath); err == nil && status != nil && status.Latest != "" {
+			attempt.To = status.Latest
+		}
+	}
+	if err := appendUpdateHistory(updateHistoryPath, attempt); err != nil {
+		fmt.Println(T(msgUpgradeHistoryFailed, err))
+	}
+	return runErr
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMaintenanceWindow 测试维护窗口，包括跨越午夜
+func TestMaintenanceWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		tm, _ := time.Parse("15:04", clock)
+		return time.Date(2024, 1, 1, tm.Hour(), tm.Minute(), 0, 0, time.Local)
+	}
+	tests := []struct {
+		window string
+		clock  string
+		want   bool
+	}{
+		{"03:00-05:00", "03:00", true},
+		{"03:00-05:00", "04:59", true},
+		{"03:00-05:00", "05:00", false},
+		{"03:00-05:00", "12:00", false},
+		{"23:00-02:00", "23:30", true},
+		{"23:00-02:00", "01:00", true},
+		{"23:00-02:00", "12:00", false},
+		{"", "12:00", true},
+	}
+	for _, tt := range tests {
+		w, err := parseMaintenanceWindow(tt.window)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.window, err)
+		}
+		if got := w.Contains(at(tt.clock), time.Local); got != tt.want {
+			t.Errorf("%q 包含 %s = %v，期望 %v", tt.window, tt.clock, got, tt.want)
+		}
+	}
+
+	// 设备时区为 UTC+8 时，UTC 19:30 是当地 03:30
+	w, _ := parseMaintenanceWindow("03:00-05:00")
+	shanghai := time.FixedZone("CST", 8*3600)
+	if !w.Contains(time.Date(2024, 1, 1, 19, 30, 0, 0, time.UTC), shanghai) {
+		t.Error("应按 loc 的时间判断: UTC 19:30 是 UTC+8 的 03:30")
+	}
+	if w.Contains(time.Date(2024, 1, 1, 3, 30, 0, 0, time.UTC), shanghai) {
+		t.Error("应按 loc 的时间判断: UTC 03:30 是 UTC+8 的 11:30")
+	}
+
+	for _, s := range []string{"03:00", "3-5", "03:00-03:00", "25:00-01:00"} {
+		if _, err := parseMaintenanceWindow(s); err == nil {
+			t.Errorf("%q 应解析失败", s)
+		}
+	}
+}
+
+// TestResolveLocation 测试依次使用 TZ、persist.sys.timezone 和配置的时区
+func TestResolveLocation(t *testing.T) {
+	env := func(tz string) func(string) string {
+		return func(name string) string {
+			if name == "TZ" {
+				return tz
+			}
+			return ""
+		}
+	}
+	prop := func(zone string) func(string) string {
+		return func(name string) string {
+			if name == "persist.sys.timezone" {
+				return zone
+			}
+			return ""
+		}
+	}
+	tests := []struct {
+		tz, prop, configured string
+		want                 string
+	}{
+		{":Europe/Berlin", "Asia/Shanghai", "Asia/Tokyo", "Europe/Berlin"},
+		{"", "Asia/Shanghai", "Asia/Tokyo", "Asia/Shanghai"},
+		{"CST-8", "", "Asia/Tokyo", "Asia/Tokyo"},
+		{"", "", "", time.Local.String()},
+	}
+	for _, tt := range tests {
+		if got := resolveLocation(env(tt.tz), prop(tt.prop), tt.configured).String(); got != tt.want {
+			t.Errorf("TZ=%q prop=%q configured=%q: %s，期望 %s", tt.tz, tt.prop, tt.configured, got, tt.want)
+		}
+	}
+}
+
+// TestCompareVersions 测试版本比较
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.10", "1.2.9", 1},
+		{"v1.3", "1.2.9", 1},
+		{"1.2", "1.2.1", -1},
+		{"20240101", "20231231", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d，期望 %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestManifestName 测试通道对应的版本文件
+func TestManifestName(t *testing.T) {
+	if got := manifestName("stable"); got != "version.txt" {
+		t.Errorf("stable: %s", got)
+	}
+	if got := manifestName("beta"); got != "version-beta.txt" {
+		t.Errorf("beta: %s", got)
+	}
+}
+
+// TestLoadUpdateConfig 测试默认设置和非法设置
+func TestLoadUpdateConfig(t *testing.T) {
+	dir := t.TempDir()
+	config, err := loadUpdateConfig(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.Check || config.AutoApply || config.Channel != "stable" || config.interval() != 6*time.Hour {
+		t.Errorf("默认设置错误: %+v", config)
+	}
+
+	path := filepath.Join(dir, "update.json")
+	for _, content := range []string{
+		`{"interval":"10s"}`,
+		`{"channel":"../x"}`,
+		`{"window":"nightly"}`,
+		`{"timezone":"Mars/Olympus"}`,
+	} {
+		os.WriteFile(path, []byte(content), 0644)
+		if _, err := loadUpdateConfig(path); err == nil {
+			t.Errorf("%s 应校验失败", content)
+		}
+	}
+}
+
+// TestAppendUpdateHistory 测试升级记录数量上限
+func TestAppendUpdateHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	for i := 0; i < updateHistoryLimit+5; i++ {
+		if err := appendUpdateHistory(path, UpdateAttempt{To: fmt.Sprintf("1.0.%d", i), Outcome: "success"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := loadUpdateHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != updateHistoryLimit || history[0].To != "1.0.5" {
+		t.Errorf("应只保留最近 %d 条: %d 条，第一条 %s", updateHistoryLimit, len(history), history[0].To)
+	}
+}
+
+// newTestUpdateChecker 创建使用临时文件和假版本信息的检查器，返回 apply 的调用记录
+func newTestUpdateChecker(t *testing.T, config string, latest string) (*UpdateChecker, *[]string) {
+	dir := t.TempDir()
+	c := &UpdateChecker{
+		configPath:  filepath.Join(dir, "update.json"),
+		statusPath:  filepath.Join(dir, "update-status.json"),
+		historyPath: filepath.Join(dir, "update-history.json"),
+		statePath:   filepath.Join(dir, "install.json"),
+		logger:      log.New(io.Discard, "", 0),
+	}
+	os.WriteFile(c.configPath, []byte(config), 0644)
+	saveInstallState(c.statePath, &InstallState{Version: "1.0.0", Channel: "stable"})
+
+	var applied []string
+	c.fetch = func(channel string) (*VersionInfo, error) {
+		if latest == "" {
+			return nil, errors.New("无法下载 version.txt")
+		}
+		return &VersionInfo{Version: latest}, nil
+	}
+	c.apply = func(version, channel string) error {
+		applied = append(applied, version+"@"+channel)
+		return nil
+	}
+	return c, &applied
+}
+
+// TestUpdateCheckerTick 测试定时检查和维护窗口内的自动升级
+func TestUpdateCheckerTick(t *testing.T) {
+	inWindow := time.Date(2024, 1, 1, 3, 30, 0, 0, time.Local)
+	outWindow := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+
+	t.Run("只检查", func(t *testing.T) {
+		c, applied := newTestUpdateChecker(t, `{"check":true,"auto_apply":false,"channel":"stable","interval":"1h"}`, "1.1.0")
+		c.Tick(inWindow)
+		if len(*applied) != 0 {
+			t.Errorf("未开启自动升级不应升级: %v", *applied)
+		}
+		status, _ := loadUpdateStatus(c.statusPath)
+		if status == nil || !status.Available || status.Latest != "1.1.0" || status.Current != "1.0.0" {
+			t.Errorf("检查结果错误: %+v", status)
+		}
+	})
+
+	t.Run("配置的时区", func(t *testing.T) {
+		saved := windowLocation
+		t.Cleanup(func() { windowLocation = saved })
+		windowLocation = func(configured string) *time.Location {
+			return resolveLocation(func(string) string { return "" }, func(string) string { return "" }, configured)
+		}
+		config := `{"check":true,"auto_apply":true,"channel":"stable","interval":"1h","window":"03:00-05:00","timezone":"Asia/Shanghai"}`
+		c, applied := newTestUpdateChecker(t, config, "1.1.0")
+		c.Tick(time.Date(2024, 1, 1, 3, 30, 0, 0, time.UTC))
+		if len(*applied) != 0 {
+			t.Errorf("UTC 03:30 是上海 11:30，不应升级: %v", *applied)
+		}
+		c, applied = newTestUpdateChecker(t, config, "1.1.0")
+		c.Tick(time.Date(2024, 1, 1, 19, 30, 0, 0, time.UTC))
+		if len(*applied) != 1 {
+			t.Errorf("UTC 19:30 是上海 03:30，应升级: %v", *applied)
+		}
+	})
+
+	t.Run("维护窗口内", func(t *testing.T) {
+		c, applied := newTestUpdateChecker(t, `{"check":true,"auto_apply":true,"channel":"beta","interval":"1h","window":"03:00-05:00"}`, "1.1.0")
+		c.Tick(inWindow)
+		if len(*applied) != 1 || (*applied)[0] != "1.1.0@beta" {
+			t.Errorf("应自动升级: %v", *applied)
+		}
+		// 未到检查间隔不再检查
+		c.Tick(inWindow.Add(10 * time.Minute))
+		if len(*applied) != 1 {
+			t.Errorf("未到检查间隔不应再次升级: %v", *applied)
+		}
+	})
+
+	t.Run("维护窗口外", func(t *testing.T) {
+		c, applied := newTestUpdateChecker(t, `{"check":true,"auto_apply":true,"channel":"stable","interval":"1h","window":"03:00-05:00"}`, "1.1.0")
+		c.Tick(outWindow)
+		if len(*applied) != 0 {
+			t.Errorf("维护窗口外不应升级: %v", *applied)
+		}
+	})
+
+	t.Run("已是最新", func(t *testing.T) {
+		c, applied := newTestUpdateChecker(t, `{"check":true,"auto_apply":true,"channel":"stable","interval":"1h","window":""}`, "1.0.0")
+		c.Tick(outWindow)
+		if len(*applied) != 0 {
+			t.Errorf("没有新版本不应升级: %v", *applied)
+		}
+	})
+
+	t.Run("之前失败过", func(t *testing.T) {
+		c, applied := newTestUpdateChecker(t, `{"check":true,"auto_apply":true,"channel":"stable","interval":"1h","window":""}`, "1.1.0")
+		appendUpdateHistory(c.historyPath, UpdateAttempt{From: "1.0.0", To: "1.1.0", Trigger: "auto", Outcome: "rolled-back"})
+		c.Tick(outWindow)
+		if len(*applied) != 0 {
+			t.Errorf("自动升级失败过的版本不应再次尝试: %v", *applied)
+		}
+	})
+
+	t.Run("检查失败", func(t *testing.T) {
+		c, applied := newTestUpdateChecker(t, `{"check":true,"auto_apply":true,"channel":"stable","interval":"24h","window":""}`, "")
+		fetches := 0
+		fetch := c.fetch
+		c.fetch = func(channel string) (*VersionInfo, error) {
+			fetches++
+			return fetch(channel)
+		}
+		c.Tick(outWindow)
+		status, _ := loadUpdateStatus(c.statusPath)
+		if len(*applied) != 0 || status == nil || status.Error == "" {
+			t.Errorf("应记录检查失败: %v %+v", *applied, status)
+		}
+		// 失败后按 updateRetryDelay 重试，不等 24h
+		c.Tick(outWindow.Add(updateRetryDelay / 2))
+		c.Tick(outWindow.Add(updateRetryDelay))
+		if fetches != 2 {
+			t.Errorf("应在 %s 后重试一次，实际请求 %d 次", updateRetryDelay, fetches)
+		}
+	})
+
+	t.Run("切换通道", func(t *testing.T) {
+		c, applied := newTestUpdateChecker(t, `{"check":true,"auto_apply":true,"channel":"beta","interval":"1h","window":""}`, "0.9.0")
+		c.Tick(outWindow)
+		if len(*applied) != 1 || (*applied)[0] != "0.9.0@beta" {
+			t.Errorf("切换通道后即使版本号更低也应升级: %v", *applied)
+		}
+	})
+}
+
+// newTestStager 在临时目录中创建安装目录和 stager
+func newTestStager(t *testing.T) *upgradeStager {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "docker")
+	os.MkdirAll(filepath.Join(root, "bin"), 0755)
+	os.MkdirAll(filepath.Join(root, "data"), 0755)
+	os.WriteFile(filepath.Join(root, "bin", "dockerd"), []byte("old"), 0755)
+	os.WriteFile(filepath.Join(root, "start.sh"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(root, "data", "image.db"), []byte("data"), 0644)
+
+	return &upgradeStager{
+		root:      root,
+		backupDir: filepath.Join(dir, "backup"),
+		install: func(channel string, w io.Writer) error {
+			os.WriteFile(filepath.Join(root, "bin", "dockerd"), []byte("new"), 0755)
+			os.WriteFile(filepath.Join(root, "bin", "containerd"), []byte("new"), 0755)
+			return nil
+		},
+		healthy: func() error { return nil },
+		restart: func(w io.Writer) error { return nil },
+	}
+}
+
+// TestUpgradeStager 测试分阶段升级的成功和回滚
+func TestUpgradeStager(t *testing.T) {
+	read := func(s *upgradeStager, p string) string {
+		data, _ := os.ReadFile(filepath.Join(s.root, p))
+		return string(data)
+	}
+
+	t.Run("成功", func(t *testing.T) {
+		s := newTestStager(t)
+		outcome, err := s.Run("stable", io.Discard)
+		if err != nil || outcome != "success" {
+			t.Fatalf("升级应成功: %s %v", outcome, err)
+		}
+		if read(s, "bin/dockerd") != "new" {
+			t.Error("应保留新版本")
+		}
+	})
+
+	t.Run("安装失败", func(t *testing.T) {
+		s := newTestStager(t)
+		install := s.install
+		s.install = func(channel string, w io.Writer) error {
+			install(channel, w)
+			return errors.New("下载失败")
+		}
+		restarted := false
+		s.restart = func(w io.Writer) error { restarted = true; return nil }
+
+		outcome, err := s.Run("stable", io.Discard)
+		if err == nil || outcome != "rolled-back" {
+			t.Fatalf("应回滚: %s %v", outcome, err)
+		}
+		if read(s, "bin/dockerd") != "old" || fileExists(filepath.Join(s.root, "bin", "containerd")) {
+			t.Error("应恢复升级前的 bin")
+		}
+		if read(s, "start.sh") != "old" || read(s, "data/image.db") != "data" {
+			t.Error("start.sh 和 data 应保持不变")
+		}
+		if !restarted {
+			t.Error("回滚后应重启服务")
+		}
+	})
+
+	t.Run("dockerd 未就绪", func(t *testing.T) {
+		s := newTestStager(t)
+		s.healthy = func() error { return errors.New("dockerd 在 2m0s 内未就绪") }
+		outcome, err := s.Run("stable", io.Discard)
+		if err == nil || outcome != "rolled-back" {
+			t.Fatalf("应回滚: %s %v", outcome, err)
+		}
+		if read(s, "bin/dockerd") != "old" {
+			t.Error("应恢复升级前的 bin")
+		}
+	})
+}